@@ -0,0 +1,1146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/porcool/ingestion/internal/balance"
+	"github.com/porcool/ingestion/internal/blobstore"
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/currency"
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/fieldcrypt"
+	"github.com/porcool/ingestion/internal/ingestion"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// command is a one-off CLI command that runs instead of the RabbitMQ consumer
+type command struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+const (
+	loadExchangeRatesUsage = "load-exchange-rates [-base CODE] [-source NAME] <rates.csv|rates.json>"
+	seedDomainsUsage       = "seed-domains <domains.json>"
+	migrateImagesUsage     = "migrate-workflow-images [-batch N] [-dry-run]"
+	userAsOfUsage          = "user-as-of <user-source-id> <YYYY/MM>"
+	rebuildSummariesUsage  = "rebuild-month-summaries"
+	balancesUsage          = "balances verify [-user ID] [-month YYYY/MM] [-basis amount|paid] [-tolerance N] [-batch N] | report [-user ID] [-month YYYY/MM] [-limit N]"
+	reencryptUsage         = "reencrypt [-batch N] [-dry-run]"
+	eraseUserUsage         = "erase-user [-requested-by NAME] <user-source-id>"
+	erasureReceiptUsage    = "erasure-receipt <receipt-guid>"
+	resyncUserUsage        = "resync-user [-dry-run] <user-source-id>"
+	schemaDriftUsage       = "schema-drift [-collection NAME]"
+	migrateUsage           = "migrate status | up | down [-steps N] [-drop-all] | to [-drop-all] <version> | baseline [<version>]"
+	quarantineUsage        = "quarantine list [-collection NAME] [-status STATUS] [-limit N] | fix <collection> <id> <field=value>... | release <collection> <id>..."
+)
+
+// commands lists every CLI command by name
+var commands = map[string]command{
+	"load-exchange-rates": {
+		usage:       loadExchangeRatesUsage,
+		description: "Load exchange rates from a local CSV or JSON file into the exchange_rate table",
+		run:         runLoadExchangeRates,
+	},
+	"seed-domains": {
+		usage:       seedDomainsUsage,
+		description: "Seed extra domain values, such as new payment providers, from a JSON file",
+		run:         runSeedDomains,
+	},
+	"migrate-workflow-images": {
+		usage:       migrateImagesUsage,
+		description: "Move inline base64 workflow images from MariaDB into the blob store",
+		run:         runMigrateWorkflowImages,
+	},
+	"user-as-of": {
+		usage:       userAsOfUsage,
+		description: "Print the tracked fields of a user, such as the monthly income, as they were at the end of a month",
+		run:         runUserAsOf,
+	},
+	"rebuild-month-summaries": {
+		usage:       rebuildSummariesUsage,
+		description: "Rebuild user_month_summary from scratch for every user and month",
+		run:         runRebuildMonthSummaries,
+	},
+	"balances": {
+		usage:       balancesUsage,
+		description: "Recompute monthly balances from income, additional balances and expenses, and report the balance_history rows that do not match",
+		run:         runBalances,
+	},
+	"reencrypt": {
+		usage:       reencryptUsage,
+		description: "Rewrite every PII column with the active encryption key, after a key rotation or a change of FIELD_ENCRYPTION_COLUMNS",
+		run:         runReencrypt,
+	},
+	"erase-user": {
+		usage:       eraseUserUsage,
+		description: "Erase a user for a data-subject request: delete its MariaDB rows, MongoDB documents and receipt images, tombstone it and store a signed receipt",
+		run:         runEraseUser,
+	},
+	"erasure-receipt": {
+		usage:       erasureReceiptUsage,
+		description: "Print an erasure receipt and check its signature",
+		run:         runErasureReceipt,
+	},
+	"resync-user": {
+		usage:       resyncUserUsage,
+		description: "Sync every MongoDB document of a user again, in ingestion order, and report which rows changed",
+		run:         runResyncUser,
+	},
+	"quarantine": {
+		usage:       quarantineUsage,
+		description: "List quarantined MongoDB documents, fix their fields, or release them for another ingestion attempt",
+		run:         runQuarantine,
+	},
+	"schema-drift": {
+		usage:       schemaDriftUsage,
+		description: "List the fields seen in synced MongoDB documents that their document type does not know",
+		run:         runSchemaDrift,
+	},
+	"migrate": {
+		usage:       migrateUsage,
+		description: "List, apply or revert MariaDB schema migrations, or record an existing schema as migrated",
+		run:         runMigrate,
+	},
+}
+
+// runCommand runs the named command and returns the process exit code
+func runCommand(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return 0
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printUsage()
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	if err := cmd.run(context.Background(), cfg, args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+
+	return 0
+}
+
+// printUsage prints the available commands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: ingestion [command] [arguments]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Without a command the RabbitMQ consumer is started.")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n      %s\n", commands[name].usage, commands[name].description)
+	}
+}
+
+// openMariaDB connects to MariaDB and makes sure the schema is up to date: migrated, or
+// checked when MARIADB_MIGRATE_ON_START is disabled
+func openMariaDB(cfg *config.Config) (*mariadb.Connection, error) {
+	conn, err := mariadb.NewConnection(cfg.MariaDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MariaDB: %w", err)
+	}
+
+	if cfg.MariaDB.MigrateOnStart {
+		err = conn.RunMigrations()
+	} else {
+		err = conn.CheckMigrations(context.Background())
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	cipher, err := fieldcrypt.New(cfg.Encryption)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to initialize field encryption: %w", err)
+	}
+	conn.SetCipher(cipher)
+
+	return conn, nil
+}
+
+// runLoadExchangeRates loads exchange rates from a local file
+func runLoadExchangeRates(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("load-exchange-rates", flag.ContinueOnError)
+	base := fs.String("base", cfg.Currency.BaseCurrency, "base currency for rates that do not set one")
+	source := fs.String("source", "", "source recorded on each rate (defaults to the file name)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s", loadExchangeRatesUsage)
+	}
+
+	path := fs.Arg(0)
+	rates, err := currency.LoadRatesFile(path, *base)
+	if err != nil {
+		return err
+	}
+
+	if *source == "" {
+		*source = filepath.Base(path)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	repo := mariadb.NewExchangeRateRepository(mariaDB)
+	for i := range rates {
+		if !rates[i].Source.Valid {
+			rates[i].Source.String = *source
+			rates[i].Source.Valid = true
+		}
+		if err := repo.UpsertExchangeRate(&rates[i]); err != nil {
+			return fmt.Errorf("failed to store %s/%s rate for %s: %w",
+				rates[i].CurrencyCode, rates[i].BaseCurrencyCode, rates[i].RateDate.Format("2006-01-02"), err)
+		}
+	}
+
+	fmt.Printf("Loaded %d exchange rates from %s\n", len(rates), path)
+	return nil
+}
+
+// runSeedDomains seeds the built-in domain values plus the ones in a local JSON file
+func runSeedDomains(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", seedDomainsUsage)
+	}
+
+	seeds, err := models.LoadDomainSeedsFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	if err := mariaDB.SeedDomains(seeds...); err != nil {
+		return fmt.Errorf("failed to seed domains: %w", err)
+	}
+
+	count := 0
+	for _, seed := range seeds {
+		count += len(seed.Names)
+	}
+	fmt.Printf("Seeded %d domain values from %s\n", count, args[0])
+	return nil
+}
+
+// runMigrateWorkflowImages moves images still stored in expense_automatic_workflow.base64_image
+// into the blob store, keeping only the hash, MIME type and size in MariaDB
+func runMigrateWorkflowImages(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate-workflow-images", flag.ContinueOnError)
+	batch := fs.Int("batch", 50, "number of rows loaded per query")
+	dryRun := fs.Bool("dry-run", false, "decode and report images without storing them or changing MariaDB")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *batch <= 0 {
+		return fmt.Errorf("usage: %s", migrateImagesUsage)
+	}
+
+	store, err := blobstore.New(cfg.BlobStore)
+	if err != nil {
+		return fmt.Errorf("failed to initialize blob store: %w", err)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	repo := mariadb.NewExpenseAutomaticWorkflowRepository(mariaDB)
+	var afterID, migrated, failed, bytes int64
+	for {
+		workflows, err := repo.GetWorkflowsWithInlineImages(afterID, *batch)
+		if err != nil {
+			return err
+		}
+		if len(workflows) == 0 {
+			break
+		}
+
+		for _, eaw := range workflows {
+			afterID = eaw.ID
+
+			blob, err := migrateWorkflowImage(ctx, store, repo, eaw, *dryRun)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "workflow %d (%s): %v\n", eaw.ID, eaw.SourceID, err)
+				failed++
+				continue
+			}
+
+			migrated++
+			bytes += blob.Size
+		}
+	}
+
+	verb := "Migrated"
+	if *dryRun {
+		verb = "Would migrate"
+	}
+	fmt.Printf("%s %d workflow images (%d bytes), %d failed\n", verb, migrated, bytes, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d workflow images could not be migrated", failed)
+	}
+	return nil
+}
+
+// migrateWorkflowImage stores one inline image in the blob store and points the workflow at it.
+// With dryRun the image is only decoded.
+func migrateWorkflowImage(ctx context.Context, store blobstore.Store, repo *mariadb.ExpenseAutomaticWorkflowRepository, eaw models.ExpenseAutomaticWorkflow, dryRun bool) (blobstore.Blob, error) {
+	if dryRun {
+		data, mimeType, err := blobstore.DecodeBase64(eaw.Base64Image.String)
+		if err != nil {
+			return blobstore.Blob{}, err
+		}
+		return blobstore.Blob{Key: blobstore.Key(data), MimeType: mimeType, Size: int64(len(data))}, nil
+	}
+
+	blob, err := blobstore.PutBase64(ctx, store, eaw.Base64Image.String)
+	if err != nil {
+		return blobstore.Blob{}, err
+	}
+	if err := repo.SetImage(eaw.ID, blob.Key, blob.MimeType, blob.Size); err != nil {
+		return blobstore.Blob{}, err
+	}
+	return blob, nil
+}
+
+// runUserAsOf prints the user_history version of a user in effect at the end of a month
+func runUserAsOf(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s", userAsOfUsage)
+	}
+	sourceID, month := args[0], args[1]
+
+	loc, err := time.LoadLocation(cfg.Dates.BusinessTimezone)
+	if err != nil {
+		return fmt.Errorf("invalid business timezone %q: %w", cfg.Dates.BusinessTimezone, err)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	repo := mariadb.NewUserRepository(mariaDB.ForReporting())
+	userID, err := resolveUserID(repo, sourceID)
+	if err != nil {
+		return err
+	}
+
+	state, err := repo.GetUserStateAsOfMonth(userID, month, loc)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Printf("User %s did not exist yet in %s\n", sourceID, month)
+		return nil
+	}
+
+	validTo := "current"
+	if state.ValidTo.Valid {
+		validTo = state.ValidTo.Time.In(loc).Format(time.RFC3339)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "user\t%s\n", sourceID)
+	fmt.Fprintf(w, "as of\t%s\n", month)
+	fmt.Fprintf(w, "monthly_income\t%.2f\n", state.MonthlyIncome)
+	fmt.Fprintf(w, "current_spending_date\t%s\n", state.CurrentSpendingDate.String)
+	fmt.Fprintf(w, "fl_admin\t%t\n", state.FlAdmin)
+	fmt.Fprintf(w, "fl_payment_requested\t%t\n", state.FlPaymentRequested)
+	fmt.Fprintf(w, "fl_payment_pending\t%t\n", state.FlPaymentPending)
+	fmt.Fprintf(w, "fl_payment_paid\t%t\n", state.FlPaymentPaid)
+	fmt.Fprintf(w, "valid\t%s to %s\n", state.ValidFrom.In(loc).Format(time.RFC3339), validTo)
+	return w.Flush()
+}
+
+// runRebuildMonthSummaries refreshes the summary of every user month that has data and then
+// removes the summaries of months that no longer have any. Existing rows are updated in place,
+// so dashboards keep reading summaries while the rebuild runs.
+func runRebuildMonthSummaries(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", rebuildSummariesUsage)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	repo := mariadb.NewUserMonthSummaryRepository(mariaDB)
+	started := time.Now()
+
+	months, err := repo.GetUserMonths(0)
+	if err != nil {
+		return err
+	}
+	for _, um := range months {
+		if err := repo.RefreshSummary(um.UserID, um.SpendingDateYYYYMM); err != nil {
+			return fmt.Errorf("user %d, %s: %w", um.UserID, um.SpendingDateYYYYMM, err)
+		}
+	}
+
+	deleted, err := repo.DeleteStaleSummaries(started)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rebuilt %d user month summaries, removed %d stale ones\n", len(months), deleted)
+	return nil
+}
+
+// runReencrypt rewrites the PII columns of every table, batch by batch, so they match the
+// current encryption configuration. Rows are read with any key in the key file, so the old
+// key must stay in the file until the command has finished.
+func runReencrypt(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	batch := fs.Int("batch", 500, "number of rows loaded per query")
+	dryRun := fs.Bool("dry-run", false, "count the rows that would change without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *batch <= 0 {
+		return fmt.Errorf("usage: %s", reencryptUsage)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	repo := mariadb.NewEncryptionRepository(mariaDB)
+	if keyID := repo.ActiveKeyID(); keyID != "" {
+		fmt.Printf("Active key: %s\n", keyID)
+	} else {
+		fmt.Println("Field encryption is disabled, encrypted values are decrypted back to plaintext")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tSCANNED\tCHANGED")
+	for _, table := range repo.EncryptedTables() {
+		var afterID int64
+		var scanned, changed int
+		for {
+			result, err := repo.ReencryptBatch(table, afterID, *batch, *dryRun)
+			if err != nil {
+				w.Flush()
+				return err
+			}
+			scanned += result.Scanned
+			changed += result.Changed
+			if result.Scanned < *batch {
+				break
+			}
+			afterID = result.LastID
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", table, scanned, changed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run: no rows were changed")
+	}
+	return nil
+}
+
+// runEraseUser erases a user by its Firestore user ID and prints the signed receipt
+func runEraseUser(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("erase-user", flag.ContinueOnError)
+	requestedBy := fs.String("requested-by", "cli", "who requested the erasure, recorded on the receipt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s", eraseUserUsage)
+	}
+
+	mongoDB, err := mongodb.NewConnection(cfg.MongoDB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer mongoDB.Close()
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	svc, err := ingestion.NewService(mariaDB, mongoDB, cfg)
+	if err != nil {
+		return err
+	}
+	receipt, err := svc.EraseUser(ctx, fs.Arg(0), *requestedBy)
+	if err != nil {
+		return err
+	}
+
+	if err := printErasureReceipt(receipt, true); err != nil {
+		return err
+	}
+	if receipt.Status == models.ErasureStatusPartial {
+		return fmt.Errorf("erasure of user %s is partial: %s", receipt.UserSourceID, receipt.StatusReason)
+	}
+	return nil
+}
+
+// runErasureReceipt prints a stored erasure receipt and fails when its signature does not match
+func runErasureReceipt(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", erasureReceiptUsage)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	receipt, err := mariadb.NewUserErasureRepository(mariaDB).GetReceipt(args[0])
+	if err != nil {
+		return err
+	}
+	if receipt == nil {
+		return fmt.Errorf("erasure receipt %s not found", args[0])
+	}
+
+	valid, err := ingestion.VerifyErasure(cfg.Erasure.ReceiptSigningKey, receipt)
+	if err != nil {
+		return err
+	}
+	if err := printErasureReceipt(receipt, valid); err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("erasure receipt %s does not match its signature", receipt.GUID)
+	}
+	return nil
+}
+
+// printErasureReceipt prints an erasure receipt with its status and erased rows, documents and blobs
+func printErasureReceipt(receipt *models.UserErasure, valid bool) error {
+	signature := "valid"
+	if !valid {
+		signature = "INVALID"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "receipt\t%s\n", receipt.GUID)
+	fmt.Fprintf(w, "user\t%s\n", receipt.UserSourceID)
+	fmt.Fprintf(w, "requested_by\t%s\n", receipt.RequestedBy)
+	fmt.Fprintf(w, "requested_at\t%s\n", receipt.RequestedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "completed_at\t%s\n", receipt.CompletedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "status\t%s\n", receipt.Status)
+	if receipt.StatusReason != "" {
+		fmt.Fprintf(w, "status_reason\t%s\n", receipt.StatusReason)
+	}
+	for _, counts := range []struct {
+		prefix string
+		counts map[string]int64
+	}{{"mariadb", receipt.MariaDBRows}, {"mongodb", receipt.MongoDBDocuments}} {
+		names := make([]string, 0, len(counts.counts))
+		for name := range counts.counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s.%s\t%d\n", counts.prefix, name, counts.counts[name])
+		}
+	}
+	fmt.Fprintf(w, "blobs_deleted\t%d\n", receipt.BlobsDeleted)
+	fmt.Fprintf(w, "signature\t%s (%s)\n", receipt.Signature, signature)
+	return w.Flush()
+}
+
+// runResyncUser syncs every document of a user again and prints what changed per collection
+func runResyncUser(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("resync-user", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report the user's documents and whether they already have a row")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s", resyncUserUsage)
+	}
+
+	mongoDB, err := mongodb.NewConnection(cfg.MongoDB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer mongoDB.Close()
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	svc, err := ingestion.NewService(mariaDB, mongoDB, cfg)
+	if err != nil {
+		return err
+	}
+	report, syncErr := svc.ResyncUser(ctx, fs.Arg(0), *dryRun)
+	if report == nil {
+		return syncErr
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if report.DryRun {
+		fmt.Fprintln(w, "COLLECTION\tDOCUMENTS\tEXISTING\tNEW\tORPHANED")
+		for _, c := range report.Collections {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", c.Collection, c.Documents, c.Existing, c.Documents-c.Existing, len(c.Orphans))
+		}
+	} else {
+		fmt.Fprintln(w, "COLLECTION\tDOCUMENTS\tCREATED\tUPDATED\tUNCHANGED\tMISSING\tORPHANED\tERROR")
+		for _, c := range report.Collections {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+				c.Collection, c.Documents, c.Created, c.Updated, c.Unchanged, c.Missing, len(c.Orphans), c.Error)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range report.Collections {
+		for _, id := range c.Orphans {
+			fmt.Printf("Orphaned %s row %s: its document is gone from MongoDB\n", c.Table, id)
+		}
+	}
+	switch {
+	case report.DryRun:
+		fmt.Println("Dry run: no documents were synced")
+	case syncErr == nil && !report.Changed():
+		fmt.Println("No changes: MariaDB already matched MongoDB")
+	}
+	return syncErr
+}
+
+// runBalances dispatches the balances subcommands. Their reads go to the MariaDB replica,
+// when one is configured.
+func runBalances(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", balancesUsage)
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	switch args[0] {
+	case "verify":
+		// Verify records its findings on the primary, so it reads there too: a lagging
+		// replica would record discrepancies that are already fixed
+		return runBalancesVerify(cfg, mariaDB, args[1:])
+	case "report":
+		return runBalancesReport(mariaDB.ForReporting(), args[1:])
+	default:
+		return fmt.Errorf("unknown balances subcommand %q, usage: %s", args[0], balancesUsage)
+	}
+}
+
+// runBalancesVerify verifies balance_history rows in batches and records the discrepancies
+func runBalancesVerify(cfg *config.Config, mariaDB *mariadb.Connection, args []string) error {
+	fs := flag.NewFlagSet("balances verify", flag.ContinueOnError)
+	userSourceID := fs.String("user", "", "only verify this user (MongoDB document ID)")
+	month := fs.String("month", "", "only verify this YYYY/MM month")
+	basis := fs.String("basis", balance.DefaultBasis, "expense total subtracted from the balance: paid, or amount (as the frontend does)")
+	tolerance := fs.Float64("tolerance", balance.DefaultTolerance, "largest difference that is not a discrepancy")
+	batch := fs.Int("batch", 500, "number of balance history records verified per batch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("invalid batch size %d: must be positive", *batch)
+	}
+
+	loc, err := time.LoadLocation(cfg.Dates.BusinessTimezone)
+	if err != nil {
+		return fmt.Errorf("invalid business timezone %q: %w", cfg.Dates.BusinessTimezone, err)
+	}
+
+	userRepo := mariadb.NewUserRepository(mariaDB)
+	filter := models.BalanceFilter{SpendingDateYYYYMM: *month, Limit: *batch}
+	if filter.UserID, err = resolveUserID(userRepo, *userSourceID); err != nil {
+		return err
+	}
+
+	verifier, err := balance.NewVerifier(mariadb.NewBalanceDiscrepancyRepository(mariaDB), userRepo, loc, *basis, *tolerance)
+	if err != nil {
+		return err
+	}
+
+	var total balance.Summary
+	for {
+		summary, err := verifier.Verify(filter)
+		if err != nil {
+			return err
+		}
+		if summary.Verified+summary.Unconverted == 0 {
+			break
+		}
+		total.Verified += summary.Verified
+		total.Discrepancies += summary.Discrepancies
+		total.Unconverted += summary.Unconverted
+		filter.AfterID = summary.LastBalanceHistoryID
+	}
+
+	fmt.Printf("Verified %d balance history records on the %s basis, %d discrepancies\n", total.Verified, *basis, total.Discrepancies)
+	if total.Unconverted > 0 {
+		fmt.Printf("Skipped %d balance history records whose month has amounts without an exchange rate\n", total.Unconverted)
+	}
+	return nil
+}
+
+// runBalancesReport prints the recorded discrepancies, largest difference first
+func runBalancesReport(mariaDB *mariadb.Connection, args []string) error {
+	fs := flag.NewFlagSet("balances report", flag.ContinueOnError)
+	userSourceID := fs.String("user", "", "only report this user (MongoDB document ID)")
+	month := fs.String("month", "", "only report this YYYY/MM month")
+	limit := fs.Int("limit", 50, "maximum number of discrepancies to list (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	userID, err := resolveUserID(mariadb.NewUserRepository(mariaDB), *userSourceID)
+	if err != nil {
+		return err
+	}
+
+	discrepancies, err := mariadb.NewBalanceDiscrepancyRepository(mariaDB).GetDiscrepancies(userID, *month, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "USER\tMONTH\tBASIS\tRECORDED\tEXPECTED\tDIFFERENCE\tLAST MONTH\tINCOME\tADDITIONAL\tEXPENSES\tREASONS\t")
+	for _, d := range discrepancies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%.2f\t%.2f\t%.2f/%.2f\t%.2f/%.2f\t%.2f\t%.2f\t%s\t\n",
+			d.UserSourceID, d.SpendingDateYYYYMM, d.Basis, d.RecordedAmount, d.ExpectedAmount, d.DifferenceAmount,
+			d.RecordedLastMonthAmount, d.ExpectedLastMonthAmount, d.RecordedMonthlyIncome, d.ExpectedMonthlyIncome,
+			d.AdditionalAmount, d.ExpenseAmount, d.Reasons)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d discrepancies (LAST MONTH and INCOME are recorded/expected)\n", len(discrepancies))
+	return nil
+}
+
+// resolveUserID returns the MariaDB id of a user given its MongoDB document ID,
+// or 0 when no user was given
+func resolveUserID(repo *mariadb.UserRepository, sourceID string) (int64, error) {
+	if sourceID == "" {
+		return 0, nil
+	}
+	user, err := repo.GetUserBySourceID(sourceID)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, fmt.Errorf("user %s not found", sourceID)
+	}
+	return user.ID, nil
+}
+
+// runQuarantine dispatches the quarantine subcommands
+func runQuarantine(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", quarantineUsage)
+	}
+
+	mongoDB, err := mongodb.NewConnection(cfg.MongoDB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer mongoDB.Close()
+
+	switch args[0] {
+	case "list":
+		return runQuarantineList(ctx, mongoDB, args[1:])
+	case "fix":
+		return runQuarantineFix(ctx, mongoDB, args[1:])
+	case "release":
+		return runQuarantineRelease(ctx, cfg, mongoDB, args[1:])
+	default:
+		return fmt.Errorf("unknown quarantine subcommand %q, usage: %s", args[0], quarantineUsage)
+	}
+}
+
+// runQuarantineList prints quarantine entries
+func runQuarantineList(ctx context.Context, mongoDB *mongodb.Connection, args []string) error {
+	fs := flag.NewFlagSet("quarantine list", flag.ContinueOnError)
+	collection := fs.String("collection", "", "only list documents from this collection")
+	status := fs.String("status", mongodb.QuarantineStatusQuarantined, "only list entries with this status (empty for all)")
+	limit := fs.Int64("limit", 50, "maximum number of entries to list (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := mongoDB.GetQuarantinedDocuments(ctx, *collection, *status, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tDOCUMENT ID\tSTATUS\tSEEN\tUPDATED\tVIOLATIONS")
+	for _, entry := range entries {
+		violations := make([]string, len(entry.Violations))
+		for i, v := range entry.Violations {
+			violations[i] = fmt.Sprintf("%s: %s", v.Field, v.Message)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			entry.Collection, entry.DocumentID, entry.Status, entry.Occurrences,
+			entry.UpdatedAt.Format(time.RFC3339), strings.Join(violations, "; "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d entries\n", len(entries))
+	return nil
+}
+
+// runQuarantineFix sets fields on a quarantined source document.
+// Values are parsed as JSON when possible, so numbers, booleans and null keep their type.
+func runQuarantineFix(ctx context.Context, mongoDB *mongodb.Connection, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: quarantine fix <collection> <id> <field=value>...")
+	}
+
+	collection, docID := args[0], args[1]
+	fields, err := parseFieldAssignments(args[2:])
+	if err != nil {
+		return err
+	}
+
+	note := fmt.Sprintf("%s fixed %s", time.Now().Format(time.RFC3339), strings.Join(args[2:], " "))
+	if err := mongoDB.FixQuarantinedDocument(ctx, collection, docID, fields, note); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %s document %s; run 'quarantine release %s %s' to ingest it again\n", collection, docID, collection, docID)
+	return nil
+}
+
+// runQuarantineRelease releases quarantined documents and ingests them again.
+// Documents that still fail validation go straight back into quarantine.
+func runQuarantineRelease(ctx context.Context, cfg *config.Config, mongoDB *mongodb.Connection, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: quarantine release <collection> <id>...")
+	}
+
+	collection, docIDs := args[0], args[1:]
+	for _, docID := range docIDs {
+		note := fmt.Sprintf("%s released", time.Now().Format(time.RFC3339))
+		if err := mongoDB.ReleaseQuarantinedDocument(ctx, collection, docID, note); err != nil {
+			return err
+		}
+	}
+
+	mariaDB, err := openMariaDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer mariaDB.Close()
+
+	svc, err := ingestion.NewService(mariaDB, mongoDB, cfg)
+	if err != nil {
+		return err
+	}
+	// Quarantine entries keep the string form of the ID, so ObjectID documents are looked up
+	// by the ObjectID it encodes
+	ids := make([]mongodb.DocID, len(docIDs))
+	for i, docID := range docIDs {
+		if ids[i], err = mongoDB.FindDocID(ctx, collection, docID); err != nil {
+			return err
+		}
+	}
+	if err := svc.SyncCollection(ctx, collection, ids); err != nil {
+		return err
+	}
+
+	for _, docID := range docIDs {
+		entry, err := mongoDB.GetQuarantinedDocument(ctx, collection, docID)
+		if err != nil {
+			return err
+		}
+		if entry != nil && entry.Status == mongodb.QuarantineStatusQuarantined {
+			fmt.Printf("%s %s: still invalid, quarantined again\n", collection, docID)
+		} else {
+			fmt.Printf("%s %s: released\n", collection, docID)
+		}
+	}
+
+	return nil
+}
+
+// runSchemaDrift prints the schema drift report
+func runSchemaDrift(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("schema-drift", flag.ContinueOnError)
+	collection := fs.String("collection", "", "only list fields of this collection")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	mongoDB, err := mongodb.NewConnection(cfg.MongoDB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer mongoDB.Close()
+
+	entries, err := mongoDB.GetSchemaDrift(ctx, *collection)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tFIELD\tTYPE\tOCCURRENCES\tSAMPLE ID\tFIRST SEEN\tLAST SEEN")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			entry.Collection, entry.Field, entry.BSONType, entry.Occurrences, entry.SampleDocID,
+			entry.FirstSeenAt.Format(time.RFC3339), entry.LastSeenAt.Format(time.RFC3339))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d fields\n", len(entries))
+	return nil
+}
+
+// parseFieldAssignments parses field=value arguments into a BSON update
+func parseFieldAssignments(args []string) (bson.M, error) {
+	fields := bson.M{}
+	for _, arg := range args {
+		field, raw, found := strings.Cut(arg, "=")
+		if !found || field == "" {
+			return nil, fmt.Errorf("invalid assignment %q, want field=value", arg)
+		}
+		if field == "_id" || strings.HasPrefix(field, "$") {
+			return nil, fmt.Errorf("field %q cannot be changed", field)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// runMigrate manages the MariaDB schema migrations. It never migrates implicitly, whatever
+// MARIADB_MIGRATE_ON_START says.
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", migrateUsage)
+	}
+
+	conn, err := mariadb.NewConnection(cfg.MariaDB)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MariaDB: %w", err)
+	}
+	defer conn.Close()
+
+	switch args[0] {
+	case "status":
+		return runMigrateStatus(ctx, conn)
+	case "up":
+		steps, err := conn.MigrateUp(ctx)
+		printMigrationSteps(steps)
+		return err
+	case "down":
+		return runMigrateDown(ctx, conn, args[1:])
+	case "to":
+		return runMigrateTo(ctx, conn, args[1:])
+	case "baseline":
+		return runMigrateBaseline(ctx, conn, args[1:])
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q, usage: %s", args[0], migrateUsage)
+	}
+}
+
+// runMigrateStatus prints every migration and whether it is applied
+func runMigrateStatus(ctx context.Context, conn *mariadb.Connection) error {
+	states, err := conn.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	var pending int
+	for _, state := range states {
+		status, appliedAt := "applied", state.AppliedAt.Format(time.RFC3339)
+		switch {
+		case state.NoFile:
+			status = "applied, no file"
+		case state.Modified:
+			status = "applied, modified"
+		case !state.Applied:
+			status, appliedAt = "pending", ""
+			pending++
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", state.Version, state.Name, status, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d migrations, %d pending\n", len(states), pending)
+	return nil
+}
+
+// runMigrateDown reverts the most recently applied migrations
+func runMigrateDown(ctx context.Context, conn *mariadb.Connection, args []string) error {
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "number of migrations to revert")
+	dropAll := fs.Bool("drop-all", false, "allow reverting the baseline, which drops every table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *steps <= 0 {
+		return fmt.Errorf("invalid -steps %d, want at least 1", *steps)
+	}
+
+	states, err := conn.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	var applied int
+	for _, state := range states {
+		if state.Applied {
+			applied++
+		}
+	}
+	if *steps >= applied && !*dropAll {
+		return fmt.Errorf("reverting %d of %d applied migrations reverts the baseline and drops every table; pass -drop-all to do it", *steps, applied)
+	}
+
+	reverted, err := conn.MigrateDown(ctx, *steps)
+	printMigrationSteps(reverted)
+	return err
+}
+
+// runMigrateTo applies or reverts migrations up to a version
+func runMigrateTo(ctx context.Context, conn *mariadb.Connection, args []string) error {
+	fs := flag.NewFlagSet("migrate to", flag.ContinueOnError)
+	dropAll := fs.Bool("drop-all", false, "allow version 0, which reverts the baseline and drops every table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: migrate to [-drop-all] <version>")
+	}
+
+	version, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil || version < 0 {
+		return fmt.Errorf("invalid version %q", fs.Arg(0))
+	}
+	if version == 0 && !*dropAll {
+		return fmt.Errorf("version 0 reverts the baseline and drops every table; pass -drop-all to do it")
+	}
+
+	steps, err := conn.MigrateTo(ctx, version)
+	printMigrationSteps(steps)
+	return err
+}
+
+// runMigrateBaseline records the migrations up to a version, the latest by default, as
+// applied without running them
+func runMigrateBaseline(ctx context.Context, conn *mariadb.Connection, args []string) error {
+	migrations, err := mariadb.Migrations()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return fmt.Errorf("no migrations")
+	}
+
+	version := migrations[len(migrations)-1].Version
+	switch len(args) {
+	case 0:
+	case 1:
+		version, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version <= 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+	default:
+		return fmt.Errorf("usage: migrate baseline [<version>]")
+	}
+
+	recorded, err := conn.Baseline(ctx, version)
+	for _, m := range recorded {
+		fmt.Printf("Recorded %d_%s as applied\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d migrations recorded\n", len(recorded))
+	return nil
+}
+
+// printMigrationSteps prints the migrations applied or reverted
+func printMigrationSteps(steps []mariadb.MigrationStep) {
+	for _, step := range steps {
+		action := "Applied"
+		if step.Revert {
+			action = "Reverted"
+		}
+		fmt.Printf("%s %d_%s\n", action, step.Version, step.Name)
+	}
+	fmt.Printf("%d migrations run\n", len(steps))
+}
@@ -0,0 +1,184 @@
+package balance
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// Bases of the expense total subtracted from a month's balance
+const (
+	// BasisAmount subtracts the full amount of every expense of the month, which is what
+	// the frontend does when it records balance_history
+	BasisAmount = "amount"
+	// BasisPaid subtracts only what was actually paid
+	BasisPaid = "paid"
+	// DefaultBasis is the basis balances are verified on unless another one is asked for
+	DefaultBasis = BasisPaid
+)
+
+// DefaultTolerance is how far a recorded value may be from the recomputed one, absorbing
+// the frontend's float rounding
+const DefaultTolerance = 0.01
+
+// Reasons recorded in balance_discrepancy.reasons
+const (
+	ReasonBalance   = "balance"
+	ReasonLastMonth = "last_month"
+	ReasonIncome    = "income"
+)
+
+// Store reads balance components and stores discrepancies
+type Store interface {
+	GetBalanceComponents(filter models.BalanceFilter) ([]models.BalanceComponents, error)
+	UpsertDiscrepancy(d *models.BalanceDiscrepancy) error
+	DeleteDiscrepancy(balanceHistoryID int64) error
+}
+
+// IncomeLookup finds the state of a user as of a month
+type IncomeLookup interface {
+	GetUserStateAsOfMonth(userID int64, month string, loc *time.Location) (*models.UserHistory, error)
+}
+
+// Verifier recomputes monthly balances and records the ones that do not match balance_history
+type Verifier struct {
+	store     Store
+	incomes   IncomeLookup
+	loc       *time.Location
+	basis     string
+	tolerance float64
+}
+
+// Summary counts the outcome of a verification run. Unconverted rows have an amount in their
+// month without a base-currency value and are not verified. LastBalanceHistoryID is the id
+// of the last row read, to continue from in the next batch.
+type Summary struct {
+	Verified             int
+	Discrepancies        int
+	Unconverted          int
+	LastBalanceHistoryID int64
+}
+
+// NewVerifier creates a new Verifier. Months are resolved in loc, the business timezone.
+func NewVerifier(store Store, incomes IncomeLookup, loc *time.Location, basis string, tolerance float64) (*Verifier, error) {
+	if basis != BasisAmount && basis != BasisPaid {
+		return nil, fmt.Errorf("invalid basis %q: want %s or %s", basis, BasisAmount, BasisPaid)
+	}
+	if tolerance < 0 {
+		return nil, fmt.Errorf("invalid tolerance %v: must not be negative", tolerance)
+	}
+	return &Verifier{store: store, incomes: incomes, loc: loc, basis: basis, tolerance: tolerance}, nil
+}
+
+// Verify verifies every balance_history row matching the filter. Rows that match have their
+// previous discrepancy removed, so the table only ever holds open discrepancies.
+func (v *Verifier) Verify(filter models.BalanceFilter) (Summary, error) {
+	var summary Summary
+
+	components, err := v.store.GetBalanceComponents(filter)
+	if err != nil {
+		return summary, err
+	}
+
+	now := time.Now()
+	for _, c := range components {
+		summary.LastBalanceHistoryID = c.BalanceHistoryID
+		if c.UnconvertedRows > 0 {
+			summary.Unconverted++
+			continue
+		}
+
+		income := c.UserMonthlyIncome
+		state, err := v.incomes.GetUserStateAsOfMonth(c.UserID, c.SpendingDateYYYYMM, v.loc)
+		if err != nil {
+			return summary, err
+		}
+		if state != nil {
+			income = state.MonthlyIncome
+		}
+
+		summary.Verified++
+		d := Check(c, income, v.basis, v.tolerance)
+		if d == nil {
+			if err := v.store.DeleteDiscrepancy(c.BalanceHistoryID); err != nil {
+				return summary, err
+			}
+			continue
+		}
+
+		d.VerifiedAt = now
+		if err := v.store.UpsertDiscrepancy(d); err != nil {
+			return summary, err
+		}
+		summary.Discrepancies++
+	}
+
+	return summary, nil
+}
+
+// Check recomputes the balance of a month and returns the discrepancy, or nil when the
+// recorded balance, last month balance and income all match. The expected balance is
+//
+//	income + previous month balance + additional balances - expenses
+//
+// where income is the user's monthly income as of the month and the previous month
+// balance is 0 when there is no balance_history row for it, as in the frontend. Every
+// amount is in the base currency.
+func Check(c models.BalanceComponents, income float64, basis string, tolerance float64) *models.BalanceDiscrepancy {
+	lastMonth := 0.0
+	if c.PreviousAmount.Valid {
+		lastMonth = c.PreviousAmount.Float64
+	}
+
+	expenses := c.ExpenseAmount
+	if basis == BasisPaid {
+		expenses = c.ExpensePaidAmount
+	}
+
+	expected := round(income + lastMonth + c.AdditionalAmount - expenses)
+
+	var reasons []string
+	if differs(c.RecordedAmount, expected, tolerance) {
+		reasons = append(reasons, ReasonBalance)
+	}
+	if differs(c.RecordedLastMonthAmount, lastMonth, tolerance) {
+		reasons = append(reasons, ReasonLastMonth)
+	}
+	if differs(c.RecordedMonthlyIncome, income, tolerance) {
+		reasons = append(reasons, ReasonIncome)
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	return &models.BalanceDiscrepancy{
+		BalanceHistoryID:        c.BalanceHistoryID,
+		UserID:                  c.UserID,
+		UserSourceID:            c.UserSourceID,
+		SpendingDateYYYYMM:      c.SpendingDateYYYYMM,
+		Basis:                   basis,
+		Reasons:                 strings.Join(reasons, ","),
+		RecordedAmount:          c.RecordedAmount,
+		ExpectedAmount:          expected,
+		DifferenceAmount:        round(c.RecordedAmount - expected),
+		RecordedLastMonthAmount: c.RecordedLastMonthAmount,
+		ExpectedLastMonthAmount: lastMonth,
+		RecordedMonthlyIncome:   c.RecordedMonthlyIncome,
+		ExpectedMonthlyIncome:   income,
+		AdditionalAmount:        c.AdditionalAmount,
+		ExpenseAmount:           expenses,
+	}
+}
+
+// differs reports whether two amounts are further apart than the tolerance
+func differs(recorded, expected, tolerance float64) bool {
+	return math.Abs(round(recorded-expected)) > tolerance
+}
+
+// round rounds an amount to cents
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,192 @@
+package balance
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// fakeStore is a Store backed by slices
+type fakeStore struct {
+	components    []models.BalanceComponents
+	discrepancies map[int64]*models.BalanceDiscrepancy
+	deleted       []int64
+}
+
+func (f *fakeStore) GetBalanceComponents(filter models.BalanceFilter) ([]models.BalanceComponents, error) {
+	return f.components, nil
+}
+
+func (f *fakeStore) UpsertDiscrepancy(d *models.BalanceDiscrepancy) error {
+	if f.discrepancies == nil {
+		f.discrepancies = make(map[int64]*models.BalanceDiscrepancy)
+	}
+	f.discrepancies[d.BalanceHistoryID] = d
+	return nil
+}
+
+func (f *fakeStore) DeleteDiscrepancy(balanceHistoryID int64) error {
+	f.deleted = append(f.deleted, balanceHistoryID)
+	return nil
+}
+
+// fakeIncomes is an IncomeLookup keyed by month
+type fakeIncomes map[string]float64
+
+func (f fakeIncomes) GetUserStateAsOfMonth(userID int64, month string, loc *time.Location) (*models.UserHistory, error) {
+	income, ok := f[month]
+	if !ok {
+		return nil, nil
+	}
+	return &models.UserHistory{UserID: userID, MonthlyIncome: income}, nil
+}
+
+// march is a consistent month: 5000 + 200 + 300 - 1200 = 4300
+func march() models.BalanceComponents {
+	return models.BalanceComponents{
+		BalanceHistoryID:        1,
+		UserID:                  7,
+		SpendingDateYYYYMM:      "2024/03",
+		RecordedAmount:          4300,
+		RecordedLastMonthAmount: 200,
+		RecordedMonthlyIncome:   5000,
+		UserMonthlyIncome:       5000,
+		PreviousAmount:          sql.NullFloat64{Float64: 200, Valid: true},
+		AdditionalAmount:        300,
+		ExpenseAmount:           1200,
+		ExpensePaidAmount:       900,
+	}
+}
+
+func TestCheckConsistent(t *testing.T) {
+	if d := Check(march(), 5000, BasisAmount, DefaultTolerance); d != nil {
+		t.Errorf("Check() = %+v, want nil", d)
+	}
+
+	c := march()
+	c.RecordedAmount = 4300.01
+	if d := Check(c, 5000, BasisAmount, DefaultTolerance); d != nil {
+		t.Errorf("Check() = %+v, a cent of rounding must be tolerated", d)
+	}
+}
+
+func TestCheckBalance(t *testing.T) {
+	c := march()
+	c.RecordedAmount = 4500
+
+	d := Check(c, 5000, BasisAmount, DefaultTolerance)
+	if d == nil {
+		t.Fatal("Check() = nil, want a discrepancy")
+	}
+	if d.Reasons != ReasonBalance {
+		t.Errorf("Reasons = %q, want %q", d.Reasons, ReasonBalance)
+	}
+	if d.ExpectedAmount != 4300 || d.DifferenceAmount != 200 {
+		t.Errorf("ExpectedAmount = %v, DifferenceAmount = %v, want 4300 and 200", d.ExpectedAmount, d.DifferenceAmount)
+	}
+}
+
+func TestCheckPaidBasis(t *testing.T) {
+	d := Check(march(), 5000, BasisPaid, DefaultTolerance)
+	if d == nil {
+		t.Fatal("Check() = nil, want a discrepancy on the paid basis")
+	}
+	if d.ExpectedAmount != 4600 || d.ExpenseAmount != 900 || d.Basis != BasisPaid {
+		t.Errorf("Check() = %+v, want expected 4600 from 900 paid", d)
+	}
+}
+
+func TestCheckLastMonthAndIncome(t *testing.T) {
+	c := march()
+	c.PreviousAmount = sql.NullFloat64{}
+	c.RecordedAmount = 4100
+
+	d := Check(c, 5000, BasisAmount, DefaultTolerance)
+	if d == nil || d.Reasons != ReasonLastMonth {
+		t.Fatalf("Check() = %+v, want only a last_month discrepancy", d)
+	}
+	if d.ExpectedLastMonthAmount != 0 {
+		t.Errorf("ExpectedLastMonthAmount = %v, want 0 without a previous month", d.ExpectedLastMonthAmount)
+	}
+
+	d = Check(march(), 4000, BasisAmount, DefaultTolerance)
+	if d == nil || d.Reasons != ReasonBalance+","+ReasonIncome {
+		t.Fatalf("Check() = %+v, want balance and income discrepancies", d)
+	}
+}
+
+func TestNewVerifierValidation(t *testing.T) {
+	if _, err := NewVerifier(&fakeStore{}, fakeIncomes{}, time.UTC, "total", DefaultTolerance); err == nil {
+		t.Error("NewVerifier() expected error for an unknown basis")
+	}
+	if _, err := NewVerifier(&fakeStore{}, fakeIncomes{}, time.UTC, BasisAmount, -1); err == nil {
+		t.Error("NewVerifier() expected error for a negative tolerance")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	wrong := march()
+	wrong.BalanceHistoryID = 2
+	wrong.RecordedAmount = 1000
+
+	// The income changed after March, the history version must be used
+	raised := march()
+	raised.BalanceHistoryID = 3
+	raised.UserMonthlyIncome = 6000
+
+	store := &fakeStore{components: []models.BalanceComponents{march(), wrong, raised}}
+	v, err := NewVerifier(store, fakeIncomes{"2024/03": 5000}, time.UTC, BasisAmount, DefaultTolerance)
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	summary, err := v.Verify(models.BalanceFilter{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if summary.Verified != 3 || summary.Discrepancies != 1 || summary.LastBalanceHistoryID != 3 {
+		t.Errorf("Verify() = %+v, want 3 verified up to id 3 and 1 discrepancy", summary)
+	}
+	if d := store.discrepancies[2]; d == nil || d.VerifiedAt.IsZero() {
+		t.Errorf("discrepancy of balance history 2 = %+v, want it stored with verified_at", d)
+	}
+	if len(store.deleted) != 2 {
+		t.Errorf("deleted = %v, want the discrepancies of the 2 consistent rows cleared", store.deleted)
+	}
+}
+
+func TestVerifyFallsBackToCurrentIncome(t *testing.T) {
+	store := &fakeStore{components: []models.BalanceComponents{march()}}
+	v, _ := NewVerifier(store, fakeIncomes{}, time.UTC, BasisAmount, DefaultTolerance)
+
+	summary, err := v.Verify(models.BalanceFilter{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if summary.Discrepancies != 0 {
+		t.Errorf("Verify() = %+v, want user.monthly_income used without history", summary)
+	}
+}
+
+func TestVerifySkipsUnconverted(t *testing.T) {
+	unconverted := march()
+	unconverted.BalanceHistoryID = 2
+	unconverted.RecordedAmount = 1000
+	unconverted.UnconvertedRows = 1
+
+	store := &fakeStore{components: []models.BalanceComponents{march(), unconverted}}
+	v, _ := NewVerifier(store, fakeIncomes{}, time.UTC, BasisAmount, DefaultTolerance)
+
+	summary, err := v.Verify(models.BalanceFilter{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if summary.Verified != 1 || summary.Unconverted != 1 || summary.LastBalanceHistoryID != 2 {
+		t.Errorf("Verify() = %+v, want 1 verified and 1 unconverted up to id 2", summary)
+	}
+	if len(store.discrepancies) != 0 || len(store.deleted) != 1 {
+		t.Errorf("discrepancies = %v, deleted = %v, want the unconverted row left alone", store.discrepancies, store.deleted)
+	}
+}
@@ -0,0 +1,112 @@
+// Package blobstore stores binary content, such as workflow receipt images, outside MariaDB.
+// Blobs are content-addressed: the key is the hex SHA-256 of the content, so storing the
+// same content twice keeps a single copy.
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// ErrNotFound is returned by Get when no blob exists for a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a content-addressed blob store driver
+type Store interface {
+	// Put stores data under key. Storing a key that already exists is a no-op.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the data stored under key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Exists reports whether a blob is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes the blob stored under key. Deleting a missing key is a no-op.
+	Delete(ctx context.Context, key string) error
+}
+
+// Blob describes stored content
+type Blob struct {
+	Key      string
+	MimeType string
+	Size     int64
+}
+
+// New creates the Store selected by the configuration
+func New(cfg config.BlobStoreConfig) (Store, error) {
+	switch cfg.Driver {
+	case "local", "":
+		return NewLocalStore(cfg.LocalDir)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob store driver: %s", cfg.Driver)
+	}
+}
+
+// Key returns the content address of data
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// objectPath spreads keys over 256 prefixes so no single directory grows too large
+func objectPath(key string) (string, error) {
+	if len(key) != sha256.Size*2 || strings.Trim(key, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return key[:2] + "/" + key, nil
+}
+
+// DecodeBase64 decodes base64 content, with or without a data URI prefix
+// (data:image/jpeg;base64,...). The MIME type comes from the prefix when there is one,
+// otherwise it is sniffed from the content.
+func DecodeBase64(value string) ([]byte, string, error) {
+	value = strings.TrimSpace(value)
+
+	var mimeType string
+	if rest, found := strings.CutPrefix(value, "data:"); found {
+		header, payload, ok := strings.Cut(rest, ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return nil, "", errors.New("data URI is not base64 encoded")
+		}
+		mimeType = strings.TrimSuffix(header, ";base64")
+		value = payload
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		// Some clients strip the padding
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+			return nil, "", fmt.Errorf("failed to decode base64 content: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, "", errors.New("base64 content is empty")
+	}
+
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return data, mimeType, nil
+}
+
+// PutBase64 decodes base64 content and stores it, returning where it was stored
+func PutBase64(ctx context.Context, store Store, value string) (Blob, error) {
+	data, mimeType, err := DecodeBase64(value)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	blob := Blob{Key: Key(data), MimeType: mimeType, Size: int64(len(data))}
+	if err := store.Put(ctx, blob.Key, data, mimeType); err != nil {
+		return Blob{}, fmt.Errorf("failed to store blob %s: %w", blob.Key, err)
+	}
+	return blob, nil
+}
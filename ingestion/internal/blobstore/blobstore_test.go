@@ -0,0 +1,105 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// pngHeader is enough of a PNG file for content sniffing
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestKey(t *testing.T) {
+	// SHA-256 of "hello"
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := Key([]byte("hello")); got != want {
+		t.Errorf("Key() = %s, want %s", got, want)
+	}
+}
+
+func TestObjectPath(t *testing.T) {
+	key := Key([]byte("hello"))
+	p, err := objectPath(key)
+	if err != nil {
+		t.Fatalf("objectPath() returned error: %v", err)
+	}
+	if p != "2c/"+key {
+		t.Errorf("objectPath() = %s, want 2c/%s", p, key)
+	}
+
+	for _, invalid := range []string{"", "../etc/passwd", "ABC", key[:10]} {
+		if _, err := objectPath(invalid); err == nil {
+			t.Errorf("objectPath(%q) should return error", invalid)
+		}
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(pngHeader)
+
+	data, mimeType, err := DecodeBase64(encoded)
+	if err != nil {
+		t.Fatalf("DecodeBase64() returned error: %v", err)
+	}
+	if string(data) != string(pngHeader) || mimeType != "image/png" {
+		t.Errorf("DecodeBase64() = %q, %s, want the PNG header and image/png", data, mimeType)
+	}
+
+	_, mimeType, err = DecodeBase64("data:image/jpeg;base64," + encoded)
+	if err != nil {
+		t.Fatalf("DecodeBase64(data URI) returned error: %v", err)
+	}
+	if mimeType != "image/jpeg" {
+		t.Errorf("DecodeBase64(data URI) MIME type = %s, want image/jpeg", mimeType)
+	}
+
+	if _, _, err := DecodeBase64(base64.RawStdEncoding.EncodeToString(pngHeader)); err != nil {
+		t.Errorf("DecodeBase64(unpadded) returned error: %v", err)
+	}
+
+	for _, invalid := range []string{"", "not base64!", "data:image/png,plain"} {
+		if _, _, err := DecodeBase64(invalid); err == nil {
+			t.Errorf("DecodeBase64(%q) should return error", invalid)
+		}
+	}
+}
+
+func TestPutBase64(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := PutBase64(context.Background(), store, base64.StdEncoding.EncodeToString(pngHeader))
+	if err != nil {
+		t.Fatalf("PutBase64() returned error: %v", err)
+	}
+	if blob.Key != Key(pngHeader) || blob.MimeType != "image/png" || blob.Size != int64(len(pngHeader)) {
+		t.Errorf("PutBase64() = %+v", blob)
+	}
+
+	if exists, _ := store.Exists(context.Background(), blob.Key); !exists {
+		t.Error("PutBase64() did not store the blob")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if store, err := New(config.BlobStoreConfig{Driver: "local", LocalDir: t.TempDir()}); err != nil {
+		t.Errorf("New(local) returned error: %v", err)
+	} else if _, ok := store.(*LocalStore); !ok {
+		t.Errorf("New(local) = %T, want *LocalStore", store)
+	}
+
+	s3 := config.S3Config{Endpoint: "http://localhost:9000", Bucket: "receipts"}
+	if store, err := New(config.BlobStoreConfig{Driver: "s3", S3: s3}); err != nil {
+		t.Errorf("New(s3) returned error: %v", err)
+	} else if _, ok := store.(*S3Store); !ok {
+		t.Errorf("New(s3) = %T, want *S3Store", store)
+	}
+
+	if _, err := New(config.BlobStoreConfig{Driver: "ftp"}); err == nil {
+		t.Error("New() should return error for an unknown driver")
+	}
+}
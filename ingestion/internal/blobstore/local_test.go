@@ -0,0 +1,73 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore() returned error: %v", err)
+	}
+
+	data := []byte("receipt")
+	key := Key(data)
+
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Errorf("Exists() before Put = %v, %v, want false", exists, err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() before Put error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Put(ctx, key, data, "text/plain"); err != nil {
+		t.Fatalf("Put() returned error: %v", err)
+	}
+	// Storing the same content again is a no-op
+	if err := store.Put(ctx, key, data, "text/plain"); err != nil {
+		t.Fatalf("second Put() returned error: %v", err)
+	}
+
+	got, err := store.Get(ctx, key)
+	if err != nil || string(got) != "receipt" {
+		t.Errorf("Get() = %q, %v, want receipt", got, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, key[:2], key)); err != nil {
+		t.Errorf("blob file not found under its prefix directory: %v", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, key[:2]))
+	if len(entries) != 1 {
+		t.Errorf("prefix directory has %d entries, want 1 (temporary files must be cleaned up)", len(entries))
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Errorf("Exists() after Delete = %v, %v, want false", exists, err)
+	}
+	// Deleting a missing blob is a no-op
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete() returned error: %v", err)
+	}
+}
+
+func TestLocalStoreInvalidKey(t *testing.T) {
+	store, _ := NewLocalStore(t.TempDir())
+	if err := store.Put(context.Background(), "../outside", []byte("x"), ""); err == nil {
+		t.Error("Put() should reject keys that are not SHA-256 hashes")
+	}
+
+	if _, err := NewLocalStore(""); err == nil {
+		t.Error("NewLocalStore() should return error for an empty directory")
+	}
+}
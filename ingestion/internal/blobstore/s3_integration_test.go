@@ -0,0 +1,67 @@
+//go:build integration
+
+package blobstore
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// TestS3StoreMinIO runs against a real S3-compatible endpoint, such as the MinIO
+// service in docker-compose.yml:
+//
+//	docker compose up -d minio minio-init
+//	go test -tags integration ./internal/blobstore/
+func TestS3StoreMinIO(t *testing.T) {
+	endpoint := os.Getenv("BLOBSTORE_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:9000"
+	}
+	bucket := os.Getenv("BLOBSTORE_S3_BUCKET")
+	if bucket == "" {
+		bucket = "porcool-receipts"
+	}
+
+	store, err := NewS3Store(config.S3Config{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          bucket,
+		AccessKeyID:     getenv("BLOBSTORE_S3_ACCESS_KEY_ID", "minioadmin"),
+		SecretAccessKey: getenv("BLOBSTORE_S3_SECRET_ACCESS_KEY", "minioadmin"),
+		UsePathStyle:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store() returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	data := []byte("integration test receipt")
+	key := Key(data)
+
+	if err := store.Put(ctx, key, data, "text/plain"); err != nil {
+		t.Fatalf("Put() returned error: %v", err)
+	}
+	got, err := store.Get(ctx, key)
+	if err != nil || string(got) != string(data) {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Errorf("Exists() = %v, %v, want true", exists, err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Errorf("Exists() after Delete = %v, %v, want false", exists, err)
+	}
+}
+
+func getenv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,157 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// fakeS3 is a minimal in-memory S3 endpoint for path-style requests
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests []*http.Request
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T, endpoint string) *S3Store {
+	t.Helper()
+	store, err := NewS3Store(config.S3Config{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          "receipts",
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+		UsePathStyle:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store() returned error: %v", err)
+	}
+	store.now = func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+	return store
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := newTestS3Store(t, server.URL)
+	data := []byte("receipt")
+	key := Key(data)
+
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() before Put error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Put(ctx, key, data, "image/png"); err != nil {
+		t.Fatalf("Put() returned error: %v", err)
+	}
+	if _, ok := fake.objects["/receipts/"+key[:2]+"/"+key]; !ok {
+		t.Errorf("object not stored under its path-style key: %v", fake.objects)
+	}
+
+	puts := 0
+	if err := store.Put(ctx, key, data, "image/png"); err != nil {
+		t.Fatalf("second Put() returned error: %v", err)
+	}
+	for _, r := range fake.requests {
+		if r.Method == http.MethodPut {
+			puts++
+		}
+	}
+	if puts != 1 {
+		t.Errorf("object uploaded %d times, want 1 (existing objects are skipped)", puts)
+	}
+
+	got, err := store.Get(ctx, key)
+	if err != nil || string(got) != "receipt" {
+		t.Errorf("Get() = %q, %v, want receipt", got, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Errorf("Exists() after Delete = %v, %v, want false", exists, err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() of a missing object returned error: %v", err)
+	}
+}
+
+func TestS3StoreSignsRequests(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := newTestS3Store(t, server.URL)
+	if _, err := store.Exists(context.Background(), Key([]byte("x"))); err != nil {
+		t.Fatalf("Exists() returned error: %v", err)
+	}
+
+	r := fake.requests[0]
+	if got := r.Header.Get("X-Amz-Date"); got != "20240315T120000Z" {
+		t.Errorf("X-Amz-Date = %s, want 20240315T120000Z", got)
+	}
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != emptyPayloadHash {
+		t.Errorf("X-Amz-Content-Sha256 = %s, want the empty payload hash", got)
+	}
+
+	auth := r.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential=minioadmin/20240315/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(auth, prefix) || len(auth) != len(prefix)+64 {
+		t.Errorf("Authorization = %s", auth)
+	}
+}
+
+func TestS3StoreObjectURL(t *testing.T) {
+	key := Key([]byte("x"))
+
+	store, _ := NewS3Store(config.S3Config{Endpoint: "https://s3.amazonaws.com", Bucket: "receipts"})
+	u, err := store.objectURL(key)
+	if err != nil {
+		t.Fatalf("objectURL() returned error: %v", err)
+	}
+	if want := "https://receipts.s3.amazonaws.com/" + key[:2] + "/" + key; u.String() != want {
+		t.Errorf("objectURL() = %s, want %s", u, want)
+	}
+
+	if _, err := NewS3Store(config.S3Config{Endpoint: "localhost:9000", Bucket: "receipts"}); err == nil {
+		t.Error("NewS3Store() should return error for an endpoint without a scheme")
+	}
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -80,11 +83,23 @@ func TestLoadWithDefaults(t *testing.T) {
 	// Clear all environment variables
 	envVars := []string{
 		"MARIADB_HOST", "MARIADB_PORT", "MARIADB_USER", "MARIADB_PASSWORD",
-		"MARIADB_DATABASE", "MONGODB_URI", "MONGODB_DATABASE",
+		"MARIADB_DATABASE", "MARIADB_MIGRATE_ON_START", "MARIADB_MAX_OPEN_CONNS", "MARIADB_MAX_IDLE_CONNS",
+		"MARIADB_CONN_MAX_LIFETIME", "MARIADB_CONN_MAX_IDLE_TIME", "MARIADB_CONNECT_TIMEOUT", "MARIADB_READ_TIMEOUT",
+		"MARIADB_WRITE_TIMEOUT", "MARIADB_TLS", "MARIADB_TLS_CA_FILE", "MARIADB_TLS_CERT_FILE", "MARIADB_TLS_KEY_FILE",
+		"MARIADB_TLS_SERVER_NAME", "MARIADB_REPLICA_HOST", "MARIADB_REPLICA_PORT", "MONGODB_URI", "MONGODB_DATABASE", "MONGODB_FETCH_BATCH_SIZE", "MONGODB_ENSURE_INDEXES",
 		"RABBITMQ_URI", "RABBITMQ_QUEUE_NAME",
 		"INGESTION_BATCH_SIZE",
 		"OPENSEARCH_ENABLED", "OPENSEARCH_URL", "OPENSEARCH_USERNAME",
 		"OPENSEARCH_PASSWORD", "OPENSEARCH_INDEX_PREFIX", "OPENSEARCH_RETENTION_DAYS",
+		"BASE_CURRENCY", "BUSINESS_TIMEZONE",
+		"DOMAIN_UNKNOWN_POLICY", "DOMAIN_FALLBACKS", "DOMAIN_REFRESH_INTERVAL",
+		"DOMAIN_SEED_FILE", "PAYMENT_DEFAULT_PROVIDER",
+		"BLOBSTORE_DRIVER", "BLOBSTORE_LOCAL_DIR", "BLOBSTORE_S3_ENDPOINT", "BLOBSTORE_S3_BUCKET",
+		"BLOBSTORE_S3_REGION", "BLOBSTORE_S3_USE_PATH_STYLE", "USER_EMAIL_CONFLICT_POLICY",
+		"FIELD_ENCRYPTION_ENABLED", "FIELD_ENCRYPTION_KEY_FILE", "FIELD_ENCRYPTION_COLUMNS",
+		"ERASURE_RECEIPT_SIGNING_KEY",
+		"INGESTION_TRIGGER", "CHANGE_STREAM_FLUSH_INTERVAL", "CHANGE_STREAM_MAX_BATCH",
+		"SCHEMA_DRIFT_PRESERVE_EXTRA_ATTRIBUTES", "METRICS_ADDR",
 	}
 	for _, key := range envVars {
 		os.Unsetenv(key)
@@ -111,6 +126,30 @@ func TestLoadWithDefaults(t *testing.T) {
 	if cfg.Ingestion.BatchSize != 100 {
 		t.Errorf("Ingestion.BatchSize = %d, want 100", cfg.Ingestion.BatchSize)
 	}
+	if cfg.MongoDB.FetchBatchSize != 500 {
+		t.Errorf("MongoDB.FetchBatchSize = %d, want 500", cfg.MongoDB.FetchBatchSize)
+	}
+	if !cfg.MongoDB.EnsureIndexes {
+		t.Error("MongoDB.EnsureIndexes should default to true")
+	}
+	if !cfg.MariaDB.MigrateOnStart {
+		t.Error("MariaDB.MigrateOnStart should default to true")
+	}
+	if cfg.MariaDB.MaxOpenConns != 25 || cfg.MariaDB.MaxIdleConns != 5 {
+		t.Errorf("MariaDB pool = %d open, %d idle, want 25 and 5", cfg.MariaDB.MaxOpenConns, cfg.MariaDB.MaxIdleConns)
+	}
+	if cfg.MariaDB.ConnMaxLifetime != 5*time.Minute || cfg.MariaDB.ConnMaxIdleTime != 0 {
+		t.Errorf("MariaDB connection lifetime = %s, idle time = %s, want 5m and 0", cfg.MariaDB.ConnMaxLifetime, cfg.MariaDB.ConnMaxIdleTime)
+	}
+	if cfg.MariaDB.ConnectTimeout != 0 || cfg.MariaDB.ReadTimeout != 0 || cfg.MariaDB.WriteTimeout != 0 {
+		t.Error("MariaDB timeouts should default to 0")
+	}
+	if cfg.MariaDB.TLS.Enabled() {
+		t.Errorf("MariaDB.TLS.Mode = %s, want TLS disabled by default", cfg.MariaDB.TLS.Mode)
+	}
+	if cfg.MariaDB.ReplicaDSN() != "" {
+		t.Errorf("MariaDB.ReplicaDSN() = %s, want none by default", cfg.MariaDB.ReplicaDSN())
+	}
 
 	// Verify OpenSearch defaults
 	if cfg.OpenSearch.Enabled {
@@ -125,6 +164,245 @@ func TestLoadWithDefaults(t *testing.T) {
 	if cfg.OpenSearch.RetentionDays != 90 {
 		t.Errorf("OpenSearch.RetentionDays = %d, want 90", cfg.OpenSearch.RetentionDays)
 	}
+
+	// Verify Currency defaults
+	if cfg.Currency.BaseCurrency != "BRL" {
+		t.Errorf("Currency.BaseCurrency = %s, want BRL", cfg.Currency.BaseCurrency)
+	}
+
+	// Verify Dates defaults
+	if cfg.Dates.BusinessTimezone != "America/Sao_Paulo" {
+		t.Errorf("Dates.BusinessTimezone = %s, want America/Sao_Paulo", cfg.Dates.BusinessTimezone)
+	}
+
+	// Verify Domains defaults
+	if cfg.Domains.UnknownPolicy != "reject" {
+		t.Errorf("Domains.UnknownPolicy = %s, want reject", cfg.Domains.UnknownPolicy)
+	}
+	if len(cfg.Domains.Fallbacks) != 0 {
+		t.Errorf("Domains.Fallbacks = %v, want empty", cfg.Domains.Fallbacks)
+	}
+	if cfg.Domains.RefreshInterval != 5*time.Minute {
+		t.Errorf("Domains.RefreshInterval = %v, want 5m", cfg.Domains.RefreshInterval)
+	}
+	if cfg.Domains.SeedFile != "" {
+		t.Errorf("Domains.SeedFile = %s, want empty", cfg.Domains.SeedFile)
+	}
+
+	// Verify Payments defaults
+	if cfg.Payments.DefaultProvider != "PayPal" {
+		t.Errorf("Payments.DefaultProvider = %s, want PayPal", cfg.Payments.DefaultProvider)
+	}
+
+	// Verify BlobStore defaults
+	if cfg.BlobStore.Driver != "local" {
+		t.Errorf("BlobStore.Driver = %s, want local", cfg.BlobStore.Driver)
+	}
+	if cfg.BlobStore.LocalDir != "data/blobs" {
+		t.Errorf("BlobStore.LocalDir = %s, want data/blobs", cfg.BlobStore.LocalDir)
+	}
+	if cfg.BlobStore.S3.Region != "us-east-1" || !cfg.BlobStore.S3.UsePathStyle {
+		t.Errorf("BlobStore.S3 = %+v, want region us-east-1 and path-style addressing", cfg.BlobStore.S3)
+	}
+	if cfg.Users.EmailConflictPolicy != EmailConflictFail {
+		t.Errorf("Users.EmailConflictPolicy = %s, want %s", cfg.Users.EmailConflictPolicy, EmailConflictFail)
+	}
+	if cfg.Encryption.Enabled || len(cfg.Encryption.Columns) != 6 {
+		t.Errorf("Encryption = %+v, want disabled with the 6 default PII columns", cfg.Encryption)
+	}
+	if cfg.Erasure.ReceiptSigningKey != "" {
+		t.Errorf("Erasure.ReceiptSigningKey = %q, want empty by default", cfg.Erasure.ReceiptSigningKey)
+	}
+	if cfg.Triggers.Mode != TriggerRabbitMQ || cfg.Triggers.ChangeStreamFlushInterval != 2*time.Second || cfg.Triggers.ChangeStreamMaxBatch != 500 {
+		t.Errorf("Triggers = %+v, want rabbitmq, 2s and 500", cfg.Triggers)
+	}
+	if cfg.Drift.PreserveExtraAttributes {
+		t.Error("Drift.PreserveExtraAttributes should default to false")
+	}
+	if cfg.Metrics.Addr != "" {
+		t.Errorf("Metrics.Addr = %q, want empty by default", cfg.Metrics.Addr)
+	}
+}
+
+func TestLoadDriftAndMetrics(t *testing.T) {
+	os.Setenv("SCHEMA_DRIFT_PRESERVE_EXTRA_ATTRIBUTES", "true")
+	os.Setenv("METRICS_ADDR", ":9090")
+	defer os.Unsetenv("SCHEMA_DRIFT_PRESERVE_EXTRA_ATTRIBUTES")
+	defer os.Unsetenv("METRICS_ADDR")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !cfg.Drift.PreserveExtraAttributes {
+		t.Error("Drift.PreserveExtraAttributes = false, want true")
+	}
+	if cfg.Metrics.Addr != ":9090" {
+		t.Errorf("Metrics.Addr = %q, want :9090", cfg.Metrics.Addr)
+	}
+}
+
+func TestLoadBlobStoreConfig(t *testing.T) {
+	os.Setenv("BLOBSTORE_DRIVER", "S3")
+	defer os.Unsetenv("BLOBSTORE_DRIVER")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should return error for the s3 driver without endpoint and bucket")
+	}
+
+	os.Setenv("BLOBSTORE_S3_ENDPOINT", "http://localhost:9000")
+	os.Setenv("BLOBSTORE_S3_BUCKET", "receipts")
+	defer func() {
+		os.Unsetenv("BLOBSTORE_S3_ENDPOINT")
+		os.Unsetenv("BLOBSTORE_S3_BUCKET")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.BlobStore.Driver != "s3" || cfg.BlobStore.S3.Bucket != "receipts" {
+		t.Errorf("BlobStore = %+v", cfg.BlobStore)
+	}
+
+	os.Setenv("BLOBSTORE_DRIVER", "ftp")
+	if _, err := Load(); err == nil {
+		t.Error("Load() should return error for an unknown blob store driver")
+	}
+}
+
+func TestLoadDomainsConfig(t *testing.T) {
+	os.Setenv("DOMAIN_UNKNOWN_POLICY", "Fallback")
+	os.Setenv("DOMAIN_FALLBACKS", "expense.id_status=pending, expense_installment.id_status=pending")
+	os.Setenv("DOMAIN_REFRESH_INTERVAL", "30s")
+	defer func() {
+		os.Unsetenv("DOMAIN_UNKNOWN_POLICY")
+		os.Unsetenv("DOMAIN_FALLBACKS")
+		os.Unsetenv("DOMAIN_REFRESH_INTERVAL")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.Domains.UnknownPolicy != "fallback" {
+		t.Errorf("Domains.UnknownPolicy = %s, want fallback", cfg.Domains.UnknownPolicy)
+	}
+	if cfg.Domains.Fallbacks["expense.id_status"] != "pending" || cfg.Domains.Fallbacks["expense_installment.id_status"] != "pending" {
+		t.Errorf("Domains.Fallbacks = %v", cfg.Domains.Fallbacks)
+	}
+	if cfg.Domains.RefreshInterval != 30*time.Second {
+		t.Errorf("Domains.RefreshInterval = %v, want 30s", cfg.Domains.RefreshInterval)
+	}
+}
+
+func TestLoadInvalidDomainsConfig(t *testing.T) {
+	tests := map[string]string{
+		"DOMAIN_UNKNOWN_POLICY":   "ignore",
+		"DOMAIN_FALLBACKS":        "pending",
+		"DOMAIN_REFRESH_INTERVAL": "often",
+	}
+
+	for key, value := range tests {
+		os.Setenv(key, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() should return error for %s=%s", key, value)
+		}
+		os.Unsetenv(key)
+	}
+}
+
+func TestLoadEmailConflictPolicy(t *testing.T) {
+	os.Setenv("USER_EMAIL_CONFLICT_POLICY", "Merge")
+	defer os.Unsetenv("USER_EMAIL_CONFLICT_POLICY")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.Users.EmailConflictPolicy != EmailConflictMerge {
+		t.Errorf("Users.EmailConflictPolicy = %s, want %s", cfg.Users.EmailConflictPolicy, EmailConflictMerge)
+	}
+
+	os.Setenv("USER_EMAIL_CONFLICT_POLICY", "overwrite")
+	if _, err := Load(); err == nil {
+		t.Error("Load() should return error for USER_EMAIL_CONFLICT_POLICY=overwrite")
+	}
+}
+
+func TestLoadEncryption(t *testing.T) {
+	os.Setenv("FIELD_ENCRYPTION_ENABLED", "true")
+	defer os.Unsetenv("FIELD_ENCRYPTION_ENABLED")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load() should return error for encryption without FIELD_ENCRYPTION_KEY_FILE")
+	}
+
+	os.Setenv("FIELD_ENCRYPTION_KEY_FILE", "keys.json")
+	os.Setenv("FIELD_ENCRYPTION_COLUMNS", " user.email , expense_automatic_workflow.description,")
+	defer os.Unsetenv("FIELD_ENCRYPTION_KEY_FILE")
+	defer os.Unsetenv("FIELD_ENCRYPTION_COLUMNS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !cfg.Encryption.Enabled || cfg.Encryption.KeyFile != "keys.json" {
+		t.Errorf("Encryption = %+v, want enabled with keys.json", cfg.Encryption)
+	}
+	want := []string{"user.email", "expense_automatic_workflow.description"}
+	if !reflect.DeepEqual(cfg.Encryption.Columns, want) {
+		t.Errorf("Encryption.Columns = %v, want %v", cfg.Encryption.Columns, want)
+	}
+
+	os.Setenv("FIELD_ENCRYPTION_COLUMNS", "email")
+	if _, err := Load(); err == nil {
+		t.Error("Load() should return error for a column without a table")
+	}
+}
+
+func TestLoadTriggers(t *testing.T) {
+	os.Setenv("INGESTION_TRIGGER", "ChangeStream")
+	os.Setenv("CHANGE_STREAM_FLUSH_INTERVAL", "500ms")
+	os.Setenv("CHANGE_STREAM_MAX_BATCH", "50")
+	defer os.Unsetenv("INGESTION_TRIGGER")
+	defer os.Unsetenv("CHANGE_STREAM_FLUSH_INTERVAL")
+	defer os.Unsetenv("CHANGE_STREAM_MAX_BATCH")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	want := TriggersConfig{Mode: TriggerChangeStream, ChangeStreamFlushInterval: 500 * time.Millisecond, ChangeStreamMaxBatch: 50}
+	if cfg.Triggers != want {
+		t.Errorf("Triggers = %+v, want %+v", cfg.Triggers, want)
+	}
+
+	for key, value := range map[string]string{
+		"INGESTION_TRIGGER":            "polling",
+		"CHANGE_STREAM_FLUSH_INTERVAL": "0s",
+		"CHANGE_STREAM_MAX_BATCH":      "0",
+	} {
+		previous := os.Getenv(key)
+		os.Setenv(key, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() should return error for %s=%s", key, value)
+		}
+		os.Setenv(key, previous)
+	}
+}
+
+func TestLoadBaseCurrencyUppercased(t *testing.T) {
+	os.Setenv("BASE_CURRENCY", "usd")
+	defer os.Unsetenv("BASE_CURRENCY")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.Currency.BaseCurrency != "USD" {
+		t.Errorf("Currency.BaseCurrency = %s, want USD", cfg.Currency.BaseCurrency)
+	}
 }
 
 func TestLoadInvalidPort(t *testing.T) {
@@ -137,6 +415,157 @@ func TestLoadInvalidPort(t *testing.T) {
 	}
 }
 
+func TestLoadInvalidBusinessTimezone(t *testing.T) {
+	os.Setenv("BUSINESS_TIMEZONE", "Not/AZone")
+	defer os.Unsetenv("BUSINESS_TIMEZONE")
+
+	_, err := Load()
+	if err == nil {
+		t.Error("Load() should return error for invalid business timezone")
+	}
+}
+
+func TestLoadInvalidFetchBatchSize(t *testing.T) {
+	defer os.Unsetenv("MONGODB_FETCH_BATCH_SIZE")
+
+	for _, value := range []string{"many", "0", "-10"} {
+		os.Setenv("MONGODB_FETCH_BATCH_SIZE", value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() should return error for MONGODB_FETCH_BATCH_SIZE=%s", value)
+		}
+	}
+}
+
+func TestLoadEnsureIndexesDisabled(t *testing.T) {
+	os.Setenv("MONGODB_ENSURE_INDEXES", "false")
+	defer os.Unsetenv("MONGODB_ENSURE_INDEXES")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.MongoDB.EnsureIndexes {
+		t.Error("MongoDB.EnsureIndexes = true, want false")
+	}
+}
+
+func TestLoadMigrateOnStartDisabled(t *testing.T) {
+	os.Setenv("MARIADB_MIGRATE_ON_START", "false")
+	defer os.Unsetenv("MARIADB_MIGRATE_ON_START")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.MariaDB.MigrateOnStart {
+		t.Error("MariaDB.MigrateOnStart = true, want false")
+	}
+}
+
+func TestLoadMariaDBPoolTimeoutsAndTLS(t *testing.T) {
+	env := map[string]string{
+		"MARIADB_HOST":               "db.internal",
+		"MARIADB_MAX_OPEN_CONNS":     "50",
+		"MARIADB_MAX_IDLE_CONNS":     "10",
+		"MARIADB_CONN_MAX_LIFETIME":  "30m",
+		"MARIADB_CONN_MAX_IDLE_TIME": "2m",
+		"MARIADB_CONNECT_TIMEOUT":    "5s",
+		"MARIADB_READ_TIMEOUT":       "30s",
+		"MARIADB_WRITE_TIMEOUT":      "15s",
+		"MARIADB_TLS":                "TRUE",
+		"MARIADB_TLS_CA_FILE":        "/certs/ca.pem",
+		"MARIADB_TLS_CERT_FILE":      "/certs/client.pem",
+		"MARIADB_TLS_KEY_FILE":       "/certs/client-key.pem",
+		"MARIADB_REPLICA_HOST":       "replica.internal",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	m := cfg.MariaDB
+	if m.MaxOpenConns != 50 || m.MaxIdleConns != 10 || m.ConnMaxLifetime != 30*time.Minute || m.ConnMaxIdleTime != 2*time.Minute {
+		t.Errorf("MariaDB pool = %+v", m)
+	}
+	if m.ConnectTimeout != 5*time.Second || m.ReadTimeout != 30*time.Second || m.WriteTimeout != 15*time.Second {
+		t.Errorf("MariaDB timeouts = %s, %s, %s", m.ConnectTimeout, m.ReadTimeout, m.WriteTimeout)
+	}
+	if m.TLS.Mode != MariaDBTLSVerify || !m.TLS.Custom() || m.TLS.CAFile != "/certs/ca.pem" || m.TLS.KeyFile != "/certs/client-key.pem" {
+		t.Errorf("MariaDB.TLS = %+v", m.TLS)
+	}
+	if m.ReplicaHost != "replica.internal" || m.ReplicaPort != 3306 {
+		t.Errorf("MariaDB replica = %s:%d, want replica.internal:3306", m.ReplicaHost, m.ReplicaPort)
+	}
+}
+
+func TestLoadInvalidMariaDBConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"zero max open connections", map[string]string{"MARIADB_MAX_OPEN_CONNS": "0"}},
+		{"negative max idle connections", map[string]string{"MARIADB_MAX_IDLE_CONNS": "-1"}},
+		{"invalid lifetime", map[string]string{"MARIADB_CONN_MAX_LIFETIME": "forever"}},
+		{"negative timeout", map[string]string{"MARIADB_READ_TIMEOUT": "-1s"}},
+		{"invalid replica port", map[string]string{"MARIADB_REPLICA_PORT": "abc"}},
+		{"zero replica port", map[string]string{"MARIADB_REPLICA_PORT": "0"}},
+		{"negative replica port", map[string]string{"MARIADB_REPLICA_PORT": "-3306"}},
+		{"unknown TLS mode", map[string]string{"MARIADB_TLS": "required"}},
+		{"certificate without key", map[string]string{"MARIADB_TLS": "true", "MARIADB_TLS_CERT_FILE": "/certs/client.pem"}},
+		{"CA without TLS", map[string]string{"MARIADB_TLS_CA_FILE": "/certs/ca.pem"}},
+		{"preferred with a CA", map[string]string{"MARIADB_TLS": "preferred", "MARIADB_TLS_CA_FILE": "/certs/ca.pem"}},
+		{"preferred with a server name", map[string]string{"MARIADB_TLS": "preferred", "MARIADB_TLS_SERVER_NAME": "db.internal"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			if _, err := Load(); err == nil {
+				t.Errorf("Load() should return error for %v", tt.env)
+			}
+		})
+	}
+}
+
+func TestMariaDBConfigDSNOptions(t *testing.T) {
+	cfg := MariaDBConfig{
+		Host:           "db.internal",
+		Port:           3306,
+		User:           "porcool",
+		Password:       "secret",
+		Database:       "porcool",
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    time.Minute,
+		WriteTimeout:   1500 * time.Millisecond,
+		TLS:            MariaDBTLSConfig{Mode: MariaDBTLSSkipVerify},
+		ReplicaHost:    "replica.internal",
+		ReplicaPort:    3307,
+	}
+
+	options := "?parseTime=true&charset=utf8mb4&timeout=5s&readTimeout=1m0s&writeTimeout=1.5s&tls=skip-verify"
+	if want := "porcool:secret@tcp(db.internal:3306)/porcool" + options; cfg.DSN() != want {
+		t.Errorf("DSN() = %s, want %s", cfg.DSN(), want)
+	}
+	if want := "porcool:secret@tcp(db.internal:3306)/" + options; cfg.ServerDSN() != want {
+		t.Errorf("ServerDSN() = %s, want %s", cfg.ServerDSN(), want)
+	}
+	if want := "porcool:secret@tcp(replica.internal:3307)/porcool" + options; cfg.ReplicaDSN() != want {
+		t.Errorf("ReplicaDSN() = %s, want %s", cfg.ReplicaDSN(), want)
+	}
+
+	cfg.TLS = MariaDBTLSConfig{Mode: MariaDBTLSVerify, CAFile: "/certs/ca.pem"}
+	if dsn := cfg.DSN(); !strings.HasSuffix(dsn, "&tls="+MariaDBCustomTLSName) {
+		t.Errorf("DSN() with a CA file = %s, want the custom TLS configuration", dsn)
+	}
+}
+
 func TestMariaDBConfigDSN(t *testing.T) {
 	cfg := MariaDBConfig{
 		Host:     "localhost",
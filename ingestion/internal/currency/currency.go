@@ -0,0 +1,236 @@
+package currency
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// RateLookup finds the exchange rate effective on a date
+type RateLookup interface {
+	GetRate(currencyCode, baseCurrencyCode string, on time.Time) (float64, bool, error)
+}
+
+// Converter converts amounts into the configured base currency
+type Converter struct {
+	baseCurrency string
+	lookup       RateLookup
+}
+
+// Conversion holds the rate used for a conversion and the converted amounts.
+// When no rate is available Rate and every amount are NULL.
+type Conversion struct {
+	CurrencyCode string
+	Rate         sql.NullFloat64
+	Amounts      []sql.NullFloat64
+}
+
+// NewConverter creates a new Converter
+func NewConverter(baseCurrency string, lookup RateLookup) *Converter {
+	return &Converter{
+		baseCurrency: NormalizeCode(baseCurrency),
+		lookup:       lookup,
+	}
+}
+
+// BaseCurrency returns the base currency code
+func (c *Converter) BaseCurrency() string {
+	return c.baseCurrency
+}
+
+// EffectiveCode returns the normalized currency code, defaulting to the base currency
+// when the source document does not specify one
+func (c *Converter) EffectiveCode(currencyCode string) string {
+	if code := NormalizeCode(currencyCode); code != "" {
+		return code
+	}
+	return c.baseCurrency
+}
+
+// Convert converts the given amounts from currencyCode into the base currency using
+// the rate effective on the given date. An empty currency code means the base currency.
+func (c *Converter) Convert(currencyCode string, on time.Time, amounts ...float64) (Conversion, error) {
+	code := c.EffectiveCode(currencyCode)
+
+	conversion := Conversion{
+		CurrencyCode: code,
+		Amounts:      make([]sql.NullFloat64, len(amounts)),
+	}
+
+	rate := 1.0
+	if code != c.baseCurrency {
+		var found bool
+		var err error
+		rate, found, err = c.lookup.GetRate(code, c.baseCurrency, on)
+		if err != nil {
+			return conversion, err
+		}
+		if !found {
+			return conversion, nil
+		}
+	}
+
+	conversion.Rate = sql.NullFloat64{Float64: rate, Valid: true}
+	for i, amount := range amounts {
+		conversion.Amounts[i] = sql.NullFloat64{Float64: roundCents(amount * rate), Valid: true}
+	}
+
+	return conversion, nil
+}
+
+// NormalizeCode trims and upper-cases an ISO 4217 currency code
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// roundCents rounds an amount to two decimal places
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// rateRecord is the JSON representation of an exchange rate in a rates file
+type rateRecord struct {
+	Currency     string  `json:"currency"`
+	BaseCurrency string  `json:"base_currency"`
+	Rate         float64 `json:"rate"`
+	Date         string  `json:"date"`
+	Source       string  `json:"source"`
+}
+
+// LoadRatesFile reads exchange rates from a local CSV or JSON file.
+// CSV files must have the header: currency,base_currency,rate,date[,source].
+// JSON files must contain an array of objects with the same keys.
+// Rates without a base currency default to defaultBase.
+func LoadRatesFile(path string, defaultBase string) ([]models.ExchangeRate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rates file: %w", err)
+	}
+	defer f.Close()
+
+	var records []rateRecord
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err = readCSV(f)
+	case ".json":
+		records, err = readJSON(f)
+	default:
+		return nil, fmt.Errorf("unsupported rates file extension: %s (want .csv or .json)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]models.ExchangeRate, 0, len(records))
+	for i, record := range records {
+		rate, err := record.toModel(defaultBase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate at entry %d: %w", i+1, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+// readCSV parses rate records from CSV
+func readCSV(r io.Reader) ([]rateRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"currency", "rate", "date"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing column %q", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	records := make([]rateRecord, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		rate, err := strconv.ParseFloat(field(row, "rate"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate on CSV line %d: %w", line+2, err)
+		}
+		records = append(records, rateRecord{
+			Currency:     field(row, "currency"),
+			BaseCurrency: field(row, "base_currency"),
+			Rate:         rate,
+			Date:         field(row, "date"),
+			Source:       field(row, "source"),
+		})
+	}
+
+	return records, nil
+}
+
+// readJSON parses rate records from a JSON array
+func readJSON(r io.Reader) ([]rateRecord, error) {
+	var records []rateRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return records, nil
+}
+
+// toModel validates a rate record and converts it into an ExchangeRate
+func (r rateRecord) toModel(defaultBase string) (models.ExchangeRate, error) {
+	currencyCode := NormalizeCode(r.Currency)
+	if len(currencyCode) != 3 {
+		return models.ExchangeRate{}, fmt.Errorf("invalid currency code %q", r.Currency)
+	}
+
+	baseCode := NormalizeCode(r.BaseCurrency)
+	if baseCode == "" {
+		baseCode = NormalizeCode(defaultBase)
+	}
+	if len(baseCode) != 3 {
+		return models.ExchangeRate{}, fmt.Errorf("invalid base currency code %q", baseCode)
+	}
+
+	if r.Rate <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("rate must be positive, got %v", r.Rate)
+	}
+
+	rateDate, err := time.Parse("2006-01-02", strings.TrimSpace(r.Date))
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", r.Date)
+	}
+
+	return models.ExchangeRate{
+		CurrencyCode:     currencyCode,
+		BaseCurrencyCode: baseCode,
+		Rate:             r.Rate,
+		RateDate:         rateDate,
+		Source:           sql.NullString{String: r.Source, Valid: r.Source != ""},
+	}, nil
+}
@@ -0,0 +1,207 @@
+package currency
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeLookup is a RateLookup backed by a map keyed by currency code
+type fakeLookup struct {
+	rates map[string]float64
+	err   error
+	calls int
+}
+
+func (f *fakeLookup) GetRate(currencyCode, baseCurrencyCode string, on time.Time) (float64, bool, error) {
+	f.calls++
+	if f.err != nil {
+		return 0, false, f.err
+	}
+	rate, ok := f.rates[currencyCode]
+	return rate, ok, nil
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"usd", "USD"},
+		{" eur ", "EUR"},
+		{"BRL", "BRL"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if result := NormalizeCode(tt.input); result != tt.expected {
+			t.Errorf("NormalizeCode(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestConverterEffectiveCode(t *testing.T) {
+	c := NewConverter("brl", &fakeLookup{})
+
+	if c.BaseCurrency() != "BRL" {
+		t.Errorf("BaseCurrency() = %s, want BRL", c.BaseCurrency())
+	}
+	if code := c.EffectiveCode(""); code != "BRL" {
+		t.Errorf("EffectiveCode(\"\") = %s, want BRL", code)
+	}
+	if code := c.EffectiveCode("usd"); code != "USD" {
+		t.Errorf("EffectiveCode(\"usd\") = %s, want USD", code)
+	}
+}
+
+func TestConvertBaseCurrency(t *testing.T) {
+	lookup := &fakeLookup{}
+	c := NewConverter("BRL", lookup)
+
+	conversion, err := c.Convert("", time.Now(), 10.5, 3)
+	if err != nil {
+		t.Fatalf("Convert() returned error: %v", err)
+	}
+	if lookup.calls != 0 {
+		t.Errorf("Convert() looked up a rate for the base currency")
+	}
+	if conversion.CurrencyCode != "BRL" {
+		t.Errorf("CurrencyCode = %s, want BRL", conversion.CurrencyCode)
+	}
+	if !conversion.Rate.Valid || conversion.Rate.Float64 != 1 {
+		t.Errorf("Rate = %+v, want 1", conversion.Rate)
+	}
+	if conversion.Amounts[0].Float64 != 10.5 || conversion.Amounts[1].Float64 != 3 {
+		t.Errorf("Amounts = %+v, want [10.5 3]", conversion.Amounts)
+	}
+}
+
+func TestConvertForeignCurrency(t *testing.T) {
+	c := NewConverter("BRL", &fakeLookup{rates: map[string]float64{"USD": 5.4321}})
+
+	conversion, err := c.Convert("usd", time.Now(), 10, 0.01)
+	if err != nil {
+		t.Fatalf("Convert() returned error: %v", err)
+	}
+	if conversion.CurrencyCode != "USD" {
+		t.Errorf("CurrencyCode = %s, want USD", conversion.CurrencyCode)
+	}
+	if !conversion.Rate.Valid || conversion.Rate.Float64 != 5.4321 {
+		t.Errorf("Rate = %+v, want 5.4321", conversion.Rate)
+	}
+	if conversion.Amounts[0].Float64 != 54.32 {
+		t.Errorf("Amounts[0] = %v, want 54.32", conversion.Amounts[0].Float64)
+	}
+	if conversion.Amounts[1].Float64 != 0.05 {
+		t.Errorf("Amounts[1] = %v, want 0.05", conversion.Amounts[1].Float64)
+	}
+}
+
+func TestConvertMissingRate(t *testing.T) {
+	c := NewConverter("BRL", &fakeLookup{rates: map[string]float64{}})
+
+	conversion, err := c.Convert("EUR", time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Convert() returned error: %v", err)
+	}
+	if conversion.Rate.Valid {
+		t.Error("Rate should be NULL when no rate is available")
+	}
+	if conversion.Amounts[0].Valid {
+		t.Error("Amounts should be NULL when no rate is available")
+	}
+}
+
+func TestConvertLookupError(t *testing.T) {
+	c := NewConverter("BRL", &fakeLookup{err: errors.New("boom")})
+
+	if _, err := c.Convert("EUR", time.Now(), 10); err == nil {
+		t.Error("Convert() should return the lookup error")
+	}
+}
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return path
+}
+
+func TestLoadRatesFileCSV(t *testing.T) {
+	path := writeTempFile(t, "rates.csv", "currency,base_currency,rate,date,source\nusd,BRL,5.4321,2024-01-31,bcb-ptax\nEUR,,5.9,2024-01-31,\n")
+
+	rates, err := LoadRatesFile(path, "BRL")
+	if err != nil {
+		t.Fatalf("LoadRatesFile() returned error: %v", err)
+	}
+	if len(rates) != 2 {
+		t.Fatalf("LoadRatesFile() returned %d rates, want 2", len(rates))
+	}
+
+	if rates[0].CurrencyCode != "USD" || rates[0].BaseCurrencyCode != "BRL" || rates[0].Rate != 5.4321 {
+		t.Errorf("rates[0] = %+v", rates[0])
+	}
+	if !rates[0].RateDate.Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("rates[0].RateDate = %v, want 2024-01-31", rates[0].RateDate)
+	}
+	if !rates[0].Source.Valid || rates[0].Source.String != "bcb-ptax" {
+		t.Errorf("rates[0].Source = %+v, want bcb-ptax", rates[0].Source)
+	}
+
+	if rates[1].BaseCurrencyCode != "BRL" {
+		t.Errorf("rates[1].BaseCurrencyCode = %s, want default BRL", rates[1].BaseCurrencyCode)
+	}
+	if rates[1].Source.Valid {
+		t.Errorf("rates[1].Source should be NULL")
+	}
+}
+
+func TestLoadRatesFileJSON(t *testing.T) {
+	path := writeTempFile(t, "rates.json", `[{"currency": "USD", "rate": 5.1, "date": "2024-02-29"}]`)
+
+	rates, err := LoadRatesFile(path, "brl")
+	if err != nil {
+		t.Fatalf("LoadRatesFile() returned error: %v", err)
+	}
+	if len(rates) != 1 {
+		t.Fatalf("LoadRatesFile() returned %d rates, want 1", len(rates))
+	}
+	if rates[0].CurrencyCode != "USD" || rates[0].BaseCurrencyCode != "BRL" || rates[0].Rate != 5.1 {
+		t.Errorf("rates[0] = %+v", rates[0])
+	}
+}
+
+func TestLoadRatesFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"unsupported extension", "rates.txt", "USD,BRL,5,2024-01-01"},
+		{"missing column", "rates.csv", "currency,rate\nUSD,5\n"},
+		{"invalid rate", "rates.csv", "currency,rate,date\nUSD,abc,2024-01-01\n"},
+		{"non-positive rate", "rates.csv", "currency,rate,date\nUSD,0,2024-01-01\n"},
+		{"invalid code", "rates.csv", "currency,rate,date\nDOLLAR,5,2024-01-01\n"},
+		{"invalid date", "rates.json", `[{"currency": "USD", "rate": 5, "date": "01/01/2024"}]`},
+		{"malformed json", "rates.json", `{"currency": "USD"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempFile(t, tt.file, tt.content)
+			if _, err := LoadRatesFile(path, "BRL"); err == nil {
+				t.Errorf("LoadRatesFile() should return error for %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestLoadRatesFileMissing(t *testing.T) {
+	if _, err := LoadRatesFile(filepath.Join(t.TempDir(), "missing.csv"), "BRL"); err == nil {
+		t.Error("LoadRatesFile() should return error for a missing file")
+	}
+}
@@ -1,6 +1,7 @@
 package mariadb
 
 import (
+	"database/sql"
 	"testing"
 
 	"github.com/porcool/ingestion/internal/config"
@@ -76,3 +77,27 @@ func TestConnection_DB(t *testing.T) {
 		t.Error("DB() should return nil for nil connection")
 	}
 }
+
+func TestConnectionForReporting(t *testing.T) {
+	primary, replica := &sql.DB{}, &sql.DB{}
+
+	conn := &Connection{db: primary}
+	if conn.ForReporting().readDB() != primary {
+		t.Error("readDB() without a replica should return the primary")
+	}
+
+	conn.replica = replica
+	if conn.readDB() != primary {
+		t.Error("readDB() should return the primary outside reporting")
+	}
+	view := conn.ForReporting()
+	if view.readDB() != replica {
+		t.Error("readDB() of the reporting view should return the replica")
+	}
+	if view.db != primary {
+		t.Error("the reporting view should still write to the primary")
+	}
+	if conn.reporting {
+		t.Error("ForReporting() should not change the original connection")
+	}
+}
@@ -0,0 +1,236 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// DomainPolicy decides what happens to values that are not in the domain table
+type DomainPolicy string
+
+// Unknown domain value policies
+const (
+	// DomainPolicyCreate inserts the unknown value as a new domain
+	DomainPolicyCreate DomainPolicy = "create"
+	// DomainPolicyReject rejects the document holding the unknown value
+	DomainPolicyReject DomainPolicy = "reject"
+	// DomainPolicyFallback maps the unknown value to the configured fallback for its source and type
+	DomainPolicyFallback DomainPolicy = "fallback"
+)
+
+// missRefreshCooldown is the minimum time between refreshes triggered by cache misses
+const missRefreshCooldown = 10 * time.Second
+
+// ErrUnknownDomain is returned when a value is not a known domain and the policy rejects it
+var ErrUnknownDomain = errors.New("unknown domain value")
+
+// UnknownDomainError describes a domain value rejected by the unknown-value policy
+type UnknownDomainError struct {
+	Name   string
+	Type   string
+	Source string
+}
+
+// Error implements the error interface
+func (e *UnknownDomainError) Error() string {
+	return fmt.Sprintf("unknown domain value %q for %s.%s", e.Name, e.Source, e.Type)
+}
+
+// Is makes errors.Is(err, ErrUnknownDomain) match
+func (e *UnknownDomainError) Is(target error) bool {
+	return target == ErrUnknownDomain
+}
+
+// domainKey identifies a domain value
+type domainKey struct {
+	source     string
+	domainType string
+	name       string
+}
+
+// DomainRegistry keeps the domain table in memory and resolves values to domain IDs
+// applying the configured policy for unknown values
+type DomainRegistry struct {
+	conn      *Connection
+	policy    DomainPolicy
+	fallbacks map[string]string
+	createdBy string
+
+	mu          sync.RWMutex
+	ids         map[domainKey]int64
+	lastRefresh time.Time
+}
+
+// NewDomainRegistry creates a new DomainRegistry. The domain table is loaded on first use.
+func NewDomainRegistry(conn *Connection, cfg config.DomainsConfig, createdBy string) *DomainRegistry {
+	policy := DomainPolicy(cfg.UnknownPolicy)
+	if policy == "" {
+		policy = DomainPolicyReject
+	}
+
+	return &DomainRegistry{
+		conn:      conn,
+		policy:    policy,
+		fallbacks: cfg.Fallbacks,
+		createdBy: createdBy,
+		ids:       make(map[domainKey]int64),
+	}
+}
+
+// Policy returns the unknown-value policy
+func (r *DomainRegistry) Policy() DomainPolicy {
+	return r.policy
+}
+
+// Refresh reloads the whole domain table into memory
+func (r *DomainRegistry) Refresh() error {
+	rows, err := r.conn.db.Query("SELECT id, name, type, source FROM domain")
+	if err != nil {
+		return fmt.Errorf("failed to load domains: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[domainKey]int64)
+	for rows.Next() {
+		var id int64
+		var key domainKey
+		if err := rows.Scan(&id, &key.name, &key.domainType, &key.source); err != nil {
+			return fmt.Errorf("failed to scan domain: %w", err)
+		}
+		ids[key] = id
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load domains: %w", err)
+	}
+
+	r.mu.Lock()
+	r.ids = ids
+	r.lastRefresh = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// StartAutoRefresh refreshes the registry on the given interval until the context is done
+func (r *DomainRegistry) StartAutoRefresh(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Refresh(); err != nil {
+					log.Printf("Warning: Failed to refresh domain registry: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Lookup returns the ID of a known domain value. A miss triggers a refresh, at most once
+// per cooldown, so values added by other services are picked up without a restart.
+func (r *DomainRegistry) Lookup(name, domainType, source string) (int64, bool, error) {
+	key := domainKey{source: source, domainType: domainType, name: name}
+
+	r.mu.RLock()
+	id, ok := r.ids[key]
+	stale := time.Since(r.lastRefresh) >= missRefreshCooldown
+	r.mu.RUnlock()
+
+	if ok || !stale {
+		return id, ok, nil
+	}
+
+	if err := r.Refresh(); err != nil {
+		return 0, false, err
+	}
+
+	r.mu.RLock()
+	id, ok = r.ids[key]
+	r.mu.RUnlock()
+
+	return id, ok, nil
+}
+
+// Resolve returns the domain ID for a value, applying the unknown-value policy when the value
+// is not in the domain table. Empty values resolve to NULL. Rejected values return an
+// *UnknownDomainError.
+func (r *DomainRegistry) Resolve(name, domainType, source string) (sql.NullInt64, error) {
+	if name == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	id, ok, err := r.Lookup(name, domainType, source)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	if ok {
+		return sql.NullInt64{Int64: id, Valid: true}, nil
+	}
+
+	switch r.policy {
+	case DomainPolicyCreate:
+		id, err := r.create(name, domainType, source)
+		if err != nil {
+			return sql.NullInt64{}, err
+		}
+		return sql.NullInt64{Int64: id, Valid: true}, nil
+
+	case DomainPolicyFallback:
+		fallback, ok := r.fallbacks[source+"."+domainType]
+		if !ok {
+			log.Printf("Warning: Unknown domain value %q for %s.%s has no fallback, storing NULL", name, source, domainType)
+			return sql.NullInt64{}, nil
+		}
+		id, ok, err := r.Lookup(fallback, domainType, source)
+		if err != nil {
+			return sql.NullInt64{}, err
+		}
+		if !ok {
+			return sql.NullInt64{}, fmt.Errorf("fallback domain value %q for %s.%s does not exist", fallback, source, domainType)
+		}
+		log.Printf("Mapped unknown domain value %q for %s.%s to fallback %q", name, source, domainType, fallback)
+		return sql.NullInt64{Int64: id, Valid: true}, nil
+
+	default:
+		return sql.NullInt64{}, &UnknownDomainError{Name: name, Type: domainType, Source: source}
+	}
+}
+
+// create inserts a new domain value and adds it to the cache
+func (r *DomainRegistry) create(name, domainType, source string) (int64, error) {
+	_, err := r.conn.db.Exec(
+		"INSERT IGNORE INTO domain (guid, name, type, source, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?)",
+		GenerateGUID(), name, domainType, source, time.Now(), r.createdBy,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create domain: %w", err)
+	}
+
+	// Another instance may have created the same value first, so read the ID back
+	id, err := r.conn.GetDomainID(name, domainType, source)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	r.ids[domainKey{source: source, domainType: domainType, name: name}] = id
+	r.mu.Unlock()
+
+	log.Printf("Auto-created domain %q for %s.%s (ID: %d, created_by: %s)", name, source, domainType, id, r.createdBy)
+	return id, nil
+}
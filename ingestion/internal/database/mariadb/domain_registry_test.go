@@ -0,0 +1,94 @@
+package mariadb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// newCachedRegistry returns a registry with a warm cache that will not refresh on a miss
+func newCachedRegistry(policy string, fallbacks map[string]string) *DomainRegistry {
+	r := NewDomainRegistry(&Connection{db: nil}, config.DomainsConfig{UnknownPolicy: policy, Fallbacks: fallbacks}, "test-service")
+	r.ids[domainKey{source: "expense", domainType: "id_status", name: "pending"}] = 1
+	r.ids[domainKey{source: "expense", domainType: "id_status", name: "paid"}] = 3
+	r.lastRefresh = time.Now()
+	return r
+}
+
+func TestNewDomainRegistry(t *testing.T) {
+	conn := &Connection{db: nil}
+	r := NewDomainRegistry(conn, config.DomainsConfig{}, "test-service")
+
+	if r.conn != conn {
+		t.Error("NewDomainRegistry() didn't set connection correctly")
+	}
+	if r.Policy() != DomainPolicyReject {
+		t.Errorf("Policy() = %s, want reject by default", r.Policy())
+	}
+	if r.createdBy != "test-service" {
+		t.Errorf("createdBy = %s, want test-service", r.createdBy)
+	}
+}
+
+func TestDomainRegistryResolveKnown(t *testing.T) {
+	r := newCachedRegistry("reject", nil)
+
+	id, err := r.Resolve("paid", "id_status", "expense")
+	if err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+	if !id.Valid || id.Int64 != 3 {
+		t.Errorf("Resolve() = %+v, want 3", id)
+	}
+}
+
+func TestDomainRegistryResolveEmpty(t *testing.T) {
+	r := newCachedRegistry("reject", nil)
+
+	id, err := r.Resolve("", "id_status", "expense")
+	if err != nil || id.Valid {
+		t.Errorf("Resolve(\"\") = %+v, %v, want NULL and no error", id, err)
+	}
+}
+
+func TestDomainRegistryResolveReject(t *testing.T) {
+	r := newCachedRegistry("reject", nil)
+
+	_, err := r.Resolve("overdue", "id_status", "expense")
+	if !errors.Is(err, ErrUnknownDomain) {
+		t.Fatalf("Resolve() error = %v, want ErrUnknownDomain", err)
+	}
+
+	var unknown *UnknownDomainError
+	if !errors.As(err, &unknown) || unknown.Name != "overdue" || unknown.Source != "expense" || unknown.Type != "id_status" {
+		t.Errorf("Resolve() error = %#v, want UnknownDomainError for overdue", err)
+	}
+}
+
+func TestDomainRegistryResolveFallback(t *testing.T) {
+	r := newCachedRegistry("fallback", map[string]string{"expense.id_status": "pending"})
+
+	id, err := r.Resolve("overdue", "id_status", "expense")
+	if err != nil {
+		t.Fatalf("Resolve() returned error: %v", err)
+	}
+	if !id.Valid || id.Int64 != 1 {
+		t.Errorf("Resolve() = %+v, want fallback pending (1)", id)
+	}
+
+	// Without a configured fallback the value is stored as NULL
+	id, err = r.Resolve("weekly", "id_type", "expense")
+	if err != nil || id.Valid {
+		t.Errorf("Resolve() without fallback = %+v, %v, want NULL and no error", id, err)
+	}
+}
+
+func TestDomainRegistryResolveMissingFallbackValue(t *testing.T) {
+	r := newCachedRegistry("fallback", map[string]string{"expense.id_status": "unknown"})
+
+	if _, err := r.Resolve("overdue", "id_status", "expense"); err == nil {
+		t.Error("Resolve() should return error when the fallback value does not exist")
+	}
+}
@@ -0,0 +1,210 @@
+package mariadb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/porcool/ingestion/internal/fieldcrypt"
+)
+
+// encrypt returns the stored form of a PII column value under the connection's cipher
+func (c *Connection) encrypt(table, column, value string) (string, error) {
+	return c.cipher.Encrypt(table, column, value)
+}
+
+// encryptNull is encrypt for nullable columns
+func (c *Connection) encryptNull(table, column string, value sql.NullString) (sql.NullString, error) {
+	if !value.Valid {
+		return value, nil
+	}
+	encrypted, err := c.encrypt(table, column, value.String)
+	return sql.NullString{String: encrypted, Valid: true}, err
+}
+
+// decrypt returns the plaintext of a stored PII column value
+func (c *Connection) decrypt(table, column, value string) (string, error) {
+	return c.cipher.Decrypt(table, column, value)
+}
+
+// decryptNull is decrypt for nullable columns
+func (c *Connection) decryptNull(table, column string, value sql.NullString) (sql.NullString, error) {
+	if !value.Valid {
+		return value, nil
+	}
+	decrypted, err := c.decrypt(table, column, value.String)
+	return sql.NullString{String: decrypted, Valid: true}, err
+}
+
+// emailIndex returns the blind index stored in user.email_bidx, NULL without a cipher
+func (c *Connection) emailIndex(email string) sql.NullString {
+	bidx := c.cipher.BlindIndex("user", "email", email)
+	return sql.NullString{String: bidx, Valid: bidx != ""}
+}
+
+// encryptedTables returns the tables with PII columns, in the order of
+// fieldcrypt.SupportedColumns, and their columns
+func encryptedTables() ([]string, map[string][]string) {
+	var tables []string
+	columns := make(map[string][]string)
+	for _, name := range fieldcrypt.SupportedColumns {
+		table, column, _ := strings.Cut(name, ".")
+		if _, ok := columns[table]; !ok {
+			tables = append(tables, table)
+		}
+		columns[table] = append(columns[table], column)
+	}
+	return tables, columns
+}
+
+// EncryptionRepository rewrites PII columns after the key or the encrypted columns change
+type EncryptionRepository struct {
+	conn *Connection
+}
+
+// NewEncryptionRepository creates a new EncryptionRepository
+func NewEncryptionRepository(conn *Connection) *EncryptionRepository {
+	return &EncryptionRepository{conn: conn}
+}
+
+// ReencryptResult counts the rows of one re-encryption batch
+type ReencryptResult struct {
+	Scanned int
+	Changed int
+	// LastID is the id of the last scanned row, to continue from in the next batch
+	LastID int64
+}
+
+// ActiveKeyID returns the ID of the key values are re-encrypted with, empty when field
+// encryption is disabled
+func (r *EncryptionRepository) ActiveKeyID() string {
+	return r.conn.cipher.ActiveKeyID()
+}
+
+// EncryptedTables returns the tables ReencryptBatch rewrites
+func (r *EncryptionRepository) EncryptedTables() []string {
+	tables, _ := encryptedTables()
+	return tables
+}
+
+// ReencryptBatch rewrites the PII columns of up to limit rows of table with an id above
+// afterID, so each holds what the current configuration would write: values under the
+// active key for encrypted columns, plaintext for the others. user.email_bidx is recomputed
+// too. With dryRun the rows are only counted.
+func (r *EncryptionRepository) ReencryptBatch(table string, afterID int64, limit int, dryRun bool) (ReencryptResult, error) {
+	var result ReencryptResult
+
+	_, byTable := encryptedTables()
+	columns, ok := byTable[table]
+	if !ok {
+		return result, fmt.Errorf("table %s has no encrypted columns", table)
+	}
+	selected := columns
+	if table == "user" {
+		selected = append(append([]string{}, columns...), "email_bidx")
+	}
+
+	rows, err := r.conn.db.Query(
+		"SELECT id, "+strings.Join(selected, ", ")+" FROM "+table+" WHERE id > ? ORDER BY id LIMIT ?",
+		afterID, limit,
+	)
+	if err != nil {
+		return result, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+
+	type update struct {
+		id     int64
+		values []interface{}
+	}
+	var updates []update
+	for rows.Next() {
+		var id int64
+		stored := make([]sql.NullString, len(selected))
+		dest := []interface{}{&id}
+		for i := range stored {
+			dest = append(dest, &stored[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return result, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		result.Scanned++
+		result.LastID = id
+
+		values, changed, err := r.rewriteRow(table, columns, stored)
+		if err != nil {
+			rows.Close()
+			return result, fmt.Errorf("%s %d: %w", table, id, err)
+		}
+		if changed {
+			updates = append(updates, update{id: id, values: values})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return result, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	rows.Close()
+
+	result.Changed = len(updates)
+	if dryRun {
+		return result, nil
+	}
+
+	assignments := make([]string, len(selected))
+	for i, column := range selected {
+		assignments[i] = column + " = ?"
+	}
+	query := "UPDATE " + table + " SET " + strings.Join(assignments, ", ") + ", updated_at = ?, updated_by = ? WHERE id = ?"
+	if table == "user_email_conflict" {
+		// The audit table is append-only and has no update audit fields
+		query = "UPDATE " + table + " SET " + strings.Join(assignments, ", ") + " WHERE id = ?"
+	}
+
+	for _, u := range updates {
+		args := u.values
+		if table != "user_email_conflict" {
+			args = append(args, time.Now(), ServiceName)
+		}
+		if _, err := r.conn.db.Exec(query, append(args, u.id)...); err != nil {
+			return result, fmt.Errorf("failed to re-encrypt %s %d: %w", table, u.id, err)
+		}
+	}
+	return result, nil
+}
+
+// rewriteRow returns the new values of a row's selected columns and whether any changed.
+// stored holds the PII columns followed, for user, by email_bidx.
+func (r *EncryptionRepository) rewriteRow(table string, columns []string, stored []sql.NullString) ([]interface{}, bool, error) {
+	values := make([]interface{}, len(stored))
+	changedAny := false
+
+	for i, column := range columns {
+		values[i] = stored[i]
+		if !stored[i].Valid {
+			continue
+		}
+		rewritten, changed, err := r.conn.cipher.Reencrypt(table, column, stored[i].String)
+		if err != nil {
+			return nil, false, err
+		}
+		if changed {
+			values[i] = sql.NullString{String: rewritten, Valid: true}
+			changedAny = true
+		}
+
+		if table == "user" && column == "email" {
+			email, err := r.conn.decrypt(table, column, stored[i].String)
+			if err != nil {
+				return nil, false, err
+			}
+			bidx := r.conn.emailIndex(email)
+			values[len(columns)] = bidx
+			if bidx != stored[len(columns)] {
+				changedAny = true
+			}
+		}
+	}
+	return values, changedAny, nil
+}
@@ -0,0 +1,105 @@
+package mariadb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/fieldcrypt"
+)
+
+// testCipher returns a cipher encrypting the given columns with a throwaway key
+func testCipher(t *testing.T, columns ...string) *fieldcrypt.Cipher {
+	t.Helper()
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"active_key_id": "k1", "keys": {"k1": "` + key + `"}, "index_key": "` + key + `"}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cipher, err := fieldcrypt.New(config.EncryptionConfig{Enabled: true, KeyFile: path, Columns: columns})
+	if err != nil {
+		t.Fatalf("fieldcrypt.New() error = %v", err)
+	}
+	return cipher
+}
+
+func TestNewEncryptionRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewEncryptionRepository(conn)
+
+	if repo == nil {
+		t.Error("NewEncryptionRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewEncryptionRepository() didn't set connection correctly")
+	}
+}
+
+func TestEncryptedTables(t *testing.T) {
+	tables, columns := encryptedTables()
+
+	wantTables := []string{"user", "user_email_conflict", "expense_automatic_workflow", "expense_automatic_workflow_pre_saved_description"}
+	if !reflect.DeepEqual(tables, wantTables) {
+		t.Errorf("encryptedTables() tables = %v, want %v", tables, wantTables)
+	}
+	if want := []string{"email", "first_name", "last_name"}; !reflect.DeepEqual(columns["user"], want) {
+		t.Errorf("encryptedTables() user columns = %v, want %v", columns["user"], want)
+	}
+}
+
+func TestConnectionEncryptWithoutCipher(t *testing.T) {
+	conn := &Connection{}
+
+	if got, _ := conn.encrypt("user", "email", "ana@example.com"); got != "ana@example.com" {
+		t.Errorf("encrypt() = %q, want plaintext without a cipher", got)
+	}
+	if got := conn.emailIndex("ana@example.com"); got.Valid {
+		t.Errorf("emailIndex() = %v, want NULL without a cipher", got)
+	}
+}
+
+func TestRewriteRow(t *testing.T) {
+	conn := &Connection{}
+	conn.SetCipher(testCipher(t, "user.email", "user.first_name"))
+	repo := NewEncryptionRepository(conn)
+
+	columns := []string{"email", "first_name", "last_name"}
+	stored := []sql.NullString{
+		{String: "ana@example.com", Valid: true},
+		{String: "Ana", Valid: true},
+		{},
+		{},
+	}
+
+	values, changed, err := repo.rewriteRow("user", columns, stored)
+	if err != nil || !changed {
+		t.Fatalf("rewriteRow() changed = %v, error = %v, want plaintext encrypted", changed, err)
+	}
+
+	email := values[0].(sql.NullString)
+	if !fieldcrypt.IsEncrypted(email.String) {
+		t.Errorf("email = %q, want it encrypted", email.String)
+	}
+	if values[2].(sql.NullString).Valid {
+		t.Error("a NULL last_name must stay NULL")
+	}
+	if bidx := values[3].(sql.NullString); bidx != conn.emailIndex("ana@example.com") {
+		t.Errorf("email_bidx = %v, want the blind index of the email", bidx)
+	}
+
+	rewritten := make([]sql.NullString, len(values))
+	for i, v := range values {
+		rewritten[i] = v.(sql.NullString)
+	}
+	if _, changed, _ := repo.rewriteRow("user", columns, rewritten); changed {
+		t.Error("rewriteRow() changed a row already under the active key")
+	}
+}
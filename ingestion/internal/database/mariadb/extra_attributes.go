@@ -0,0 +1,54 @@
+package mariadb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// extraAttributesTables are the tables with an extra_attributes column: the tables synced
+// one row per MongoDB document, keyed by source_id, except user. Unknown user fields may be
+// personal data, which would be stored as plaintext whether or not field encryption is on.
+var extraAttributesTables = []string{
+	"financial_institution",
+	"expense",
+	"additional_balance",
+	"balance_history",
+	"expense_automatic_workflow",
+	"expense_automatic_workflow_pre_saved_description",
+	"service_payment",
+}
+
+// ExtraAttributesRepository stores the MongoDB fields of synced rows that no column holds
+type ExtraAttributesRepository struct {
+	conn *Connection
+}
+
+// NewExtraAttributesRepository creates a new ExtraAttributesRepository
+func NewExtraAttributesRepository(conn *Connection) *ExtraAttributesRepository {
+	return &ExtraAttributesRepository{conn: conn}
+}
+
+// SetExtraAttributes stores the extra attributes JSON of the row synced from a document. An
+// empty JSON clears them.
+func (r *ExtraAttributesRepository) SetExtraAttributes(table, sourceID, attributes string) error {
+	if !HasExtraAttributes(table) {
+		return fmt.Errorf("table %s has no extra attributes", table)
+	}
+
+	value := sql.NullString{String: attributes, Valid: attributes != ""}
+	_, err := r.conn.db.Exec("UPDATE "+table+" SET extra_attributes = ? WHERE source_id = ?", value, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to set extra attributes of %s %s: %w", table, sourceID, err)
+	}
+	return nil
+}
+
+// HasExtraAttributes reports whether a table has an extra_attributes column
+func HasExtraAttributes(table string) bool {
+	for _, t := range extraAttributesTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
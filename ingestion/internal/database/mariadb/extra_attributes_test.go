@@ -0,0 +1,41 @@
+package mariadb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewExtraAttributesRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewExtraAttributesRepository(conn)
+
+	if repo == nil {
+		t.Error("NewExtraAttributesRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewExtraAttributesRepository() didn't set connection correctly")
+	}
+}
+
+func TestHasExtraAttributes(t *testing.T) {
+	for _, table := range []string{"financial_institution", "expense", "service_payment"} {
+		if !HasExtraAttributes(table) {
+			t.Errorf("HasExtraAttributes(%q) = false, want true", table)
+		}
+	}
+	for _, table := range []string{"", "user", "domain", "user_history", "expense; DROP TABLE user"} {
+		if HasExtraAttributes(table) {
+			t.Errorf("HasExtraAttributes(%q) = true, want false", table)
+		}
+	}
+}
+
+func TestSetExtraAttributesRejectsUnknownTable(t *testing.T) {
+	repo := NewExtraAttributesRepository(&Connection{db: nil})
+
+	err := repo.SetExtraAttributes("domain", "doc-1", `{"a":1}`)
+	if err == nil || !strings.Contains(err.Error(), "no extra attributes") {
+		t.Errorf("SetExtraAttributes() error = %v, want no extra attributes error", err)
+	}
+}
@@ -0,0 +1,471 @@
+package mariadb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the numbered migrations, <version>_<name>.up.sql and
+// <version>_<name>.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockTimeout is how long, in seconds, a replica waits for another one to finish
+// migrating
+const migrationLockTimeout = 300
+
+// schemaMigrationsTable records the applied migrations
+const schemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`
+
+// migrationFileName matches migration file names: version, name and direction
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change with the SQL applying and reverting it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the hex SHA-256 of Up, recorded in schema_migrations when it is applied
+	Checksum string
+}
+
+// AppliedMigration is a migration recorded in schema_migrations
+type AppliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// MigrationStep is a migration applied, or reverted when Revert is set
+type MigrationStep struct {
+	Migration
+	Revert bool
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+// loadMigrations reads the migrations in a directory. Every version needs both an up and a
+// down file with the same name.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s, want <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements splits a migration file into statements. A statement ends with a line
+// ending in a semicolon; comment lines are dropped.
+func splitStatements(sql string) []string {
+	var statements []string
+	var current []string
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, strings.TrimRight(line, " \t\r"))
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.Join(current, "\n")
+			statements = append(statements, strings.TrimSuffix(statement, ";"))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		statements = append(statements, strings.Join(current, "\n"))
+	}
+	return statements
+}
+
+// MigrationState is a migration and whether it is applied
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the up file no longer matches the checksum recorded when the
+	// migration was applied
+	Modified bool
+	// NoFile is set for applied migrations this release has no file for, applied by a
+	// newer release
+	NoFile bool
+}
+
+// RunMigrations applies every pending migration in version order
+func (c *Connection) RunMigrations() error {
+	steps, err := c.MigrateUp(context.Background())
+	for _, step := range steps {
+		log.Printf("Applied migration %d_%s", step.Version, step.Name)
+	}
+	return err
+}
+
+// MigrationStatus lists every migration, known or applied, in version order
+func (c *Connection) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, schemaMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(migrations, applied), nil
+}
+
+// CheckMigrations fails when migrations are pending or an applied migration was modified,
+// for a service that does not migrate at startup
+func (c *Connection) CheckMigrations(ctx context.Context) error {
+	states, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, state := range states {
+		if state.Modified {
+			return fmt.Errorf("migration %d_%s was modified after it was applied", state.Version, state.Name)
+		}
+		if !state.Applied {
+			pending = append(pending, fmt.Sprintf("%d_%s", state.Version, state.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations: %s", len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration in version order. Migrations applied by a newer
+// release are left alone.
+func (c *Connection) MigrateUp(ctx context.Context) ([]MigrationStep, error) {
+	return c.migrate(ctx, func(migrations []Migration, applied map[int64]AppliedMigration) ([]MigrationStep, error) {
+		var steps []MigrationStep
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; !ok {
+				steps = append(steps, MigrationStep{Migration: m})
+			}
+		}
+		return steps, nil
+	})
+}
+
+// MigrateDown reverts the n most recently applied migrations, newest first
+func (c *Connection) MigrateDown(ctx context.Context, n int) ([]MigrationStep, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of migrations to revert: %d", n)
+	}
+	return c.migrate(ctx, func(migrations []Migration, applied map[int64]AppliedMigration) ([]MigrationStep, error) {
+		return planMigrations(migrations, applied, downTarget(applied, n))
+	})
+}
+
+// MigrateTo brings the schema to a version: pending migrations up to it are applied in
+// version order, and applied migrations above it are reverted newest first. Version 0
+// reverts every migration.
+func (c *Connection) MigrateTo(ctx context.Context, version int64) ([]MigrationStep, error) {
+	return c.migrate(ctx, func(migrations []Migration, applied map[int64]AppliedMigration) ([]MigrationStep, error) {
+		return planMigrations(migrations, applied, version)
+	})
+}
+
+// Baseline records the migrations up to a version as applied without running them, for a
+// database whose schema already matches them
+func (c *Connection) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := planMigrations(migrations, nil, version); err != nil {
+		return nil, err
+	}
+
+	var recorded []Migration
+	err = c.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok || m.Version > version {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+				m.Version, m.Name, m.Checksum); err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			recorded = append(recorded, m)
+		}
+		return nil
+	})
+	return recorded, err
+}
+
+// migrate runs the steps a plan returns for the applied migrations. It holds a MariaDB
+// advisory lock, so replicas starting together migrate one at a time, and stops before
+// changing anything when an applied migration no longer matches its file. The steps taken
+// are returned, also on error.
+func (c *Connection) migrate(ctx context.Context, plan func([]Migration, map[int64]AppliedMigration) ([]MigrationStep, error)) ([]MigrationStep, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []MigrationStep
+	err = c.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verifyChecksums(migrations, applied); err != nil {
+			return err
+		}
+		planned, err := plan(migrations, applied)
+		if err != nil {
+			return err
+		}
+
+		for _, step := range planned {
+			if err := runMigrationStep(ctx, conn, step); err != nil {
+				return err
+			}
+			steps = append(steps, step)
+		}
+		return nil
+	})
+	return steps, err
+}
+
+// migrationStates merges the known and the applied migrations in version order
+func migrationStates(migrations []Migration, applied map[int64]AppliedMigration) []MigrationState {
+	var states []MigrationState
+	known := make(map[int64]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			state.Applied, state.AppliedAt = true, a.AppliedAt
+			state.Modified = a.Checksum != m.Checksum
+		}
+		states = append(states, state)
+	}
+	for _, a := range applied {
+		if !known[a.Version] {
+			states = append(states, MigrationState{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, NoFile: true})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states
+}
+
+// downTarget returns the version left current after reverting the n most recently applied
+// migrations
+func downTarget(applied map[int64]AppliedMigration, n int) int64 {
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if n >= len(versions) {
+		return 0
+	}
+	return versions[n]
+}
+
+// planMigrations returns the steps bringing the applied migrations to a version
+func planMigrations(migrations []Migration, applied map[int64]AppliedMigration, version int64) ([]MigrationStep, error) {
+	known := make(map[int64]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	if _, ok := known[version]; !ok && version != 0 {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	var steps []MigrationStep
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok && m.Version <= version {
+			steps = append(steps, MigrationStep{Migration: m})
+		}
+	}
+
+	var reverted []int64
+	for v := range applied {
+		if v > version {
+			reverted = append(reverted, v)
+		}
+	}
+	sort.Slice(reverted, func(i, j int) bool { return reverted[i] > reverted[j] })
+	for _, v := range reverted {
+		m, ok := known[v]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %d_%s has no file to revert it with", v, applied[v].Name)
+		}
+		steps = append(steps, MigrationStep{Migration: m, Revert: true})
+	}
+	return steps, nil
+}
+
+// verifyChecksums fails when an applied migration's file changed after it was applied.
+// Applied migrations without a file, written by a newer release, are left alone.
+func verifyChecksums(migrations []Migration, applied map[int64]AppliedMigration) error {
+	for _, m := range migrations {
+		a, ok := applied[m.Version]
+		if ok && a.Checksum != m.Checksum {
+			return fmt.Errorf("migration %d_%s was modified after it was applied (checksum %s, file %s); add a new migration instead",
+				m.Version, m.Name, a.Checksum, m.Checksum)
+		}
+	}
+	return nil
+}
+
+// runMigrationStep runs the statements of a migration in one direction and records it.
+// MariaDB commits DDL statements one by one, so a failing migration can be left half
+// applied and is not recorded.
+func runMigrationStep(ctx context.Context, conn *sql.Conn, step MigrationStep) error {
+	script := step.Up
+	if step.Revert {
+		script = step.Down
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to run migration %d_%s: %w\nSQL: %s", step.Version, step.Name, err, statement)
+		}
+	}
+
+	var err error
+	if step.Revert {
+		_, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", step.Version)
+	} else {
+		_, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+			step.Version, step.Name, step.Checksum)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", step.Version, step.Name, err)
+	}
+	return nil
+}
+
+// appliedMigrations reads schema_migrations by version
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]AppliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]AppliedMigration)
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[a.Version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// withMigrationLock runs fn on a connection holding the database's migration lock, after
+// creating schema_migrations if needed. GET_LOCK locks are held by a session, so every
+// statement of fn must run on the connection it is given.
+func (c *Connection) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	lockName := "schema_migrations:" + c.cfg.Database
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, migrationLockTimeout).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("timed out after %ds waiting for migration lock %s", migrationLockTimeout, lockName)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	if _, err := conn.ExecContext(ctx, schemaMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
@@ -0,0 +1,12 @@
+-- Drops every table of the baseline, dependent tables first
+DROP TABLE IF EXISTS system_settings;
+DROP TABLE IF EXISTS service_payment;
+DROP TABLE IF EXISTS balance_history;
+DROP TABLE IF EXISTS additional_balance;
+DROP TABLE IF EXISTS expense_installment;
+DROP TABLE IF EXISTS expense;
+DROP TABLE IF EXISTS expense_automatic_workflow_pre_saved_description;
+DROP TABLE IF EXISTS expense_automatic_workflow;
+DROP TABLE IF EXISTS financial_institution;
+DROP TABLE IF EXISTS user;
+DROP TABLE IF EXISTS domain;
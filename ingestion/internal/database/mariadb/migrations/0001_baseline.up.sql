@@ -0,0 +1,220 @@
+-- Baseline: the schema the service started from, before the upgrades in the later
+-- versions. Tables are created only if missing, so databases created by earlier releases,
+-- which ran these statements on every start, are left as they are.
+
+-- Domain table
+CREATE TABLE IF NOT EXISTS domain (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	name VARCHAR(255) NOT NULL,
+	type VARCHAR(255) NOT NULL,
+	source VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_domain_type_source (type, source),
+	INDEX idx_domain_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- User table
+CREATE TABLE IF NOT EXISTS user (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	first_name VARCHAR(255) NOT NULL,
+	last_name VARCHAR(255),
+	email VARCHAR(255) NOT NULL UNIQUE,
+	fl_admin BOOLEAN NOT NULL DEFAULT FALSE,
+	monthly_income DECIMAL(15,2) NOT NULL DEFAULT 0,
+	fl_payment_requested BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_payment_pending BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_payment_paid BOOLEAN NOT NULL DEFAULT FALSE,
+	current_spending_date VARCHAR(7),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_user_email (email),
+	INDEX idx_user_source_id (source_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Financial institution table
+CREATE TABLE IF NOT EXISTS financial_institution (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	fl_credit_card BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_money_movement BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_investment BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_fi_user_id (user_id),
+	INDEX idx_fi_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Expense automatic workflow table
+CREATE TABLE IF NOT EXISTS expense_automatic_workflow (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	base64_image LONGTEXT,
+	description TEXT,
+	extracted_expense_content_from_image LONGTEXT,
+	spending_date__YYYY_MM VARCHAR(7),
+	sync_processed_date TIMESTAMP NULL,
+	id_sync_status BIGINT,
+	processing_message TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_eaw_user_id (user_id),
+	INDEX idx_eaw_sync_status (id_sync_status),
+	INDEX idx_eaw_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (id_sync_status) REFERENCES domain(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Expense automatic workflow pre-saved description table
+CREATE TABLE IF NOT EXISTS expense_automatic_workflow_pre_saved_description (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	description TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_eawpsd_user_id (user_id),
+	INDEX idx_eawpsd_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Expense table
+CREATE TABLE IF NOT EXISTS expense (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	spending_date__YYYY_MM VARCHAR(7) NOT NULL,
+	id_status BIGINT,
+	id_type BIGINT,
+	validity_period_date DATE,
+	fl_indeterminate_validity_period_date BOOLEAN NOT NULL DEFAULT FALSE,
+	name VARCHAR(255) NOT NULL,
+	total_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	total_paid_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_expense_user_id (user_id),
+	INDEX idx_expense_spending_date (spending_date__YYYY_MM),
+	INDEX idx_expense_status (id_status),
+	INDEX idx_expense_type (id_type),
+	INDEX idx_expense_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (id_status) REFERENCES domain(id),
+	FOREIGN KEY (id_type) REFERENCES domain(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Expense installment table
+CREATE TABLE IF NOT EXISTS expense_installment (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	expense_id BIGINT NOT NULL,
+	amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	paid_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	id_status BIGINT,
+	due_date DATE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_ei_expense_id (expense_id),
+	INDEX idx_ei_status (id_status),
+	INDEX idx_ei_due_date (due_date),
+	FOREIGN KEY (expense_id) REFERENCES expense(id) ON DELETE CASCADE,
+	FOREIGN KEY (id_status) REFERENCES domain(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Additional balance table
+CREATE TABLE IF NOT EXISTS additional_balance (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	spending_date__YYYY_MM VARCHAR(7) NOT NULL,
+	amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	description TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_ab_user_id (user_id),
+	INDEX idx_ab_spending_date (spending_date__YYYY_MM),
+	INDEX idx_ab_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Balance history table
+CREATE TABLE IF NOT EXISTS balance_history (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	spending_date__YYYY_MM VARCHAR(7) NOT NULL,
+	amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	last_month_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	monthly_income DECIMAL(15,2) NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_bh_user_id (user_id),
+	INDEX idx_bh_spending_date (spending_date__YYYY_MM),
+	INDEX idx_bh_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Service payment table
+CREATE TABLE IF NOT EXISTS service_payment (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	user_id BIGINT NOT NULL,
+	service_payment_date DATE NOT NULL,
+	service_payment_type_id BIGINT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_sp_user_id (user_id),
+	INDEX idx_sp_payment_date (service_payment_date),
+	INDEX idx_sp_source_id (source_id),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (service_payment_type_id) REFERENCES domain(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- System settings table
+CREATE TABLE IF NOT EXISTS system_settings (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	source_id VARCHAR(255) NOT NULL,
+	fl_block_user_registration BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_maintenance BOOLEAN NOT NULL DEFAULT FALSE,
+	json_sync_metadata JSON,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_ss_source_id (source_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
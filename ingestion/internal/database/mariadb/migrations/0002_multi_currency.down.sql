@@ -0,0 +1,20 @@
+ALTER TABLE balance_history
+	DROP COLUMN IF EXISTS monthly_income_base,
+	DROP COLUMN IF EXISTS last_month_amount_base,
+	DROP COLUMN IF EXISTS amount_base,
+	DROP COLUMN IF EXISTS exchange_rate,
+	DROP COLUMN IF EXISTS currency_code;
+ALTER TABLE additional_balance
+	DROP COLUMN IF EXISTS amount_base,
+	DROP COLUMN IF EXISTS exchange_rate,
+	DROP COLUMN IF EXISTS currency_code;
+ALTER TABLE expense_installment
+	DROP COLUMN IF EXISTS paid_amount_base,
+	DROP COLUMN IF EXISTS amount_base,
+	DROP COLUMN IF EXISTS exchange_rate;
+ALTER TABLE expense
+	DROP COLUMN IF EXISTS total_paid_amount_base,
+	DROP COLUMN IF EXISTS total_amount_base,
+	DROP COLUMN IF EXISTS exchange_rate,
+	DROP COLUMN IF EXISTS currency_code;
+DROP TABLE IF EXISTS exchange_rate;
@@ -0,0 +1,36 @@
+-- Exchange rate table
+CREATE TABLE IF NOT EXISTS exchange_rate (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	currency_code CHAR(3) NOT NULL,
+	base_currency_code CHAR(3) NOT NULL,
+	rate DECIMAL(18,8) NOT NULL,
+	rate_date DATE NOT NULL,
+	source VARCHAR(255),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	UNIQUE KEY uk_er_currency_base_date (currency_code, base_currency_code, rate_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Currency of the amounts and their conversion into the base currency
+ALTER TABLE expense
+	ADD COLUMN IF NOT EXISTS currency_code CHAR(3) AFTER total_paid_amount,
+	ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18,8) AFTER currency_code,
+	ADD COLUMN IF NOT EXISTS total_amount_base DECIMAL(15,2) AFTER exchange_rate,
+	ADD COLUMN IF NOT EXISTS total_paid_amount_base DECIMAL(15,2) AFTER total_amount_base;
+ALTER TABLE expense_installment
+	ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18,8) AFTER due_date,
+	ADD COLUMN IF NOT EXISTS amount_base DECIMAL(15,2) AFTER exchange_rate,
+	ADD COLUMN IF NOT EXISTS paid_amount_base DECIMAL(15,2) AFTER amount_base;
+ALTER TABLE additional_balance
+	ADD COLUMN IF NOT EXISTS currency_code CHAR(3) AFTER description,
+	ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18,8) AFTER currency_code,
+	ADD COLUMN IF NOT EXISTS amount_base DECIMAL(15,2) AFTER exchange_rate;
+ALTER TABLE balance_history
+	ADD COLUMN IF NOT EXISTS currency_code CHAR(3) AFTER monthly_income,
+	ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(18,8) AFTER currency_code,
+	ADD COLUMN IF NOT EXISTS amount_base DECIMAL(15,2) AFTER exchange_rate,
+	ADD COLUMN IF NOT EXISTS last_month_amount_base DECIMAL(15,2) AFTER amount_base,
+	ADD COLUMN IF NOT EXISTS monthly_income_base DECIMAL(15,2) AFTER last_month_amount_base;
@@ -0,0 +1,7 @@
+ALTER TABLE service_payment DROP FOREIGN KEY IF EXISTS fk_sp_status;
+ALTER TABLE service_payment
+	DROP INDEX IF EXISTS idx_sp_provider_transaction_id,
+	DROP COLUMN IF EXISTS service_payment_status_id,
+	DROP COLUMN IF EXISTS provider_transaction_id,
+	DROP COLUMN IF EXISTS currency_code,
+	DROP COLUMN IF EXISTS amount;
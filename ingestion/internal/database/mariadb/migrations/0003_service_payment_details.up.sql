@@ -0,0 +1,8 @@
+-- Payment details synced from the payments collection
+ALTER TABLE service_payment
+	ADD COLUMN IF NOT EXISTS amount DECIMAL(15,2) AFTER service_payment_type_id,
+	ADD COLUMN IF NOT EXISTS currency_code CHAR(3) AFTER amount,
+	ADD COLUMN IF NOT EXISTS provider_transaction_id VARCHAR(255) AFTER currency_code,
+	ADD COLUMN IF NOT EXISTS service_payment_status_id BIGINT AFTER provider_transaction_id,
+	ADD INDEX IF NOT EXISTS idx_sp_provider_transaction_id (provider_transaction_id),
+	ADD CONSTRAINT fk_sp_status FOREIGN KEY IF NOT EXISTS (service_payment_status_id) REFERENCES domain(id);
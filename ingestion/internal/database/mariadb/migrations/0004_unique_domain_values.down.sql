@@ -0,0 +1,2 @@
+-- Merged duplicates are not restored
+ALTER TABLE domain DROP INDEX IF EXISTS uk_domain_source_type_name;
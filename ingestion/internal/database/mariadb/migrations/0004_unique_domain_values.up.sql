@@ -0,0 +1,45 @@
+-- Unique domain values, so that auto-created domains cannot be duplicated by concurrent
+-- instances. Duplicates created before are merged into the oldest row of each value:
+-- references are repointed first, then the other rows are deleted.
+UPDATE expense r
+	JOIN domain d ON d.id = r.id_status
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+SET r.id_status = k.kept_id
+WHERE r.id_status <> k.kept_id;
+UPDATE expense r
+	JOIN domain d ON d.id = r.id_type
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+SET r.id_type = k.kept_id
+WHERE r.id_type <> k.kept_id;
+UPDATE expense_installment r
+	JOIN domain d ON d.id = r.id_status
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+SET r.id_status = k.kept_id
+WHERE r.id_status <> k.kept_id;
+UPDATE expense_automatic_workflow r
+	JOIN domain d ON d.id = r.id_sync_status
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+SET r.id_sync_status = k.kept_id
+WHERE r.id_sync_status <> k.kept_id;
+UPDATE service_payment r
+	JOIN domain d ON d.id = r.service_payment_type_id
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+SET r.service_payment_type_id = k.kept_id
+WHERE r.service_payment_type_id <> k.kept_id;
+UPDATE service_payment r
+	JOIN domain d ON d.id = r.service_payment_status_id
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+SET r.service_payment_status_id = k.kept_id
+WHERE r.service_payment_status_id <> k.kept_id;
+DELETE d FROM domain d
+	JOIN (SELECT source, type, name, MIN(id) AS kept_id FROM domain GROUP BY source, type, name HAVING COUNT(*) > 1) k
+		ON k.source = d.source AND k.type = d.type AND k.name = d.name
+WHERE d.id <> k.kept_id;
+ALTER TABLE domain
+	ADD UNIQUE KEY IF NOT EXISTS uk_domain_source_type_name (source, type, name);
@@ -0,0 +1,2 @@
+ALTER TABLE expense_automatic_workflow DROP COLUMN IF EXISTS fl_extracted_content_unparsed;
+DROP TABLE IF EXISTS expense_automatic_workflow_item;
@@ -0,0 +1,24 @@
+-- Expense automatic workflow item table (line items parsed from extracted_expense_content_from_image)
+CREATE TABLE IF NOT EXISTS expense_automatic_workflow_item (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	expense_automatic_workflow_id BIGINT NOT NULL,
+	position INT NOT NULL,
+	name VARCHAR(255),
+	amount DECIMAL(15,2),
+	currency_code CHAR(3),
+	item_date DATE,
+	confidence DECIMAL(5,4),
+	raw_text TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	INDEX idx_eawi_workflow_id (expense_automatic_workflow_id),
+	INDEX idx_eawi_item_date (item_date),
+	FOREIGN KEY (expense_automatic_workflow_id) REFERENCES expense_automatic_workflow(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Flags workflows whose extracted content could not be parsed into items
+ALTER TABLE expense_automatic_workflow
+	ADD COLUMN IF NOT EXISTS fl_extracted_content_unparsed BOOLEAN NOT NULL DEFAULT FALSE AFTER extracted_expense_content_from_image;
@@ -0,0 +1,6 @@
+-- Images already moved out of base64_image lose their reference
+ALTER TABLE expense_automatic_workflow
+	DROP INDEX IF EXISTS idx_eaw_image_sha256,
+	DROP COLUMN IF EXISTS image_size,
+	DROP COLUMN IF EXISTS image_mime_type,
+	DROP COLUMN IF EXISTS image_sha256;
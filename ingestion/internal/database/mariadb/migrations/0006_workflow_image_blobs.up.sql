@@ -0,0 +1,6 @@
+-- Blob store references of workflow images, which are no longer stored inline
+ALTER TABLE expense_automatic_workflow
+	ADD COLUMN IF NOT EXISTS image_sha256 CHAR(64) AFTER base64_image,
+	ADD COLUMN IF NOT EXISTS image_mime_type VARCHAR(100) AFTER image_sha256,
+	ADD COLUMN IF NOT EXISTS image_size BIGINT AFTER image_mime_type,
+	ADD INDEX IF NOT EXISTS idx_eaw_image_sha256 (image_sha256);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS expense_automatic_workflow_expense;
@@ -0,0 +1,19 @@
+-- Expense automatic workflow to expense link table (which workflow produced which expense)
+CREATE TABLE IF NOT EXISTS expense_automatic_workflow_expense (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	expense_automatic_workflow_id BIGINT NOT NULL,
+	expense_id BIGINT NOT NULL,
+	expense_automatic_workflow_item_id BIGINT,
+	match_method VARCHAR(20) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	UNIQUE KEY uk_eawe_workflow_expense (expense_automatic_workflow_id, expense_id),
+	INDEX idx_eawe_expense_id (expense_id),
+	INDEX idx_eawe_match_method (match_method),
+	FOREIGN KEY (expense_automatic_workflow_id) REFERENCES expense_automatic_workflow(id) ON DELETE CASCADE,
+	FOREIGN KEY (expense_id) REFERENCES expense(id) ON DELETE CASCADE,
+	FOREIGN KEY (expense_automatic_workflow_item_id) REFERENCES expense_automatic_workflow_item(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
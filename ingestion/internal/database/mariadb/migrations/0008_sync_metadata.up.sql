@@ -0,0 +1,56 @@
+-- Sync metadata table (one row per sync service, for pipeline freshness)
+CREATE TABLE IF NOT EXISTS sync_metadata (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	service_name VARCHAR(255) NOT NULL,
+	latest_sync_datetime TIMESTAMP NULL,
+	latest_success_datetime TIMESTAMP NULL,
+	last_status VARCHAR(20),
+	last_error TEXT,
+	last_documents_count INT NOT NULL DEFAULT 0,
+	sync_count BIGINT NOT NULL DEFAULT 0,
+	failure_count BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	UNIQUE KEY uk_sync_metadata_service_name (service_name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Carry over the sync times kept in system_settings.json_sync_metadata, which version 16
+-- drops, the way syncing a settings document records them: a row moves only forwards.
+-- Entries were stored as objects, or as lists of Key/Value pairs when serialized from BSON
+-- documents. Entries without a name or an RFC 3339 latestSyncDatetime are skipped.
+ALTER TABLE system_settings ADD COLUMN IF NOT EXISTS json_sync_metadata JSON AFTER fl_maintenance;
+INSERT INTO sync_metadata (guid, service_name, latest_sync_datetime, latest_success_datetime,
+	last_status, created_at, created_by)
+SELECT UUID(), synced.service_name, synced.synced_at, synced.synced_at, 'success', NOW(), 'migration'
+FROM (
+	SELECT entry.service_name, MAX(CONVERT_TZ(
+		STR_TO_DATE(LEFT(entry.latest, 19), '%Y-%m-%dT%H:%i:%s'),
+		IF(entry.latest LIKE '%Z', '+00:00', RIGHT(entry.latest, 6)),
+		'+00:00')) AS synced_at
+	FROM (
+		SELECT
+			COALESCE(MAX(j.name), MAX(CASE WHEN j.pair_key = 'name' THEN j.pair_value END)) AS service_name,
+			COALESCE(MAX(j.latest), MAX(CASE WHEN j.pair_key = 'latestSyncDatetime' THEN j.pair_value END)) AS latest
+		FROM system_settings s,
+			JSON_TABLE(s.json_sync_metadata, '$[*]' COLUMNS (
+				entry_no FOR ORDINALITY,
+				name VARCHAR(255) PATH '$.name',
+				latest VARCHAR(64) PATH '$.latestSyncDatetime',
+				NESTED PATH '$[*]' COLUMNS (
+					pair_key VARCHAR(255) PATH '$.Key',
+					pair_value VARCHAR(255) PATH '$.Value'
+				)
+			)) j
+		GROUP BY s.id, j.entry_no
+	) entry
+	WHERE entry.service_name <> ''
+		AND entry.latest REGEXP '^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}([.][0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})$'
+	GROUP BY entry.service_name
+) synced
+ON DUPLICATE KEY UPDATE
+	latest_sync_datetime = GREATEST(COALESCE(latest_sync_datetime, VALUES(latest_sync_datetime)), VALUES(latest_sync_datetime)),
+	latest_success_datetime = GREATEST(COALESCE(latest_success_datetime, VALUES(latest_success_datetime)), VALUES(latest_success_datetime)),
+	updated_at = NOW(), updated_by = 'migration';
@@ -0,0 +1,26 @@
+-- User history table (type-2 slowly changing dimension of the tracked user fields)
+CREATE TABLE IF NOT EXISTS user_history (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	user_id BIGINT NOT NULL,
+	fl_admin BOOLEAN NOT NULL DEFAULT FALSE,
+	monthly_income DECIMAL(15,2) NOT NULL DEFAULT 0,
+	fl_payment_requested BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_payment_pending BOOLEAN NOT NULL DEFAULT FALSE,
+	fl_payment_paid BOOLEAN NOT NULL DEFAULT FALSE,
+	current_spending_date VARCHAR(7),
+	valid_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	valid_to TIMESTAMP NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE,
+	INDEX idx_user_history_user_valid (user_id, valid_from, valid_to)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Open a history version for users created before user_history existed
+INSERT INTO user_history (guid, user_id, fl_admin, monthly_income, fl_payment_requested, fl_payment_pending,
+	fl_payment_paid, current_spending_date, valid_from, created_at, created_by)
+SELECT UUID(), u.id, u.fl_admin, u.monthly_income, u.fl_payment_requested, u.fl_payment_pending,
+	u.fl_payment_paid, u.current_spending_date, u.created_at, NOW(), 'migration'
+FROM user u
+WHERE NOT EXISTS (SELECT 1 FROM user_history h WHERE h.user_id = u.id);
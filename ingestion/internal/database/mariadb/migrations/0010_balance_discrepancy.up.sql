@@ -0,0 +1,28 @@
+-- Balance discrepancy table (balance_history rows that do not match the recomputed balance)
+CREATE TABLE IF NOT EXISTS balance_discrepancy (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	balance_history_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	spending_date__YYYY_MM VARCHAR(7) NOT NULL,
+	basis VARCHAR(10) NOT NULL,
+	reasons VARCHAR(255) NOT NULL,
+	recorded_amount DECIMAL(15,2) NOT NULL,
+	expected_amount DECIMAL(15,2) NOT NULL,
+	difference_amount DECIMAL(15,2) NOT NULL,
+	recorded_last_month_amount DECIMAL(15,2) NOT NULL,
+	expected_last_month_amount DECIMAL(15,2) NOT NULL,
+	recorded_monthly_income DECIMAL(15,2) NOT NULL,
+	expected_monthly_income DECIMAL(15,2) NOT NULL,
+	additional_amount DECIMAL(15,2) NOT NULL,
+	expense_amount DECIMAL(15,2) NOT NULL,
+	verified_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	UNIQUE KEY uk_bd_balance_history (balance_history_id),
+	INDEX idx_bd_user_spending_date (user_id, spending_date__YYYY_MM),
+	FOREIGN KEY (balance_history_id) REFERENCES balance_history(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
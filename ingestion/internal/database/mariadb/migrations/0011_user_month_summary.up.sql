@@ -0,0 +1,27 @@
+-- User month summary table (per user and month totals maintained after each ingestion)
+CREATE TABLE IF NOT EXISTS user_month_summary (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	user_id BIGINT NOT NULL,
+	spending_date__YYYY_MM VARCHAR(7) NOT NULL,
+	total_expense_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	total_paid_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	total_pending_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	total_additional_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	expense_count INT NOT NULL DEFAULT 0,
+	additional_balance_count INT NOT NULL DEFAULT 0,
+	type_expense_count INT NOT NULL DEFAULT 0,
+	type_invoice_count INT NOT NULL DEFAULT 0,
+	type_savings_count INT NOT NULL DEFAULT 0,
+	status_pending_count INT NOT NULL DEFAULT 0,
+	status_partially_paid_count INT NOT NULL DEFAULT 0,
+	status_paid_count INT NOT NULL DEFAULT 0,
+	refreshed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	updated_at TIMESTAMP NULL,
+	updated_by VARCHAR(255),
+	UNIQUE KEY uk_ums_user_spending_date (user_id, spending_date__YYYY_MM),
+	INDEX idx_ums_spending_date (spending_date__YYYY_MM),
+	FOREIGN KEY (user_id) REFERENCES user(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
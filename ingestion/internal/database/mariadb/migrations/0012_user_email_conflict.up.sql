@@ -0,0 +1,18 @@
+-- User email conflict table (audit of every email uniqueness conflict and how it was resolved)
+CREATE TABLE IF NOT EXISTS user_email_conflict (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	email VARCHAR(255) NOT NULL,
+	incoming_source_id VARCHAR(255) NOT NULL,
+	stale_user_id BIGINT NOT NULL,
+	stale_source_id VARCHAR(255) NOT NULL,
+	kept_user_id BIGINT,
+	policy VARCHAR(10) NOT NULL,
+	resolution VARCHAR(20) NOT NULL,
+	renamed_email VARCHAR(255),
+	moved_rows INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	INDEX idx_uec_email (email),
+	INDEX idx_uec_stale_source_id (stale_source_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,9 @@
+-- Fails while encrypted values longer than 255 characters remain: disable
+-- FIELD_ENCRYPTION_ENABLED and run reencrypt first
+ALTER TABLE user_email_conflict MODIFY email VARCHAR(255) NOT NULL;
+ALTER TABLE user
+	DROP INDEX IF EXISTS uk_user_email_bidx,
+	DROP COLUMN IF EXISTS email_bidx,
+	MODIFY first_name VARCHAR(255) NOT NULL,
+	MODIFY last_name VARCHAR(255),
+	MODIFY email VARCHAR(255) NOT NULL;
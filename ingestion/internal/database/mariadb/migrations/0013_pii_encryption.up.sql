@@ -0,0 +1,8 @@
+-- Room for encrypted PII and the email blind index
+ALTER TABLE user
+	MODIFY first_name VARCHAR(512) NOT NULL,
+	MODIFY last_name VARCHAR(512),
+	MODIFY email VARCHAR(512) NOT NULL,
+	ADD COLUMN IF NOT EXISTS email_bidx CHAR(64) AFTER email,
+	ADD UNIQUE KEY IF NOT EXISTS uk_user_email_bidx (email_bidx);
+ALTER TABLE user_email_conflict MODIFY email VARCHAR(512) NOT NULL;
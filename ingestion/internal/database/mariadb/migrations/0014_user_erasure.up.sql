@@ -0,0 +1,18 @@
+-- User erasure table (signed receipts of data-subject erasures, kept after the user is gone)
+CREATE TABLE IF NOT EXISTS user_erasure (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	guid VARCHAR(36) NOT NULL UNIQUE,
+	user_source_id VARCHAR(255) NOT NULL,
+	requested_by VARCHAR(255) NOT NULL,
+	requested_at TIMESTAMP NOT NULL,
+	completed_at TIMESTAMP NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	status_reason TEXT,
+	mariadb_rows TEXT NOT NULL,
+	mongodb_documents TEXT NOT NULL,
+	blobs_deleted BIGINT NOT NULL DEFAULT 0,
+	signature CHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_by VARCHAR(255),
+	INDEX idx_ue_user_source_id (user_source_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,8 @@
+ALTER TABLE service_payment DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE expense_automatic_workflow_pre_saved_description DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE expense_automatic_workflow DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE balance_history DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE additional_balance DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE expense DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE financial_institution DROP COLUMN IF EXISTS extra_attributes;
+ALTER TABLE user DROP COLUMN IF EXISTS extra_attributes;
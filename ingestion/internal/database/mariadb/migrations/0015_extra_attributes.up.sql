@@ -0,0 +1,9 @@
+-- Unknown and unmapped MongoDB fields of synced rows
+ALTER TABLE user ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE financial_institution ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE expense ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE additional_balance ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE balance_history ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE expense_automatic_workflow ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE expense_automatic_workflow_pre_saved_description ADD COLUMN IF NOT EXISTS extra_attributes JSON;
+ALTER TABLE service_payment ADD COLUMN IF NOT EXISTS extra_attributes JSON;
@@ -0,0 +1,2 @@
+-- The column comes back empty; sync_metadata keeps the data
+ALTER TABLE system_settings ADD COLUMN IF NOT EXISTS json_sync_metadata JSON AFTER fl_maintenance;
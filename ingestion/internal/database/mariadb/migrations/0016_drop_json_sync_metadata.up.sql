@@ -0,0 +1,2 @@
+-- Sync metadata moved to the sync_metadata table
+ALTER TABLE system_settings DROP COLUMN IF EXISTS json_sync_metadata;
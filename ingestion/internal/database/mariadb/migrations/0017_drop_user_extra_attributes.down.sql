@@ -0,0 +1,2 @@
+-- The column comes back empty
+ALTER TABLE user ADD COLUMN IF NOT EXISTS extra_attributes JSON;
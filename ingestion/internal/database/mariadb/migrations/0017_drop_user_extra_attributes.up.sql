@@ -0,0 +1,3 @@
+-- Unknown user fields may be personal data, which extra_attributes would keep as plaintext
+-- even with field encryption on. Dropping the column also removes what was stored.
+ALTER TABLE user DROP COLUMN IF EXISTS extra_attributes;
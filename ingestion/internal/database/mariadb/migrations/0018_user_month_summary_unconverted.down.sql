@@ -0,0 +1,3 @@
+ALTER TABLE user_month_summary
+	DROP COLUMN IF EXISTS unconverted_additional_balance_count,
+	DROP COLUMN IF EXISTS unconverted_expense_count;
@@ -0,0 +1,5 @@
+-- Expenses and additional balances left out of the summary totals because they have no
+-- base-currency amount
+ALTER TABLE user_month_summary
+	ADD COLUMN IF NOT EXISTS unconverted_expense_count INT NOT NULL DEFAULT 0 AFTER additional_balance_count,
+	ADD COLUMN IF NOT EXISTS unconverted_additional_balance_count INT NOT NULL DEFAULT 0 AFTER unconverted_expense_count;
@@ -0,0 +1,191 @@
+//go:build integration
+
+package mariadb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// TestMigrationsMariaDB runs the migrations against a MariaDB server, such as the MariaDB
+// service in docker-compose.yml:
+//
+//	docker compose up -d mariadb
+//	go test -tags integration ./internal/database/mariadb/
+func TestMigrationsMariaDB(t *testing.T) {
+	password := os.Getenv("MYSQL_ROOT_PASSWORD")
+	if password == "" {
+		password = "root_secret"
+	}
+	cfg := config.MariaDBConfig{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "root",
+		Password: password,
+		Database: fmt.Sprintf("porcool_migrations_test_%d", time.Now().UnixNano()),
+	}
+
+	conn, err := NewConnection(cfg)
+	if err != nil {
+		t.Fatalf("NewConnection() returned error: %v", err)
+	}
+	defer conn.Close()
+	defer conn.db.Exec("DROP DATABASE `" + cfg.Database + "`")
+
+	// Replicas starting together take turns on the lock; only one applies the baseline
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- conn.RunMigrations()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("RunMigrations() returned error: %v", err)
+		}
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() returned error: %v", err)
+	}
+	var count int
+	if err := conn.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); err != nil {
+		t.Fatalf("failed to count schema_migrations: %v", err)
+	}
+	if count != len(migrations) {
+		t.Errorf("schema_migrations has %d rows, want %d", count, len(migrations))
+	}
+
+	ctx := context.Background()
+	steps, err := conn.MigrateTo(ctx, 0)
+	if err != nil {
+		t.Fatalf("MigrateTo(0) returned error: %v", err)
+	}
+	if len(steps) != len(migrations) || !steps[0].Revert {
+		t.Errorf("MigrateTo(0) steps = %+v, want every migration reverted", steps)
+	}
+	var tables int
+	if err := conn.db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name <> 'schema_migrations'", cfg.Database).Scan(&tables); err != nil {
+		t.Fatalf("failed to count tables: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("%d tables left after reverting every migration", tables)
+	}
+
+	// Duplicate domain values are merged into the oldest row before the unique key is added
+	if _, err := conn.MigrateTo(ctx, 3); err != nil {
+		t.Fatalf("MigrateTo(3) returned error: %v", err)
+	}
+	for _, statement := range []string{
+		"INSERT INTO user (guid, source_id, first_name, email) VALUES ('u1', 'user-1', 'Ana', 'ana@example.com')",
+		"INSERT INTO domain (id, guid, name, type, source) VALUES (1, 'd1', 'paid', 'status', 'expense'), (2, 'd2', 'paid', 'status', 'expense')",
+		"INSERT INTO expense (guid, source_id, user_id, spending_date__YYYY_MM, name, id_status) VALUES ('e1', 'exp-1', 1, '2026-03', 'Rent', 2)",
+	} {
+		if _, err := conn.db.Exec(statement); err != nil {
+			t.Fatalf("failed to insert duplicate domains: %v", err)
+		}
+	}
+
+	// Sync times kept in system_settings are carried over to sync_metadata before the column is dropped
+	if _, err := conn.MigrateTo(ctx, 7); err != nil {
+		t.Fatalf("MigrateTo(7) returned error: %v", err)
+	}
+	_, err = conn.db.Exec(`INSERT INTO system_settings (guid, source_id, json_sync_metadata) VALUES ('s1', 'settings-1', ?)`,
+		`[{"name": "backup", "latestSyncDatetime": "2024-03-10T09:30:00-03:00"},
+		[{"Key": "name", "Value": "reports"}, {"Key": "latestSyncDatetime", "Value": "2024-03-11T12:30:00.5Z"}],
+		{"name": "broken", "latestSyncDatetime": "yesterday"}]`)
+	if err != nil {
+		t.Fatalf("failed to insert system settings: %v", err)
+	}
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations() after reverting returned error: %v", err)
+	}
+	var domains, status int64
+	if err := conn.db.QueryRow("SELECT COUNT(*), MIN(e.id_status) FROM domain d JOIN expense e").Scan(&domains, &status); err != nil {
+		t.Fatalf("failed to read merged domains: %v", err)
+	}
+	if domains != 1 || status != 1 {
+		t.Errorf("after merging duplicates: %d domains, expense status %d, want 1 domain referenced by the expense", domains, status)
+	}
+	rows, err := conn.db.Query("SELECT service_name, latest_sync_datetime FROM sync_metadata ORDER BY service_name")
+	if err != nil {
+		t.Fatalf("failed to read sync metadata: %v", err)
+	}
+	synced := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var at time.Time
+		if err := rows.Scan(&name, &at); err != nil {
+			t.Fatalf("failed to scan sync metadata: %v", err)
+		}
+		synced[name] = at
+	}
+	rows.Close()
+	want := map[string]time.Time{
+		"backup":  time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC),
+		"reports": time.Date(2024, 3, 11, 12, 30, 0, 0, time.UTC),
+	}
+	if len(synced) != len(want) {
+		t.Errorf("sync_metadata = %v, want %v", synced, want)
+	}
+	for name, at := range want {
+		if !synced[name].Equal(at) {
+			t.Errorf("sync_metadata %s = %v, want %v", name, synced[name], at)
+		}
+	}
+	if err := conn.CheckMigrations(ctx); err != nil {
+		t.Errorf("CheckMigrations() after migrating returned error: %v", err)
+	}
+
+	// Databases created by earlier releases already have some of the upgrades, so every
+	// migration must run again on a schema that has them all
+	if _, err := conn.db.Exec("DELETE FROM schema_migrations"); err != nil {
+		t.Fatalf("failed to clear schema_migrations: %v", err)
+	}
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations() on an upgraded schema returned error: %v", err)
+	}
+
+	// An existing schema is baselined instead of migrated
+	if _, err := conn.db.Exec("DELETE FROM schema_migrations"); err != nil {
+		t.Fatalf("failed to clear schema_migrations: %v", err)
+	}
+	if err := conn.CheckMigrations(ctx); err == nil {
+		t.Error("CheckMigrations() should fail while migrations are pending")
+	}
+	recorded, err := conn.Baseline(ctx, migrations[len(migrations)-1].Version)
+	if err != nil {
+		t.Fatalf("Baseline() returned error: %v", err)
+	}
+	if len(recorded) != len(migrations) {
+		t.Errorf("Baseline() recorded %d migrations, want %d", len(recorded), len(migrations))
+	}
+	states, err := conn.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus() returned error: %v", err)
+	}
+	for _, state := range states {
+		if !state.Applied || state.Modified || state.NoFile {
+			t.Errorf("MigrationStatus() after baseline: %+v, want applied", state)
+		}
+	}
+
+	if _, err := conn.db.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1"); err != nil {
+		t.Fatalf("failed to edit checksum: %v", err)
+	}
+	if err := conn.RunMigrations(); err == nil {
+		t.Error("RunMigrations() should fail when an applied migration was modified")
+	}
+}
@@ -0,0 +1,281 @@
+package mariadb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMigrationsEmbedded(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() returned error: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 || migrations[0].Name != "baseline" {
+		t.Fatalf("Migrations() should start with 1_baseline, got %+v", migrations)
+	}
+
+	for i, m := range migrations {
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Errorf("migration %d is out of order", m.Version)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		if m.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("migration %d checksum = %s, want the SHA-256 of its up file", m.Version, m.Checksum)
+		}
+		for _, statement := range append(splitStatements(m.Up), splitStatements(m.Down)...) {
+			if strings.TrimSpace(statement) == "" || strings.HasSuffix(statement, ";") {
+				t.Errorf("migration %d has a malformed statement %q", m.Version, statement)
+			}
+		}
+	}
+}
+
+func TestBaselineCoversSnapshotTables(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() returned error: %v", err)
+	}
+	baseline := migrations[0]
+
+	// Upgrades belong to later versions, so that each one can be reverted on its own
+	for _, statement := range splitStatements(baseline.Up) {
+		if !strings.HasPrefix(statement, "CREATE TABLE IF NOT EXISTS ") {
+			t.Errorf("baseline has a statement other than CREATE TABLE: %q", statement)
+		}
+	}
+
+	var extraAttributes *Migration
+	for i := range migrations {
+		if migrations[i].Name == "extra_attributes" {
+			extraAttributes = &migrations[i]
+		}
+	}
+	if extraAttributes == nil {
+		t.Fatal("no extra_attributes migration")
+	}
+	for _, table := range extraAttributesTables {
+		if !strings.Contains(baseline.Up, "CREATE TABLE IF NOT EXISTS "+table+" (") {
+			t.Errorf("baseline does not create %s", table)
+		}
+		if !strings.Contains(baseline.Down, "DROP TABLE IF EXISTS "+table+";") {
+			t.Errorf("baseline down does not drop %s", table)
+		}
+		if !strings.Contains(extraAttributes.Up, "ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS extra_attributes JSON") {
+			t.Errorf("extra_attributes migration does not add the column to %s", table)
+		}
+		if !strings.Contains(extraAttributes.Down, "ALTER TABLE "+table+" DROP COLUMN IF EXISTS extra_attributes") {
+			t.Errorf("extra_attributes migration down does not drop the column from %s", table)
+		}
+	}
+}
+
+func TestUserHasNoExtraAttributes(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() returned error: %v", err)
+	}
+	for _, m := range migrations {
+		if strings.Contains(m.Up, "ALTER TABLE user DROP COLUMN IF EXISTS extra_attributes") {
+			return
+		}
+	}
+	t.Error("no migration drops the extra_attributes column of user")
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_column.up.sql":   {Data: []byte("ALTER TABLE t ADD COLUMN c INT;\n")},
+		"m/0002_add_column.down.sql": {Data: []byte("ALTER TABLE t DROP COLUMN c;\n")},
+		"m/0001_baseline.up.sql":     {Data: []byte("CREATE TABLE t (id INT);\n")},
+		"m/0001_baseline.down.sql":   {Data: []byte("DROP TABLE t;\n")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations() returned error: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("loadMigrations() = %+v, want versions 1 and 2", migrations)
+	}
+	if migrations[1].Name != "add_column" || migrations[1].Down != "ALTER TABLE t DROP COLUMN c;\n" {
+		t.Errorf("loadMigrations() second migration = %+v", migrations[1])
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			name:  "bad file name",
+			files: fstest.MapFS{"m/baseline.sql": {Data: []byte("SELECT 1;")}},
+			want:  "invalid migration file name",
+		},
+		{
+			name:  "missing down",
+			files: fstest.MapFS{"m/0001_baseline.up.sql": {Data: []byte("SELECT 1;")}},
+			want:  "needs both an up and a down file",
+		},
+		{
+			name: "two names",
+			files: fstest.MapFS{
+				"m/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"m/0001_b.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			want: "has two names",
+		},
+		{
+			name:  "version zero",
+			files: fstest.MapFS{"m/0000_a.up.sql": {Data: []byte("SELECT 1;")}},
+			want:  "invalid migration version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadMigrations() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- Create a table
+CREATE TABLE t (
+	id INT
+);
+
+-- Two statements
+ALTER TABLE t ADD COLUMN a INT;
+ALTER TABLE t ADD COLUMN b INT;
+SELECT 1`
+
+	want := []string{
+		"CREATE TABLE t (\n\tid INT\n)",
+		"ALTER TABLE t ADD COLUMN a INT",
+		"ALTER TABLE t ADD COLUMN b INT",
+		"SELECT 1",
+	}
+	if got := splitStatements(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitStatements() = %q, want %q", got, want)
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}, {Version: 3, Name: "c"}}
+	applied := func(versions ...int64) map[int64]AppliedMigration {
+		m := make(map[int64]AppliedMigration)
+		for _, v := range versions {
+			m[v] = AppliedMigration{Version: v}
+		}
+		return m
+	}
+	type step struct {
+		version int64
+		revert  bool
+	}
+
+	tests := []struct {
+		name    string
+		applied map[int64]AppliedMigration
+		target  int64
+		want    []step
+	}{
+		{"fresh database", applied(), 3, []step{{1, false}, {2, false}, {3, false}}},
+		{"up to date", applied(1, 2, 3), 3, nil},
+		{"partial up", applied(1), 2, []step{{2, false}}},
+		{"down", applied(1, 2, 3), 1, []step{{3, true}, {2, true}}},
+		{"down to nothing", applied(1, 2), 0, []step{{2, true}, {1, true}}},
+		{"gap filled", applied(1, 3), 3, []step{{2, false}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planMigrations(migrations, tt.applied, tt.target)
+			if err != nil {
+				t.Fatalf("planMigrations() returned error: %v", err)
+			}
+			var got []step
+			for _, s := range plan {
+				got = append(got, step{s.Version, s.Revert})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planMigrations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := planMigrations(migrations, applied(), 7); err == nil {
+		t.Error("planMigrations() should fail for an unknown version")
+	}
+	if _, err := planMigrations(migrations, applied(1, 2, 3, 4), 3); err == nil {
+		t.Error("planMigrations() should fail to revert a migration without a file")
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "a", Checksum: "aaa"}}
+
+	if err := verifyChecksums(migrations, map[int64]AppliedMigration{1: {Version: 1, Checksum: "aaa"}}); err != nil {
+		t.Errorf("verifyChecksums() returned error for a matching checksum: %v", err)
+	}
+	if err := verifyChecksums(migrations, map[int64]AppliedMigration{2: {Version: 2, Checksum: "bbb"}}); err != nil {
+		t.Errorf("verifyChecksums() returned error for a migration from a newer release: %v", err)
+	}
+	err := verifyChecksums(migrations, map[int64]AppliedMigration{1: {Version: 1, Checksum: "bbb"}})
+	if err == nil || !strings.Contains(err.Error(), "modified after it was applied") {
+		t.Errorf("verifyChecksums() error = %v, want a modified migration error", err)
+	}
+}
+
+func TestMigrationStates(t *testing.T) {
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	migrations := []Migration{
+		{Version: 1, Name: "a", Checksum: "aaa"},
+		{Version: 2, Name: "b", Checksum: "bbb"},
+		{Version: 3, Name: "c", Checksum: "ccc"},
+	}
+	applied := map[int64]AppliedMigration{
+		1: {Version: 1, Name: "a", Checksum: "aaa", AppliedAt: appliedAt},
+		2: {Version: 2, Name: "b", Checksum: "old", AppliedAt: appliedAt},
+		4: {Version: 4, Name: "d", Checksum: "ddd", AppliedAt: appliedAt},
+	}
+
+	want := []MigrationState{
+		{Version: 1, Name: "a", Applied: true, AppliedAt: appliedAt},
+		{Version: 2, Name: "b", Applied: true, AppliedAt: appliedAt, Modified: true},
+		{Version: 3, Name: "c"},
+		{Version: 4, Name: "d", Applied: true, AppliedAt: appliedAt, NoFile: true},
+	}
+	if got := migrationStates(migrations, applied); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrationStates() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDownTarget(t *testing.T) {
+	applied := map[int64]AppliedMigration{1: {Version: 1}, 2: {Version: 2}, 5: {Version: 5}}
+
+	tests := []struct {
+		n    int
+		want int64
+	}{
+		{1, 2},
+		{2, 1},
+		{3, 0},
+		{10, 0},
+	}
+	for _, tt := range tests {
+		if got := downTarget(applied, tt.n); got != tt.want {
+			t.Errorf("downTarget(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
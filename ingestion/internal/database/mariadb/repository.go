@@ -2,11 +2,15 @@ package mariadb
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/porcool/ingestion/internal/dates"
+	"github.com/porcool/ingestion/internal/logging"
 	"github.com/porcool/ingestion/internal/models"
 )
 
@@ -23,25 +27,39 @@ func NewUserRepository(conn *Connection) *UserRepository {
 	return &UserRepository{conn: conn}
 }
 
-// UpsertUser inserts or updates a user
+// UpsertUser inserts or updates a user. The user row and its history version are written
+// in one transaction, so user_history always matches the user table.
 func (r *UserRepository) UpsertUser(user *models.User) error {
+	tx, err := r.conn.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	firstName, lastName, email, err := r.sealUser(user)
+	if err != nil {
+		return err
+	}
+	emailBidx := r.conn.emailIndex(user.Email)
+
 	// Check if user exists by source_id (MongoDB document ID)
 	var existingID int64
 	var existingGUID string
-	err := r.conn.db.QueryRow("SELECT id, guid FROM user WHERE source_id = ?", user.SourceID).Scan(&existingID, &existingGUID)
+	err = tx.QueryRow("SELECT id, guid FROM user WHERE source_id = ? FOR UPDATE", user.SourceID).Scan(&existingID, &existingGUID)
 
+	now := time.Now()
 	if err == sql.ErrNoRows {
 		// Insert new user with a new random UUID for guid
 		newGUID := uuid.New().String()
-		log.Printf("Inserting new user into MariaDB: source_id=%s, email=%s", user.SourceID, user.Email)
-		result, err := r.conn.db.Exec(`
-			INSERT INTO user (guid, source_id, first_name, last_name, email, fl_admin, monthly_income,
+		log.Printf("Inserting new user into MariaDB: source_id=%s, email=%s", user.SourceID, logging.MaskEmail(user.Email))
+		result, err := tx.Exec(`
+			INSERT INTO user (guid, source_id, first_name, last_name, email, email_bidx, fl_admin, monthly_income,
 				fl_payment_requested, fl_payment_pending, fl_payment_paid, current_spending_date,
 				created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			newGUID, user.SourceID, user.FirstName, user.LastName, user.Email, user.FlAdmin, user.MonthlyIncome,
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			newGUID, user.SourceID, firstName, lastName, email, emailBidx, user.FlAdmin, user.MonthlyIncome,
 			user.FlPaymentRequested, user.FlPaymentPending, user.FlPaymentPaid, user.CurrentSpendingDate,
-			time.Now(), ServiceName,
+			now, ServiceName,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert user: %w", err)
@@ -49,40 +67,198 @@ func (r *UserRepository) UpsertUser(user *models.User) error {
 		id, _ := result.LastInsertId()
 		user.ID = id
 		user.GUID = newGUID
-		log.Printf("Successfully inserted user into MariaDB: id=%d, guid=%s", user.ID, user.GUID)
-		return nil
 	} else if err != nil {
 		return fmt.Errorf("failed to check user existence: %w", err)
+	} else {
+		// Update existing user
+		log.Printf("Updating existing user in MariaDB: id=%d, source_id=%s", existingID, user.SourceID)
+		_, err = tx.Exec(`
+			UPDATE user SET first_name = ?, last_name = ?, email = ?, email_bidx = ?, fl_admin = ?, monthly_income = ?,
+				fl_payment_requested = ?, fl_payment_pending = ?, fl_payment_paid = ?, current_spending_date = ?,
+				updated_at = ?, updated_by = ?
+			WHERE source_id = ?`,
+			firstName, lastName, email, emailBidx, user.FlAdmin, user.MonthlyIncome,
+			user.FlPaymentRequested, user.FlPaymentPending, user.FlPaymentPaid, user.CurrentSpendingDate,
+			now, ServiceName, user.SourceID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		user.ID = existingID
+		user.GUID = existingGUID
 	}
 
-	// Update existing user
-	log.Printf("Updating existing user in MariaDB: id=%d, source_id=%s", existingID, user.SourceID)
-	_, err = r.conn.db.Exec(`
-		UPDATE user SET first_name = ?, last_name = ?, email = ?, fl_admin = ?, monthly_income = ?,
-			fl_payment_requested = ?, fl_payment_pending = ?, fl_payment_paid = ?, current_spending_date = ?,
-			updated_at = ?, updated_by = ?
-		WHERE source_id = ?`,
-		user.FirstName, user.LastName, user.Email, user.FlAdmin, user.MonthlyIncome,
-		user.FlPaymentRequested, user.FlPaymentPending, user.FlPaymentPaid, user.CurrentSpendingDate,
-		time.Now(), ServiceName, user.SourceID,
+	if err := recordUserHistory(tx, user, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user: %w", err)
+	}
+	if existingID == 0 {
+		log.Printf("Successfully inserted user into MariaDB: id=%d, guid=%s", user.ID, user.GUID)
+	} else {
+		log.Printf("Successfully updated user in MariaDB: id=%d, guid=%s", user.ID, user.GUID)
+	}
+	return nil
+}
+
+// sealUser returns the stored form of a user's PII columns: first name, last name and email
+func (r *UserRepository) sealUser(user *models.User) (string, sql.NullString, string, error) {
+	firstName, err := r.conn.encrypt("user", "first_name", user.FirstName)
+	if err != nil {
+		return "", sql.NullString{}, "", err
+	}
+	lastName, err := r.conn.encryptNull("user", "last_name", user.LastName)
+	if err != nil {
+		return "", sql.NullString{}, "", err
+	}
+	email, err := r.conn.encrypt("user", "email", user.Email)
+	if err != nil {
+		return "", sql.NullString{}, "", err
+	}
+	return firstName, lastName, email, nil
+}
+
+// openUser decrypts the PII columns of a user read from MariaDB in place
+func (r *UserRepository) openUser(user *models.User) error {
+	var err error
+	if user.FirstName, err = r.conn.decrypt("user", "first_name", user.FirstName); err != nil {
+		return err
+	}
+	if user.LastName, err = r.conn.decryptNull("user", "last_name", user.LastName); err != nil {
+		return err
+	}
+	user.Email, err = r.conn.decrypt("user", "email", user.Email)
+	return err
+}
+
+// recordUserHistory closes the current history version of a user and opens a new one
+// when a tracked field changed. Unchanged users keep their current version.
+func recordUserHistory(tx *sql.Tx, user *models.User, now time.Time) error {
+	current := models.UserHistory{}
+	err := tx.QueryRow(`
+		SELECT id, fl_admin, monthly_income, fl_payment_requested, fl_payment_pending, fl_payment_paid,
+			current_spending_date
+		FROM user_history WHERE user_id = ? AND valid_to IS NULL
+		ORDER BY valid_from DESC LIMIT 1 FOR UPDATE`, user.ID,
+	).Scan(
+		&current.ID, &current.FlAdmin, &current.MonthlyIncome, &current.FlPaymentRequested, &current.FlPaymentPending,
+		&current.FlPaymentPaid, &current.CurrentSpendingDate,
+	)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to get current user history: %w", err)
+	case current.SameState(user):
+		return nil
+	default:
+		if _, err := tx.Exec("UPDATE user_history SET valid_to = ? WHERE id = ?", now, current.ID); err != nil {
+			return fmt.Errorf("failed to close user history: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_history (guid, user_id, fl_admin, monthly_income, fl_payment_requested, fl_payment_pending,
+			fl_payment_paid, current_spending_date, valid_from, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), user.ID, user.FlAdmin, user.MonthlyIncome, user.FlPaymentRequested, user.FlPaymentPending,
+		user.FlPaymentPaid, user.CurrentSpendingDate, now, now, ServiceName,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return fmt.Errorf("failed to insert user history: %w", err)
 	}
-	user.ID = existingID
-	user.GUID = existingGUID
-	log.Printf("Successfully updated user in MariaDB: id=%d, guid=%s", user.ID, user.GUID)
 	return nil
 }
 
+// GetUserStateAsOf returns the history version of a user that was valid at the given instant,
+// or nil when the user did not exist yet
+func (r *UserRepository) GetUserStateAsOf(userID int64, at time.Time) (*models.UserHistory, error) {
+	h := &models.UserHistory{}
+	err := r.conn.readDB().QueryRow(`
+		SELECT id, guid, user_id, fl_admin, monthly_income, fl_payment_requested, fl_payment_pending, fl_payment_paid,
+			current_spending_date, valid_from, valid_to, created_at, created_by
+		FROM user_history
+		WHERE user_id = ? AND valid_from <= ? AND (valid_to IS NULL OR valid_to > ?)
+		ORDER BY valid_from DESC LIMIT 1`, userID, at, at,
+	).Scan(
+		&h.ID, &h.GUID, &h.UserID, &h.FlAdmin, &h.MonthlyIncome, &h.FlPaymentRequested, &h.FlPaymentPending, &h.FlPaymentPaid,
+		&h.CurrentSpendingDate, &h.ValidFrom, &h.ValidTo, &h.CreatedAt, &h.CreatedBy,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user state: %w", err)
+	}
+	return h, nil
+}
+
+// GetUserStateAsOfMonth returns the state of a user as of a YYYY/MM month, that is the
+// version in effect at the end of the month in the given timezone. Reports for past months
+// use it to read the income the user had back then.
+func (r *UserRepository) GetUserStateAsOfMonth(userID int64, month string, loc *time.Location) (*models.UserHistory, error) {
+	start, err := dates.ParseMonthKey(month)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetUserStateAsOf(userID, monthEnd(start, loc))
+}
+
+// monthEnd returns the last second of the month starting at start, in the given timezone.
+// TIMESTAMP columns have second precision, so a version opened exactly at the start of
+// the next month is not part of the month.
+func monthEnd(start time.Time, loc *time.Location) time.Time {
+	return time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, loc).Add(-time.Second)
+}
+
 // GetUserByGUID retrieves a user by GUID
 func (r *UserRepository) GetUserByGUID(guid string) (*models.User, error) {
+	return r.getUser("guid = ?", guid)
+}
+
+// GetUserBySourceID retrieves a user by source_id (MongoDB document ID). A user merged into
+// another one by the email conflict policy resolves to the user it was merged into, so the
+// documents that still reference it keep syncing.
+func (r *UserRepository) GetUserBySourceID(sourceID string) (*models.User, error) {
+	user, err := r.getUser("source_id = ?", sourceID)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	var keptUserID int64
+	err = r.conn.db.QueryRow(`
+		SELECT kept_user_id FROM user_email_conflict
+		WHERE stale_source_id = ? AND resolution = ? AND kept_user_id IS NOT NULL
+		ORDER BY id DESC LIMIT 1`, sourceID, models.EmailConflictMerged,
+	).Scan(&keptUserID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merged user by source_id: %w", err)
+	}
+	return r.getUser("id = ?", keptUserID)
+}
+
+// GetUserByEmail retrieves a user by email. The comparison follows the column collation,
+// so it is case-insensitive like the unique key. Encrypted emails are looked up by their
+// blind index; the plaintext comparison still finds rows not re-encrypted yet.
+func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
+	if r.conn.cipher.Encrypts("user", "email") {
+		return r.getUser("(email_bidx = ? OR email = ?)", r.conn.emailIndex(email), email)
+	}
+	return r.getUser("email = ?", email)
+}
+
+// getUser retrieves the user matching a condition, or nil when there is none
+func (r *UserRepository) getUser(condition string, args ...interface{}) (*models.User, error) {
 	user := &models.User{}
 	err := r.conn.db.QueryRow(`
 		SELECT id, guid, source_id, first_name, last_name, email, fl_admin, monthly_income,
 			fl_payment_requested, fl_payment_pending, fl_payment_paid, current_spending_date,
 			created_at, created_by, updated_at, updated_by
-		FROM user WHERE guid = ?`, guid,
+		FROM user WHERE `+condition, args...,
 	).Scan(
 		&user.ID, &user.GUID, &user.SourceID, &user.FirstName, &user.LastName, &user.Email, &user.FlAdmin, &user.MonthlyIncome,
 		&user.FlPaymentRequested, &user.FlPaymentPending, &user.FlPaymentPaid, &user.CurrentSpendingDate,
@@ -94,29 +270,251 @@ func (r *UserRepository) GetUserByGUID(guid string) (*models.User, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	if err := r.openUser(user); err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
-// GetUserBySourceID retrieves a user by source_id (MongoDB document ID)
-func (r *UserRepository) GetUserBySourceID(sourceID string) (*models.User, error) {
-	user := &models.User{}
+// RenameEmail replaces the email of a user, freeing the old one
+func (r *UserRepository) RenameEmail(userID int64, email string) error {
+	stored, err := r.conn.encrypt("user", "email", email)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.db.Exec("UPDATE user SET email = ?, email_bidx = ?, updated_at = ?, updated_by = ? WHERE id = ?",
+		stored, r.conn.emailIndex(email), time.Now(), ServiceName, userID)
+	if err != nil {
+		return fmt.Errorf("failed to rename user email: %w", err)
+	}
+	return nil
+}
+
+// AdoptUser gives a user a new source_id, so the next upsert of that source_id updates it
+// in place with all its rows. It merges a stale user into an incoming one not stored yet.
+func (r *UserRepository) AdoptUser(userID int64, sourceID string) error {
+	_, err := r.conn.db.Exec("UPDATE user SET source_id = ?, updated_at = ?, updated_by = ? WHERE id = ?",
+		sourceID, time.Now(), ServiceName, userID)
+	if err != nil {
+		return fmt.Errorf("failed to adopt user: %w", err)
+	}
+	return nil
+}
+
+// userOwnedTables are the tables whose rows move to the kept user when two users are merged
+var userOwnedTables = []string{
+	"financial_institution",
+	"expense_automatic_workflow",
+	"expense_automatic_workflow_pre_saved_description",
+	"expense",
+	"additional_balance",
+	"balance_history",
+	"balance_discrepancy",
+	"service_payment",
+}
+
+// MergeUsers moves every row owned by the stale user to the kept user and deletes the stale
+// user, in one transaction. The stale user's history and month summaries are derived from
+// its own state, so they are dropped instead of moved. It returns the number of moved rows.
+func (r *UserRepository) MergeUsers(staleID, keptID int64) (int64, error) {
+	tx, err := r.conn.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var moved int64
+	for _, table := range userOwnedTables {
+		result, err := tx.Exec("UPDATE "+table+" SET user_id = ? WHERE user_id = ?", keptID, staleID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to move %s rows: %w", table, err)
+		}
+		n, _ := result.RowsAffected()
+		moved += n
+	}
+
+	if _, err := tx.Exec("DELETE FROM user WHERE id = ?", staleID); err != nil {
+		return 0, fmt.Errorf("failed to delete merged user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit user merge: %w", err)
+	}
+	return moved, nil
+}
+
+// UserEmailConflictRepository handles the email conflict audit table
+type UserEmailConflictRepository struct {
+	conn *Connection
+}
+
+// NewUserEmailConflictRepository creates a new UserEmailConflictRepository
+func NewUserEmailConflictRepository(conn *Connection) *UserEmailConflictRepository {
+	return &UserEmailConflictRepository{conn: conn}
+}
+
+// RecordConflict inserts an audit row for a resolved or failed email conflict
+func (r *UserEmailConflictRepository) RecordConflict(c *models.UserEmailConflict) error {
+	email, err := r.conn.encrypt("user_email_conflict", "email", c.Email)
+	if err != nil {
+		return err
+	}
+
+	c.GUID = uuid.New().String()
+	result, err := r.conn.db.Exec(`
+		INSERT INTO user_email_conflict (guid, email, incoming_source_id, stale_user_id, stale_source_id, kept_user_id,
+			policy, resolution, renamed_email, moved_rows, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.GUID, email, c.IncomingSourceID, c.StaleUserID, c.StaleSourceID, c.KeptUserID,
+		c.Policy, c.Resolution, c.RenamedEmail, c.MovedRows, time.Now(), ServiceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record user email conflict: %w", err)
+	}
+	c.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// erasedEmail replaces the email in user_email_conflict rows of an erased user
+const erasedEmail = "erased"
+
+// erasureCounts are the queries counting, per table, the rows a user erasure removes.
+// The user row's foreign keys cascade to all of them.
+var erasureCounts = []struct {
+	table string
+	query string
+}{
+	{"user", "SELECT COUNT(*) FROM user WHERE id = ?"},
+	{"user_history", "SELECT COUNT(*) FROM user_history WHERE user_id = ?"},
+	{"financial_institution", "SELECT COUNT(*) FROM financial_institution WHERE user_id = ?"},
+	{"expense_automatic_workflow", "SELECT COUNT(*) FROM expense_automatic_workflow WHERE user_id = ?"},
+	{"expense_automatic_workflow_item", `SELECT COUNT(*) FROM expense_automatic_workflow_item i
+		JOIN expense_automatic_workflow w ON w.id = i.expense_automatic_workflow_id WHERE w.user_id = ?`},
+	{"expense_automatic_workflow_pre_saved_description", "SELECT COUNT(*) FROM expense_automatic_workflow_pre_saved_description WHERE user_id = ?"},
+	{"expense", "SELECT COUNT(*) FROM expense WHERE user_id = ?"},
+	{"expense_installment", "SELECT COUNT(*) FROM expense_installment i JOIN expense e ON e.id = i.expense_id WHERE e.user_id = ?"},
+	{"expense_automatic_workflow_expense", `SELECT COUNT(*) FROM expense_automatic_workflow_expense l
+		JOIN expense e ON e.id = l.expense_id WHERE e.user_id = ?`},
+	{"additional_balance", "SELECT COUNT(*) FROM additional_balance WHERE user_id = ?"},
+	{"balance_history", "SELECT COUNT(*) FROM balance_history WHERE user_id = ?"},
+	{"balance_discrepancy", "SELECT COUNT(*) FROM balance_discrepancy WHERE user_id = ?"},
+	{"user_month_summary", "SELECT COUNT(*) FROM user_month_summary WHERE user_id = ?"},
+	{"service_payment", "SELECT COUNT(*) FROM service_payment WHERE user_id = ?"},
+}
+
+// UserErasureRepository erases users and stores the erasure receipts
+type UserErasureRepository struct {
+	conn *Connection
+}
+
+// NewUserErasureRepository creates a new UserErasureRepository
+func NewUserErasureRepository(conn *Connection) *UserErasureRepository {
+	return &UserErasureRepository{conn: conn}
+}
+
+// EraseUser deletes a user and, through the cascading foreign keys, every row it owns, in one
+// transaction. user_email_conflict has no foreign keys, so its rows about the user are
+// anonymized instead. userID 0 erases nothing but still anonymizes the conflicts of
+// sourceID, for users already gone from MariaDB. It returns the affected rows per table.
+func (r *UserErasureRepository) EraseUser(userID int64, sourceID string) (map[string]int64, error) {
+	tx, err := r.conn.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	counts := make(map[string]int64)
+	if userID != 0 {
+		for _, c := range erasureCounts {
+			var n int64
+			if err := tx.QueryRow(c.query, userID).Scan(&n); err != nil {
+				return nil, fmt.Errorf("failed to count %s rows: %w", c.table, err)
+			}
+			if n > 0 {
+				counts[c.table] = n
+			}
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE user_email_conflict SET email = ?, renamed_email = NULL
+		WHERE (stale_user_id = ? OR kept_user_id = ? OR incoming_source_id = ? OR stale_source_id = ?)
+			AND email <> ?`,
+		erasedEmail, userID, userID, sourceID, sourceID, erasedEmail,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to anonymize user email conflicts: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		counts["user_email_conflict"] = n
+	}
+
+	if userID != 0 {
+		if _, err := tx.Exec("DELETE FROM user WHERE id = ?", userID); err != nil {
+			return nil, fmt.Errorf("failed to delete user: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user erasure: %w", err)
+	}
+	return counts, nil
+}
+
+// RecordReceipt inserts a signed erasure receipt
+func (r *UserErasureRepository) RecordReceipt(e *models.UserErasure) error {
+	mariadbRows, err := json.Marshal(e.MariaDBRows)
+	if err != nil {
+		return fmt.Errorf("failed to encode erased rows: %w", err)
+	}
+	mongodbDocuments, err := json.Marshal(e.MongoDBDocuments)
+	if err != nil {
+		return fmt.Errorf("failed to encode erased documents: %w", err)
+	}
+
+	result, err := r.conn.db.Exec(`
+		INSERT INTO user_erasure (guid, user_source_id, requested_by, requested_at, completed_at,
+			status, status_reason, mariadb_rows, mongodb_documents, blobs_deleted, signature, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.GUID, e.UserSourceID, e.RequestedBy, e.RequestedAt, e.CompletedAt,
+		e.Status, sql.NullString{String: e.StatusReason, Valid: e.StatusReason != ""},
+		string(mariadbRows), string(mongodbDocuments), e.BlobsDeleted, e.Signature, time.Now(), ServiceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record erasure receipt: %w", err)
+	}
+	e.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetReceipt retrieves an erasure receipt by GUID, or nil when there is none
+func (r *UserErasureRepository) GetReceipt(guid string) (*models.UserErasure, error) {
+	e := &models.UserErasure{}
+	var mariadbRows, mongodbDocuments string
+	var statusReason sql.NullString
 	err := r.conn.db.QueryRow(`
-		SELECT id, guid, source_id, first_name, last_name, email, fl_admin, monthly_income,
-			fl_payment_requested, fl_payment_pending, fl_payment_paid, current_spending_date,
-			created_at, created_by, updated_at, updated_by
-		FROM user WHERE source_id = ?`, sourceID,
+		SELECT id, guid, user_source_id, requested_by, requested_at, completed_at,
+			status, status_reason, mariadb_rows, mongodb_documents, blobs_deleted, signature
+		FROM user_erasure WHERE guid = ?`, guid,
 	).Scan(
-		&user.ID, &user.GUID, &user.SourceID, &user.FirstName, &user.LastName, &user.Email, &user.FlAdmin, &user.MonthlyIncome,
-		&user.FlPaymentRequested, &user.FlPaymentPending, &user.FlPaymentPaid, &user.CurrentSpendingDate,
-		&user.CreatedAt, &user.CreatedBy, &user.UpdatedAt, &user.UpdatedBy,
+		&e.ID, &e.GUID, &e.UserSourceID, &e.RequestedBy, &e.RequestedAt, &e.CompletedAt,
+		&e.Status, &statusReason, &mariadbRows, &mongodbDocuments, &e.BlobsDeleted, &e.Signature,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by source_id: %w", err)
+		return nil, fmt.Errorf("failed to get erasure receipt: %w", err)
 	}
-	return user, nil
+	e.StatusReason = statusReason.String
+
+	if err := json.Unmarshal([]byte(mariadbRows), &e.MariaDBRows); err != nil {
+		return nil, fmt.Errorf("failed to decode erased rows: %w", err)
+	}
+	if err := json.Unmarshal([]byte(mongodbDocuments), &e.MongoDBDocuments); err != nil {
+		return nil, fmt.Errorf("failed to decode erased documents: %w", err)
+	}
+	return e, nil
 }
 
 // ExpenseRepository handles expense database operations
@@ -142,10 +540,12 @@ func (r *ExpenseRepository) UpsertExpense(expense *models.Expense) error {
 		result, err := r.conn.db.Exec(`
 			INSERT INTO expense (guid, source_id, user_id, spending_date__YYYY_MM, id_status, id_type,
 				validity_period_date, fl_indeterminate_validity_period_date, name, total_amount, total_paid_amount,
+				currency_code, exchange_rate, total_amount_base, total_paid_amount_base,
 				created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			newGUID, expense.SourceID, expense.UserID, expense.SpendingDateYYYYMM, expense.IDStatus, expense.IDType,
 			expense.ValidityPeriodDate, expense.FlIndeterminateValidityPeriodDate, expense.Name, expense.TotalAmount, expense.TotalPaidAmount,
+			expense.CurrencyCode, expense.ExchangeRate, expense.TotalAmountBase, expense.TotalPaidAmountBase,
 			time.Now(), ServiceName,
 		)
 		if err != nil {
@@ -162,10 +562,12 @@ func (r *ExpenseRepository) UpsertExpense(expense *models.Expense) error {
 	_, err = r.conn.db.Exec(`
 		UPDATE expense SET user_id = ?, spending_date__YYYY_MM = ?, id_status = ?, id_type = ?,
 			validity_period_date = ?, fl_indeterminate_validity_period_date = ?, name = ?, total_amount = ?, total_paid_amount = ?,
+			currency_code = ?, exchange_rate = ?, total_amount_base = ?, total_paid_amount_base = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
 		expense.UserID, expense.SpendingDateYYYYMM, expense.IDStatus, expense.IDType,
 		expense.ValidityPeriodDate, expense.FlIndeterminateValidityPeriodDate, expense.Name, expense.TotalAmount, expense.TotalPaidAmount,
+		expense.CurrencyCode, expense.ExchangeRate, expense.TotalAmountBase, expense.TotalPaidAmountBase,
 		time.Now(), ServiceName, expense.SourceID,
 	)
 	if err != nil {
@@ -189,6 +591,7 @@ func (r *ExpenseRepository) GetExpenseByNameValidityUser(name string, validity s
 	err := r.conn.db.QueryRow(`
 		SELECT id, guid, source_id, user_id, spending_date__YYYY_MM, id_status, id_type,
 			validity_period_date, fl_indeterminate_validity_period_date, name, total_amount, total_paid_amount,
+			currency_code, exchange_rate, total_amount_base, total_paid_amount_base,
 			created_at, created_by, updated_at, updated_by
 		FROM expense
 		WHERE user_id = ? AND name = ? AND (spending_date__YYYY_MM = '' OR spending_date__YYYY_MM IS NULL)
@@ -197,6 +600,7 @@ func (r *ExpenseRepository) GetExpenseByNameValidityUser(name string, validity s
 	).Scan(
 		&expense.ID, &expense.GUID, &expense.SourceID, &expense.UserID, &expense.SpendingDateYYYYMM, &expense.IDStatus, &expense.IDType,
 		&expense.ValidityPeriodDate, &expense.FlIndeterminateValidityPeriodDate, &expense.Name, &expense.TotalAmount, &expense.TotalPaidAmount,
+		&expense.CurrencyCode, &expense.ExchangeRate, &expense.TotalAmountBase, &expense.TotalPaidAmountBase,
 		&expense.CreatedAt, &expense.CreatedBy, &expense.UpdatedAt, &expense.UpdatedBy,
 	)
 	if err == sql.ErrNoRows {
@@ -208,6 +612,65 @@ func (r *ExpenseRepository) GetExpenseByNameValidityUser(name string, validity s
 	return expense, nil
 }
 
+// GetExpenseIDBySourceID returns the ID of the expense synced from a MongoDB document
+func (r *ExpenseRepository) GetExpenseIDBySourceID(sourceID string) (int64, bool, error) {
+	var id int64
+	err := r.conn.db.QueryRow("SELECT id FROM expense WHERE source_id = ?", sourceID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get expense by source_id: %w", err)
+	}
+	return id, true, nil
+}
+
+// GetUserMonthBySourceID returns the user and spending month an expense is currently stored
+// under, or nil when it is not stored yet or is an aggregate without a spending month
+func (r *ExpenseRepository) GetUserMonthBySourceID(sourceID string) (*models.UserMonth, error) {
+	um := &models.UserMonth{}
+	err := r.conn.db.QueryRow("SELECT user_id, spending_date__YYYY_MM FROM expense WHERE source_id = ?", sourceID).Scan(&um.UserID, &um.SpendingDateYYYYMM)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expense month by source_id: %w", err)
+	}
+	if um.SpendingDateYYYYMM == "" {
+		return nil, nil
+	}
+	return um, nil
+}
+
+// GetUnlinkedExpensesByUserAndMonth returns the id, name and total_amount of a user's expenses
+// in a spending month that are not linked to an automatic workflow other than workflowID
+func (r *ExpenseRepository) GetUnlinkedExpensesByUserAndMonth(userID int64, spendingDate string, workflowID int64) ([]models.Expense, error) {
+	rows, err := r.conn.db.Query(`
+		SELECT e.id, e.name, e.total_amount FROM expense e
+		WHERE e.user_id = ? AND e.spending_date__YYYY_MM = ?
+			AND NOT EXISTS (
+				SELECT 1 FROM expense_automatic_workflow_expense l
+				WHERE l.expense_id = e.id AND l.expense_automatic_workflow_id != ?
+			)
+		ORDER BY e.id`,
+		userID, spendingDate, workflowID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unlinked expenses: %w", err)
+	}
+	defer rows.Close()
+
+	var expenses []models.Expense
+	for rows.Next() {
+		var expense models.Expense
+		if err := rows.Scan(&expense.ID, &expense.Name, &expense.TotalAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %w", err)
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, rows.Err()
+}
+
 // ExpenseInstallmentRepository handles expense installment database operations
 type ExpenseInstallmentRepository struct {
 	conn *Connection
@@ -231,9 +694,11 @@ func (r *ExpenseInstallmentRepository) UpsertExpenseInstallment(installment *mod
 			// Update existing installment
 			_, err = r.conn.db.Exec(`
 				UPDATE expense_installment SET expense_id = ?, amount = ?, paid_amount = ?, id_status = ?, due_date = ?,
+					exchange_rate = ?, amount_base = ?, paid_amount_base = ?,
 					updated_at = ?, updated_by = ?
 				WHERE guid = ?`,
 				installment.ExpenseID, installment.Amount, installment.PaidAmount, installment.IDStatus, installment.DueDate,
+				installment.ExchangeRate, installment.AmountBase, installment.PaidAmountBase,
 				time.Now(), ServiceName, installment.GUID,
 			)
 			if err != nil {
@@ -251,9 +716,11 @@ func (r *ExpenseInstallmentRepository) UpsertExpenseInstallment(installment *mod
 	newGUID := uuid.New().String()
 	result, err := r.conn.db.Exec(`
 		INSERT INTO expense_installment (guid, expense_id, amount, paid_amount, id_status, due_date,
+			exchange_rate, amount_base, paid_amount_base,
 			created_at, created_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		newGUID, installment.ExpenseID, installment.Amount, installment.PaidAmount, installment.IDStatus, installment.DueDate,
+		installment.ExchangeRate, installment.AmountBase, installment.PaidAmountBase,
 		time.Now(), ServiceName,
 	)
 	if err != nil {
@@ -275,6 +742,7 @@ func (r *ExpenseInstallmentRepository) GetInstallmentByExpenseAndDate(expenseID
 	// The due_date is stored as a DATE, so we compare using DATE_FORMAT to match YYYY/MM
 	err := r.conn.db.QueryRow(`
 		SELECT id, guid, expense_id, amount, paid_amount, id_status, due_date,
+			exchange_rate, amount_base, paid_amount_base,
 			created_at, created_by, updated_at, updated_by
 		FROM expense_installment
 		WHERE expense_id = ? AND DATE_FORMAT(due_date, '%Y/%m') = ?`,
@@ -282,6 +750,7 @@ func (r *ExpenseInstallmentRepository) GetInstallmentByExpenseAndDate(expenseID
 	).Scan(
 		&installment.ID, &installment.GUID, &installment.ExpenseID, &installment.Amount, &installment.PaidAmount,
 		&installment.IDStatus, &installment.DueDate,
+		&installment.ExchangeRate, &installment.AmountBase, &installment.PaidAmountBase,
 		&installment.CreatedAt, &installment.CreatedBy, &installment.UpdatedAt, &installment.UpdatedBy,
 	)
 	if err == sql.ErrNoRows {
@@ -368,9 +837,11 @@ func (r *AdditionalBalanceRepository) UpsertAdditionalBalance(ab *models.Additio
 		newGUID := uuid.New().String()
 		result, err := r.conn.db.Exec(`
 			INSERT INTO additional_balance (guid, source_id, user_id, spending_date__YYYY_MM, amount, description,
+				currency_code, exchange_rate, amount_base,
 				created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			newGUID, ab.SourceID, ab.UserID, ab.SpendingDateYYYYMM, ab.Amount, ab.Description,
+			ab.CurrencyCode, ab.ExchangeRate, ab.AmountBase,
 			time.Now(), ServiceName,
 		)
 		if err != nil {
@@ -386,9 +857,11 @@ func (r *AdditionalBalanceRepository) UpsertAdditionalBalance(ab *models.Additio
 
 	_, err = r.conn.db.Exec(`
 		UPDATE additional_balance SET user_id = ?, spending_date__YYYY_MM = ?, amount = ?, description = ?,
+			currency_code = ?, exchange_rate = ?, amount_base = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
 		ab.UserID, ab.SpendingDateYYYYMM, ab.Amount, ab.Description,
+		ab.CurrencyCode, ab.ExchangeRate, ab.AmountBase,
 		time.Now(), ServiceName, ab.SourceID,
 	)
 	if err != nil {
@@ -399,6 +872,20 @@ func (r *AdditionalBalanceRepository) UpsertAdditionalBalance(ab *models.Additio
 	return nil
 }
 
+// GetUserMonthBySourceID returns the user and spending month an additional balance is
+// currently stored under, or nil when it is not stored yet
+func (r *AdditionalBalanceRepository) GetUserMonthBySourceID(sourceID string) (*models.UserMonth, error) {
+	um := &models.UserMonth{}
+	err := r.conn.db.QueryRow("SELECT user_id, spending_date__YYYY_MM FROM additional_balance WHERE source_id = ?", sourceID).Scan(&um.UserID, &um.SpendingDateYYYYMM)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get additional balance month by source_id: %w", err)
+	}
+	return um, nil
+}
+
 // BalanceHistoryRepository handles balance history database operations
 type BalanceHistoryRepository struct {
 	conn *Connection
@@ -421,9 +908,11 @@ func (r *BalanceHistoryRepository) UpsertBalanceHistory(bh *models.BalanceHistor
 		newGUID := uuid.New().String()
 		result, err := r.conn.db.Exec(`
 			INSERT INTO balance_history (guid, source_id, user_id, spending_date__YYYY_MM, amount, last_month_amount, monthly_income,
+				currency_code, exchange_rate, amount_base, last_month_amount_base, monthly_income_base,
 				created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			newGUID, bh.SourceID, bh.UserID, bh.SpendingDateYYYYMM, bh.Amount, bh.LastMonthAmount, bh.MonthlyIncome,
+			bh.CurrencyCode, bh.ExchangeRate, bh.AmountBase, bh.LastMonthAmountBase, bh.MonthlyIncomeBase,
 			time.Now(), ServiceName,
 		)
 		if err != nil {
@@ -439,9 +928,11 @@ func (r *BalanceHistoryRepository) UpsertBalanceHistory(bh *models.BalanceHistor
 
 	_, err = r.conn.db.Exec(`
 		UPDATE balance_history SET user_id = ?, spending_date__YYYY_MM = ?, amount = ?, last_month_amount = ?, monthly_income = ?,
+			currency_code = ?, exchange_rate = ?, amount_base = ?, last_month_amount_base = ?, monthly_income_base = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
 		bh.UserID, bh.SpendingDateYYYYMM, bh.Amount, bh.LastMonthAmount, bh.MonthlyIncome,
+		bh.CurrencyCode, bh.ExchangeRate, bh.AmountBase, bh.LastMonthAmountBase, bh.MonthlyIncomeBase,
 		time.Now(), ServiceName, bh.SourceID,
 	)
 	if err != nil {
@@ -452,6 +943,348 @@ func (r *BalanceHistoryRepository) UpsertBalanceHistory(bh *models.BalanceHistor
 	return nil
 }
 
+// UserMonthSummaryRepository handles user month summary database operations
+type UserMonthSummaryRepository struct {
+	conn *Connection
+}
+
+// NewUserMonthSummaryRepository creates a new UserMonthSummaryRepository
+func NewUserMonthSummaryRepository(conn *Connection) *UserMonthSummaryRepository {
+	return &UserMonthSummaryRepository{conn: conn}
+}
+
+// RefreshSummary recomputes the summary of a user's month from expense, expense_installment
+// and additional_balance. The month's expenses are its simple expenses plus the installments
+// of aggregate expenses due in the month; installments count with their aggregate's type and
+// their own status. Totals add up the base-currency columns; rows without a base-currency
+// value are left out of them and counted apart. A month left without expenses and additional
+// balances loses its row.
+func (r *UserMonthSummaryRepository) RefreshSummary(userID int64, month string) error {
+	start, err := dates.ParseMonthKey(month)
+	if err != nil {
+		return fmt.Errorf("invalid summary month: %w", err)
+	}
+	end := start.AddDate(0, 1, 0)
+
+	tx, err := r.conn.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO user_month_summary (guid, user_id, spending_date__YYYY_MM,
+			total_expense_amount, total_paid_amount, total_pending_amount, total_additional_amount,
+			expense_count, additional_balance_count, unconverted_expense_count, unconverted_additional_balance_count,
+			type_expense_count, type_invoice_count, type_savings_count,
+			status_pending_count, status_partially_paid_count, status_paid_count, refreshed_at, created_at, created_by)
+		SELECT ?, ?, ?,
+			COALESCE(SUM(i.amount), 0), COALESCE(SUM(i.paid_amount), 0), COALESCE(SUM(GREATEST(i.amount - i.paid_amount, 0)), 0),
+			ab.total, COUNT(i.present), ab.count, COUNT(CASE WHEN i.present = 1 AND i.amount IS NULL THEN 1 END), ab.unconverted,
+			COUNT(CASE WHEN t.name = 'expense' THEN 1 END), COUNT(CASE WHEN t.name = 'invoice' THEN 1 END),
+			COUNT(CASE WHEN t.name = 'savings' THEN 1 END),
+			COUNT(CASE WHEN st.name = 'pending' THEN 1 END), COUNT(CASE WHEN st.name = 'partially_paid' THEN 1 END),
+			COUNT(CASE WHEN st.name = 'paid' THEN 1 END),
+			?, ?, ?
+		FROM (SELECT COALESCE(SUM(amount_base), 0) AS total, COUNT(*) AS count,
+				COUNT(CASE WHEN amount_base IS NULL THEN 1 END) AS unconverted
+			FROM additional_balance
+			WHERE user_id = ? AND spending_date__YYYY_MM = ?) ab
+		LEFT JOIN (
+			SELECT 1 AS present, e.total_amount_base AS amount, e.total_paid_amount_base AS paid_amount, e.id_type, e.id_status
+			FROM expense e
+			WHERE e.user_id = ? AND e.spending_date__YYYY_MM = ?
+			UNION ALL
+			SELECT 1, ei.amount_base, ei.paid_amount_base, e.id_type, ei.id_status
+			FROM expense_installment ei JOIN expense e ON e.id = ei.expense_id
+			WHERE e.user_id = ? AND ei.due_date >= ? AND ei.due_date < ?
+		) i ON 1 = 1
+		LEFT JOIN domain t ON t.id = i.id_type
+		LEFT JOIN domain st ON st.id = i.id_status
+		GROUP BY ab.total, ab.count, ab.unconverted
+		ON DUPLICATE KEY UPDATE
+			total_expense_amount = VALUES(total_expense_amount),
+			total_paid_amount = VALUES(total_paid_amount),
+			total_pending_amount = VALUES(total_pending_amount),
+			total_additional_amount = VALUES(total_additional_amount),
+			expense_count = VALUES(expense_count),
+			additional_balance_count = VALUES(additional_balance_count),
+			unconverted_expense_count = VALUES(unconverted_expense_count),
+			unconverted_additional_balance_count = VALUES(unconverted_additional_balance_count),
+			type_expense_count = VALUES(type_expense_count),
+			type_invoice_count = VALUES(type_invoice_count),
+			type_savings_count = VALUES(type_savings_count),
+			status_pending_count = VALUES(status_pending_count),
+			status_partially_paid_count = VALUES(status_partially_paid_count),
+			status_paid_count = VALUES(status_paid_count),
+			refreshed_at = VALUES(refreshed_at),
+			updated_at = ?, updated_by = ?`,
+		uuid.New().String(), userID, month,
+		now, now, ServiceName,
+		userID, month,
+		userID, month,
+		userID, start, end,
+		now, ServiceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to refresh user month summary: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM user_month_summary
+		WHERE user_id = ? AND spending_date__YYYY_MM = ? AND expense_count = 0 AND additional_balance_count = 0`,
+		userID, month,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete empty user month summary: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user month summary: %w", err)
+	}
+	return nil
+}
+
+// GetUserMonths returns every user and month that has expenses, installments or
+// additional balances, which is the set of rows a full rebuild produces. A non-zero userID
+// restricts the result to that user.
+func (r *UserMonthSummaryRepository) GetUserMonths(userID int64) ([]models.UserMonth, error) {
+	rows, err := r.conn.db.Query(`
+		SELECT user_id, month FROM (
+			SELECT user_id, spending_date__YYYY_MM AS month FROM expense WHERE spending_date__YYYY_MM <> ''
+			UNION
+			SELECT e.user_id, DATE_FORMAT(ei.due_date, '%Y/%m') FROM expense_installment ei JOIN expense e ON e.id = ei.expense_id
+			WHERE ei.due_date IS NOT NULL
+			UNION
+			SELECT user_id, spending_date__YYYY_MM FROM additional_balance WHERE spending_date__YYYY_MM <> ''
+		) user_months
+		WHERE ? = 0 OR user_id = ?
+		ORDER BY user_id, month`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user months: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.UserMonth
+	for rows.Next() {
+		var um models.UserMonth
+		if err := rows.Scan(&um.UserID, &um.SpendingDateYYYYMM); err != nil {
+			return nil, fmt.Errorf("failed to scan user month: %w", err)
+		}
+		result = append(result, um)
+	}
+	return result, rows.Err()
+}
+
+// DeleteStaleSummaries removes summary rows refreshed before the given instant, which after a
+// full rebuild are the months that no longer have any data. The instant is truncated to the
+// second, the precision of refreshed_at, so rows refreshed during the rebuild are kept.
+func (r *UserMonthSummaryRepository) DeleteStaleSummaries(before time.Time) (int64, error) {
+	result, err := r.conn.db.Exec("DELETE FROM user_month_summary WHERE refreshed_at < ?", before.Truncate(time.Second))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale user month summaries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// previousMonthSQL is the YYYY/MM month before the month of the balance_history row bh
+const previousMonthSQL = `DATE_FORMAT(STR_TO_DATE(CONCAT(bh.spending_date__YYYY_MM, '/01'), '%Y/%m/%d') - INTERVAL 1 MONTH, '%Y/%m')`
+
+// BalanceDiscrepancyRepository handles balance verification database operations
+type BalanceDiscrepancyRepository struct {
+	conn *Connection
+}
+
+// NewBalanceDiscrepancyRepository creates a new BalanceDiscrepancyRepository
+func NewBalanceDiscrepancyRepository(conn *Connection) *BalanceDiscrepancyRepository {
+	return &BalanceDiscrepancyRepository{conn: conn}
+}
+
+// GetBalanceComponents returns the balance_history rows matching the filter, ordered by id,
+// with the previous month's balance, the month's additional balances and the month's
+// expenses of the same user. Expenses are simple expenses of the month plus installments
+// of aggregate expenses due in the month. Amounts are the base-currency columns; rows
+// whose amount has no base-currency value are counted in UnconvertedRows instead.
+func (r *BalanceDiscrepancyRepository) GetBalanceComponents(filter models.BalanceFilter) ([]models.BalanceComponents, error) {
+	query := `
+		SELECT bh.id, bh.user_id, u.source_id, bh.spending_date__YYYY_MM, COALESCE(bh.amount_base, 0),
+			COALESCE(bh.last_month_amount_base, 0), COALESCE(bh.monthly_income_base, 0),
+			u.monthly_income,
+			(SELECT prev.amount_base FROM balance_history prev
+				WHERE prev.user_id = bh.user_id
+					AND prev.spending_date__YYYY_MM = ` + previousMonthSQL + `
+				ORDER BY prev.id DESC LIMIT 1),
+			(SELECT COALESCE(SUM(ab.amount_base), 0) FROM additional_balance ab
+				WHERE ab.user_id = bh.user_id AND ab.spending_date__YYYY_MM = bh.spending_date__YYYY_MM),
+			(SELECT COALESCE(SUM(e.total_amount_base), 0) FROM expense e
+				WHERE e.user_id = bh.user_id AND e.spending_date__YYYY_MM = bh.spending_date__YYYY_MM)
+			+ (SELECT COALESCE(SUM(ei.amount_base), 0) FROM expense_installment ei JOIN expense e ON e.id = ei.expense_id
+				WHERE e.user_id = bh.user_id AND DATE_FORMAT(ei.due_date, '%Y/%m') = bh.spending_date__YYYY_MM),
+			(SELECT COALESCE(SUM(e.total_paid_amount_base), 0) FROM expense e
+				WHERE e.user_id = bh.user_id AND e.spending_date__YYYY_MM = bh.spending_date__YYYY_MM)
+			+ (SELECT COALESCE(SUM(ei.paid_amount_base), 0) FROM expense_installment ei JOIN expense e ON e.id = ei.expense_id
+				WHERE e.user_id = bh.user_id AND DATE_FORMAT(ei.due_date, '%Y/%m') = bh.spending_date__YYYY_MM),
+			(bh.amount_base IS NULL)
+			+ (SELECT COUNT(*) FROM balance_history prev
+				WHERE prev.user_id = bh.user_id AND prev.amount_base IS NULL
+					AND prev.spending_date__YYYY_MM = ` + previousMonthSQL + `)
+			+ (SELECT COUNT(*) FROM additional_balance ab
+				WHERE ab.user_id = bh.user_id AND ab.spending_date__YYYY_MM = bh.spending_date__YYYY_MM AND ab.amount_base IS NULL)
+			+ (SELECT COUNT(*) FROM expense e
+				WHERE e.user_id = bh.user_id AND e.spending_date__YYYY_MM = bh.spending_date__YYYY_MM AND e.total_amount_base IS NULL)
+			+ (SELECT COUNT(*) FROM expense_installment ei JOIN expense e ON e.id = ei.expense_id
+				WHERE e.user_id = bh.user_id AND DATE_FORMAT(ei.due_date, '%Y/%m') = bh.spending_date__YYYY_MM AND ei.amount_base IS NULL)
+		FROM balance_history bh
+		JOIN user u ON u.id = bh.user_id
+		WHERE bh.spending_date__YYYY_MM <> '' AND bh.id > ?`
+	args := []interface{}{filter.AfterID}
+
+	if filter.UserID != 0 {
+		query += " AND bh.user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.SpendingDateYYYYMM != "" {
+		query += " AND bh.spending_date__YYYY_MM = ?"
+		args = append(args, filter.SpendingDateYYYYMM)
+	}
+	if len(filter.BalanceHistoryIDs) > 0 {
+		query += " AND bh.id IN (?" + strings.Repeat(", ?", len(filter.BalanceHistoryIDs)-1) + ")"
+		for _, id := range filter.BalanceHistoryIDs {
+			args = append(args, id)
+		}
+	}
+	query += " ORDER BY bh.id"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.conn.readDB().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance components: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.BalanceComponents
+	for rows.Next() {
+		var c models.BalanceComponents
+		if err := rows.Scan(&c.BalanceHistoryID, &c.UserID, &c.UserSourceID, &c.SpendingDateYYYYMM, &c.RecordedAmount,
+			&c.RecordedLastMonthAmount, &c.RecordedMonthlyIncome, &c.UserMonthlyIncome, &c.PreviousAmount,
+			&c.AdditionalAmount, &c.ExpenseAmount, &c.ExpensePaidAmount, &c.UnconvertedRows); err != nil {
+			return nil, fmt.Errorf("failed to scan balance components: %w", err)
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// UpsertDiscrepancy inserts or updates the discrepancy of a balance_history row
+func (r *BalanceDiscrepancyRepository) UpsertDiscrepancy(d *models.BalanceDiscrepancy) error {
+	// Check if the discrepancy exists by balance history
+	var existingID int64
+	var existingGUID string
+	err := r.conn.db.QueryRow("SELECT id, guid FROM balance_discrepancy WHERE balance_history_id = ?", d.BalanceHistoryID).Scan(&existingID, &existingGUID)
+
+	if err == sql.ErrNoRows {
+		newGUID := uuid.New().String()
+		result, err := r.conn.db.Exec(`
+			INSERT INTO balance_discrepancy (guid, balance_history_id, user_id, spending_date__YYYY_MM, basis, reasons,
+				recorded_amount, expected_amount, difference_amount, recorded_last_month_amount, expected_last_month_amount,
+				recorded_monthly_income, expected_monthly_income, additional_amount, expense_amount, verified_at,
+				created_at, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			newGUID, d.BalanceHistoryID, d.UserID, d.SpendingDateYYYYMM, d.Basis, d.Reasons,
+			d.RecordedAmount, d.ExpectedAmount, d.DifferenceAmount, d.RecordedLastMonthAmount, d.ExpectedLastMonthAmount,
+			d.RecordedMonthlyIncome, d.ExpectedMonthlyIncome, d.AdditionalAmount, d.ExpenseAmount, d.VerifiedAt,
+			time.Now(), ServiceName,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert balance discrepancy: %w", err)
+		}
+		id, _ := result.LastInsertId()
+		d.ID = id
+		d.GUID = newGUID
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check balance discrepancy existence: %w", err)
+	}
+
+	_, err = r.conn.db.Exec(`
+		UPDATE balance_discrepancy SET user_id = ?, spending_date__YYYY_MM = ?, basis = ?, reasons = ?,
+			recorded_amount = ?, expected_amount = ?, difference_amount = ?, recorded_last_month_amount = ?,
+			expected_last_month_amount = ?, recorded_monthly_income = ?, expected_monthly_income = ?,
+			additional_amount = ?, expense_amount = ?, verified_at = ?,
+			updated_at = ?, updated_by = ?
+		WHERE id = ?`,
+		d.UserID, d.SpendingDateYYYYMM, d.Basis, d.Reasons,
+		d.RecordedAmount, d.ExpectedAmount, d.DifferenceAmount, d.RecordedLastMonthAmount,
+		d.ExpectedLastMonthAmount, d.RecordedMonthlyIncome, d.ExpectedMonthlyIncome,
+		d.AdditionalAmount, d.ExpenseAmount, d.VerifiedAt,
+		time.Now(), ServiceName, existingID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update balance discrepancy: %w", err)
+	}
+	d.ID = existingID
+	d.GUID = existingGUID
+	return nil
+}
+
+// DeleteDiscrepancy removes the discrepancy of a balance_history row that now verifies
+func (r *BalanceDiscrepancyRepository) DeleteDiscrepancy(balanceHistoryID int64) error {
+	if _, err := r.conn.db.Exec("DELETE FROM balance_discrepancy WHERE balance_history_id = ?", balanceHistoryID); err != nil {
+		return fmt.Errorf("failed to delete balance discrepancy: %w", err)
+	}
+	return nil
+}
+
+// GetDiscrepancies returns the recorded discrepancies, largest difference first.
+// A zero userID or empty month matches every user or month.
+func (r *BalanceDiscrepancyRepository) GetDiscrepancies(userID int64, month string, limit int) ([]models.BalanceDiscrepancy, error) {
+	query := `
+		SELECT d.id, d.guid, d.balance_history_id, d.user_id, u.source_id, d.spending_date__YYYY_MM, d.basis, d.reasons,
+			d.recorded_amount, d.expected_amount, d.difference_amount, d.recorded_last_month_amount,
+			d.expected_last_month_amount, d.recorded_monthly_income, d.expected_monthly_income,
+			d.additional_amount, d.expense_amount, d.verified_at
+		FROM balance_discrepancy d
+		JOIN user u ON u.id = d.user_id
+		WHERE 1 = 1`
+	var args []interface{}
+	if userID != 0 {
+		query += " AND d.user_id = ?"
+		args = append(args, userID)
+	}
+	if month != "" {
+		query += " AND d.spending_date__YYYY_MM = ?"
+		args = append(args, month)
+	}
+	query += " ORDER BY ABS(d.difference_amount) DESC, d.id"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := r.conn.readDB().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance discrepancies: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.BalanceDiscrepancy
+	for rows.Next() {
+		var d models.BalanceDiscrepancy
+		if err := rows.Scan(&d.ID, &d.GUID, &d.BalanceHistoryID, &d.UserID, &d.UserSourceID, &d.SpendingDateYYYYMM, &d.Basis, &d.Reasons,
+			&d.RecordedAmount, &d.ExpectedAmount, &d.DifferenceAmount, &d.RecordedLastMonthAmount,
+			&d.ExpectedLastMonthAmount, &d.RecordedMonthlyIncome, &d.ExpectedMonthlyIncome,
+			&d.AdditionalAmount, &d.ExpenseAmount, &d.VerifiedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan balance discrepancy: %w", err)
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
 // ExpenseAutomaticWorkflowRepository handles expense automatic workflow database operations
 type ExpenseAutomaticWorkflowRepository struct {
 	conn *Connection
@@ -464,20 +1297,27 @@ func NewExpenseAutomaticWorkflowRepository(conn *Connection) *ExpenseAutomaticWo
 
 // UpsertExpenseAutomaticWorkflow inserts or updates an expense automatic workflow
 func (r *ExpenseAutomaticWorkflowRepository) UpsertExpenseAutomaticWorkflow(eaw *models.ExpenseAutomaticWorkflow) error {
+	description, err := r.conn.encryptNull("expense_automatic_workflow", "description", eaw.Description)
+	if err != nil {
+		return err
+	}
+
 	// Check if expense automatic workflow exists by source_id (MongoDB document ID)
 	var existingID int64
 	var existingGUID string
-	err := r.conn.db.QueryRow("SELECT id, guid FROM expense_automatic_workflow WHERE source_id = ?", eaw.SourceID).Scan(&existingID, &existingGUID)
+	err = r.conn.db.QueryRow("SELECT id, guid FROM expense_automatic_workflow WHERE source_id = ?", eaw.SourceID).Scan(&existingID, &existingGUID)
 
 	if err == sql.ErrNoRows {
 		// Insert new expense automatic workflow with a new random UUID for guid
 		newGUID := uuid.New().String()
 		result, err := r.conn.db.Exec(`
-			INSERT INTO expense_automatic_workflow (guid, source_id, user_id, base64_image, description, extracted_expense_content_from_image,
-				spending_date__YYYY_MM, sync_processed_date, id_sync_status, processing_message, created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			newGUID, eaw.SourceID, eaw.UserID, eaw.Base64Image, eaw.Description, eaw.ExtractedExpenseContentFromImage,
-			eaw.SpendingDateYYYYMM, eaw.SyncProcessedDate, eaw.IDSyncStatus, eaw.ProcessingMessage, time.Now(), ServiceName,
+			INSERT INTO expense_automatic_workflow (guid, source_id, user_id, base64_image, image_sha256, image_mime_type, image_size,
+				description, extracted_expense_content_from_image,
+				fl_extracted_content_unparsed, spending_date__YYYY_MM, sync_processed_date, id_sync_status, processing_message, created_at, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			newGUID, eaw.SourceID, eaw.UserID, eaw.Base64Image, eaw.ImageSHA256, eaw.ImageMimeType, eaw.ImageSize,
+			description, eaw.ExtractedExpenseContentFromImage,
+			eaw.FlExtractedContentUnparsed, eaw.SpendingDateYYYYMM, eaw.SyncProcessedDate, eaw.IDSyncStatus, eaw.ProcessingMessage, time.Now(), ServiceName,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert expense automatic workflow: %w", err)
@@ -491,12 +1331,14 @@ func (r *ExpenseAutomaticWorkflowRepository) UpsertExpenseAutomaticWorkflow(eaw
 	}
 
 	_, err = r.conn.db.Exec(`
-		UPDATE expense_automatic_workflow SET user_id = ?, base64_image = ?, description = ?, extracted_expense_content_from_image = ?,
-			spending_date__YYYY_MM = ?, sync_processed_date = ?, id_sync_status = ?, processing_message = ?,
+		UPDATE expense_automatic_workflow SET user_id = ?, base64_image = ?, image_sha256 = ?, image_mime_type = ?, image_size = ?,
+			description = ?, extracted_expense_content_from_image = ?,
+			fl_extracted_content_unparsed = ?, spending_date__YYYY_MM = ?, sync_processed_date = ?, id_sync_status = ?, processing_message = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
-		eaw.UserID, eaw.Base64Image, eaw.Description, eaw.ExtractedExpenseContentFromImage,
-		eaw.SpendingDateYYYYMM, eaw.SyncProcessedDate, eaw.IDSyncStatus, eaw.ProcessingMessage,
+		eaw.UserID, eaw.Base64Image, eaw.ImageSHA256, eaw.ImageMimeType, eaw.ImageSize,
+		description, eaw.ExtractedExpenseContentFromImage,
+		eaw.FlExtractedContentUnparsed, eaw.SpendingDateYYYYMM, eaw.SyncProcessedDate, eaw.IDSyncStatus, eaw.ProcessingMessage,
 		time.Now(), ServiceName, eaw.SourceID,
 	)
 	if err != nil {
@@ -507,6 +1349,207 @@ func (r *ExpenseAutomaticWorkflowRepository) UpsertExpenseAutomaticWorkflow(eaw
 	return nil
 }
 
+// GetWorkflowIDBySourceID returns the ID of the expense automatic workflow synced from a MongoDB document
+func (r *ExpenseAutomaticWorkflowRepository) GetWorkflowIDBySourceID(sourceID string) (int64, bool, error) {
+	var id int64
+	err := r.conn.db.QueryRow("SELECT id FROM expense_automatic_workflow WHERE source_id = ?", sourceID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get expense automatic workflow by source_id: %w", err)
+	}
+	return id, true, nil
+}
+
+// GetImageKeysByUser returns the distinct blob keys of the receipt images of a user's workflows
+func (r *ExpenseAutomaticWorkflowRepository) GetImageKeysByUser(userID int64) ([]string, error) {
+	rows, err := r.conn.db.Query(
+		"SELECT DISTINCT image_sha256 FROM expense_automatic_workflow WHERE user_id = ? AND image_sha256 IS NOT NULL",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow image keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow image key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// IsImageReferenced reports whether any workflow still references a receipt image blob
+func (r *ExpenseAutomaticWorkflowRepository) IsImageReferenced(key string) (bool, error) {
+	var referenced bool
+	err := r.conn.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM expense_automatic_workflow WHERE image_sha256 = ?)", key,
+	).Scan(&referenced)
+	if err != nil {
+		return false, fmt.Errorf("failed to check workflow image references: %w", err)
+	}
+	return referenced, nil
+}
+
+// GetWorkflowsWithInlineImages returns up to limit workflows with an id above afterID that still
+// store their image in base64_image, with only the id, source_id and base64_image columns set
+func (r *ExpenseAutomaticWorkflowRepository) GetWorkflowsWithInlineImages(afterID int64, limit int) ([]models.ExpenseAutomaticWorkflow, error) {
+	rows, err := r.conn.db.Query(`
+		SELECT id, source_id, base64_image FROM expense_automatic_workflow
+		WHERE id > ? AND base64_image IS NOT NULL AND base64_image != ''
+		ORDER BY id
+		LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflows with inline images: %w", err)
+	}
+	defer rows.Close()
+
+	var workflows []models.ExpenseAutomaticWorkflow
+	for rows.Next() {
+		var eaw models.ExpenseAutomaticWorkflow
+		if err := rows.Scan(&eaw.ID, &eaw.SourceID, &eaw.Base64Image); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow: %w", err)
+		}
+		workflows = append(workflows, eaw)
+	}
+	return workflows, rows.Err()
+}
+
+// SetImage points a workflow at its image in the blob store and drops the inline copy
+func (r *ExpenseAutomaticWorkflowRepository) SetImage(id int64, sha256, mimeType string, size int64) error {
+	_, err := r.conn.db.Exec(`
+		UPDATE expense_automatic_workflow SET base64_image = NULL, image_sha256 = ?, image_mime_type = ?, image_size = ?,
+			updated_at = ?, updated_by = ?
+		WHERE id = ?`,
+		sha256, mimeType, size, time.Now(), ServiceName, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set workflow image: %w", err)
+	}
+	return nil
+}
+
+// ExpenseAutomaticWorkflowItemRepository handles expense automatic workflow item database operations
+type ExpenseAutomaticWorkflowItemRepository struct {
+	conn *Connection
+}
+
+// NewExpenseAutomaticWorkflowItemRepository creates a new ExpenseAutomaticWorkflowItemRepository
+func NewExpenseAutomaticWorkflowItemRepository(conn *Connection) *ExpenseAutomaticWorkflowItemRepository {
+	return &ExpenseAutomaticWorkflowItemRepository{conn: conn}
+}
+
+// ReplaceItems replaces every item of a workflow in a single transaction,
+// so a re-synced workflow never ends up with a mix of old and new items
+func (r *ExpenseAutomaticWorkflowItemRepository) ReplaceItems(workflowID int64, items []models.ExpenseAutomaticWorkflowItem) error {
+	tx, err := r.conn.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM expense_automatic_workflow_item WHERE expense_automatic_workflow_id = ?", workflowID); err != nil {
+		return fmt.Errorf("failed to delete expense automatic workflow items: %w", err)
+	}
+
+	now := time.Now()
+	for i := range items {
+		item := &items[i]
+		item.ExpenseAutomaticWorkflowID = workflowID
+		item.GUID = uuid.New().String()
+
+		result, err := tx.Exec(`
+			INSERT INTO expense_automatic_workflow_item (guid, expense_automatic_workflow_id, position, name, amount,
+				currency_code, item_date, confidence, raw_text, created_at, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			item.GUID, item.ExpenseAutomaticWorkflowID, item.Position, item.Name, item.Amount,
+			item.CurrencyCode, item.ItemDate, item.Confidence, item.RawText, now, ServiceName,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert expense automatic workflow item %d: %w", item.Position, err)
+		}
+		item.ID, _ = result.LastInsertId()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit expense automatic workflow items: %w", err)
+	}
+	return nil
+}
+
+// ExpenseAutomaticWorkflowExpenseRepository handles workflow to expense link database operations
+type ExpenseAutomaticWorkflowExpenseRepository struct {
+	conn *Connection
+}
+
+// NewExpenseAutomaticWorkflowExpenseRepository creates a new ExpenseAutomaticWorkflowExpenseRepository
+func NewExpenseAutomaticWorkflowExpenseRepository(conn *Connection) *ExpenseAutomaticWorkflowExpenseRepository {
+	return &ExpenseAutomaticWorkflowExpenseRepository{conn: conn}
+}
+
+// UpsertLink inserts or updates the link between a workflow and an expense
+func (r *ExpenseAutomaticWorkflowExpenseRepository) UpsertLink(link *models.ExpenseAutomaticWorkflowExpense) error {
+	// Check if the link exists by workflow and expense
+	var existingID int64
+	var existingGUID string
+	err := r.conn.db.QueryRow(`
+		SELECT id, guid FROM expense_automatic_workflow_expense
+		WHERE expense_automatic_workflow_id = ? AND expense_id = ?`,
+		link.ExpenseAutomaticWorkflowID, link.ExpenseID,
+	).Scan(&existingID, &existingGUID)
+
+	if err == sql.ErrNoRows {
+		newGUID := uuid.New().String()
+		result, err := r.conn.db.Exec(`
+			INSERT INTO expense_automatic_workflow_expense (guid, expense_automatic_workflow_id, expense_id,
+				expense_automatic_workflow_item_id, match_method, created_at, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			newGUID, link.ExpenseAutomaticWorkflowID, link.ExpenseID,
+			link.ExpenseAutomaticWorkflowItemID, link.MatchMethod, time.Now(), ServiceName,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert expense automatic workflow link: %w", err)
+		}
+		id, _ := result.LastInsertId()
+		link.ID = id
+		link.GUID = newGUID
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check expense automatic workflow link existence: %w", err)
+	}
+
+	_, err = r.conn.db.Exec(`
+		UPDATE expense_automatic_workflow_expense SET expense_automatic_workflow_item_id = ?, match_method = ?,
+			updated_at = ?, updated_by = ?
+		WHERE id = ?`,
+		link.ExpenseAutomaticWorkflowItemID, link.MatchMethod, time.Now(), ServiceName, existingID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update expense automatic workflow link: %w", err)
+	}
+	link.ID = existingID
+	link.GUID = existingGUID
+	return nil
+}
+
+// DeleteLinks deletes a workflow's links that were made with the given match method
+func (r *ExpenseAutomaticWorkflowExpenseRepository) DeleteLinks(workflowID int64, matchMethod string) error {
+	_, err := r.conn.db.Exec(`
+		DELETE FROM expense_automatic_workflow_expense
+		WHERE expense_automatic_workflow_id = ? AND match_method = ?`,
+		workflowID, matchMethod,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete expense automatic workflow links: %w", err)
+	}
+	return nil
+}
+
 // ServicePaymentRepository handles service payment database operations
 type ServicePaymentRepository struct {
 	conn *Connection
@@ -529,9 +1572,11 @@ func (r *ServicePaymentRepository) UpsertServicePayment(sp *models.ServicePaymen
 		newGUID := uuid.New().String()
 		result, err := r.conn.db.Exec(`
 			INSERT INTO service_payment (guid, source_id, user_id, service_payment_date, service_payment_type_id,
+				amount, currency_code, provider_transaction_id, service_payment_status_id,
 				created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			newGUID, sp.SourceID, sp.UserID, sp.ServicePaymentDate, sp.ServicePaymentTypeID,
+			sp.Amount, sp.CurrencyCode, sp.ProviderTransactionID, sp.ServicePaymentStatusID,
 			time.Now(), ServiceName,
 		)
 		if err != nil {
@@ -547,9 +1592,11 @@ func (r *ServicePaymentRepository) UpsertServicePayment(sp *models.ServicePaymen
 
 	_, err = r.conn.db.Exec(`
 		UPDATE service_payment SET user_id = ?, service_payment_date = ?, service_payment_type_id = ?,
+			amount = ?, currency_code = ?, provider_transaction_id = ?, service_payment_status_id = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
 		sp.UserID, sp.ServicePaymentDate, sp.ServicePaymentTypeID,
+		sp.Amount, sp.CurrencyCode, sp.ProviderTransactionID, sp.ServicePaymentStatusID,
 		time.Now(), ServiceName, sp.SourceID,
 	)
 	if err != nil {
@@ -572,10 +1619,15 @@ func NewExpenseAutomaticWorkflowPreSavedDescriptionRepository(conn *Connection)
 
 // UpsertExpenseAutomaticWorkflowPreSavedDescription inserts or updates a pre-saved description
 func (r *ExpenseAutomaticWorkflowPreSavedDescriptionRepository) UpsertExpenseAutomaticWorkflowPreSavedDescription(desc *models.ExpenseAutomaticWorkflowPreSavedDescription) error {
+	description, err := r.conn.encrypt("expense_automatic_workflow_pre_saved_description", "description", desc.Description)
+	if err != nil {
+		return err
+	}
+
 	// Check if pre-saved description exists by source_id (MongoDB document ID)
 	var existingID int64
 	var existingGUID string
-	err := r.conn.db.QueryRow("SELECT id, guid FROM expense_automatic_workflow_pre_saved_description WHERE source_id = ?", desc.SourceID).Scan(&existingID, &existingGUID)
+	err = r.conn.db.QueryRow("SELECT id, guid FROM expense_automatic_workflow_pre_saved_description WHERE source_id = ?", desc.SourceID).Scan(&existingID, &existingGUID)
 
 	if err == sql.ErrNoRows {
 		// Insert new pre-saved description with a new random UUID for guid
@@ -583,7 +1635,7 @@ func (r *ExpenseAutomaticWorkflowPreSavedDescriptionRepository) UpsertExpenseAut
 		result, err := r.conn.db.Exec(`
 			INSERT INTO expense_automatic_workflow_pre_saved_description (guid, source_id, user_id, description, created_at, created_by)
 			VALUES (?, ?, ?, ?, ?, ?)`,
-			newGUID, desc.SourceID, desc.UserID, desc.Description, time.Now(), ServiceName,
+			newGUID, desc.SourceID, desc.UserID, description, time.Now(), ServiceName,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert pre-saved description: %w", err)
@@ -600,7 +1652,7 @@ func (r *ExpenseAutomaticWorkflowPreSavedDescriptionRepository) UpsertExpenseAut
 		UPDATE expense_automatic_workflow_pre_saved_description SET user_id = ?, description = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
-		desc.UserID, desc.Description, time.Now(), ServiceName, desc.SourceID,
+		desc.UserID, description, time.Now(), ServiceName, desc.SourceID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update pre-saved description: %w", err)
@@ -631,10 +1683,10 @@ func (r *SystemSettingsRepository) UpsertSystemSettings(ss *models.SystemSetting
 		// Insert new system settings with a new random UUID for guid
 		newGUID := uuid.New().String()
 		result, err := r.conn.db.Exec(`
-			INSERT INTO system_settings (guid, source_id, fl_block_user_registration, fl_maintenance, json_sync_metadata,
+			INSERT INTO system_settings (guid, source_id, fl_block_user_registration, fl_maintenance,
 				created_at, created_by)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
-			newGUID, ss.SourceID, ss.FlBlockUserRegistration, ss.FlMaintenance, ss.JSONSyncMetadata,
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			newGUID, ss.SourceID, ss.FlBlockUserRegistration, ss.FlMaintenance,
 			time.Now(), ServiceName,
 		)
 		if err != nil {
@@ -649,10 +1701,10 @@ func (r *SystemSettingsRepository) UpsertSystemSettings(ss *models.SystemSetting
 	}
 
 	_, err = r.conn.db.Exec(`
-		UPDATE system_settings SET fl_block_user_registration = ?, fl_maintenance = ?, json_sync_metadata = ?,
+		UPDATE system_settings SET fl_block_user_registration = ?, fl_maintenance = ?,
 			updated_at = ?, updated_by = ?
 		WHERE source_id = ?`,
-		ss.FlBlockUserRegistration, ss.FlMaintenance, ss.JSONSyncMetadata,
+		ss.FlBlockUserRegistration, ss.FlMaintenance,
 		time.Now(), ServiceName, ss.SourceID,
 	)
 	if err != nil {
@@ -663,6 +1715,149 @@ func (r *SystemSettingsRepository) UpsertSystemSettings(ss *models.SystemSetting
 	return nil
 }
 
+// SyncMetadataRepository handles sync metadata database operations
+type SyncMetadataRepository struct {
+	conn *Connection
+}
+
+// NewSyncMetadataRepository creates a new SyncMetadataRepository
+func NewSyncMetadataRepository(conn *Connection) *SyncMetadataRepository {
+	return &SyncMetadataRepository{conn: conn}
+}
+
+// RecordSync records a sync run of a service. It uses INSERT ... ON DUPLICATE KEY UPDATE
+// instead of SELECT then INSERT/UPDATE so concurrent consumers never lose a counter increment.
+func (r *SyncMetadataRepository) RecordSync(serviceName, status string, documents int, errMsg string, at time.Time) error {
+	failed := 0
+	var latestSuccess sql.NullTime
+	if status == models.SyncStatusSuccess {
+		latestSuccess = sql.NullTime{Time: at, Valid: true}
+	} else {
+		failed = 1
+	}
+	lastError := sql.NullString{String: errMsg, Valid: errMsg != ""}
+
+	_, err := r.conn.db.Exec(`
+		INSERT INTO sync_metadata (guid, service_name, latest_sync_datetime, latest_success_datetime,
+			last_status, last_error, last_documents_count, sync_count, failure_count, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			latest_sync_datetime = VALUES(latest_sync_datetime),
+			latest_success_datetime = COALESCE(VALUES(latest_success_datetime), latest_success_datetime),
+			last_status = VALUES(last_status),
+			last_error = VALUES(last_error),
+			last_documents_count = VALUES(last_documents_count),
+			sync_count = sync_count + 1,
+			failure_count = failure_count + VALUES(failure_count),
+			updated_at = ?, updated_by = ?`,
+		uuid.New().String(), serviceName, at, latestSuccess,
+		status, lastError, documents, failed, time.Now(), ServiceName,
+		time.Now(), ServiceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record sync metadata for %s: %w", serviceName, err)
+	}
+	return nil
+}
+
+// UpsertLatestSync stores the latest successful sync of a service as reported by the settings
+// document. Firestore only advances an entry after a successful sync, and the datetime never
+// moves backwards, so a stale settings document cannot override a newer local record.
+func (r *SyncMetadataRepository) UpsertLatestSync(serviceName string, at time.Time) error {
+	_, err := r.conn.db.Exec(`
+		INSERT INTO sync_metadata (guid, service_name, latest_sync_datetime, latest_success_datetime,
+			last_status, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			latest_sync_datetime = GREATEST(COALESCE(latest_sync_datetime, VALUES(latest_sync_datetime)), VALUES(latest_sync_datetime)),
+			latest_success_datetime = GREATEST(COALESCE(latest_success_datetime, VALUES(latest_success_datetime)), VALUES(latest_success_datetime)),
+			updated_at = ?, updated_by = ?`,
+		uuid.New().String(), serviceName, at, at,
+		models.SyncStatusSuccess, time.Now(), ServiceName,
+		time.Now(), ServiceName,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert sync metadata for %s: %w", serviceName, err)
+	}
+	return nil
+}
+
+// ExchangeRateRepository handles exchange rate database operations
+type ExchangeRateRepository struct {
+	conn *Connection
+}
+
+// NewExchangeRateRepository creates a new ExchangeRateRepository
+func NewExchangeRateRepository(conn *Connection) *ExchangeRateRepository {
+	return &ExchangeRateRepository{conn: conn}
+}
+
+// UpsertExchangeRate inserts or updates an exchange rate.
+// Rates are unique per currency, base currency and date, so loading the same file twice is safe.
+func (r *ExchangeRateRepository) UpsertExchangeRate(rate *models.ExchangeRate) error {
+	var existingID int64
+	var existingGUID string
+	err := r.conn.db.QueryRow(
+		"SELECT id, guid FROM exchange_rate WHERE currency_code = ? AND base_currency_code = ? AND rate_date = ?",
+		rate.CurrencyCode, rate.BaseCurrencyCode, rate.RateDate,
+	).Scan(&existingID, &existingGUID)
+
+	if err == sql.ErrNoRows {
+		// Insert new exchange rate with a new random UUID for guid
+		newGUID := uuid.New().String()
+		result, err := r.conn.db.Exec(`
+			INSERT INTO exchange_rate (guid, currency_code, base_currency_code, rate, rate_date, source,
+				created_at, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			newGUID, rate.CurrencyCode, rate.BaseCurrencyCode, rate.Rate, rate.RateDate, rate.Source,
+			time.Now(), ServiceName,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert exchange rate: %w", err)
+		}
+		id, _ := result.LastInsertId()
+		rate.ID = id
+		rate.GUID = newGUID
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check exchange rate existence: %w", err)
+	}
+
+	_, err = r.conn.db.Exec(`
+		UPDATE exchange_rate SET rate = ?, source = ?,
+			updated_at = ?, updated_by = ?
+		WHERE id = ?`,
+		rate.Rate, rate.Source,
+		time.Now(), ServiceName, existingID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update exchange rate: %w", err)
+	}
+	rate.ID = existingID
+	rate.GUID = existingGUID
+	return nil
+}
+
+// GetRate returns the most recent rate converting currencyCode into baseCurrencyCode
+// that is effective on the given date. The boolean result is false when no such rate exists.
+func (r *ExchangeRateRepository) GetRate(currencyCode, baseCurrencyCode string, on time.Time) (float64, bool, error) {
+	var rate float64
+	err := r.conn.db.QueryRow(`
+		SELECT rate FROM exchange_rate
+		WHERE currency_code = ? AND base_currency_code = ? AND rate_date <= ?
+		ORDER BY rate_date DESC
+		LIMIT 1`,
+		currencyCode, baseCurrencyCode, on,
+	).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+	return rate, true, nil
+}
+
 // GenerateGUID generates a new UUID
 func GenerateGUID() string {
 	return uuid.New().String()
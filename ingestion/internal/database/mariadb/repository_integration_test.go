@@ -0,0 +1,116 @@
+//go:build integration
+
+package mariadb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// newIntegrationConnection connects to a fresh, migrated database on a MariaDB server, such
+// as the MariaDB service in docker-compose.yml
+func newIntegrationConnection(t *testing.T) *Connection {
+	t.Helper()
+
+	password := os.Getenv("MYSQL_ROOT_PASSWORD")
+	if password == "" {
+		password = "root_secret"
+	}
+	cfg := config.MariaDBConfig{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "root",
+		Password: password,
+		Database: fmt.Sprintf("porcool_repository_test_%d", time.Now().UnixNano()),
+	}
+
+	conn, err := NewConnection(cfg)
+	if err != nil {
+		t.Fatalf("NewConnection() returned error: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.db.Exec("DROP DATABASE `" + cfg.Database + "`")
+		conn.Close()
+	})
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations() returned error: %v", err)
+	}
+	return conn
+}
+
+// TestMergeUsersMovesOwnedRows tests that merging users moves a row of every user-owned
+// table to the kept user, and that no table with a user_id is left out of the merge
+func TestMergeUsersMovesOwnedRows(t *testing.T) {
+	conn := newIntegrationConnection(t)
+
+	for _, statement := range []string{
+		"INSERT INTO user (id, guid, source_id, first_name, email) VALUES (1, 'u1', 'user-old', 'Ana', 'ana@example.com'), (2, 'u2', 'user-new', 'Ana', 'ana.new@example.com')",
+		"INSERT INTO financial_institution (guid, source_id, user_id, name) VALUES ('fi1', 'bank-1', 1, 'Bank')",
+		"INSERT INTO expense_automatic_workflow (guid, source_id, user_id) VALUES ('w1', 'eaw-1', 1)",
+		"INSERT INTO expense_automatic_workflow_pre_saved_description (guid, source_id, user_id, description) VALUES ('d1', 'desc-1', 1, 'Groceries')",
+		"INSERT INTO expense (guid, source_id, user_id, spending_date__YYYY_MM, name) VALUES ('e1', 'exp-1', 1, '2026-03', 'Rent')",
+		"INSERT INTO additional_balance (guid, source_id, user_id, spending_date__YYYY_MM) VALUES ('a1', 'ab-1', 1, '2026-03')",
+		"INSERT INTO balance_history (id, guid, source_id, user_id, spending_date__YYYY_MM) VALUES (1, 'b1', 'bh-1', 1, '2026-03')",
+		`INSERT INTO balance_discrepancy (guid, balance_history_id, user_id, spending_date__YYYY_MM, basis, reasons,
+			recorded_amount, expected_amount, difference_amount, recorded_last_month_amount, expected_last_month_amount,
+			recorded_monthly_income, expected_monthly_income, additional_amount, expense_amount, verified_at)
+			VALUES ('bd1', 1, 1, '2026-03', 'paid', 'amount', 10, 20, -10, 0, 0, 0, 0, 0, 20, NOW())`,
+		"INSERT INTO service_payment (guid, source_id, user_id, service_payment_date) VALUES ('p1', 'sp-1', 1, '2026-03-05')",
+	} {
+		if _, err := conn.db.Exec(statement); err != nil {
+			t.Fatalf("failed to insert rows of the stale user: %v", err)
+		}
+	}
+
+	moved, err := NewUserRepository(conn).MergeUsers(1, 2)
+	if err != nil {
+		t.Fatalf("MergeUsers() returned error: %v", err)
+	}
+	if moved != int64(len(userOwnedTables)) {
+		t.Errorf("MergeUsers() moved %d rows, want %d", moved, len(userOwnedTables))
+	}
+
+	for _, table := range userOwnedTables {
+		var kept, stale int
+		err := conn.db.QueryRow("SELECT COALESCE(SUM(user_id = 2), 0), COALESCE(SUM(user_id = 1), 0) FROM "+table).Scan(&kept, &stale)
+		if err != nil {
+			t.Fatalf("failed to count %s rows: %v", table, err)
+		}
+		if kept != 1 || stale != 0 {
+			t.Errorf("%s: %d rows of the kept user and %d of the stale user, want 1 and 0", table, kept, stale)
+		}
+	}
+
+	var users int
+	if err := conn.db.QueryRow("SELECT COUNT(*) FROM user WHERE id = 1").Scan(&users); err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	if users != 0 {
+		t.Error("MergeUsers() left the stale user in place")
+	}
+
+	// History and month summaries are derived from the user's own state and dropped instead
+	derived := map[string]bool{"user_history": true, "user_month_summary": true}
+	owned := make(map[string]bool, len(userOwnedTables))
+	for _, table := range userOwnedTables {
+		owned[table] = true
+	}
+	rows, err := conn.db.Query("SELECT table_name FROM information_schema.columns WHERE table_schema = DATABASE() AND column_name = 'user_id'")
+	if err != nil {
+		t.Fatalf("failed to list tables with a user_id: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("failed to scan table name: %v", err)
+		}
+		if !owned[table] && !derived[table] {
+			t.Errorf("table %s has a user_id but is not in userOwnedTables", table)
+		}
+	}
+}
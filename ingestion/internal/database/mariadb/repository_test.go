@@ -2,6 +2,7 @@ package mariadb
 
 import (
 	"testing"
+	"time"
 )
 
 func TestGenerateGUID(t *testing.T) {
@@ -42,6 +43,52 @@ func TestNewUserRepository(t *testing.T) {
 	}
 }
 
+func TestNewUserEmailConflictRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewUserEmailConflictRepository(conn)
+
+	if repo == nil {
+		t.Error("NewUserEmailConflictRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewUserEmailConflictRepository() didn't set connection correctly")
+	}
+}
+
+func TestNewUserErasureRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewUserErasureRepository(conn)
+
+	if repo == nil {
+		t.Error("NewUserErasureRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewUserErasureRepository() didn't set connection correctly")
+	}
+}
+
+func TestMonthEnd(t *testing.T) {
+	saoPaulo := time.FixedZone("BRT", -3*60*60)
+
+	tests := []struct {
+		start time.Time
+		loc   *time.Location
+		want  time.Time
+	}{
+		{time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.UTC, time.Date(2024, 2, 29, 23, 59, 59, 0, time.UTC)},
+		{time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), time.UTC, time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), saoPaulo, time.Date(2024, 4, 1, 2, 59, 59, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := monthEnd(tt.start, tt.loc); !got.Equal(tt.want) {
+			t.Errorf("monthEnd(%v, %v) = %v, want %v", tt.start, tt.loc, got, tt.want)
+		}
+	}
+}
+
 func TestNewExpenseRepository(t *testing.T) {
 	conn := &Connection{db: nil}
 	repo := NewExpenseRepository(conn)
@@ -107,6 +154,32 @@ func TestNewBalanceHistoryRepository(t *testing.T) {
 	}
 }
 
+func TestNewUserMonthSummaryRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewUserMonthSummaryRepository(conn)
+
+	if repo == nil {
+		t.Error("NewUserMonthSummaryRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewUserMonthSummaryRepository() didn't set connection correctly")
+	}
+}
+
+func TestNewBalanceDiscrepancyRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewBalanceDiscrepancyRepository(conn)
+
+	if repo == nil {
+		t.Error("NewBalanceDiscrepancyRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewBalanceDiscrepancyRepository() didn't set connection correctly")
+	}
+}
+
 func TestNewExpenseAutomaticWorkflowRepository(t *testing.T) {
 	conn := &Connection{db: nil}
 	repo := NewExpenseAutomaticWorkflowRepository(conn)
@@ -120,6 +193,32 @@ func TestNewExpenseAutomaticWorkflowRepository(t *testing.T) {
 	}
 }
 
+func TestNewExpenseAutomaticWorkflowItemRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewExpenseAutomaticWorkflowItemRepository(conn)
+
+	if repo == nil {
+		t.Error("NewExpenseAutomaticWorkflowItemRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewExpenseAutomaticWorkflowItemRepository() didn't set connection correctly")
+	}
+}
+
+func TestNewExpenseAutomaticWorkflowExpenseRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewExpenseAutomaticWorkflowExpenseRepository(conn)
+
+	if repo == nil {
+		t.Error("NewExpenseAutomaticWorkflowExpenseRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewExpenseAutomaticWorkflowExpenseRepository() didn't set connection correctly")
+	}
+}
+
 func TestNewServicePaymentRepository(t *testing.T) {
 	conn := &Connection{db: nil}
 	repo := NewServicePaymentRepository(conn)
@@ -132,3 +231,29 @@ func TestNewServicePaymentRepository(t *testing.T) {
 		t.Error("NewServicePaymentRepository() didn't set connection correctly")
 	}
 }
+
+func TestNewSyncMetadataRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewSyncMetadataRepository(conn)
+
+	if repo == nil {
+		t.Error("NewSyncMetadataRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewSyncMetadataRepository() didn't set connection correctly")
+	}
+}
+
+func TestNewExchangeRateRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewExchangeRateRepository(conn)
+
+	if repo == nil {
+		t.Error("NewExchangeRateRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewExchangeRateRepository() didn't set connection correctly")
+	}
+}
@@ -0,0 +1,184 @@
+package mariadb
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// snapshotTables are the tables synced from a user's MongoDB documents, keyed by source_id.
+// The user table holds the user itself, the others reference it through user_id.
+var snapshotTables = []string{
+	"user",
+	"financial_institution",
+	"expense",
+	"additional_balance",
+	"balance_history",
+	"expense_automatic_workflow",
+	"expense_automatic_workflow_pre_saved_description",
+	"service_payment",
+}
+
+// snapshotIgnoredColumns change on every upsert, whether or not the row's data changed
+var snapshotIgnoredColumns = map[string]bool{
+	"updated_at": true,
+	"updated_by": true,
+}
+
+// UserSnapshot holds a fingerprint of each row of a user, per table and source_id
+type UserSnapshot map[string]map[string]string
+
+// UserSnapshotRepository reads the rows of a user, to tell what a resync of the user changed
+type UserSnapshotRepository struct {
+	conn *Connection
+}
+
+// NewUserSnapshotRepository creates a new UserSnapshotRepository
+func NewUserSnapshotRepository(conn *Connection) *UserSnapshotRepository {
+	return &UserSnapshotRepository{conn: conn}
+}
+
+// Snapshot fingerprints every row of a user in the snapshot tables. userID 0, a user not
+// in MariaDB yet, yields an empty snapshot.
+func (r *UserSnapshotRepository) Snapshot(userID int64) (UserSnapshot, error) {
+	snapshot := make(UserSnapshot)
+	if userID == 0 {
+		return snapshot, nil
+	}
+
+	for _, table := range snapshotTables {
+		query := "SELECT * FROM " + table + " WHERE user_id = ?"
+		if table == "user" {
+			query = "SELECT * FROM user WHERE id = ?"
+		}
+		rows, err := r.tableSnapshot(table, query, userID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot[table] = rows
+	}
+	return snapshot, nil
+}
+
+// tableSnapshot fingerprints the rows a query returns, by source_id
+func (r *UserSnapshotRepository) tableSnapshot(table, query string, userID int64) (map[string]string, error) {
+	rows, err := r.conn.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+
+	fingerprints := make(map[string]string)
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+
+		sourceID, fingerprint, err := r.fingerprint(table, columns, values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		fingerprints[sourceID] = fingerprint
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	return fingerprints, nil
+}
+
+// fingerprint returns a row's source_id and a hash of its columns. Encrypted columns are
+// hashed by plaintext, since every write encrypts them with a new nonce.
+func (r *UserSnapshotRepository) fingerprint(table string, columns []string, values []sql.NullString) (string, string, error) {
+	var sourceID string
+	h := sha256.New()
+	for i, column := range columns {
+		if snapshotIgnoredColumns[column] {
+			continue
+		}
+		value, err := r.conn.decryptNull(table, column, values[i])
+		if err != nil {
+			return "", "", fmt.Errorf("failed to decrypt %s: %w", column, err)
+		}
+		if column == "source_id" {
+			sourceID = value.String
+		}
+
+		h.Write([]byte(column))
+		if value.Valid {
+			h.Write([]byte{1})
+			h.Write([]byte(value.String))
+		}
+		h.Write([]byte{0})
+	}
+	return sourceID, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SnapshotDiff counts how the rows of one table differ between two snapshots
+type SnapshotDiff struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	// Missing counts source IDs without a row afterwards, documents that were not synced
+	Missing int
+}
+
+// Diff compares the rows of table with the given source IDs before and after a resync
+func (s UserSnapshot) Diff(after UserSnapshot, table string, sourceIDs []string) SnapshotDiff {
+	var diff SnapshotDiff
+	for _, id := range sourceIDs {
+		old, existed := s[table][id]
+		current, exists := after[table][id]
+		switch {
+		case !exists:
+			diff.Missing++
+		case !existed:
+			diff.Created++
+		case old != current:
+			diff.Updated++
+		default:
+			diff.Unchanged++
+		}
+	}
+	return diff
+}
+
+// Existing counts the source IDs with a row of table in the snapshot
+func (s UserSnapshot) Existing(table string, sourceIDs []string) int {
+	n := 0
+	for _, id := range sourceIDs {
+		if _, ok := s[table][id]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Orphans returns the source IDs of the rows of table not among sourceIDs, rows whose
+// MongoDB document is gone
+func (s UserSnapshot) Orphans(table string, sourceIDs []string) []string {
+	known := make(map[string]bool, len(sourceIDs))
+	for _, id := range sourceIDs {
+		known[id] = true
+	}
+
+	var orphans []string
+	for id := range s[table] {
+		if !known[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
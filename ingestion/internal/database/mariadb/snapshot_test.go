@@ -0,0 +1,82 @@
+package mariadb
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestNewUserSnapshotRepository(t *testing.T) {
+	conn := &Connection{db: nil}
+	repo := NewUserSnapshotRepository(conn)
+
+	if repo == nil {
+		t.Error("NewUserSnapshotRepository() returned nil")
+	}
+
+	if repo.conn != conn {
+		t.Error("NewUserSnapshotRepository() didn't set connection correctly")
+	}
+}
+
+func TestSnapshotWithoutUser(t *testing.T) {
+	snapshot, err := NewUserSnapshotRepository(&Connection{}).Snapshot(0)
+	if err != nil || len(snapshot) != 0 {
+		t.Errorf("Snapshot(0) = %v, %v, want an empty snapshot", snapshot, err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	repo := NewUserSnapshotRepository(&Connection{cipher: testCipher(t, "user.email")})
+	columns := []string{"id", "source_id", "email", "last_name", "updated_at"}
+	row := func(email string, lastName sql.NullString, updatedAt string) []sql.NullString {
+		encrypted, err := repo.conn.encrypt("user", "email", email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []sql.NullString{
+			{String: "1", Valid: true},
+			{String: "user-1", Valid: true},
+			{String: encrypted, Valid: true},
+			lastName,
+			{String: updatedAt, Valid: true},
+		}
+	}
+
+	sourceID, base, err := repo.fingerprint("user", columns, row("ana@example.com", sql.NullString{}, "2024-03-01"))
+	if err != nil || sourceID != "user-1" {
+		t.Fatalf("fingerprint() = %q, %v, want user-1", sourceID, err)
+	}
+
+	// A new nonce and a new updated_at do not make a change
+	if _, again, _ := repo.fingerprint("user", columns, row("ana@example.com", sql.NullString{}, "2024-03-02")); again != base {
+		t.Error("fingerprint() changed for a rewrite of the same values")
+	}
+	if _, changed, _ := repo.fingerprint("user", columns, row("bia@example.com", sql.NullString{}, "2024-03-01")); changed == base {
+		t.Error("fingerprint() did not change with the email")
+	}
+	if _, changed, _ := repo.fingerprint("user", columns, row("ana@example.com", sql.NullString{Valid: true}, "2024-03-01")); changed == base {
+		t.Error("fingerprint() must tell NULL from an empty string")
+	}
+}
+
+func TestUserSnapshotDiff(t *testing.T) {
+	before := UserSnapshot{"expense": {"e1": "a", "e2": "b", "e3": "c"}}
+	after := UserSnapshot{"expense": {"e1": "a", "e2": "B", "e3": "c", "e4": "d"}}
+
+	got := before.Diff(after, "expense", []string{"e1", "e2", "e4", "e5"})
+	want := SnapshotDiff{Created: 1, Updated: 1, Unchanged: 1, Missing: 1}
+	if got != want {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+
+	if n := before.Existing("expense", []string{"e1", "e4"}); n != 1 {
+		t.Errorf("Existing() = %d, want 1", n)
+	}
+	if orphans := after.Orphans("expense", []string{"e1", "e2"}); !reflect.DeepEqual(orphans, []string{"e3", "e4"}) {
+		t.Errorf("Orphans() = %v, want [e3 e4]", orphans)
+	}
+	if orphans := before.Orphans("user", nil); orphans != nil {
+		t.Errorf("Orphans() = %v, want none for a table without rows", orphans)
+	}
+}
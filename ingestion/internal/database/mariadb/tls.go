@@ -0,0 +1,60 @@
+package mariadb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// registerTLS registers the custom TLS configuration with the MySQL driver, when the
+// configuration needs one; the DSN names it
+func registerTLS(cfg config.MariaDBTLSConfig) error {
+	if !cfg.Custom() {
+		return nil
+	}
+
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if err := mysql.RegisterTLSConfig(config.MariaDBCustomTLSName, tlsConfig); err != nil {
+		return fmt.Errorf("failed to register TLS configuration: %w", err)
+	}
+	return nil
+}
+
+// buildTLSConfig builds the TLS configuration from the CA, client certificate and server
+// name. Without a server name the driver verifies the host of the DSN.
+func buildTLSConfig(cfg config.MariaDBTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.Mode == config.MariaDBTLSSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS CA file %s holds no PEM certificate", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
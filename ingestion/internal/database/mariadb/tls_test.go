@@ -0,0 +1,123 @@
+package mariadb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM files
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() returned error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "porcool-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() returned error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() returned error: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+
+	tlsConfig, err := buildTLSConfig(config.MariaDBTLSConfig{
+		Mode:       config.MariaDBTLSVerify,
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "db.internal",
+	})
+	if err != nil {
+		t.Fatalf("buildTLSConfig() returned error: %v", err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Error("buildTLSConfig() did not set the CA pool")
+	}
+	if len(tlsConfig.Certificates) != 1 {
+		t.Errorf("buildTLSConfig() has %d client certificates, want 1", len(tlsConfig.Certificates))
+	}
+	if tlsConfig.ServerName != "db.internal" || tlsConfig.InsecureSkipVerify {
+		t.Errorf("buildTLSConfig() ServerName = %q, InsecureSkipVerify = %v", tlsConfig.ServerName, tlsConfig.InsecureSkipVerify)
+	}
+
+	tlsConfig, err = buildTLSConfig(config.MariaDBTLSConfig{Mode: config.MariaDBTLSSkipVerify, CAFile: certFile})
+	if err != nil {
+		t.Fatalf("buildTLSConfig() returned error: %v", err)
+	}
+	if !tlsConfig.InsecureSkipVerify {
+		t.Error("buildTLSConfig() with skip-verify should not verify the server")
+	}
+}
+
+func TestBuildTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeTestCertificate(t, dir)
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.MariaDBTLSConfig
+		want string
+	}{
+		{"missing CA", config.MariaDBTLSConfig{Mode: config.MariaDBTLSVerify, CAFile: filepath.Join(dir, "missing.pem")}, "failed to read TLS CA file"},
+		{"CA without certificates", config.MariaDBTLSConfig{Mode: config.MariaDBTLSVerify, CAFile: notPEM}, "holds no PEM certificate"},
+		{"certificate without matching key", config.MariaDBTLSConfig{Mode: config.MariaDBTLSVerify, CertFile: certFile, KeyFile: notPEM}, "failed to load TLS client certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildTLSConfig(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("buildTLSConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterTLSWithoutCustomConfig(t *testing.T) {
+	// Modes without files are named in the DSN and need no registration, so a missing
+	// file cannot be read here
+	for _, mode := range []string{config.MariaDBTLSDisabled, config.MariaDBTLSVerify, config.MariaDBTLSSkipVerify} {
+		if err := registerTLS(config.MariaDBTLSConfig{Mode: mode}); err != nil {
+			t.Errorf("registerTLS(%s) returned error: %v", mode, err)
+		}
+	}
+}
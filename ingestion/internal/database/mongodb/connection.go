@@ -96,28 +96,31 @@ type UserDocument struct {
 
 // ExpenseDocument represents an expense document from MongoDB (collection: expenses)
 // MongoDB fields: _id, _firestoreCreateTime, _firestorePath, _firestoreUpdateTime, _importedAt,
-// alreadyPaidAmount, amount, created, expenseName, indeterminateValidity, onPremiseSyncDatetime,
-// onPremiseSyncService, source, spendingDate, status, type, updated, user, validity
+// alreadyPaidAmount, amount, created, currency, expenseAutomaticWorkflowId, expenseName, indeterminateValidity,
+// onPremiseSyncDatetime, onPremiseSyncService, source, spendingDate, status, type, updated, user, validity
 type ExpenseDocument struct {
-	ID                    string     `bson:"_id"`
-	FirestoreCreateTime   string     `bson:"_firestoreCreateTime,omitempty"`
-	FirestorePath         string     `bson:"_firestorePath,omitempty"`
-	FirestoreUpdateTime   string     `bson:"_firestoreUpdateTime,omitempty"`
-	ImportedAt            time.Time  `bson:"_importedAt,omitempty"`
-	AlreadyPaidAmount     float64    `bson:"alreadyPaidAmount"`
-	Amount                float64    `bson:"amount"`
-	Created               string     `bson:"created"`
-	ExpenseName           string     `bson:"expenseName"`
-	IndeterminateValidity bool       `bson:"indeterminateValidity"`
-	OnPremiseSyncDatetime *time.Time `bson:"onPremiseSyncDatetime"`
-	OnPremiseSyncService  *string    `bson:"onPremiseSyncService"`
-	Source                string     `bson:"source"`
-	SpendingDate          string     `bson:"spendingDate"`
-	Status                string     `bson:"status"`
-	Type                  string     `bson:"type"`
-	Updated               string     `bson:"updated"`
-	User                  string     `bson:"user"`
-	Validity              *string    `bson:"validity"`
+	ID                  string    `bson:"_id"`
+	FirestoreCreateTime string    `bson:"_firestoreCreateTime,omitempty"`
+	FirestorePath       string    `bson:"_firestorePath,omitempty"`
+	FirestoreUpdateTime string    `bson:"_firestoreUpdateTime,omitempty"`
+	ImportedAt          time.Time `bson:"_importedAt,omitempty"`
+	AlreadyPaidAmount   float64   `bson:"alreadyPaidAmount"`
+	Amount              float64   `bson:"amount"`
+	Created             string    `bson:"created"`
+	Currency            string    `bson:"currency"`
+	// ExpenseAutomaticWorkflowID references the workflow that created the expense, when known
+	ExpenseAutomaticWorkflowID string      `bson:"expenseAutomaticWorkflowId"`
+	ExpenseName                string      `bson:"expenseName"`
+	IndeterminateValidity      bool        `bson:"indeterminateValidity"`
+	OnPremiseSyncDatetime      *time.Time  `bson:"onPremiseSyncDatetime"`
+	OnPremiseSyncService       *string     `bson:"onPremiseSyncService"`
+	Source                     string      `bson:"source"`
+	SpendingDate               string      `bson:"spendingDate"`
+	Status                     string      `bson:"status"`
+	Type                       string      `bson:"type"`
+	Updated                    string      `bson:"updated"`
+	User                       string      `bson:"user"`
+	Validity                   interface{} `bson:"validity"`
 }
 
 // FinancialInstitutionDocument represents a financial institution from MongoDB (collection: banks)
@@ -144,7 +147,7 @@ type FinancialInstitutionDocument struct {
 
 // AdditionalBalanceDocument represents an additional balance from MongoDB (collection: additional_balances)
 // MongoDB fields: _id, _firestoreCreateTime, _firestorePath, _firestoreUpdateTime, _importedAt,
-// balance, created, description, onPremiseSyncDatetime, onPremiseSyncService, spendingDate, user
+// balance, created, currency, description, onPremiseSyncDatetime, onPremiseSyncService, spendingDate, user
 type AdditionalBalanceDocument struct {
 	ID                    string     `bson:"_id"`
 	FirestoreCreateTime   string     `bson:"_firestoreCreateTime,omitempty"`
@@ -153,6 +156,7 @@ type AdditionalBalanceDocument struct {
 	ImportedAt            time.Time  `bson:"_importedAt,omitempty"`
 	Balance               float64    `bson:"balance"`
 	Created               string     `bson:"created"`
+	Currency              string     `bson:"currency"`
 	Description           string     `bson:"description"`
 	OnPremiseSyncDatetime *time.Time `bson:"onPremiseSyncDatetime"`
 	OnPremiseSyncService  *string    `bson:"onPremiseSyncService"`
@@ -162,7 +166,7 @@ type AdditionalBalanceDocument struct {
 
 // BalanceHistoryDocument represents a balance history record from MongoDB (collection: balance_history)
 // MongoDB fields: _id, _firestoreCreateTime, _firestorePath, _firestoreUpdateTime, _importedAt,
-// balance, created, lastMonthBalance, monthlyIncome, onPremiseSyncDatetime, onPremiseSyncService,
+// balance, created, currency, lastMonthBalance, monthlyIncome, onPremiseSyncDatetime, onPremiseSyncService,
 // spendingDate, user
 type BalanceHistoryDocument struct {
 	ID                    string     `bson:"_id"`
@@ -172,6 +176,7 @@ type BalanceHistoryDocument struct {
 	ImportedAt            time.Time  `bson:"_importedAt,omitempty"`
 	Balance               float64    `bson:"balance"`
 	Created               string     `bson:"created"`
+	Currency              string     `bson:"currency"`
 	LastMonthBalance      float64    `bson:"lastMonthBalance"`
 	MonthlyIncome         float64    `bson:"monthlyIncome"`
 	OnPremiseSyncDatetime *time.Time `bson:"onPremiseSyncDatetime"`
@@ -199,7 +204,7 @@ type ExpenseAutomaticWorkflowDocument struct {
 	OnPremiseSyncService             *string     `bson:"onPremiseSyncService"`
 	ProcessingMessage                string      `bson:"processingMessage"`
 	SpendingDate                     string      `bson:"spendingDate"`
-	SyncProcessedDate                string      `bson:"syncProcessedDate"`
+	SyncProcessedDate                interface{} `bson:"syncProcessedDate"`
 	SyncStatus                       string      `bson:"syncStatus"`
 	User                             string      `bson:"user"`
 }
@@ -223,17 +228,23 @@ type ExpenseAutomaticWorkflowPreSavedDescriptionDocument struct {
 
 // ServicePaymentDocument represents a service payment from MongoDB (collection: payments)
 // MongoDB fields: _id, _firestoreCreateTime, _firestorePath, _firestoreUpdateTime, _importedAt,
-// onPremiseSyncDatetime, onPremiseSyncService, paymentDate, user
+// amount, currency, onPremiseSyncDatetime, onPremiseSyncService, paymentDate, provider,
+// providerTransactionId, status, user
 type ServicePaymentDocument struct {
-	ID                    string     `bson:"_id"`
-	FirestoreCreateTime   string     `bson:"_firestoreCreateTime,omitempty"`
-	FirestorePath         string     `bson:"_firestorePath,omitempty"`
-	FirestoreUpdateTime   string     `bson:"_firestoreUpdateTime,omitempty"`
-	ImportedAt            time.Time  `bson:"_importedAt,omitempty"`
-	OnPremiseSyncDatetime *time.Time `bson:"onPremiseSyncDatetime"`
-	OnPremiseSyncService  *string    `bson:"onPremiseSyncService"`
-	PaymentDate           string     `bson:"paymentDate"`
-	User                  string     `bson:"user"`
+	ID                    string      `bson:"_id"`
+	FirestoreCreateTime   string      `bson:"_firestoreCreateTime,omitempty"`
+	FirestorePath         string      `bson:"_firestorePath,omitempty"`
+	FirestoreUpdateTime   string      `bson:"_firestoreUpdateTime,omitempty"`
+	ImportedAt            time.Time   `bson:"_importedAt,omitempty"`
+	Amount                *float64    `bson:"amount"`
+	Currency              string      `bson:"currency"`
+	OnPremiseSyncDatetime *time.Time  `bson:"onPremiseSyncDatetime"`
+	OnPremiseSyncService  *string     `bson:"onPremiseSyncService"`
+	PaymentDate           interface{} `bson:"paymentDate"`
+	Provider              string      `bson:"provider"`
+	ProviderTransactionID string      `bson:"providerTransactionId"`
+	Status                string      `bson:"status"`
+	User                  string      `bson:"user"`
 }
 
 // SettingsDocument represents system settings from MongoDB (collection: settings)
@@ -496,22 +507,32 @@ func (c *Connection) GetSettings(ctx context.Context) (*SettingsDocument, error)
 	return &settings, nil
 }
 
-// MarkAsSynced marks a document as synced in MongoDB
-// Uses fields: onPremiseRelationalDBSyncDatetime, onPremiseRelationalDBSyncService
-func (c *Connection) MarkAsSynced(ctx context.Context, collectionName string, docID string, serviceName string) error {
-	coll := c.Collection(collectionName)
-
-	filter := bson.M{"_id": docID}
-	update := bson.M{
-		"$set": bson.M{
-			"onPremiseRelationalDBSyncDatetime": time.Now(),
-			"onPremiseRelationalDBSyncService":  serviceName,
-		},
+// MarkAsSynced marks synced documents of a collection in MongoDB with one bulk write.
+// Uses fields: onPremiseRelationalDBSyncDatetime, onPremiseRelationalDBSyncService,
+// onPremiseRelationalDBSyncContentHash, onPremiseRelationalDBSyncFirestoreUpdateTime
+func (c *Connection) MarkAsSynced(ctx context.Context, collectionName string, marks []SyncMark, serviceName string) error {
+	if len(marks) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	models := make([]mongo.WriteModel, len(marks))
+	for i, mark := range marks {
+		update := bson.M{
+			"$set": bson.M{
+				SyncDatetimeField:            now,
+				SyncServiceField:             serviceName,
+				SyncContentHashField:         mark.ContentHash,
+				SyncFirestoreUpdateTimeField: mark.FirestoreUpdateTime,
+			},
+		}
+		models[i] = mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": mark.ID}).SetUpdate(update)
 	}
 
-	_, err := coll.UpdateOne(ctx, filter, update)
+	// Unordered, so one failing update does not leave the rest of the batch unmarked
+	_, err := c.Collection(collectionName).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
 	if err != nil {
-		return fmt.Errorf("failed to mark document as synced: %w", err)
+		return fmt.Errorf("failed to mark documents as synced: %w", err)
 	}
 
 	return nil
@@ -546,190 +567,30 @@ func (c *Connection) GetSuccessfullyIngestedFirestoreDoc(ctx context.Context, do
 	return &doc, nil
 }
 
-// GetUsersByIDs fetches users by their IDs
-func (c *Connection) GetUsersByIDs(ctx context.Context, ids []string) ([]UserDocument, error) {
-	collection := c.Collection("users")
-
-	log.Printf("Fetching %d users from MongoDB", len(ids))
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find users: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var users []UserDocument
-	if err := cursor.All(ctx, &users); err != nil {
-		return nil, fmt.Errorf("failed to decode users: %w", err)
-	}
-
-	log.Printf("Retrieved %d users from MongoDB (requested %d)", len(users), len(ids))
-	if len(users) != len(ids) {
-		log.Printf("Warning: Some user IDs were not found in MongoDB")
-	}
-
-	return users, nil
-}
-
-// GetExpensesByIDs fetches expenses by their IDs
-func (c *Connection) GetExpensesByIDs(ctx context.Context, ids []string) ([]ExpenseDocument, error) {
+// GetExpenseIDsByWorkflowID returns the IDs of the expenses that reference an automatic workflow
+// through expenseAutomaticWorkflowId
+func (c *Connection) GetExpenseIDsByWorkflowID(ctx context.Context, workflowID string) ([]string, error) {
 	collection := c.Collection("expenses")
 
-	log.Printf("Fetching %d expenses from MongoDB", len(ids))
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"expenseAutomaticWorkflowId": workflowID}, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find expenses: %w", err)
+		return nil, fmt.Errorf("failed to find expenses by workflow: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var expenses []ExpenseDocument
-	if err := cursor.All(ctx, &expenses); err != nil {
-		return nil, fmt.Errorf("failed to decode expenses: %w", err)
+	var docs []struct {
+		ID string `bson:"_id"`
 	}
-
-	log.Printf("Retrieved %d expenses from MongoDB (requested %d)", len(expenses), len(ids))
-	if len(expenses) != len(ids) {
-		log.Printf("Warning: Some expense IDs were not found in MongoDB")
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode expenses by workflow: %w", err)
 	}
 
-	return expenses, nil
-}
-
-// GetFinancialInstitutionsByIDs fetches financial institutions by their IDs
-func (c *Connection) GetFinancialInstitutionsByIDs(ctx context.Context, ids []string) ([]FinancialInstitutionDocument, error) {
-	collection := c.Collection("banks")
-
-	log.Printf("Fetching %d financial institutions from MongoDB", len(ids))
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find financial institutions: %w", err)
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
 	}
-	defer cursor.Close(ctx)
-
-	var institutions []FinancialInstitutionDocument
-	if err := cursor.All(ctx, &institutions); err != nil {
-		return nil, fmt.Errorf("failed to decode financial institutions: %w", err)
-	}
-
-	log.Printf("Retrieved %d financial institutions from MongoDB (requested %d)", len(institutions), len(ids))
-
-	return institutions, nil
-}
-
-// GetAdditionalBalancesByIDs fetches additional balances by their IDs
-func (c *Connection) GetAdditionalBalancesByIDs(ctx context.Context, ids []string) ([]AdditionalBalanceDocument, error) {
-	collection := c.Collection("additional_balances")
-
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find additional balances: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var balances []AdditionalBalanceDocument
-	if err := cursor.All(ctx, &balances); err != nil {
-		return nil, fmt.Errorf("failed to decode additional balances: %w", err)
-	}
-
-	return balances, nil
-}
-
-// GetBalanceHistoryByIDs fetches balance history records by their IDs
-func (c *Connection) GetBalanceHistoryByIDs(ctx context.Context, ids []string) ([]BalanceHistoryDocument, error) {
-	collection := c.Collection("balance_history")
-
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find balance history: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var history []BalanceHistoryDocument
-	if err := cursor.All(ctx, &history); err != nil {
-		return nil, fmt.Errorf("failed to decode balance history: %w", err)
-	}
-
-	return history, nil
-}
-
-// GetExpenseAutomaticWorkflowsByIDs fetches expense automatic workflows by their IDs
-func (c *Connection) GetExpenseAutomaticWorkflowsByIDs(ctx context.Context, ids []string) ([]ExpenseAutomaticWorkflowDocument, error) {
-	collection := c.Collection("expense_automatic_workflow")
-
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find expense automatic workflows: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var workflows []ExpenseAutomaticWorkflowDocument
-	if err := cursor.All(ctx, &workflows); err != nil {
-		return nil, fmt.Errorf("failed to decode expense automatic workflows: %w", err)
-	}
-
-	return workflows, nil
-}
-
-// GetExpenseAutomaticWorkflowPreSavedDescriptionsByIDs fetches pre-saved descriptions by their IDs
-func (c *Connection) GetExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx context.Context, ids []string) ([]ExpenseAutomaticWorkflowPreSavedDescriptionDocument, error) {
-	collection := c.Collection("expense_automatic_workflow_pre_saved_description")
-
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find pre-saved descriptions: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var descriptions []ExpenseAutomaticWorkflowPreSavedDescriptionDocument
-	if err := cursor.All(ctx, &descriptions); err != nil {
-		return nil, fmt.Errorf("failed to decode pre-saved descriptions: %w", err)
-	}
-
-	return descriptions, nil
-}
-
-// GetServicePaymentsByIDs fetches service payments by their IDs
-func (c *Connection) GetServicePaymentsByIDs(ctx context.Context, ids []string) ([]ServicePaymentDocument, error) {
-	collection := c.Collection("payments")
-
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find service payments: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var payments []ServicePaymentDocument
-	if err := cursor.All(ctx, &payments); err != nil {
-		return nil, fmt.Errorf("failed to decode service payments: %w", err)
-	}
-
-	return payments, nil
-}
-
-// GetSettingsByIDs fetches settings documents by their IDs
-func (c *Connection) GetSettingsByIDs(ctx context.Context, ids []string) ([]SettingsDocument, error) {
-	collection := c.Collection("settings")
-
-	filter := bson.M{"_id": bson.M{"$in": ids}}
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find settings: %w", err)
-	}
-	defer cursor.Close(ctx)
-
-	var settings []SettingsDocument
-	if err := cursor.All(ctx, &settings); err != nil {
-		return nil, fmt.Errorf("failed to decode settings: %w", err)
-	}
-
-	return settings, nil
+	return ids, nil
 }
 
 // MarkIngestionDocAsProcessed updates the ingestedBy and ingestedAt fields
@@ -770,7 +631,8 @@ func (c *Connection) MarkIngestionDocAsProcessed(ctx context.Context, docID stri
 // This is used for invoice/savings aggregation where multiple MongoDB expense records
 // with the same expense name and validity should be consolidated into a single expense
 // record in MariaDB with multiple installments.
-func (c *Connection) GetExpenseAggregate(ctx context.Context, userID string, expenseName string, validity string) ([]ExpenseDocument, error) {
+// The validity is matched as stored, so it must be the raw value read from the document.
+func (c *Connection) GetExpenseAggregate(ctx context.Context, userID string, expenseName string, validity interface{}) ([]ExpenseDocument, error) {
 	collection := c.Collection("expenses")
 
 	filter := bson.M{
@@ -795,3 +657,29 @@ func (c *Connection) GetExpenseAggregate(ctx context.Context, userID string, exp
 
 	return expenses, nil
 }
+
+// GetUserInstallmentExpenses returns the invoices and savings of a user, the expenses synced
+// as an aggregate with installments when they have a validity. Only the fields grouping them
+// into aggregates are fetched.
+func (c *Connection) GetUserInstallmentExpenses(ctx context.Context, userID string) ([]ExpenseDocument, error) {
+	collection := c.Collection("expenses")
+
+	filter := bson.M{
+		"user": userID,
+		"type": bson.M{"$in": []string{"invoice", "savings"}},
+	}
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "user": 1, "type": 1, "expenseName": 1, "validity": 1})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find installment expenses of user: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var expenses []ExpenseDocument
+	if err := cursor.All(ctx, &expenses); err != nil {
+		return nil, fmt.Errorf("failed to decode installment expenses of user: %w", err)
+	}
+
+	return expenses, nil
+}
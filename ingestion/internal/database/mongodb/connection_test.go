@@ -67,7 +67,6 @@ func TestUserDocumentStructure(t *testing.T) {
 }
 
 func TestExpenseDocumentStructure(t *testing.T) {
-	validity := "2024-12-31"
 	expense := ExpenseDocument{
 		ID:                    "expense-123",
 		FirestoreCreateTime:   "2024-01-01T00:00:00Z",
@@ -83,7 +82,7 @@ func TestExpenseDocumentStructure(t *testing.T) {
 		Type:                  "expense",
 		Updated:               "2024-01-02T00:00:00Z",
 		User:                  "user-123",
-		Validity:              &validity,
+		Validity:              "2024-12-31",
 	}
 
 	if expense.ID != "expense-123" {
@@ -107,8 +106,8 @@ func TestExpenseDocumentStructure(t *testing.T) {
 	if expense.ExpenseName != "Test Expense" {
 		t.Errorf("ExpenseName = %s, want Test Expense", expense.ExpenseName)
 	}
-	if *expense.Validity != "2024-12-31" {
-		t.Errorf("Validity = %s, want 2024-12-31", *expense.Validity)
+	if expense.Validity != "2024-12-31" {
+		t.Errorf("Validity = %v, want 2024-12-31", expense.Validity)
 	}
 }
 
@@ -269,7 +268,7 @@ func TestServicePaymentDocumentStructure(t *testing.T) {
 		t.Errorf("ID = %s, want sp-123", sp.ID)
 	}
 	if sp.PaymentDate != "2024-01-15" {
-		t.Errorf("PaymentDate = %s, want 2024-01-15", sp.PaymentDate)
+		t.Errorf("PaymentDate = %v, want 2024-01-15", sp.PaymentDate)
 	}
 	if sp.User != "user-123" {
 		t.Errorf("User = %s, want user-123", sp.User)
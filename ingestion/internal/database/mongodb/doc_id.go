@@ -0,0 +1,164 @@
+package mongodb
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DocID is the _id of a MongoDB document. Stage 1 writes Firestore document IDs as strings,
+// but an ID may also be an ObjectID; DocID keeps its type so queries and updates match the
+// stored _id. It is marshaled to and unmarshaled from BSON as the bare ID.
+type DocID struct {
+	value interface{} // string or primitive.ObjectID
+}
+
+// StringID returns the ID of a document whose _id is a string
+func StringID(id string) DocID {
+	return DocID{value: id}
+}
+
+// ObjectID returns the ID of a document whose _id is an ObjectID
+func ObjectID(id primitive.ObjectID) DocID {
+	return DocID{value: id}
+}
+
+// StringIDs returns string document IDs as DocIDs
+func StringIDs(ids []string) []DocID {
+	docIDs := make([]DocID, len(ids))
+	for i, id := range ids {
+		docIDs[i] = StringID(id)
+	}
+	return docIDs
+}
+
+// DocIDStrings returns the string forms of document IDs
+func DocIDStrings(ids []DocID) []string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	return strs
+}
+
+// CandidateDocIDs returns the _id values a document ID printed by String may stand for: the
+// string itself and, when it is 24 hex digits, the ObjectID it encodes
+func CandidateDocIDs(id string) []DocID {
+	candidates := []DocID{StringID(id)}
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		candidates = append(candidates, ObjectID(objectID))
+	}
+	return candidates
+}
+
+// String returns the ID as the document structs decode it and MariaDB stores it as
+// source_id: the string itself, or the hex form of an ObjectID
+func (d DocID) String() string {
+	switch id := d.value.(type) {
+	case string:
+		return id
+	case primitive.ObjectID:
+		return id.Hex()
+	default:
+		return ""
+	}
+}
+
+// IsObjectID reports whether the _id is an ObjectID
+func (d DocID) IsObjectID() bool {
+	_, ok := d.value.(primitive.ObjectID)
+	return ok
+}
+
+// IsZero reports whether the ID is unset
+func (d DocID) IsZero() bool {
+	return d.value == nil
+}
+
+// MarshalBSONValue implements bson.ValueMarshaler
+func (d DocID) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(d.value)
+}
+
+// UnmarshalBSONValue implements bson.ValueUnmarshaler
+func (d *DocID) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	id, ok := DocIDFromRaw(bson.RawValue{Type: t, Value: data})
+	if !ok {
+		return fmt.Errorf("unsupported document ID of BSON type %s", t)
+	}
+	*d = id
+	return nil
+}
+
+// DocIDFromRaw reads a string or ObjectID _id, rejecting other types
+func DocIDFromRaw(raw bson.RawValue) (DocID, bool) {
+	if id, ok := raw.StringValueOK(); ok && id != "" {
+		return StringID(id), true
+	}
+	if id, ok := raw.ObjectIDOK(); ok {
+		return ObjectID(id), true
+	}
+	return DocID{}, false
+}
+
+// ParseDocID reads a document ID as stage 1 writes it into map_collection_to_docs: a string,
+// an ObjectID, or an object with an id field such as {id, path}. Empty IDs and other values
+// are rejected.
+func ParseDocID(value interface{}) (DocID, bool) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return DocID{}, false
+		}
+		return StringID(v), true
+	case primitive.ObjectID:
+		if v.IsZero() {
+			return DocID{}, false
+		}
+		return ObjectID(v), true
+	case primitive.M:
+		return ParseDocID(v["id"])
+	case map[string]interface{}:
+		return ParseDocID(v["id"])
+	case primitive.D:
+		for _, e := range v {
+			if e.Key == "id" {
+				return ParseDocID(e.Value)
+			}
+		}
+	}
+	return DocID{}, false
+}
+
+// ParseDocIDs reads the document IDs of one map_collection_to_docs entry, an array of IDs or
+// a single ID, and returns them with the number of elements that are not a document ID
+func ParseDocIDs(value interface{}) (ids []DocID, dropped int) {
+	var elems []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, 0
+	case primitive.A:
+		elems = v
+	case []interface{}:
+		elems = v
+	case []string:
+		elems = make([]interface{}, len(v))
+		for i, id := range v {
+			elems[i] = id
+		}
+	default:
+		elems = []interface{}{v}
+	}
+
+	for _, elem := range elems {
+		id, ok := ParseDocID(elem)
+		if !ok {
+			dropped++
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, dropped
+}
@@ -0,0 +1,153 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseDocIDs(t *testing.T) {
+	oid := primitive.NewObjectID()
+
+	tests := []struct {
+		name        string
+		input       interface{}
+		expected    []DocID
+		wantDropped int
+	}{
+		{
+			name:     "array of strings",
+			input:    []interface{}{"doc1", "doc2", "doc3"},
+			expected: []DocID{StringID("doc1"), StringID("doc2"), StringID("doc3")},
+		},
+		{
+			name:     "slice of strings",
+			input:    []string{"doc1", "doc2"},
+			expected: []DocID{StringID("doc1"), StringID("doc2")},
+		},
+		{
+			name:     "single string",
+			input:    "doc1",
+			expected: []DocID{StringID("doc1")},
+		},
+		{
+			name:     "nil",
+			input:    nil,
+			expected: nil,
+		},
+		{
+			name:     "empty slice",
+			input:    []interface{}{},
+			expected: nil,
+		},
+		{
+			name:        "mixed types in slice",
+			input:       []interface{}{"doc1", 123, "doc2"},
+			expected:    []DocID{StringID("doc1"), StringID("doc2")},
+			wantDropped: 1,
+		},
+		{
+			name:     "BSON array of ObjectIDs and strings",
+			input:    primitive.A{oid, "doc1"},
+			expected: []DocID{ObjectID(oid), StringID("doc1")},
+		},
+		{
+			name: "objects with an id field",
+			input: primitive.A{
+				primitive.D{{Key: "id", Value: "doc1"}, {Key: "path", Value: "expenses/doc1"}},
+				primitive.M{"id": oid, "path": "expenses/" + oid.Hex()},
+				map[string]interface{}{"id": "doc2"},
+			},
+			expected: []DocID{StringID("doc1"), ObjectID(oid), StringID("doc2")},
+		},
+		{
+			name:        "objects without an id and empty IDs",
+			input:       primitive.A{primitive.D{{Key: "path", Value: "expenses/doc1"}}, "", primitive.NilObjectID, nil, "doc1"},
+			expected:    []DocID{StringID("doc1")},
+			wantDropped: 4,
+		},
+		{
+			name:        "unsupported single value",
+			input:       42,
+			wantDropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, dropped := ParseDocIDs(tt.input)
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Errorf("ParseDocIDs() ids = %v, want %v", ids, tt.expected)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("ParseDocIDs() dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestDocIDString(t *testing.T) {
+	oid := primitive.NewObjectID()
+	if got := ObjectID(oid).String(); got != oid.Hex() {
+		t.Errorf("ObjectID.String() = %q, want %q", got, oid.Hex())
+	}
+	if got := StringID("doc1").String(); got != "doc1" {
+		t.Errorf("StringID.String() = %q, want doc1", got)
+	}
+	if !ObjectID(oid).IsObjectID() || StringID(oid.Hex()).IsObjectID() {
+		t.Error("IsObjectID() must follow the _id type, not its form")
+	}
+	if !(DocID{}).IsZero() || StringID("doc1").IsZero() {
+		t.Error("IsZero() must only be true for an unset ID")
+	}
+}
+
+func TestCandidateDocIDs(t *testing.T) {
+	oid := primitive.NewObjectID()
+
+	got := CandidateDocIDs(oid.Hex())
+	if len(got) != 2 || got[0] != StringID(oid.Hex()) || got[1] != ObjectID(oid) {
+		t.Errorf("CandidateDocIDs(%s) = %v, want the string and the ObjectID", oid.Hex(), got)
+	}
+	got = CandidateDocIDs("exp-1")
+	if len(got) != 1 || got[0] != StringID("exp-1") {
+		t.Errorf("CandidateDocIDs(exp-1) = %v, want only the string", got)
+	}
+}
+
+func TestDocIDBSONRoundTrip(t *testing.T) {
+	oid := primitive.NewObjectID()
+
+	for _, id := range []DocID{StringID("doc1"), ObjectID(oid)} {
+		raw, err := bson.Marshal(bson.M{"_id": id})
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+
+		// The ID is stored bare, so filters on _id match the stored type
+		want, _ := bson.Marshal(bson.M{"_id": id.value})
+		if string(raw) != string(want) {
+			t.Errorf("marshaled %v = %v, want %v", id, bson.Raw(raw), bson.Raw(want))
+		}
+
+		var decoded struct {
+			ID DocID `bson:"_id"`
+		}
+		if err := bson.Unmarshal(raw, &decoded); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if decoded.ID != id {
+			t.Errorf("decoded ID = %v, want %v", decoded.ID, id)
+		}
+	}
+
+	raw, _ := bson.Marshal(bson.M{"_id": 42})
+	var decoded struct {
+		ID DocID `bson:"_id"`
+	}
+	if err := bson.Unmarshal(raw, &decoded); err == nil {
+		t.Error("Unmarshal() of an integer _id should fail")
+	}
+}
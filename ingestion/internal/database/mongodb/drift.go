@@ -0,0 +1,177 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SchemaDriftCollection is the MongoDB collection holding an entry per document field that
+// the document type of its collection does not know
+const SchemaDriftCollection = "schema_drift"
+
+// SchemaDriftDocument represents an unknown field of a collection (collection: schema_drift).
+// Occurrences counts sightings, not distinct documents: a document fetched again, on each
+// change or resync, is counted again.
+type SchemaDriftDocument struct {
+	ID          string    `bson:"_id"`
+	Collection  string    `bson:"collection"`
+	Field       string    `bson:"field"`
+	BSONType    string    `bson:"bsonType"`
+	Occurrences int64     `bson:"occurrences"`
+	SampleDocID string    `bson:"sampleDocumentId"`
+	FirstSeenAt time.Time `bson:"firstSeenAt"`
+	LastSeenAt  time.Time `bson:"lastSeenAt"`
+}
+
+// FieldDrift describes an unknown field seen during a fetch
+type FieldDrift struct {
+	// Documents counts the documents of the fetch carrying the field
+	Documents int
+	// BSONType is the type of the field in the first document seen
+	BSONType string
+	// SampleID is the ID of the first document seen with the field
+	SampleID string
+}
+
+// alwaysKnownFields are written by the service itself and are not part of any document type
+var alwaysKnownFields = map[string]bool{
+	SyncDatetimeField:            true,
+	SyncServiceField:             true,
+	SyncContentHashField:         true,
+	SyncFirestoreUpdateTimeField: true,
+}
+
+// knownFieldsCache holds the known fields of each document type
+var knownFieldsCache sync.Map
+
+// knownFields returns the BSON keys a document struct decodes, nil when the struct keeps
+// every field through an inline map
+func knownFields(t reflect.Type) map[string]bool {
+	if cached, ok := knownFieldsCache.Load(t); ok {
+		return cached.(map[string]bool)
+	}
+
+	fields := make(map[string]bool)
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			tag := strings.Split(f.Tag.Get("bson"), ",")
+			if len(tag) > 1 && tag[1] == "inline" {
+				fields = nil
+				break
+			}
+			name := tag[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = true
+		}
+	}
+
+	knownFieldsCache.Store(t, fields)
+	return fields
+}
+
+// inspectFields returns the top-level fields of a document that are neither known nor
+// written by the service, with their BSON type, and, with preserve, the unknown and
+// unmapped fields as a JSON object for the extra_attributes column. The JSON is empty when
+// there are none.
+func inspectFields(doc bson.Raw, known map[string]bool, unmapped map[string]bool, preserve bool) (unknown map[string]string, extra string, err error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read document: %w", err)
+	}
+
+	var extraFields bson.D
+	for _, e := range elements {
+		key := e.Key()
+		if alwaysKnownFields[key] {
+			continue
+		}
+		isUnknown := known != nil && !known[key]
+		if isUnknown {
+			if unknown == nil {
+				unknown = make(map[string]string)
+			}
+			unknown[key] = e.Value().Type.String()
+		}
+		if preserve && (isUnknown || unmapped[key]) {
+			extraFields = append(extraFields, bson.E{Key: key, Value: e.Value()})
+		}
+	}
+
+	if len(extraFields) == 0 {
+		return unknown, "", nil
+	}
+	sort.Slice(extraFields, func(i, j int) bool { return extraFields[i].Key < extraFields[j].Key })
+	data, err := bson.MarshalExtJSON(extraFields, false, false)
+	if err != nil {
+		return unknown, "", fmt.Errorf("failed to encode extra attributes: %w", err)
+	}
+	return unknown, string(data), nil
+}
+
+// RecordSchemaDrift adds the unknown fields seen in a fetch of a collection to the drift
+// report, one entry per field adding the fetch's documents to its occurrences
+func (c *Connection) RecordSchemaDrift(ctx context.Context, collection string, fields map[string]FieldDrift) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(fields))
+	for field, drift := range fields {
+		update := bson.M{
+			"$setOnInsert": bson.M{"collection": collection, "field": field, "firstSeenAt": now},
+			"$set":         bson.M{"bsonType": drift.BSONType, "sampleDocumentId": drift.SampleID, "lastSeenAt": now},
+			"$inc":         bson.M{"occurrences": drift.Documents},
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": collection + "." + field}).
+			SetUpdate(update).
+			SetUpsert(true))
+	}
+
+	_, err := c.Collection(SchemaDriftCollection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("failed to record schema drift: %w", err)
+	}
+	return nil
+}
+
+// GetSchemaDrift lists the drift report, most recently seen first. An empty collection
+// matches every collection.
+func (c *Connection) GetSchemaDrift(ctx context.Context, collection string) ([]SchemaDriftDocument, error) {
+	filter := bson.M{}
+	if collection != "" {
+		filter["collection"] = collection
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: 1}})
+	cursor, err := c.Collection(SchemaDriftCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find schema drift: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entries []SchemaDriftDocument
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode schema drift: %w", err)
+	}
+	return entries, nil
+}
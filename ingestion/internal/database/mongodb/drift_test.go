@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestKnownFields(t *testing.T) {
+	type doc struct {
+		ID       string `bson:"_id"`
+		Name     string `bson:"name,omitempty"`
+		Skipped  string `bson:"-"`
+		Untagged string
+		hidden   string
+	}
+
+	got := knownFields(reflect.TypeOf(doc{}))
+	want := map[string]bool{"_id": true, "name": true, "untagged": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("knownFields() = %v, want %v", got, want)
+	}
+
+	type inline struct {
+		ID    string                 `bson:"_id"`
+		Extra map[string]interface{} `bson:",inline"`
+	}
+	if got := knownFields(reflect.TypeOf(inline{})); got != nil {
+		t.Errorf("knownFields() of an inline struct = %v, want nil", got)
+	}
+}
+
+func TestInspectFields(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: "doc-1"},
+		{Key: "name", Value: "Rent"},
+		{Key: "created", Value: "2024-01-01"},
+		{Key: "tags", Value: bson.A{"a"}},
+		{Key: "amount", Value: int32(3)},
+		{Key: SyncDatetimeField, Value: "2024-01-02"},
+	})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	known := map[string]bool{"_id": true, "name": true, "created": true}
+	unmapped := map[string]bool{"created": true}
+
+	unknown, extra, err := inspectFields(doc, known, unmapped, true)
+	if err != nil {
+		t.Fatalf("inspectFields() error = %v", err)
+	}
+	wantUnknown := map[string]string{"tags": "array", "amount": "32-bit integer"}
+	if !reflect.DeepEqual(unknown, wantUnknown) {
+		t.Errorf("inspectFields() unknown = %v, want %v", unknown, wantUnknown)
+	}
+	if want := `{"amount":3,"created":"2024-01-01","tags":["a"]}`; extra != want {
+		t.Errorf("inspectFields() extra = %s, want %s", extra, want)
+	}
+
+	if _, extra, _ := inspectFields(doc, known, unmapped, false); extra != "" {
+		t.Errorf("inspectFields() without preserve extra = %s, want empty", extra)
+	}
+
+	unknown, extra, _ = inspectFields(doc, nil, nil, true)
+	if unknown != nil || extra != "" {
+		t.Errorf("inspectFields() with every field known = %v, %q, want none", unknown, extra)
+	}
+}
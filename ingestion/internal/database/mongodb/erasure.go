@@ -0,0 +1,150 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErasureCollection is the MongoDB collection holding a tombstone per erased user, so
+// documents of an erased user that reappear, for example when Firestore is replayed, are
+// never synced again
+const ErasureCollection = "user_erasures"
+
+// userDocumentFields maps each collection holding user data to the field that references
+// the user. The users collection is keyed by the user ID itself.
+var userDocumentFields = []struct {
+	collection string
+	field      string
+}{
+	{"expenses", "user"},
+	{"banks", "user"},
+	{"additional_balances", "user"},
+	{"balance_history", "user"},
+	{"expense_automatic_workflow", "user"},
+	{"expense_automatic_workflow_pre_saved_description", "user"},
+	{"payments", "user"},
+	{"users", "_id"},
+}
+
+// ErasureTombstone represents an erased user (collection: user_erasures)
+type ErasureTombstone struct {
+	UserID      string    `bson:"_id"`
+	ReceiptGUID string    `bson:"receiptGuid"`
+	ErasedAt    time.Time `bson:"erasedAt"`
+}
+
+// TombstoneUser records that a user is erased. Erasing the same user again replaces the
+// receipt the tombstone points to.
+func (c *Connection) TombstoneUser(ctx context.Context, userID string, receiptGUID string, at time.Time) error {
+	coll := c.Collection(ErasureCollection)
+
+	filter := bson.M{"_id": userID}
+	update := bson.M{"$set": bson.M{"receiptGuid": receiptGUID, "erasedAt": at}}
+	if _, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to tombstone user: %w", err)
+	}
+	return nil
+}
+
+// GetErasedUserIDs returns which of the given user IDs have a tombstone
+func (c *Connection) GetErasedUserIDs(ctx context.Context, userIDs []string) (map[string]bool, error) {
+	erased := make(map[string]bool)
+	if len(userIDs) == 0 {
+		return erased, nil
+	}
+
+	cursor, err := c.Collection(ErasureCollection).Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find erased users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tombstones []ErasureTombstone
+	if err := cursor.All(ctx, &tombstones); err != nil {
+		return nil, fmt.Errorf("failed to decode erased users: %w", err)
+	}
+	for _, t := range tombstones {
+		erased[t.UserID] = true
+	}
+	return erased, nil
+}
+
+// EraseUserDocuments deletes every document of a user, and the quarantine entries of those
+// documents, and returns the number of deleted documents per collection
+func (c *Connection) EraseUserDocuments(ctx context.Context, userID string) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	var quarantineIDs []string
+
+	for _, u := range userDocumentFields {
+		ids, err := c.findUserDocumentIDs(ctx, u.collection, u.field, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			quarantineIDs = append(quarantineIDs, quarantineID(u.collection, id.String()))
+		}
+
+		result, err := c.Collection(u.collection).DeleteMany(ctx, bson.M{u.field: userID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete %s of user: %w", u.collection, err)
+		}
+		if result.DeletedCount > 0 {
+			counts[u.collection] = result.DeletedCount
+		}
+	}
+
+	if len(quarantineIDs) > 0 {
+		result, err := c.Collection(QuarantineCollection).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": quarantineIDs}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete quarantine entries of user: %w", err)
+		}
+		if result.DeletedCount > 0 {
+			counts[QuarantineCollection] = result.DeletedCount
+		}
+	}
+
+	return counts, nil
+}
+
+// GetUserDocumentIDs returns the IDs of every document of a user, per collection. Collections
+// without documents of the user are left out.
+func (c *Connection) GetUserDocumentIDs(ctx context.Context, userID string) (map[string][]DocID, error) {
+	ids := make(map[string][]DocID)
+	for _, u := range userDocumentFields {
+		found, err := c.findUserDocumentIDs(ctx, u.collection, u.field, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			ids[u.collection] = found
+		}
+	}
+	return ids, nil
+}
+
+// findUserDocumentIDs returns the IDs of the documents of a collection whose field holds userID
+func (c *Connection) findUserDocumentIDs(ctx context.Context, collection, field, userID string) ([]DocID, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := c.Collection(collection).Find(ctx, bson.M{field: userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s of user: %w", collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID DocID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode %s of user: %w", collection, err)
+	}
+
+	ids := make([]DocID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,29 @@
+package mongodb
+
+import "testing"
+
+func TestUserDocumentFields(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, u := range userDocumentFields {
+		if seen[u.collection] {
+			t.Errorf("collection %s listed twice", u.collection)
+		}
+		seen[u.collection] = true
+
+		want := "user"
+		if u.collection == "users" {
+			want = "_id"
+		}
+		if u.field != want {
+			t.Errorf("%s: field = %s, want %s", u.collection, u.field, want)
+		}
+	}
+
+	// Every collection synced per user must be erased
+	for _, collection := range []string{"users", "expenses", "banks", "additional_balances", "balance_history",
+		"expense_automatic_workflow", "expense_automatic_workflow_pre_saved_description", "payments"} {
+		if !seen[collection] {
+			t.Errorf("collection %s is not erased", collection)
+		}
+	}
+}
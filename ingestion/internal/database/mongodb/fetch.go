@@ -0,0 +1,177 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultFetchBatchSize is the number of IDs per $in query when neither the fetch options
+// nor the connection configure one
+const DefaultFetchBatchSize = 500
+
+// FetchOptions tunes a fetch by IDs
+type FetchOptions struct {
+	// BatchSize is the number of IDs per query and the most documents held in memory at
+	// once. Zero uses MONGODB_FETCH_BATCH_SIZE.
+	BatchSize int
+	// Projection selects the fetched fields, for example bson.M{"base64_image": 0} to leave
+	// out heavy fields. Nil fetches whole documents. Documents fetched with a projection
+	// have no content hash or extra attributes, since they would only cover the fetched
+	// fields.
+	Projection bson.M
+	// UnmappedFields are fields of T that no column holds. With PreserveExtra they are kept
+	// in FetchedDoc.ExtraAttributes along with the fields T does not know.
+	UnmappedFields []string
+	// PreserveExtra fills FetchedDoc.ExtraAttributes
+	PreserveExtra bool
+}
+
+// FetchResult counts the documents of a fetch by IDs
+type FetchResult struct {
+	Requested int
+	Found     int
+	// Unchanged counts the found documents whose content is the version last synced
+	Unchanged int
+	// UnknownFields are the fields of the found documents that T does not know
+	UnknownFields map[string]FieldDrift
+	// Missing are the requested IDs without a document, in request order
+	Missing []string
+}
+
+// FetchByIDs fetches the documents of a collection with the given IDs, decoded as T, and
+// passes them to fn one batch at a time, with the typed IDs and sync state of the batch's
+// documents. IDs are deduplicated and queried BatchSize at a time, so a tracking document
+// with thousands of IDs never builds one giant $in or loads every document at once. An
+// error from fn stops the fetch.
+func FetchByIDs[T any](ctx context.Context, c *Connection, collection string, ids []DocID, opts FetchOptions, fn func(batch []T, fetched FetchedDocs) error) (FetchResult, error) {
+	ids = uniqueIDs(ids)
+	result := FetchResult{Requested: len(ids)}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = c.cfg.FetchBatchSize
+	}
+	if size <= 0 {
+		size = DefaultFetchBatchSize
+	}
+
+	findOpts := options.Find()
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+
+	log.Printf("Fetching %d %s documents from MongoDB in batches of %d", len(ids), collection, size)
+	for _, chunk := range chunkIDs(ids, size) {
+		batch, found, err := fetchChunk[T](ctx, c, collection, chunk, findOpts, opts)
+		if err != nil {
+			return result, err
+		}
+		result.Found += len(batch)
+		for _, id := range chunk {
+			doc, ok := found[id.String()]
+			if !ok {
+				continue
+			}
+			if !doc.ChangedSinceSync() {
+				result.Unchanged++
+			}
+			for field, bsonType := range doc.UnknownFields {
+				if result.UnknownFields == nil {
+					result.UnknownFields = make(map[string]FieldDrift)
+				}
+				drift := result.UnknownFields[field]
+				if drift.Documents == 0 {
+					drift.BSONType, drift.SampleID = bsonType, id.String()
+				}
+				drift.Documents++
+				result.UnknownFields[field] = drift
+			}
+		}
+		for _, id := range chunk {
+			if _, ok := found[id.String()]; !ok {
+				result.Missing = append(result.Missing, id.String())
+			}
+		}
+
+		if len(batch) == 0 {
+			continue
+		}
+		if err := fn(batch, found); err != nil {
+			return result, err
+		}
+	}
+
+	log.Printf("Retrieved %d %s documents from MongoDB (requested %d, unchanged since their last sync %d)",
+		result.Found, collection, result.Requested, result.Unchanged)
+	return result, nil
+}
+
+// fetchChunk runs one $in query and returns its documents, indexed with their sync state
+// and unknown fields
+func fetchChunk[T any](ctx context.Context, c *Connection, collection string, ids []DocID, findOpts *options.FindOptions, opts FetchOptions) ([]T, FetchedDocs, error) {
+	cursor, err := c.Collection(collection).Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, findOpts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find %s: %w", collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	whole := opts.Projection == nil
+	known := knownFields(reflect.TypeOf((*T)(nil)).Elem())
+	unmapped := make(map[string]bool, len(opts.UnmappedFields))
+	for _, field := range opts.UnmappedFields {
+		unmapped[field] = true
+	}
+
+	batch := make([]T, 0, len(ids))
+	found := make(FetchedDocs, len(ids))
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s: %w", collection, err)
+		}
+		if fetched, ok := newFetchedDoc(cursor.Current, whole); ok {
+			fetched.UnknownFields, fetched.ExtraAttributes, err = inspectFields(cursor.Current, known, unmapped, whole && opts.PreserveExtra)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to inspect %s %s: %w", collection, fetched.ID, err)
+			}
+			found[fetched.ID.String()] = fetched
+		}
+		batch = append(batch, doc)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", collection, err)
+	}
+	return batch, found, nil
+}
+
+// uniqueIDs returns ids without duplicates or empty IDs, in their first order
+func uniqueIDs(ids []DocID) []DocID {
+	seen := make(map[DocID]bool, len(ids))
+	unique := make([]DocID, 0, len(ids))
+	for _, id := range ids {
+		if id.IsZero() || id.String() == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// chunkIDs splits ids into slices of at most size IDs
+func chunkIDs(ids []DocID, size int) [][]DocID {
+	var chunks [][]DocID
+	for len(ids) > size {
+		chunks = append(chunks, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
@@ -0,0 +1,43 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUniqueIDs(t *testing.T) {
+	oid := primitive.NewObjectID()
+	ids := []DocID{StringID("b"), StringID("a"), StringID(""), {}, StringID("b"), ObjectID(oid), StringID("c"), ObjectID(oid)}
+	got := uniqueIDs(ids)
+	if want := []DocID{StringID("b"), StringID("a"), ObjectID(oid), StringID("c")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueIDs() = %v, want %v", got, want)
+	}
+	if got := uniqueIDs(nil); len(got) != 0 {
+		t.Errorf("uniqueIDs(nil) = %v, want empty", got)
+	}
+}
+
+func TestChunkIDs(t *testing.T) {
+	a, b, c, d, e := StringID("a"), StringID("b"), StringID("c"), StringID("d"), StringID("e")
+	tests := []struct {
+		name string
+		ids  []DocID
+		size int
+		want [][]DocID
+	}{
+		{"empty", nil, 2, nil},
+		{"smaller than a chunk", []DocID{a}, 2, [][]DocID{{a}}},
+		{"exact chunks", []DocID{a, b, c, d}, 2, [][]DocID{{a, b}, {c, d}}},
+		{"last chunk shorter", []DocID{a, b, c, d, e}, 2, [][]DocID{{a, b}, {c, d}, {e}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkIDs(tt.ids, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunkIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
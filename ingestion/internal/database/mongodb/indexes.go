@@ -0,0 +1,169 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index on a collection the service reads
+type IndexSpec struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	// Purpose names the queries the index serves
+	Purpose string
+}
+
+// pendingSyncCollections are the collections read by the GetPendingSync* queries
+var pendingSyncCollections = []string{
+	"users",
+	"expenses",
+	"banks",
+	"additional_balances",
+	"balance_history",
+	"expense_automatic_workflow",
+	"expense_automatic_workflow_pre_saved_description",
+	"payments",
+}
+
+// IndexSpecs returns the indexes the service relies on, in creation order
+func IndexSpecs() []IndexSpec {
+	var specs []IndexSpec
+	for _, collection := range pendingSyncCollections {
+		specs = append(specs, IndexSpec{
+			Collection: collection,
+			Name:       "onPremiseSyncDatetime_1",
+			Keys:       bson.D{{Key: "onPremiseSyncDatetime", Value: 1}},
+			Purpose:    "pending sync queries",
+		})
+	}
+
+	specs = append(specs,
+		IndexSpec{
+			Collection: "expenses",
+			Name:       "user_1_expenseName_1_validity_1_spendingDate_1",
+			Keys: bson.D{
+				{Key: "user", Value: 1},
+				{Key: "expenseName", Value: 1},
+				{Key: "validity", Value: 1},
+				{Key: "spendingDate", Value: 1},
+			},
+			Purpose: "expense aggregates and per-user queries",
+		},
+		IndexSpec{
+			Collection: "expenses",
+			Name:       "expenseAutomaticWorkflowId_1",
+			Keys:       bson.D{{Key: "expenseAutomaticWorkflowId", Value: 1}},
+			Purpose:    "expenses of a workflow",
+		},
+	)
+
+	// The expenses index above already starts with user, and users are keyed by _id
+	for _, u := range userDocumentFields {
+		if u.field != "user" || u.collection == "expenses" {
+			continue
+		}
+		specs = append(specs, IndexSpec{
+			Collection: u.collection,
+			Name:       "user_1",
+			Keys:       bson.D{{Key: "user", Value: 1}},
+			Purpose:    "per-user resync and erasure",
+		})
+	}
+
+	specs = append(specs, IndexSpec{
+		Collection: QuarantineCollection,
+		Name:       "collection_1_status_1_updatedAt_-1",
+		Keys: bson.D{
+			{Key: "collection", Value: 1},
+			{Key: "status", Value: 1},
+			{Key: "updatedAt", Value: -1},
+		},
+		Purpose: "quarantine listings",
+	})
+
+	return specs
+}
+
+// IndexResult reports ensuring one declared index
+type IndexResult struct {
+	IndexSpec
+	// Created is false when the index already existed
+	Created bool
+	Err     error
+}
+
+// EnsureIndexes creates the declared indexes that do not exist yet. Indexes are matched by
+// name, so running it again changes nothing. Every index is attempted; the ones that could
+// not be created, for example because an index with the same keys exists under another
+// name, carry their error in the results.
+func (c *Connection) EnsureIndexes(ctx context.Context) []IndexResult {
+	specs := IndexSpecs()
+	results := make([]IndexResult, len(specs))
+	existing := make(map[string]map[string]bool)
+
+	for i, spec := range specs {
+		results[i].IndexSpec = spec
+
+		names, ok := existing[spec.Collection]
+		if !ok {
+			var err error
+			names, err = c.indexNames(ctx, spec.Collection)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			existing[spec.Collection] = names
+		}
+		if names[spec.Name] {
+			continue
+		}
+
+		model := mongo.IndexModel{Keys: spec.Keys, Options: options.Index().SetName(spec.Name)}
+		if _, err := c.Collection(spec.Collection).Indexes().CreateOne(ctx, model); err != nil {
+			results[i].Err = fmt.Errorf("failed to create index %s on %s: %w", spec.Name, spec.Collection, err)
+			continue
+		}
+		names[spec.Name] = true
+		results[i].Created = true
+	}
+
+	return results
+}
+
+// indexNames returns the names of the indexes of a collection, none when the collection
+// does not exist yet
+func (c *Connection) indexNames(ctx context.Context, collection string) (map[string]bool, error) {
+	names := make(map[string]bool)
+
+	cursor, err := c.Collection(collection).Indexes().List(ctx)
+	if isNamespaceNotFound(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes of %s: %w", collection, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		if name, ok := cursor.Current.Lookup("name").StringValueOK(); ok {
+			names[name] = true
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indexes of %s: %w", collection, err)
+	}
+	return names, nil
+}
+
+// isNamespaceNotFound reports whether err is MongoDB's NamespaceNotFound error, returned
+// when listing the indexes of a collection that does not exist
+func isNamespaceNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 26
+}
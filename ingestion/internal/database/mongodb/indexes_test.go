@@ -0,0 +1,55 @@
+package mongodb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIndexSpecs(t *testing.T) {
+	specs := IndexSpecs()
+
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		key := spec.Collection + "." + spec.Name
+		if seen[key] {
+			t.Errorf("index %s declared twice", key)
+		}
+		seen[key] = true
+
+		// Names follow MongoDB's default naming, so an index created by hand with the same
+		// keys is recognized
+		parts := make([]string, len(spec.Keys))
+		for i, k := range spec.Keys {
+			parts[i] = fmt.Sprintf("%s_%v", k.Key, k.Value)
+		}
+		if want := strings.Join(parts, "_"); spec.Name != want {
+			t.Errorf("%s: name = %s, want %s", spec.Collection, spec.Name, want)
+		}
+	}
+
+	for _, collection := range pendingSyncCollections {
+		if !seen[collection+".onPremiseSyncDatetime_1"] {
+			t.Errorf("%s has no pending sync index", collection)
+		}
+	}
+	for _, u := range userDocumentFields {
+		if u.field == "user" && !seen[u.collection+".user_1"] && u.collection != "expenses" {
+			t.Errorf("%s has no user index", u.collection)
+		}
+	}
+	if !seen["expenses.user_1_expenseName_1_validity_1_spendingDate_1"] {
+		t.Error("expenses has no expense aggregate index")
+	}
+}
+
+func TestIsNamespaceNotFound(t *testing.T) {
+	if !isNamespaceNotFound(fmt.Errorf("list: %w", mongo.CommandError{Code: 26, Name: "NamespaceNotFound"})) {
+		t.Error("NamespaceNotFound was not recognized")
+	}
+	if isNamespaceNotFound(mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}) || isNamespaceNotFound(nil) {
+		t.Error("other errors must not be NamespaceNotFound")
+	}
+}
@@ -0,0 +1,244 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// QuarantineCollection is the MongoDB collection holding documents that failed validation
+const QuarantineCollection = "quarantine"
+
+// Quarantine statuses
+const (
+	// QuarantineStatusQuarantined marks a document that failed validation and is not synced
+	QuarantineStatusQuarantined = "quarantined"
+	// QuarantineStatusReleased marks a document an operator released for another ingestion attempt
+	QuarantineStatusReleased = "released"
+	// QuarantineStatusResolved marks a document that passed validation after being quarantined
+	QuarantineStatusResolved = "resolved"
+)
+
+// QuarantineViolation is a single validation rule a document failed
+type QuarantineViolation struct {
+	Field   string `bson:"field"`
+	Rule    string `bson:"rule"`
+	Message string `bson:"message"`
+}
+
+// QuarantineDocument represents a quarantined document (collection: quarantine)
+// There is one entry per source collection and document ID.
+type QuarantineDocument struct {
+	ID            string                `bson:"_id"`
+	Collection    string                `bson:"collection"`
+	DocumentID    string                `bson:"documentId"`
+	Status        string                `bson:"status"`
+	Violations    []QuarantineViolation `bson:"violations"`
+	Occurrences   int                   `bson:"occurrences"`
+	QuarantinedAt time.Time             `bson:"quarantinedAt"`
+	UpdatedAt     time.Time             `bson:"updatedAt"`
+	ReleasedAt    *time.Time            `bson:"releasedAt,omitempty"`
+	ResolvedAt    *time.Time            `bson:"resolvedAt,omitempty"`
+	Notes         []string              `bson:"notes,omitempty"`
+}
+
+// quarantineID builds the quarantine entry ID for a source document
+func quarantineID(collectionName string, docID string) string {
+	return collectionName + ":" + docID
+}
+
+// QuarantineDocument upserts the quarantine entry for a document with its current violations
+func (c *Connection) QuarantineDocument(ctx context.Context, collectionName string, docID string, violations []QuarantineViolation) error {
+	coll := c.Collection(QuarantineCollection)
+
+	now := time.Now()
+	filter := bson.M{"_id": quarantineID(collectionName, docID)}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     QuarantineStatusQuarantined,
+			"violations": violations,
+			"updatedAt":  now,
+		},
+		"$setOnInsert": bson.M{
+			"collection":    collectionName,
+			"documentId":    docID,
+			"quarantinedAt": now,
+		},
+		"$inc": bson.M{"occurrences": 1},
+	}
+
+	_, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to quarantine document: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveQuarantinedDocuments marks the quarantine entries of documents that passed validation as resolved
+func (c *Connection) ResolveQuarantinedDocuments(ctx context.Context, collectionName string, docIDs []string) error {
+	if len(docIDs) == 0 {
+		return nil
+	}
+
+	coll := c.Collection(QuarantineCollection)
+
+	ids := make([]string, len(docIDs))
+	for i, docID := range docIDs {
+		ids[i] = quarantineID(collectionName, docID)
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":    bson.M{"$in": ids},
+		"status": bson.M{"$ne": QuarantineStatusResolved},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     QuarantineStatusResolved,
+			"resolvedAt": now,
+			"updatedAt":  now,
+		},
+	}
+
+	if _, err := coll.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to resolve quarantined documents: %w", err)
+	}
+
+	return nil
+}
+
+// GetQuarantinedDocuments lists quarantine entries, newest first.
+// Empty collectionName or status match any value; limit <= 0 means no limit.
+func (c *Connection) GetQuarantinedDocuments(ctx context.Context, collectionName string, status string, limit int64) ([]QuarantineDocument, error) {
+	coll := c.Collection(QuarantineCollection)
+
+	filter := bson.M{}
+	if collectionName != "" {
+		filter["collection"] = collectionName
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.M{"updatedAt": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find quarantined documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entries []QuarantineDocument
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode quarantined documents: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetQuarantinedDocument fetches the quarantine entry of a document, or nil if there is none
+func (c *Connection) GetQuarantinedDocument(ctx context.Context, collectionName string, docID string) (*QuarantineDocument, error) {
+	coll := c.Collection(QuarantineCollection)
+
+	var entry QuarantineDocument
+	err := coll.FindOne(ctx, bson.M{"_id": quarantineID(collectionName, docID)}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find quarantined document: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// ReleaseQuarantinedDocument marks a quarantine entry as released so it can be ingested again
+func (c *Connection) ReleaseQuarantinedDocument(ctx context.Context, collectionName string, docID string, note string) error {
+	coll := c.Collection(QuarantineCollection)
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":     QuarantineStatusReleased,
+			"releasedAt": now,
+			"updatedAt":  now,
+		},
+	}
+	if note != "" {
+		update["$push"] = bson.M{"notes": note}
+	}
+
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": quarantineID(collectionName, docID)}, update)
+	if err != nil {
+		return fmt.Errorf("failed to release quarantined document: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no quarantine entry for %s document %s", collectionName, docID)
+	}
+
+	return nil
+}
+
+// FindDocID returns the typed _id of a source document from the string form quarantine
+// entries and commands use, trying the ObjectID a hex ID encodes as well as the string
+func (c *Connection) FindDocID(ctx context.Context, collectionName string, docID string) (DocID, error) {
+	filter := bson.M{"_id": bson.M{"$in": CandidateDocIDs(docID)}}
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+
+	raw, err := c.Collection(collectionName).FindOne(ctx, filter, opts).Raw()
+	if err == mongo.ErrNoDocuments {
+		return DocID{}, fmt.Errorf("%s document %s not found", collectionName, docID)
+	}
+	if err != nil {
+		return DocID{}, fmt.Errorf("failed to find %s document %s: %w", collectionName, docID, err)
+	}
+
+	id, ok := DocIDFromRaw(raw.Lookup("_id"))
+	if !ok {
+		return DocID{}, fmt.Errorf("%s document %s has an unsupported _id", collectionName, docID)
+	}
+	return id, nil
+}
+
+// FixQuarantinedDocument sets fields on a quarantined source document and records a note on its
+// quarantine entry. The document is not re-validated until it is released.
+func (c *Connection) FixQuarantinedDocument(ctx context.Context, collectionName string, docID string, fields bson.M, note string) error {
+	entry, err := c.GetQuarantinedDocument(ctx, collectionName, docID)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("no quarantine entry for %s document %s", collectionName, docID)
+	}
+
+	id, err := c.FindDocID(ctx, collectionName, docID)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.Collection(collectionName).UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	if err != nil {
+		return fmt.Errorf("failed to update quarantined document: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%s document %s not found", collectionName, docID)
+	}
+
+	update := bson.M{
+		"$set":  bson.M{"updatedAt": time.Now()},
+		"$push": bson.M{"notes": note},
+	}
+	if _, err := c.Collection(QuarantineCollection).UpdateOne(ctx, bson.M{"_id": entry.ID}, update); err != nil {
+		return fmt.Errorf("failed to record fix on quarantine entry: %w", err)
+	}
+
+	return nil
+}
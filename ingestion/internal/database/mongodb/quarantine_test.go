@@ -0,0 +1,51 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuarantineID(t *testing.T) {
+	if id := quarantineID("expenses", "exp-1"); id != "expenses:exp-1" {
+		t.Errorf("quarantineID() = %s, want expenses:exp-1", id)
+	}
+}
+
+func TestQuarantineDocumentStructure(t *testing.T) {
+	now := time.Now()
+	entry := QuarantineDocument{
+		ID:         quarantineID("payments", "sp-1"),
+		Collection: "payments",
+		DocumentID: "sp-1",
+		Status:     QuarantineStatusQuarantined,
+		Violations: []QuarantineViolation{
+			{Field: "paymentDate", Rule: "date", Message: "unsupported date 15/01: "},
+		},
+		Occurrences:   1,
+		QuarantinedAt: now,
+		UpdatedAt:     now,
+	}
+
+	if entry.Collection != "payments" {
+		t.Errorf("Collection = %s, want payments", entry.Collection)
+	}
+	if entry.Status != "quarantined" {
+		t.Errorf("Status = %s, want quarantined", entry.Status)
+	}
+	if len(entry.Violations) != 1 || entry.Violations[0].Field != "paymentDate" {
+		t.Errorf("Violations = %+v, want one paymentDate violation", entry.Violations)
+	}
+}
+
+func TestQuarantineStatuses(t *testing.T) {
+	statuses := map[string]string{
+		QuarantineStatusQuarantined: "quarantined",
+		QuarantineStatusReleased:    "released",
+		QuarantineStatusResolved:    "resolved",
+	}
+	for got, want := range statuses {
+		if got != want {
+			t.Errorf("status = %s, want %s", got, want)
+		}
+	}
+}
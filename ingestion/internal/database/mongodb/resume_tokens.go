@@ -0,0 +1,48 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ResumeTokenCollection is the MongoDB collection holding the last processed position of
+// each change stream, so a restarted service continues where it left off
+const ResumeTokenCollection = "change_stream_resume_tokens"
+
+// ResumeTokenDocument represents the saved position of a change stream (collection:
+// change_stream_resume_tokens)
+type ResumeTokenDocument struct {
+	Stream    string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// GetResumeToken returns the saved resume token of a change stream, nil when the stream
+// has never saved one
+func (c *Connection) GetResumeToken(ctx context.Context, stream string) (bson.Raw, error) {
+	var doc ResumeTokenDocument
+	err := c.Collection(ResumeTokenCollection).FindOne(ctx, bson.M{"_id": stream}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resume token: %w", err)
+	}
+	return doc.Token, nil
+}
+
+// SaveResumeToken saves the resume token of a change stream
+func (c *Connection) SaveResumeToken(ctx context.Context, stream string, token bson.Raw) error {
+	filter := bson.M{"_id": stream}
+	update := bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}}
+	_, err := c.Collection(ResumeTokenCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save resume token: %w", err)
+	}
+	return nil
+}
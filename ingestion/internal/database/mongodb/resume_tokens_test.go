@@ -0,0 +1,32 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestResumeTokenDocumentRoundTrip(t *testing.T) {
+	token, err := bson.Marshal(bson.M{"_data": "8263A1B2C3000000012B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := ResumeTokenDocument{Stream: "ingestion", Token: token, UpdatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if id := bson.Raw(raw).Lookup("_id").StringValue(); id != "ingestion" {
+		t.Errorf("_id = %q, want the stream name", id)
+	}
+
+	var decoded ResumeTokenDocument
+	if err := bson.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if string(decoded.Token) != string(token) {
+		t.Errorf("Token = %v, want %v", decoded.Token, bson.Raw(token))
+	}
+}
@@ -0,0 +1,143 @@
+package mongodb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/porcool/ingestion/internal/dates"
+)
+
+// Fields MarkAsSynced writes to a document synced to MariaDB
+const (
+	SyncDatetimeField = "onPremiseRelationalDBSyncDatetime"
+	SyncServiceField  = "onPremiseRelationalDBSyncService"
+	// SyncContentHashField holds the content hash of the synced version of the document
+	SyncContentHashField = "onPremiseRelationalDBSyncContentHash"
+	// SyncFirestoreUpdateTimeField holds the _firestoreUpdateTime of the synced version
+	SyncFirestoreUpdateTimeField = "onPremiseRelationalDBSyncFirestoreUpdateTime"
+)
+
+// contentHashIgnoredFields are left out of the content hash: the sync fields, and import
+// metadata that changes when a document is imported again without changing
+var contentHashIgnoredFields = map[string]bool{
+	SyncDatetimeField:            true,
+	SyncServiceField:             true,
+	SyncContentHashField:         true,
+	SyncFirestoreUpdateTimeField: true,
+	"_importedAt":                true,
+	"_firestoreUpdateTime":       true,
+}
+
+// ContentHash returns the hex SHA-256 of a document's top-level fields in key order,
+// leaving out the sync fields and import metadata. Two versions of a document with the same
+// content have the same hash whatever their field order.
+func ContentHash(doc bson.Raw) (string, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return "", fmt.Errorf("failed to read document: %w", err)
+	}
+	sort.Slice(elements, func(i, j int) bool { return elements[i].Key() < elements[j].Key() })
+
+	h := sha256.New()
+	for _, e := range elements {
+		if contentHashIgnoredFields[e.Key()] {
+			continue
+		}
+		value := e.Value()
+		h.Write([]byte(e.Key()))
+		h.Write([]byte{0, byte(value.Type)})
+		h.Write(value.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SyncMark is what MarkAsSynced records about a synced document
+type SyncMark struct {
+	ID DocID
+	// ContentHash is the content hash of the version that was synced, empty when unknown
+	ContentHash string
+	// FirestoreUpdateTime is the _firestoreUpdateTime of the version that was synced, in the
+	// form firestoreUpdateTime reads it
+	FirestoreUpdateTime string
+}
+
+// FetchedDoc describes a document fetched for syncing
+type FetchedDoc struct {
+	SyncMark
+	// SyncedContentHash is the content hash recorded by the document's last sync, empty
+	// when it was never synced with one
+	SyncedContentHash string
+	// UnknownFields are the document's fields its document type does not know, with their
+	// BSON type
+	UnknownFields map[string]string
+	// ExtraAttributes is a JSON object of the document's unknown and unmapped fields, when
+	// the fetch preserves them and there are any
+	ExtraAttributes string
+}
+
+// ChangedSinceSync reports whether the document's content differs from the version last
+// synced to MariaDB. Documents without a recorded or computed hash count as changed.
+func (d FetchedDoc) ChangedSinceSync() bool {
+	return d.ContentHash == "" || d.SyncedContentHash != d.ContentHash
+}
+
+// newFetchedDoc reads the ID and sync state of a fetched document. With withHash the content
+// hash is computed; documents fetched with a projection leave it empty.
+func newFetchedDoc(doc bson.Raw, withHash bool) (FetchedDoc, bool) {
+	id, ok := DocIDFromRaw(doc.Lookup("_id"))
+	if !ok {
+		return FetchedDoc{}, false
+	}
+
+	fetched := FetchedDoc{SyncMark: SyncMark{ID: id}}
+	fetched.FirestoreUpdateTime = firestoreUpdateTime(doc.Lookup("_firestoreUpdateTime"))
+	fetched.SyncedContentHash, _ = doc.Lookup(SyncContentHashField).StringValueOK()
+	if withHash {
+		// An unreadable document is left without a hash and counts as changed
+		fetched.ContentHash, _ = ContentHash(doc)
+	}
+	return fetched, true
+}
+
+// utcDates reads the timestamps of sync marks, which are recorded in UTC
+var utcDates = dates.NewNormalizer(time.UTC)
+
+// firestoreUpdateTime reads a document's _firestoreUpdateTime. Strings are kept as imported;
+// BSON dates, timestamps and Firestore timestamp maps become RFC 3339 strings in UTC. A
+// missing or unreadable value is empty.
+func firestoreUpdateTime(raw bson.RawValue) string {
+	if s, ok := raw.StringValueOK(); ok {
+		return s
+	}
+	if raw.Type == 0 || raw.Type == bson.TypeNull {
+		return ""
+	}
+
+	var value interface{}
+	if err := raw.Unmarshal(&value); err != nil {
+		return ""
+	}
+	t, err := utcDates.Time(value)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// FetchedDocs indexes the documents of a fetched batch by their string ID, the form the
+// document structs decode _id into
+type FetchedDocs map[string]FetchedDoc
+
+// Mark returns the sync mark of a decoded document. A document that is not indexed is
+// marked by its string ID alone.
+func (docs FetchedDocs) Mark(id string) SyncMark {
+	if doc, ok := docs[id]; ok {
+		return doc.SyncMark
+	}
+	return SyncMark{ID: StringID(id)}
+}
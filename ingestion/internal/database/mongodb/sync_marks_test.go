@@ -0,0 +1,128 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mustMarshal marshals a test document
+func mustMarshal(t *testing.T, doc interface{}) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestContentHash(t *testing.T) {
+	hash := func(doc bson.D) string {
+		h, err := ContentHash(mustMarshal(t, doc))
+		if err != nil {
+			t.Fatalf("ContentHash() error = %v", err)
+		}
+		return h
+	}
+
+	base := hash(bson.D{{Key: "_id", Value: "exp-1"}, {Key: "amount", Value: 10.5}, {Key: "expenseName", Value: "Rent"}})
+
+	reordered := hash(bson.D{{Key: "expenseName", Value: "Rent"}, {Key: "_id", Value: "exp-1"}, {Key: "amount", Value: 10.5}})
+	if reordered != base {
+		t.Error("field order must not change the hash")
+	}
+
+	synced := hash(bson.D{
+		{Key: "_id", Value: "exp-1"}, {Key: "amount", Value: 10.5}, {Key: "expenseName", Value: "Rent"},
+		{Key: SyncDatetimeField, Value: time.Now()}, {Key: SyncServiceField, Value: "svc"},
+		{Key: SyncContentHashField, Value: base}, {Key: SyncFirestoreUpdateTimeField, Value: "2024-03-01T10:00:00Z"},
+		{Key: "_importedAt", Value: time.Now()}, {Key: "_firestoreUpdateTime", Value: "2024-03-01T10:00:00Z"},
+	})
+	if synced != base {
+		t.Error("sync fields and import metadata must not change the hash")
+	}
+
+	if changed := hash(bson.D{{Key: "_id", Value: "exp-1"}, {Key: "amount", Value: 11.0}, {Key: "expenseName", Value: "Rent"}}); changed == base {
+		t.Error("a changed value must change the hash")
+	}
+	if retyped := hash(bson.D{{Key: "_id", Value: "exp-1"}, {Key: "amount", Value: "10.5"}, {Key: "expenseName", Value: "Rent"}}); retyped == base {
+		t.Error("a changed value type must change the hash")
+	}
+}
+
+func TestNewFetchedDoc(t *testing.T) {
+	oid := primitive.NewObjectID()
+	raw := mustMarshal(t, bson.D{{Key: "_id", Value: oid}, {Key: "amount", Value: 10}, {Key: "_firestoreUpdateTime", Value: "2024-03-01T10:00:00Z"}})
+
+	doc, ok := newFetchedDoc(raw, true)
+	if !ok {
+		t.Fatal("newFetchedDoc() rejected an ObjectID _id")
+	}
+	if doc.ID != ObjectID(oid) || doc.FirestoreUpdateTime != "2024-03-01T10:00:00Z" || doc.ContentHash == "" {
+		t.Errorf("newFetchedDoc() = %+v", doc)
+	}
+	if !doc.ChangedSinceSync() {
+		t.Error("a document never synced with a hash must count as changed")
+	}
+
+	syncedRaw := mustMarshal(t, bson.D{{Key: "_id", Value: oid}, {Key: "amount", Value: 10}, {Key: SyncContentHashField, Value: doc.ContentHash}})
+	synced, _ := newFetchedDoc(syncedRaw, true)
+	if synced.ChangedSinceSync() {
+		t.Error("a document with its synced content hash must not count as changed")
+	}
+
+	projected, _ := newFetchedDoc(syncedRaw, false)
+	if projected.ContentHash != "" || !projected.ChangedSinceSync() {
+		t.Errorf("projected document = %+v, want no hash and counted as changed", projected)
+	}
+
+	if _, ok := newFetchedDoc(mustMarshal(t, bson.D{{Key: "_id", Value: 42}}), true); ok {
+		t.Error("newFetchedDoc() accepted an integer _id")
+	}
+}
+
+func TestFirestoreUpdateTime(t *testing.T) {
+	at := time.Date(2024, 3, 1, 10, 0, 0, 500000000, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"string", "2024-03-01T07:00:00-03:00", "2024-03-01T07:00:00-03:00"},
+		{"time.Time", at, "2024-03-01T10:00:00.5Z"},
+		{"BSON date", primitive.NewDateTimeFromTime(at), "2024-03-01T10:00:00.5Z"},
+		{"BSON timestamp", primitive.Timestamp{T: uint32(at.Unix())}, "2024-03-01T10:00:00Z"},
+		{"Firestore timestamp map", bson.D{{Key: "_seconds", Value: at.Unix()}, {Key: "_nanoseconds", Value: 500000000}}, "2024-03-01T10:00:00.5Z"},
+		{"null", nil, ""},
+		{"unreadable", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := mustMarshal(t, bson.D{{Key: "_id", Value: "exp-1"}, {Key: "_firestoreUpdateTime", Value: tt.value}})
+			doc, _ := newFetchedDoc(raw, false)
+			if doc.FirestoreUpdateTime != tt.want {
+				t.Errorf("FirestoreUpdateTime = %q, want %q", doc.FirestoreUpdateTime, tt.want)
+			}
+		})
+	}
+
+	doc, _ := newFetchedDoc(mustMarshal(t, bson.D{{Key: "_id", Value: "exp-1"}}), false)
+	if doc.FirestoreUpdateTime != "" {
+		t.Errorf("FirestoreUpdateTime without the field = %q, want empty", doc.FirestoreUpdateTime)
+	}
+}
+
+func TestFetchedDocsMark(t *testing.T) {
+	oid := primitive.NewObjectID()
+	docs := FetchedDocs{oid.Hex(): {SyncMark: SyncMark{ID: ObjectID(oid), ContentHash: "abc"}}}
+
+	if got := docs.Mark(oid.Hex()); got.ID != ObjectID(oid) || got.ContentHash != "abc" {
+		t.Errorf("Mark(hex) = %+v, want the ObjectID with its hash", got)
+	}
+	if got := docs.Mark("doc1"); got != (SyncMark{ID: StringID("doc1")}) {
+		t.Errorf("Mark(doc1) = %+v, want a string ID without a hash", got)
+	}
+}
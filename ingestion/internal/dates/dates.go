@@ -0,0 +1,284 @@
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MonthKeyLayout is the YYYY/MM layout used for spending dates in MariaDB
+const MonthKeyLayout = "2006/01"
+
+var (
+	// ErrEmpty is returned when there is no date value at all
+	ErrEmpty = errors.New("empty date")
+	// ErrAmbiguous is returned when a value could mean more than one date
+	ErrAmbiguous = errors.New("ambiguous date")
+	// ErrUnsupported is returned when a value is not in any supported format
+	ErrUnsupported = errors.New("unsupported date")
+)
+
+var (
+	// monthPattern matches the short month formats: YYYY-MM, YYYY/MM and YYYYMM
+	monthPattern = regexp.MustCompile(`^(\d{4})[-/]?(\d{2})$`)
+	// yearPattern matches a bare year
+	yearPattern = regexp.MustCompile(`^\d{4}$`)
+	// dayMonthPattern matches DD/MM/YYYY or MM/DD/YYYY, which cannot be told apart
+	dayMonthPattern = regexp.MustCompile(`^\d{1,2}[-/.]\d{1,2}[-/.]\d{4}$`)
+)
+
+// localLayouts are timestamp layouts without an offset, read as business-local wall clock
+var localLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// ParseError describes a value that could not be normalized.
+// It unwraps to ErrEmpty, ErrAmbiguous or ErrUnsupported.
+type ParseError struct {
+	Value  interface{}
+	Reason string
+	Err    error
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%v: %v", e.Err, e.Value)
+	}
+	return fmt.Sprintf("%v %v: %s", e.Err, e.Value, e.Reason)
+}
+
+// Unwrap returns the underlying sentinel error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Normalizer turns the date values found in MongoDB documents into times in the
+// business timezone, so that months and days are cut where users expect them to be
+type Normalizer struct {
+	loc *time.Location
+}
+
+// NewNormalizer creates a new Normalizer for the given business timezone
+func NewNormalizer(loc *time.Location) *Normalizer {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Normalizer{loc: loc}
+}
+
+// Location returns the business timezone
+func (n *Normalizer) Location() *time.Location {
+	return n.loc
+}
+
+// Time normalizes a value into an instant in the business timezone.
+// Supported values are RFC3339 strings, timestamps without an offset (read in the
+// business timezone), YYYY-MM-DD, YYYY-MM, YYYY/MM, YYYYMM, Firestore timestamp maps
+// ({_seconds, _nanoseconds}, {seconds, nanos} or {timestampValue}), BSON dates and time.Time.
+func (n *Normalizer) Time(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, &ParseError{Value: value, Err: ErrEmpty}
+	case string:
+		return n.parseString(v)
+	case *string:
+		if v == nil {
+			return time.Time{}, &ParseError{Value: value, Err: ErrEmpty}
+		}
+		return n.parseString(*v)
+	case time.Time:
+		if v.IsZero() {
+			return time.Time{}, &ParseError{Value: value, Err: ErrEmpty}
+		}
+		return v.In(n.loc), nil
+	case primitive.DateTime:
+		return v.Time().In(n.loc), nil
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).In(n.loc), nil
+	case primitive.M:
+		return n.parseMap(map[string]interface{}(v))
+	case map[string]interface{}:
+		return n.parseMap(v)
+	case primitive.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = e.Value
+		}
+		return n.parseMap(m)
+	case int, int32, int64, float64:
+		return time.Time{}, &ParseError{Value: value, Reason: "bare numbers may be seconds or milliseconds", Err: ErrAmbiguous}
+	default:
+		return time.Time{}, &ParseError{Value: value, Reason: fmt.Sprintf("type %T", value), Err: ErrUnsupported}
+	}
+}
+
+// Month normalizes a value into its YYYY/MM month in the business timezone
+func (n *Normalizer) Month(value interface{}) (string, error) {
+	t, err := n.Time(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(MonthKeyLayout), nil
+}
+
+// MonthStart normalizes a value into the first day of its month in the business timezone.
+// The result is a UTC midnight date suitable for DATE columns.
+func (n *Normalizer) MonthStart(value interface{}) (time.Time, error) {
+	t, err := n.Time(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// Date normalizes a value into its calendar day in the business timezone.
+// The result is a UTC midnight date suitable for DATE columns.
+func (n *Normalizer) Date(value interface{}) (time.Time, error) {
+	t, err := n.Time(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// IsEmpty reports whether a value holds no date at all
+func IsEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case *string:
+		return v == nil || strings.TrimSpace(*v) == ""
+	case time.Time:
+		return v.IsZero()
+	}
+	return false
+}
+
+// ParseMonthKey parses a normalized YYYY/MM (or YYYY-MM) month into the first day of
+// that month at UTC midnight
+func ParseMonthKey(key string) (time.Time, error) {
+	if key == "" {
+		return time.Time{}, &ParseError{Value: key, Err: ErrEmpty}
+	}
+
+	m := monthPattern.FindStringSubmatch(key)
+	if m == nil {
+		return time.Time{}, &ParseError{Value: key, Reason: "want YYYY/MM", Err: ErrUnsupported}
+	}
+
+	return monthStart(key, m[1], m[2], time.UTC)
+}
+
+// parseString parses the string representations of a date
+func (n *Normalizer) parseString(value string) (time.Time, error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return time.Time{}, &ParseError{Value: value, Err: ErrEmpty}
+	}
+
+	// Values with an offset are instants and are moved into the business timezone
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.In(n.loc), nil
+	}
+
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, n.loc); err == nil {
+			return t, nil
+		}
+	}
+
+	if m := monthPattern.FindStringSubmatch(s); m != nil {
+		return monthStart(value, m[1], m[2], n.loc)
+	}
+
+	if yearPattern.MatchString(s) {
+		return time.Time{}, &ParseError{Value: value, Reason: "year without a month", Err: ErrAmbiguous}
+	}
+	if dayMonthPattern.MatchString(s) {
+		return time.Time{}, &ParseError{Value: value, Reason: "day and month order cannot be determined", Err: ErrAmbiguous}
+	}
+
+	return time.Time{}, &ParseError{Value: value, Err: ErrUnsupported}
+}
+
+// parseMap parses a Firestore timestamp map
+func (n *Normalizer) parseMap(m map[string]interface{}) (time.Time, error) {
+	if v, ok := m["timestampValue"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return time.Time{}, &ParseError{Value: m, Reason: "timestampValue is not a string", Err: ErrUnsupported}
+		}
+		return n.parseString(s)
+	}
+
+	secondsValue, ok := firstKey(m, "_seconds", "seconds")
+	if !ok {
+		return time.Time{}, &ParseError{Value: m, Reason: "not a Firestore timestamp", Err: ErrUnsupported}
+	}
+
+	seconds, ok := toInt64(secondsValue)
+	if !ok {
+		return time.Time{}, &ParseError{Value: m, Reason: "seconds is not a number", Err: ErrUnsupported}
+	}
+
+	var nanos int64
+	if nanosValue, ok := firstKey(m, "_nanoseconds", "nanoseconds", "nanos"); ok {
+		if nanos, ok = toInt64(nanosValue); !ok {
+			return time.Time{}, &ParseError{Value: m, Reason: "nanoseconds is not a number", Err: ErrUnsupported}
+		}
+	}
+
+	return time.Unix(seconds, nanos).In(n.loc), nil
+}
+
+// monthStart builds the first day of a month, validating the month number
+func monthStart(value interface{}, yearStr, monthStr string, loc *time.Location) (time.Time, error) {
+	year, _ := strconv.Atoi(yearStr)
+	month, _ := strconv.Atoi(monthStr)
+	if month < 1 || month > 12 {
+		return time.Time{}, &ParseError{Value: value, Reason: "month out of range", Err: ErrUnsupported}
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, loc), nil
+}
+
+// firstKey returns the value of the first key present in the map
+func firstKey(m map[string]interface{}, keys ...string) (interface{}, bool) {
+	for _, key := range keys {
+		if v, ok := m[key]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// toInt64 converts the numeric types produced by the BSON and JSON decoders
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		if n != math.Trunc(n) {
+			return 0, false
+		}
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
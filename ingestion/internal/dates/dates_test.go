@@ -0,0 +1,186 @@
+package dates
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func saoPaulo(t *testing.T) *Normalizer {
+	t.Helper()
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+	return NewNormalizer(loc)
+}
+
+// TestMonth tests normalization of the supported formats to YYYY/MM in the business timezone
+func TestMonth(t *testing.T) {
+	n := saoPaulo(t)
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{name: "YYYYMM format", input: "202312", expected: "2023/12"},
+		{name: "YYYY-MM format", input: "2023-12", expected: "2023/12"},
+		{name: "YYYY/MM format already correct", input: "2023/12", expected: "2023/12"},
+		{name: "YYYYMM format with leading zeros", input: "202301", expected: "2023/01"},
+		{name: "date only", input: "2026-03-01", expected: "2026/03"},
+		{name: "UTC midnight in Sao Paulo", input: "2026-03-01T03:00:00Z", expected: "2026/03"},
+		{name: "UTC instant still in previous local month", input: "2026-03-01T02:59:59Z", expected: "2026/02"},
+		{name: "local offset late in the month", input: "2026-02-28T23:00:00-03:00", expected: "2026/02"},
+		{name: "timestamp without offset is local", input: "2026-02-28T23:00:00", expected: "2026/02"},
+		{name: "firestore _seconds map", input: map[string]interface{}{"_seconds": int64(1772334000), "_nanoseconds": int64(0)}, expected: "2026/03"},
+		{name: "firestore seconds map", input: primitive.M{"seconds": float64(1772333999), "nanos": int32(0)}, expected: "2026/02"},
+		{name: "firestore timestampValue", input: primitive.D{{Key: "timestampValue", Value: "2026-03-01T03:00:00Z"}}, expected: "2026/03"},
+		{name: "BSON date", input: primitive.NewDateTimeFromTime(time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)), expected: "2026/02"},
+		{name: "time value", input: time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC), expected: "2026/03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := n.Month(tt.input)
+			if err != nil {
+				t.Fatalf("Month(%v) unexpected error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("Month(%v) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMonthErrors tests that malformed values return typed errors
+func TestMonthErrors(t *testing.T) {
+	n := saoPaulo(t)
+	var nilString *string
+
+	tests := []struct {
+		name  string
+		input interface{}
+		want  error
+	}{
+		{name: "empty string", input: "", want: ErrEmpty},
+		{name: "nil", input: nil, want: ErrEmpty},
+		{name: "nil string pointer", input: nilString, want: ErrEmpty},
+		{name: "year only", input: "2023", want: ErrAmbiguous},
+		{name: "day and month order", input: "03/04/2026", want: ErrAmbiguous},
+		{name: "bare number", input: int64(1772334000), want: ErrAmbiguous},
+		{name: "month out of range", input: "2023-13", want: ErrUnsupported},
+		{name: "free text", input: "next month", want: ErrUnsupported},
+		{name: "map without seconds", input: map[string]interface{}{"foo": 1}, want: ErrUnsupported},
+		{name: "unknown type", input: true, want: ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := n.Month(tt.input)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Month(%v) error = %v, want %v", tt.input, err, tt.want)
+			}
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("Month(%v) error is not a *ParseError", tt.input)
+			}
+		})
+	}
+}
+
+func TestMonthStartAndDate(t *testing.T) {
+	n := saoPaulo(t)
+
+	start, err := n.MonthStart("2026-03-31T23:30:00-03:00")
+	if err != nil {
+		t.Fatalf("MonthStart() unexpected error: %v", err)
+	}
+	if !start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("MonthStart() = %v, want 2026-03-01 UTC", start)
+	}
+
+	// 02:00 UTC on the 15th is still the 14th in Sao Paulo
+	day, err := n.Date(map[string]interface{}{"seconds": int64(1705284000)})
+	if err != nil {
+		t.Fatalf("Date() unexpected error: %v", err)
+	}
+	if !day.Equal(time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date() = %v, want 2024-01-14 UTC", day)
+	}
+}
+
+func TestNewNormalizerDefaultsToUTC(t *testing.T) {
+	n := NewNormalizer(nil)
+	if n.Location() != time.UTC {
+		t.Errorf("Location() = %v, want UTC", n.Location())
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	empty := ""
+	value := "2024-01"
+
+	tests := []struct {
+		input    interface{}
+		expected bool
+	}{
+		{nil, true},
+		{"", true},
+		{"  ", true},
+		{&empty, true},
+		{time.Time{}, true},
+		{"2024-01", false},
+		{&value, false},
+		{map[string]interface{}{"_seconds": 1}, false},
+	}
+
+	for _, tt := range tests {
+		if result := IsEmpty(tt.input); result != tt.expected {
+			t.Errorf("IsEmpty(%v) = %v, want %v", tt.input, result, tt.expected)
+		}
+	}
+}
+
+// TestParseMonthKey tests parsing of normalized YYYY/MM months
+func TestParseMonthKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+		expectYear  int
+		expectMonth int
+	}{
+		{name: "empty string", input: "", expectError: true},
+		{name: "YYYY/MM format", input: "2023/12", expectYear: 2023, expectMonth: 12},
+		{name: "YYYY-MM format", input: "2023-12", expectYear: 2023, expectMonth: 12},
+		{name: "invalid format", input: "2023", expectError: true},
+		{name: "invalid month", input: "2023/00", expectError: true},
+		{name: "YYYY/MM January", input: "2024/01", expectYear: 2024, expectMonth: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseMonthKey(tt.input)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ParseMonthKey(%q) expected error, got nil", tt.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseMonthKey(%q) unexpected error: %v", tt.input, err)
+			}
+			if result.Year() != tt.expectYear || int(result.Month()) != tt.expectMonth || result.Day() != 1 {
+				t.Errorf("ParseMonthKey(%q) = %v, want %d-%02d-01", tt.input, result, tt.expectYear, tt.expectMonth)
+			}
+			if result.Location() != time.UTC {
+				t.Errorf("ParseMonthKey(%q) location = %v, want UTC", tt.input, result.Location())
+			}
+		})
+	}
+}
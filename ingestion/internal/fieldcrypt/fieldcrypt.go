@@ -0,0 +1,325 @@
+// Package fieldcrypt encrypts PII columns before they are written to MariaDB.
+//
+// Values are envelope-encrypted with AES-256-GCM: each value gets a random data key, the
+// data key is wrapped with a master key from the key file, and the ID of that master key is
+// stored with the value so keys can rotate. Encrypted values look like
+//
+//	enc:v1:<key id>:<base64 wrapped data key>:<base64 ciphertext>
+//
+// Columns that need lookups, such as user.email, also get a blind index: an HMAC-SHA256 of
+// the normalized value that can be compared with equality without decrypting anything.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// prefix marks an encrypted value, so plaintext written before encryption was enabled is
+// still readable
+const prefix = "enc:v1:"
+
+// keySize is the size of master, data and index keys: AES-256
+const keySize = 32
+
+// SupportedColumns are the table.column names the MariaDB repositories encrypt when configured
+var SupportedColumns = []string{
+	"user.email",
+	"user.first_name",
+	"user.last_name",
+	"user_email_conflict.email",
+	"expense_automatic_workflow.description",
+	"expense_automatic_workflow_pre_saved_description.description",
+}
+
+// keyFile is the JSON layout of the key file. Keys are base64-encoded 32 byte keys; the
+// active key encrypts new values, the others only decrypt values written before a rotation.
+type keyFile struct {
+	ActiveKeyID string            `json:"active_key_id"`
+	Keys        map[string]string `json:"keys"`
+	IndexKey    string            `json:"index_key"`
+}
+
+// Cipher encrypts and decrypts the configured columns. A nil *Cipher is valid and leaves
+// every value as plaintext, which is what the repositories use when encryption is disabled.
+type Cipher struct {
+	activeKeyID string
+	keys        map[string][]byte
+	indexKey    []byte
+	columns     map[string]bool
+}
+
+// New creates the Cipher selected by the configuration, or nil when encryption is disabled
+func New(cfg config.EncryptionConfig) (*Cipher, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+	return newCipher(kf, cfg.Columns)
+}
+
+// newCipher validates the keys and columns and creates a Cipher
+func newCipher(kf keyFile, columns []string) (*Cipher, error) {
+	c := &Cipher{
+		activeKeyID: kf.ActiveKeyID,
+		keys:        make(map[string][]byte, len(kf.Keys)),
+		columns:     make(map[string]bool, len(columns)),
+	}
+
+	for id, encoded := range kf.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q: must be non-empty and not contain ':'", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		c.keys[id] = key
+	}
+	if _, ok := c.keys[c.activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the key file", c.activeKeyID)
+	}
+
+	indexKey, err := decodeKey(kf.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index key: %w", err)
+	}
+	c.indexKey = indexKey
+
+	for _, column := range columns {
+		if !isSupported(column) {
+			return nil, fmt.Errorf("unsupported column %q: want one of %s", column, strings.Join(SupportedColumns, ", "))
+		}
+		c.columns[column] = true
+	}
+	return c, nil
+}
+
+// decodeKey decodes a base64 key and checks its size
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("got %d bytes, want %d", len(key), keySize)
+	}
+	return key, nil
+}
+
+// isSupported reports whether a table.column name is in SupportedColumns
+func isSupported(column string) bool {
+	for _, supported := range SupportedColumns {
+		if supported == column {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveKeyID returns the ID of the key new values are encrypted with
+func (c *Cipher) ActiveKeyID() string {
+	if c == nil {
+		return ""
+	}
+	return c.activeKeyID
+}
+
+// KeyIDs returns the IDs of every key in the key file, sorted
+func (c *Cipher) KeyIDs() []string {
+	if c == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(c.keys))
+	for id := range c.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Encrypts reports whether a column is encrypted
+func (c *Cipher) Encrypts(table, column string) bool {
+	return c != nil && c.columns[table+"."+column]
+}
+
+// Encrypt encrypts a value of a column with the active key. Values of columns that are not
+// configured, and empty values, are returned unchanged.
+func (c *Cipher) Encrypt(table, column, plaintext string) (string, error) {
+	if !c.Encrypts(table, column) || plaintext == "" {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := seal(c.keys[c.activeKeyID], dataKey, []byte(c.activeKeyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	sealed, err := seal(dataKey, []byte(plaintext), []byte(table+"."+column))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s.%s: %w", table, column, err)
+	}
+
+	return prefix + c.activeKeyID + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value of a column with the key it was encrypted with. Plaintext values
+// are returned unchanged, so columns can be read while they are being re-encrypted.
+func (c *Cipher) Decrypt(table, column, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", fmt.Errorf("%s.%s is encrypted but field encryption is disabled", table, column)
+	}
+
+	keyID, wrapped, sealed, err := parse(value)
+	if err != nil {
+		return "", fmt.Errorf("%s.%s: %w", table, column, err)
+	}
+	key, ok := c.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%s.%s is encrypted with unknown key %q", table, column, keyID)
+	}
+
+	dataKey, err := open(key, wrapped, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key of %s.%s: %w", table, column, err)
+	}
+	plaintext, err := open(dataKey, sealed, []byte(table+"."+column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s.%s: %w", table, column, err)
+	}
+	return string(plaintext), nil
+}
+
+// Reencrypt returns the value a column should hold under the current configuration: encrypted
+// with the active key when the column is configured, plaintext otherwise. changed is false
+// when the stored value is already right.
+func (c *Cipher) Reencrypt(table, column, value string) (result string, changed bool, err error) {
+	if value == "" {
+		return value, false, nil
+	}
+
+	if c.Encrypts(table, column) {
+		if keyID, _, _, err := parse(value); err == nil && keyID == c.activeKeyID {
+			return value, false, nil
+		}
+	} else if !IsEncrypted(value) {
+		return value, false, nil
+	}
+
+	plaintext, err := c.Decrypt(table, column, value)
+	if err != nil {
+		return "", false, err
+	}
+	result, err = c.Encrypt(table, column, plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return result, true, nil
+}
+
+// BlindIndex returns the blind index of a column value: the hex HMAC-SHA256 of the trimmed,
+// lower-cased value, keyed by the index key and the column name. It returns an empty string
+// for a nil Cipher, which stores no index.
+func (c *Cipher) BlindIndex(table, column, value string) string {
+	if c == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(table + "." + column + "\x00"))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether a stored value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key an encrypted value was encrypted with
+func KeyID(value string) (string, error) {
+	keyID, _, _, err := parse(value)
+	return keyID, err
+}
+
+// parse splits an encrypted value into its key ID, wrapped data key and ciphertext
+func parse(value string) (keyID string, wrapped, sealed []byte, err error) {
+	if !IsEncrypted(value) {
+		return "", nil, nil, fmt.Errorf("value is not encrypted")
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	if wrapped, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed data key: %w", err)
+	}
+	if sealed, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	return parts[0], wrapped, sealed, nil
+}
+
+// seal encrypts plaintext with AES-GCM under key and returns the nonce followed by the ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the output of seal
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// newGCM creates an AES-GCM AEAD for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,195 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/config"
+)
+
+// testKey returns a base64 key made of a repeated byte
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+// testCipher returns a cipher with keys k1 and k2, k2 active, encrypting the user columns
+func testCipher(t *testing.T, active string) *Cipher {
+	t.Helper()
+	c, err := newCipher(keyFile{
+		ActiveKeyID: active,
+		Keys:        map[string]string{"k1": testKey(1), "k2": testKey(2)},
+		IndexKey:    testKey(9),
+	}, []string{"user.email", "user.first_name"})
+	if err != nil {
+		t.Fatalf("newCipher() error = %v", err)
+	}
+	return c
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	c := testCipher(t, "k2")
+
+	encrypted, err := c.Encrypt("user", "email", "ana@example.com")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "ana") {
+		t.Fatalf("Encrypt() = %q, want an encrypted value", encrypted)
+	}
+	if keyID, _ := KeyID(encrypted); keyID != "k2" {
+		t.Errorf("KeyID() = %q, want k2", keyID)
+	}
+
+	again, _ := c.Encrypt("user", "email", "ana@example.com")
+	if again == encrypted {
+		t.Error("Encrypt() must not be deterministic")
+	}
+
+	decrypted, err := c.Decrypt("user", "email", encrypted)
+	if err != nil || decrypted != "ana@example.com" {
+		t.Errorf("Decrypt() = %q, %v, want ana@example.com", decrypted, err)
+	}
+
+	if _, err := c.Decrypt("user", "first_name", encrypted); err == nil {
+		t.Error("Decrypt() must fail for a value moved to another column")
+	}
+}
+
+func TestEncryptPassthrough(t *testing.T) {
+	c := testCipher(t, "k2")
+
+	if got, _ := c.Encrypt("user", "last_name", "Silva"); got != "Silva" {
+		t.Errorf("Encrypt() = %q, want a column that is not configured unchanged", got)
+	}
+	if got, _ := c.Encrypt("user", "email", ""); got != "" {
+		t.Errorf("Encrypt() = %q, want an empty value unchanged", got)
+	}
+
+	var disabled *Cipher
+	if got, _ := disabled.Encrypt("user", "email", "ana@example.com"); got != "ana@example.com" {
+		t.Errorf("nil Encrypt() = %q, want plaintext", got)
+	}
+	if got, _ := disabled.Decrypt("user", "email", "ana@example.com"); got != "ana@example.com" {
+		t.Errorf("nil Decrypt() = %q, want plaintext", got)
+	}
+
+	encrypted, _ := c.Encrypt("user", "email", "ana@example.com")
+	if _, err := disabled.Decrypt("user", "email", encrypted); err == nil {
+		t.Error("nil Decrypt() must fail for an encrypted value")
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	old := testCipher(t, "k1")
+	rotated := testCipher(t, "k2")
+
+	v1, _ := old.Encrypt("user", "email", "ana@example.com")
+
+	v2, changed, err := rotated.Reencrypt("user", "email", v1)
+	if err != nil || !changed {
+		t.Fatalf("Reencrypt() = %q, %v, %v, want a rotated value", v2, changed, err)
+	}
+	if keyID, _ := KeyID(v2); keyID != "k2" {
+		t.Errorf("KeyID() = %q, want k2", keyID)
+	}
+	if plaintext, _ := rotated.Decrypt("user", "email", v2); plaintext != "ana@example.com" {
+		t.Errorf("Decrypt() = %q after rotation", plaintext)
+	}
+
+	if _, changed, _ := rotated.Reencrypt("user", "email", v2); changed {
+		t.Error("Reencrypt() changed a value already under the active key")
+	}
+
+	// Plaintext written before encryption was enabled gets encrypted
+	if v, changed, _ := rotated.Reencrypt("user", "first_name", "Ana"); !changed || !IsEncrypted(v) {
+		t.Errorf("Reencrypt() = %q, %v, want plaintext encrypted", v, changed)
+	}
+
+	// A column removed from the configuration goes back to plaintext
+	if v, changed, _ := rotated.Reencrypt("user", "last_name", mustEncrypt(t, "Silva")); !changed || v != "Silva" {
+		t.Errorf("Reencrypt() = %q, %v, want plaintext for an unconfigured column", v, changed)
+	}
+}
+
+// mustEncrypt encrypts a user.last_name value with a cipher that encrypts it
+func mustEncrypt(t *testing.T, plaintext string) string {
+	t.Helper()
+	c, err := newCipher(keyFile{
+		ActiveKeyID: "k1",
+		Keys:        map[string]string{"k1": testKey(1)},
+		IndexKey:    testKey(9),
+	}, []string{"user.last_name"})
+	if err != nil {
+		t.Fatalf("newCipher() error = %v", err)
+	}
+	v, err := c.Encrypt("user", "last_name", plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	return v
+}
+
+func TestBlindIndex(t *testing.T) {
+	c := testCipher(t, "k2")
+
+	a := c.BlindIndex("user", "email", "Ana@Example.com ")
+	if a != c.BlindIndex("user", "email", "ana@example.com") {
+		t.Error("BlindIndex() must ignore case and surrounding spaces")
+	}
+	if len(a) != 64 {
+		t.Errorf("BlindIndex() = %q, want 64 hex characters", a)
+	}
+	if a == c.BlindIndex("user_email_conflict", "email", "ana@example.com") {
+		t.Error("BlindIndex() must differ between columns")
+	}
+
+	var disabled *Cipher
+	if got := disabled.BlindIndex("user", "email", "ana@example.com"); got != "" {
+		t.Errorf("nil BlindIndex() = %q, want empty", got)
+	}
+}
+
+func TestNewCipherValidation(t *testing.T) {
+	valid := keyFile{ActiveKeyID: "k1", Keys: map[string]string{"k1": testKey(1)}, IndexKey: testKey(9)}
+
+	tests := map[string]struct {
+		kf      keyFile
+		columns []string
+	}{
+		"unknown active key": {keyFile{ActiveKeyID: "k3", Keys: valid.Keys, IndexKey: valid.IndexKey}, nil},
+		"short key":          {keyFile{ActiveKeyID: "k1", Keys: map[string]string{"k1": "c2hvcnQ="}, IndexKey: valid.IndexKey}, nil},
+		"colon in key id":    {keyFile{ActiveKeyID: "k:1", Keys: map[string]string{"k:1": testKey(1)}, IndexKey: valid.IndexKey}, nil},
+		"missing index key":  {keyFile{ActiveKeyID: "k1", Keys: valid.Keys}, nil},
+		"unsupported column": {valid, []string{"expense.name"}},
+	}
+
+	for name, tt := range tests {
+		if _, err := newCipher(tt.kf, tt.columns); err == nil {
+			t.Errorf("%s: newCipher() expected error", name)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if c, err := New(config.EncryptionConfig{}); c != nil || err != nil {
+		t.Errorf("New() = %v, %v, want nil when disabled", c, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"active_key_id": "2024-10", "keys": {"2024-10": "` + testKey(1) + `"}, "index_key": "` + testKey(9) + `"}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(config.EncryptionConfig{Enabled: true, KeyFile: path, Columns: []string{"user.email"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if c.ActiveKeyID() != "2024-10" || !c.Encrypts("user", "email") || c.Encrypts("user", "first_name") {
+		t.Errorf("New() = %+v, want key 2024-10 encrypting user.email only", c)
+	}
+}
@@ -0,0 +1,101 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// SyncedCollections returns the MongoDB collections the service syncs, in ingestion order
+func SyncedCollections() []string {
+	return append([]string{}, collectionOrder...)
+}
+
+// SyncChanges syncs documents reported changed by the MongoDB change stream: the documents
+// listed by new succesfully_ingested_firestore_docs entries, processed like ingestion
+// messages, and the other changed documents of the synced collections, in ingestion order.
+// Failures are recorded in sync_metadata like failed ingestion messages. An error is
+// returned when MariaDB cannot be reached or an ingestion document or a collection fails
+// to sync, so that the changes are kept for a retry, as a failed message is requeued.
+func (s *Service) SyncChanges(ctx context.Context, ingestionDocIDs []string, documents map[string][]mongodb.DocID) error {
+	if err := s.mariaDB.DB().PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach MariaDB: %w", err)
+	}
+
+	var errs []error
+	covered := make(map[string]map[mongodb.DocID]bool)
+	for _, docID := range ingestionDocIDs {
+		doc, err := s.mongoDB.GetSuccessfullyIngestedFirestoreDoc(ctx, docID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch ingestion document %s: %w", docID, err)
+		}
+		if doc == nil {
+			log.Printf("Warning: Skipping ingestion document %s from the change stream: it no longer exists", docID)
+			continue
+		}
+		coverIngestionDoc(covered, doc)
+
+		if err := s.processIngestionDoc(ctx, docID, doc); err != nil {
+			log.Printf("Error processing ingestion document %s from the change stream: %v", docID, err)
+			errs = append(errs, fmt.Errorf("ingestion document %s: %w", docID, err))
+		}
+	}
+
+	documentsCount := 0
+	var syncErr error
+	for _, collectionName := range collectionOrder {
+		ids := uncoveredIDs(documents[collectionName], covered[collectionName])
+		if len(ids) == 0 {
+			continue
+		}
+		documentsCount += len(ids)
+
+		if err := s.SyncCollection(ctx, collectionName, ids); err != nil {
+			log.Printf("Error syncing changed %s: %v", collectionName, err)
+			syncErr = err
+			errs = append(errs, fmt.Errorf("%s: %w", collectionName, err))
+		}
+	}
+
+	if documentsCount > 0 {
+		if syncErr != nil {
+			s.recordSync(models.SyncStatusFailed, documentsCount, syncErr)
+		} else {
+			s.recordSync(models.SyncStatusSuccess, documentsCount, nil)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// coverIngestionDoc adds the document IDs listed by an ingestion document to covered, by
+// collection
+func coverIngestionDoc(covered map[string]map[mongodb.DocID]bool, doc *mongodb.SuccessfullyIngestedFirestoreDocsDocument) {
+	for collectionName, docIDs := range doc.MapCollectionToDocs {
+		ids, _ := mongodb.ParseDocIDs(docIDs)
+		if covered[collectionName] == nil {
+			covered[collectionName] = make(map[mongodb.DocID]bool, len(ids))
+		}
+		for _, id := range ids {
+			covered[collectionName][id] = true
+		}
+	}
+}
+
+// uncoveredIDs returns the IDs not in covered, so that a document listed by an ingestion
+// document of the same batch is not synced twice
+func uncoveredIDs(ids []mongodb.DocID, covered map[mongodb.DocID]bool) []mongodb.DocID {
+	if len(covered) == 0 {
+		return ids
+	}
+	var uncovered []mongodb.DocID
+	for _, id := range ids {
+		if !covered[id] {
+			uncovered = append(uncovered, id)
+		}
+	}
+	return uncovered
+}
@@ -0,0 +1,97 @@
+//go:build integration
+
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/queue/changestream"
+)
+
+// changesHandler passes the batches of a change stream watcher to a service, like main.go
+func changesHandler(s *Service) changestream.BatchHandler {
+	return func(ctx context.Context, batch *changestream.Batch) error {
+		return s.SyncChanges(ctx, batch.IngestionDocs, batch.Documents)
+	}
+}
+
+// TestFailedChangeBatchKeepsResumeToken tests that a batch that fails to sync stops the
+// watcher without saving its resume token, so that its changes are synced after a restart
+func TestFailedChangeBatchKeepsResumeToken(t *testing.T) {
+	svc, mongoDB := newIntegrationService(t)
+	ctx := context.Background()
+
+	// A service whose MongoDB client is disconnected fails to fetch every collection
+	disconnected, err := mongodb.NewConnection(svc.cfg.MongoDB)
+	if err != nil {
+		t.Fatalf("mongodb.NewConnection() returned error: %v", err)
+	}
+	disconnected.Close()
+	broken, err := NewService(svc.mariaDB, disconnected, svc.cfg)
+	if err != nil {
+		t.Fatalf("NewService() returned error: %v", err)
+	}
+
+	triggers := config.TriggersConfig{Mode: config.TriggerChangeStream, ChangeStreamFlushInterval: 200 * time.Millisecond, ChangeStreamMaxBatch: 100}
+	watcher := changestream.NewWatcher(mongoDB, triggers, SyncedCollections(), changesHandler(broken))
+	if err := watcher.Start(ctx); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	defer watcher.Stop()
+
+	// The idle watcher saves its position before the change is made
+	var saved bson.Raw
+	for deadline := time.Now().Add(10 * time.Second); saved == nil; time.Sleep(100 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the watcher did not save a resume token")
+		}
+		if saved, err = mongoDB.GetResumeToken(ctx, changestream.StreamName); err != nil {
+			t.Fatalf("GetResumeToken() returned error: %v", err)
+		}
+	}
+
+	if _, err := mongoDB.Collection("users").InsertOne(ctx, bson.M{"_id": "user-1", "email": "ana@example.com", "name": "Ana"}); err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	select {
+	case <-watcher.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the watcher did not stop after its batch failed")
+	}
+	if watcher.Err() == nil {
+		t.Error("the watcher stopped without an error")
+	}
+	token, err := mongoDB.GetResumeToken(ctx, changestream.StreamName)
+	if err != nil {
+		t.Fatalf("GetResumeToken() returned error: %v", err)
+	}
+	if !bytes.Equal(token, saved) {
+		t.Error("the resume token moved past a batch that failed")
+	}
+
+	restarted := changestream.NewWatcher(mongoDB, triggers, SyncedCollections(), changesHandler(svc))
+	if err := restarted.Start(ctx); err != nil {
+		t.Fatalf("Start() after restart returned error: %v", err)
+	}
+	defer restarted.Stop()
+
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		var users int
+		if err := svc.mariaDB.DB().QueryRow("SELECT COUNT(*) FROM user WHERE source_id = 'user-1'").Scan(&users); err != nil {
+			t.Fatalf("failed to count users: %v", err)
+		}
+		if users == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the change of the failed batch was not synced after a restart")
+		}
+	}
+}
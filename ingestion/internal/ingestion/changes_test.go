@@ -0,0 +1,41 @@
+package ingestion
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/database/mongodb"
+)
+
+func TestSyncedCollections(t *testing.T) {
+	collections := SyncedCollections()
+	if !reflect.DeepEqual(collections, collectionOrder) {
+		t.Errorf("SyncedCollections() = %v, want %v", collections, collectionOrder)
+	}
+	if collections[0] != "users" {
+		t.Errorf("SyncedCollections()[0] = %s, want users first", collections[0])
+	}
+
+	collections[0] = "changed"
+	if collectionOrder[0] != "users" {
+		t.Error("SyncedCollections() must return a copy")
+	}
+}
+
+func TestUncoveredIDs(t *testing.T) {
+	covered := make(map[string]map[mongodb.DocID]bool)
+	coverIngestionDoc(covered, &mongodb.SuccessfullyIngestedFirestoreDocsDocument{
+		MapCollectionToDocs: map[string]interface{}{"expenses": []interface{}{"exp-1", "exp-2"}},
+	})
+
+	ids := mongodb.StringIDs([]string{"exp-1", "exp-3"})
+	if got := uncoveredIDs(ids, covered["expenses"]); !reflect.DeepEqual(got, mongodb.StringIDs([]string{"exp-3"})) {
+		t.Errorf("uncoveredIDs() = %v, want only exp-3", got)
+	}
+	if got := uncoveredIDs(ids, covered["users"]); !reflect.DeepEqual(got, ids) {
+		t.Errorf("uncoveredIDs() without covered IDs = %v, want %v", got, ids)
+	}
+	if got := uncoveredIDs(mongodb.StringIDs([]string{"exp-2"}), covered["expenses"]); len(got) != 0 {
+		t.Errorf("uncoveredIDs() = %v, want none", got)
+	}
+}
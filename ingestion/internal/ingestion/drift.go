@@ -0,0 +1,67 @@
+package ingestion
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/metrics"
+)
+
+// unmappedFields lists, per collection, the document fields the document types decode but
+// no column holds. They are preserved in extra_attributes along with unknown fields.
+var unmappedFields = map[string][]string{
+	"expenses":                   {"created", "updated"},
+	"banks":                      {"created", "observacoes", "updated"},
+	"additional_balances":        {"created"},
+	"balance_history":            {"created"},
+	"expense_automatic_workflow": {"created"},
+	"expense_automatic_workflow_pre_saved_description": {"created"},
+}
+
+// driftOptions sets the schema drift options of a fetch. Unmapped and unknown fields are only
+// preserved for collections synced into a table with an extra_attributes column, which users
+// are not.
+func (s *Service) driftOptions(collectionName string, opts mongodb.FetchOptions) mongodb.FetchOptions {
+	opts.UnmappedFields = unmappedFields[collectionName]
+	opts.PreserveExtra = s.cfg.Drift.PreserveExtraAttributes && opts.Projection == nil && mariadb.HasExtraAttributes(collectionTables[collectionName])
+	return opts
+}
+
+// recordSchemaDrift counts and reports the unknown fields seen while fetching a collection
+func (s *Service) recordSchemaDrift(ctx context.Context, collectionName string, fields map[string]mongodb.FieldDrift) {
+	if len(fields) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	for _, field := range names {
+		drift := fields[field]
+		metrics.AddSchemaDrift(collectionName, field, drift.Documents)
+		log.Printf("Warning: Schema drift: %d %s documents have the unknown field %s (%s), e.g. %s",
+			drift.Documents, collectionName, field, drift.BSONType, drift.SampleID)
+	}
+
+	if err := s.mongoDB.RecordSchemaDrift(ctx, collectionName, fields); err != nil {
+		log.Printf("Error recording schema drift of %s: %v", collectionName, err)
+	}
+}
+
+// saveExtraAttributes stores the extra attributes of the synced documents of a batch on
+// their rows, clearing them on rows whose document no longer has any
+func (s *Service) saveExtraAttributes(collectionName string, synced *syncedDocs) {
+	repo := mariadb.NewExtraAttributesRepository(s.mariaDB)
+	table := collectionTables[collectionName]
+	for _, mark := range synced.marks {
+		id := mark.ID.String()
+		if err := repo.SetExtraAttributes(table, id, synced.fetched[id].ExtraAttributes); err != nil {
+			log.Printf("Error saving extra attributes of %s %s: %v", collectionName, id, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ingestion
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+)
+
+// collectionDocuments maps the collections with unmapped fields to their document types
+var collectionDocuments = map[string]interface{}{
+	"expenses":                   mongodb.ExpenseDocument{},
+	"banks":                      mongodb.FinancialInstitutionDocument{},
+	"additional_balances":        mongodb.AdditionalBalanceDocument{},
+	"balance_history":            mongodb.BalanceHistoryDocument{},
+	"expense_automatic_workflow": mongodb.ExpenseAutomaticWorkflowDocument{},
+	"expense_automatic_workflow_pre_saved_description": mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument{},
+}
+
+func TestUnmappedFieldsAreDecoded(t *testing.T) {
+	for collection, fields := range unmappedFields {
+		if collectionTables[collection] == "" {
+			t.Errorf("%s has unmapped fields but no table", collection)
+		}
+
+		doc, ok := collectionDocuments[collection]
+		if !ok {
+			t.Errorf("%s has no document type in the test", collection)
+			continue
+		}
+		tags := make(map[string]bool)
+		typ := reflect.TypeOf(doc)
+		for i := 0; i < typ.NumField(); i++ {
+			tags[strings.Split(typ.Field(i).Tag.Get("bson"), ",")[0]] = true
+		}
+		for _, field := range fields {
+			if !tags[field] {
+				t.Errorf("%s unmapped field %s is not decoded by %s", collection, field, typ.Name())
+			}
+		}
+	}
+}
+
+func TestDriftOptions(t *testing.T) {
+	svc := &Service{cfg: &config.Config{Drift: config.DriftConfig{PreserveExtraAttributes: true}}}
+
+	opts := svc.driftOptions("banks", mongodb.FetchOptions{BatchSize: 10})
+	if !opts.PreserveExtra || opts.BatchSize != 10 {
+		t.Errorf("driftOptions(banks) = %+v, want PreserveExtra and BatchSize kept", opts)
+	}
+	if !reflect.DeepEqual(opts.UnmappedFields, unmappedFields["banks"]) {
+		t.Errorf("driftOptions(banks).UnmappedFields = %v, want %v", opts.UnmappedFields, unmappedFields["banks"])
+	}
+
+	if opts := svc.driftOptions("users", mongodb.FetchOptions{}); opts.PreserveExtra {
+		t.Error("driftOptions(users).PreserveExtra = true, want false since user fields may be personal data")
+	}
+	if opts := svc.driftOptions("settings", mongodb.FetchOptions{}); opts.PreserveExtra {
+		t.Error("driftOptions(settings).PreserveExtra = true, want false for a collection without a table")
+	}
+	if opts := svc.driftOptions("banks", mongodb.FetchOptions{Projection: bson.M{"_id": 1}}); opts.PreserveExtra {
+		t.Error("driftOptions() with a projection: PreserveExtra = true, want false")
+	}
+
+	svc.cfg.Drift.PreserveExtraAttributes = false
+	if opts := svc.driftOptions("banks", mongodb.FetchOptions{}); opts.PreserveExtra {
+		t.Error("driftOptions() with preservation disabled: PreserveExtra = true, want false")
+	}
+}
@@ -0,0 +1,207 @@
+package ingestion
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// errNoSigningKey is returned when an erasure is requested without a receipt signing key
+var errNoSigningKey = errors.New("ERASURE_RECEIPT_SIGNING_KEY is required to sign erasure receipts")
+
+// erasurePayload returns the bytes an erasure receipt signature covers: the JSON of every
+// field except the ID and the signature, with times in UTC and empty counts as {}
+func erasurePayload(e *models.UserErasure) ([]byte, error) {
+	normalized := *e
+	normalized.RequestedAt = e.RequestedAt.UTC()
+	normalized.CompletedAt = e.CompletedAt.UTC()
+	if normalized.MariaDBRows == nil {
+		normalized.MariaDBRows = map[string]int64{}
+	}
+	if normalized.MongoDBDocuments == nil {
+		normalized.MongoDBDocuments = map[string]int64{}
+	}
+	return json.Marshal(normalized)
+}
+
+// SignErasure returns the hex HMAC-SHA256 signature of an erasure receipt
+func SignErasure(key string, e *models.UserErasure) (string, error) {
+	if key == "" {
+		return "", errNoSigningKey
+	}
+	payload, err := erasurePayload(e)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode erasure receipt: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyErasure reports whether an erasure receipt still matches its signature
+func VerifyErasure(key string, e *models.UserErasure) (bool, error) {
+	expected, err := SignErasure(key, e)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal([]byte(expected), []byte(e.Signature)), nil
+}
+
+// EraseUser erases a user for a data-subject request, keyed by its Firestore user ID. The
+// user is tombstoned first, so documents of the user synced meanwhile are skipped, then its
+// MongoDB documents are deleted, its MariaDB rows deleted or anonymized and the receipt
+// images no other workflow uses deleted from the blob store. The signed receipt is stored in
+// user_erasure and returned; it is marked partial, with the reason, when data was left
+// behind. Erasing a user again is safe and yields a new receipt.
+func (s *Service) EraseUser(ctx context.Context, userSourceID, requestedBy string) (*models.UserErasure, error) {
+	if userSourceID == "" {
+		return nil, fmt.Errorf("missing user ID")
+	}
+	key := s.cfg.Erasure.ReceiptSigningKey
+	if key == "" {
+		return nil, errNoSigningKey
+	}
+
+	// MariaDB stores timestamps to the second, the receipt must verify after a round trip
+	receipt := &models.UserErasure{
+		GUID:         uuid.New().String(),
+		UserSourceID: userSourceID,
+		RequestedBy:  requestedBy,
+		RequestedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := s.mongoDB.TombstoneUser(ctx, userSourceID, receipt.GUID, receipt.RequestedAt); err != nil {
+		return nil, err
+	}
+
+	documents, err := s.mongoDB.EraseUserDocuments(ctx, userSourceID)
+	if err != nil {
+		return nil, err
+	}
+	receipt.MongoDBDocuments = documents
+
+	var userID int64
+	var leftBehind []string
+	user, err := mariadb.NewUserRepository(s.mariaDB).GetUserBySourceID(userSourceID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case user == nil:
+	case user.SourceID != userSourceID:
+		// The ID was merged into another user by the email conflict policy; its rows now
+		// belong to that user, which needs its own erasure request
+		log.Printf("Warning: user %s was merged into user %s, erase that user to remove its rows", userSourceID, user.SourceID)
+		leftBehind = append(leftBehind, fmt.Sprintf("the user was merged into user %s, whose rows were not erased", user.SourceID))
+	default:
+		userID = user.ID
+	}
+
+	// The image keys are read before the cascade removes the workflows that hold them
+	workflowRepo := mariadb.NewExpenseAutomaticWorkflowRepository(s.mariaDB)
+	var imageKeys []string
+	if userID != 0 {
+		if imageKeys, err = workflowRepo.GetImageKeysByUser(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := mariadb.NewUserErasureRepository(s.mariaDB).EraseUser(userID, userSourceID)
+	if err != nil {
+		return nil, err
+	}
+	receipt.MariaDBRows = rows
+
+	deleted, failed := s.deleteUnreferencedImages(ctx, workflowRepo, imageKeys)
+	receipt.BlobsDeleted = deleted
+	if failed > 0 {
+		leftBehind = append(leftBehind, fmt.Sprintf("%d receipt images could not be deleted from the blob store", failed))
+	}
+
+	receipt.Status = models.ErasureStatusCompleted
+	if len(leftBehind) > 0 {
+		receipt.Status = models.ErasureStatusPartial
+		receipt.StatusReason = strings.Join(leftBehind, "; ")
+	}
+	receipt.CompletedAt = time.Now().UTC().Truncate(time.Second)
+
+	if receipt.Signature, err = SignErasure(key, receipt); err != nil {
+		return nil, err
+	}
+	if err := mariadb.NewUserErasureRepository(s.mariaDB).RecordReceipt(receipt); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Erased user %s (%s): %d MariaDB rows, %d MongoDB documents, %d blobs, receipt %s",
+		userSourceID, receipt.Status, total(rows), total(documents), deleted, receipt.GUID)
+	return receipt, nil
+}
+
+// deleteUnreferencedImages deletes the receipt images no remaining workflow references from
+// the blob store. The same image may be shared with another user's workflow, which keeps it.
+// It returns how many blobs were deleted and how many could not be.
+func (s *Service) deleteUnreferencedImages(ctx context.Context, repo *mariadb.ExpenseAutomaticWorkflowRepository, keys []string) (deleted int64, failed int) {
+	for _, key := range keys {
+		referenced, err := repo.IsImageReferenced(key)
+		if err != nil {
+			log.Printf("Error checking references of receipt image %s: %v", key, err)
+			failed++
+			continue
+		}
+		if referenced {
+			continue
+		}
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting receipt image %s: %v", key, err)
+			failed++
+			continue
+		}
+		deleted++
+	}
+	return deleted, failed
+}
+
+// total sums erased rows or documents over every table or collection
+func total(counts map[string]int64) int64 {
+	var sum int64
+	for _, n := range counts {
+		sum += n
+	}
+	return sum
+}
+
+// dropErasedUsers removes the user documents of erased users, which must never be synced again
+func (s *Service) dropErasedUsers(ctx context.Context, users []mongodb.UserDocument) ([]mongodb.UserDocument, error) {
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+
+	erased, err := s.mongoDB.GetErasedUserIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := users[:0]
+	for _, u := range users {
+		if erased[u.ID] {
+			log.Printf("Skipping user %s: the user was erased", u.ID)
+			continue
+		}
+		kept = append(kept, u)
+	}
+	return kept, nil
+}
@@ -0,0 +1,88 @@
+package ingestion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// testErasure returns a receipt as EraseUser builds it
+func testErasure() *models.UserErasure {
+	return &models.UserErasure{
+		GUID:             "0b6f2c4e-7a1d-4c2b-9f3e-5d8a1b2c3d4e",
+		UserSourceID:     "user-1",
+		RequestedBy:      "cli",
+		RequestedAt:      time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		CompletedAt:      time.Date(2024, 3, 10, 12, 0, 2, 0, time.UTC),
+		Status:           models.ErasureStatusCompleted,
+		MariaDBRows:      map[string]int64{"user": 1, "expense": 12},
+		MongoDBDocuments: map[string]int64{"users": 1, "expenses": 12},
+		BlobsDeleted:     2,
+	}
+}
+
+func TestSignErasure(t *testing.T) {
+	receipt := testErasure()
+	signature, err := SignErasure("secret", receipt)
+	if err != nil {
+		t.Fatalf("SignErasure() error = %v", err)
+	}
+	if len(signature) != 64 {
+		t.Errorf("SignErasure() = %q, want 64 hex characters", signature)
+	}
+	receipt.Signature = signature
+
+	if valid, err := VerifyErasure("secret", receipt); err != nil || !valid {
+		t.Errorf("VerifyErasure() = %v, %v, want valid", valid, err)
+	}
+	if valid, _ := VerifyErasure("other secret", receipt); valid {
+		t.Error("VerifyErasure() must fail with another key")
+	}
+
+	receipt.MariaDBRows["expense"] = 11
+	if valid, _ := VerifyErasure("secret", receipt); valid {
+		t.Error("VerifyErasure() must fail for an altered receipt")
+	}
+	receipt.MariaDBRows["expense"] = 12
+
+	// A partial erasure cannot be passed off as a completed one
+	partial := testErasure()
+	partial.Status = models.ErasureStatusPartial
+	partial.StatusReason = "the user was merged into user user-2, whose rows were not erased"
+	partial.Signature, _ = SignErasure("secret", partial)
+	partial.Status = models.ErasureStatusCompleted
+	partial.StatusReason = ""
+	if valid, _ := VerifyErasure("secret", partial); valid {
+		t.Error("VerifyErasure() must fail when the status is altered")
+	}
+
+	if _, err := SignErasure("", receipt); err == nil {
+		t.Error("SignErasure() expected error without a key")
+	}
+}
+
+func TestSignErasureRoundTrip(t *testing.T) {
+	receipt := testErasure()
+	receipt.MariaDBRows = nil
+	receipt.Signature, _ = SignErasure("secret", receipt)
+
+	// As read back from MariaDB: empty counts decode to {} and times may carry another location
+	stored := *receipt
+	stored.MariaDBRows = map[string]int64{}
+	stored.RequestedAt = receipt.RequestedAt.In(time.FixedZone("BRT", -3*3600))
+	stored.ID = 42
+
+	if valid, err := VerifyErasure("secret", &stored); err != nil || !valid {
+		t.Errorf("VerifyErasure() = %v, %v, want the stored receipt valid", valid, err)
+	}
+}
+
+func TestTotal(t *testing.T) {
+	if got := total(map[string]int64{"user": 1, "expense": 12}); got != 13 {
+		t.Errorf("total() = %d, want 13", got)
+	}
+	if got := total(nil); got != 0 {
+		t.Errorf("total(nil) = %d, want 0", got)
+	}
+}
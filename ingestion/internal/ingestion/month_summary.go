@@ -0,0 +1,62 @@
+package ingestion
+
+import (
+	"log"
+	"sort"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// userMonths is the set of user months touched by a sync, whose summaries must be refreshed
+type userMonths map[models.UserMonth]struct{}
+
+// add adds a user month, ignoring the empty month of aggregate expenses
+func (m userMonths) add(userID int64, month string) {
+	if month == "" {
+		return
+	}
+	m[models.UserMonth{UserID: userID, SpendingDateYYYYMM: month}] = struct{}{}
+}
+
+// addExisting adds the month a record was stored under before the sync, so a record that
+// moves to another month also refreshes the month it left
+func (m userMonths) addExisting(um *models.UserMonth) {
+	if um != nil {
+		m.add(um.UserID, um.SpendingDateYYYYMM)
+	}
+}
+
+// sorted returns the user months ordered by user and month
+func (m userMonths) sorted() []models.UserMonth {
+	result := make([]models.UserMonth, 0, len(m))
+	for um := range m {
+		result = append(result, um)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UserID != result[j].UserID {
+			return result[i].UserID < result[j].UserID
+		}
+		return result[i].SpendingDateYYYYMM < result[j].SpendingDateYYYYMM
+	})
+	return result
+}
+
+// refreshMonthSummaries refreshes user_month_summary for the touched user months only.
+// Failures are logged, the summaries are derived data that a rebuild can always restore.
+func (s *Service) refreshMonthSummaries(months userMonths) {
+	if len(months) == 0 {
+		return
+	}
+
+	repo := mariadb.NewUserMonthSummaryRepository(s.mariaDB)
+	refreshed := 0
+	for _, um := range months.sorted() {
+		if err := repo.RefreshSummary(um.UserID, um.SpendingDateYYYYMM); err != nil {
+			log.Printf("Warning: failed to refresh month summary of user %d for %s: %v", um.UserID, um.SpendingDateYYYYMM, err)
+			continue
+		}
+		refreshed++
+	}
+	log.Printf("Refreshed %d of %d user month summaries", refreshed, len(months))
+}
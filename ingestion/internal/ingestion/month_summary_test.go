@@ -0,0 +1,29 @@
+package ingestion
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+func TestUserMonths(t *testing.T) {
+	months := userMonths{}
+	months.add(2, "2024/03")
+	months.add(1, "2024/04")
+	months.add(1, "2024/03")
+	months.add(1, "2024/03")
+	months.add(1, "")
+	months.addExisting(&models.UserMonth{UserID: 2, SpendingDateYYYYMM: "2024/02"})
+	months.addExisting(nil)
+
+	want := []models.UserMonth{
+		{UserID: 1, SpendingDateYYYYMM: "2024/03"},
+		{UserID: 1, SpendingDateYYYYMM: "2024/04"},
+		{UserID: 2, SpendingDateYYYYMM: "2024/02"},
+		{UserID: 2, SpendingDateYYYYMM: "2024/03"},
+	}
+	if got := months.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,250 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/dates"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// collectionTables maps each collection synced per user to the MariaDB table it is synced into
+var collectionTables = map[string]string{
+	"users":                      "user",
+	"banks":                      "financial_institution",
+	"expenses":                   "expense",
+	"additional_balances":        "additional_balance",
+	"balance_history":            "balance_history",
+	"expense_automatic_workflow": "expense_automatic_workflow",
+	"expense_automatic_workflow_pre_saved_description": "expense_automatic_workflow_pre_saved_description",
+	"payments": "service_payment",
+}
+
+// ResyncReport describes a resync of every document of one user
+type ResyncReport struct {
+	UserID      string
+	DryRun      bool
+	Collections []ResyncCollection
+}
+
+// ResyncCollection describes the resync of the documents of a user in one collection. A dry
+// run only fills Documents, Existing and Orphans.
+type ResyncCollection struct {
+	Collection string
+	Table      string
+	Documents  int
+	// Existing counts documents that already had a row before the resync
+	Existing int
+	mariadb.SnapshotDiff
+	// Orphans are the source IDs of rows of the user whose document is gone from MongoDB.
+	// A resync leaves them in place.
+	Orphans []string
+	Error   string
+}
+
+// Changed reports whether the resync created or updated any row
+func (r *ResyncReport) Changed() bool {
+	for _, c := range r.Collections {
+		if c.Created > 0 || c.Updated > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ResyncUser pulls every MongoDB document of a user, keyed by its Firestore user ID, and
+// runs them through the syncers in ingestion order. The report compares the user's rows
+// before and after. With dryRun nothing is synced and the report tells which documents
+// already have a row. A failing collection does not stop the others; the report is
+// returned with the error.
+func (s *Service) ResyncUser(ctx context.Context, userSourceID string, dryRun bool) (*ResyncReport, error) {
+	if userSourceID == "" {
+		return nil, fmt.Errorf("missing user ID")
+	}
+
+	erased, err := s.mongoDB.GetErasedUserIDs(ctx, []string{userSourceID})
+	if err != nil {
+		return nil, err
+	}
+	if erased[userSourceID] {
+		return nil, fmt.Errorf("user %s was erased", userSourceID)
+	}
+
+	docIDs, err := s.mongoDB.GetUserDocumentIDs(ctx, userSourceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(docIDs) == 0 {
+		return nil, fmt.Errorf("no documents found for user %s", userSourceID)
+	}
+
+	var aggregates [][]string
+	if _, ok := docIDs["expenses"]; ok {
+		expenses, err := s.mongoDB.GetUserInstallmentExpenses(ctx, userSourceID)
+		if err != nil {
+			return nil, err
+		}
+		aggregates = expenseAggregates(expenses, s.dates.Month)
+	}
+
+	before, err := s.userSnapshot(userSourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ResyncReport{UserID: userSourceID, DryRun: dryRun}
+	var collectionErrors []string
+	documentsCount := 0
+	rowIDs := make(map[string][]string)
+
+	for _, collectionName := range collectionOrder {
+		ids, ok := docIDs[collectionName]
+		if !ok {
+			continue
+		}
+		table := collectionTables[collectionName]
+		sourceIDs := mongodb.DocIDStrings(ids)
+		if collectionName == "expenses" {
+			sourceIDs = aggregateRowIDs(sourceIDs, aggregates, table, before)
+		}
+		rowIDs[collectionName] = sourceIDs
+		result := ResyncCollection{
+			Collection: collectionName,
+			Table:      table,
+			Documents:  len(ids),
+			Existing:   before.Existing(table, sourceIDs),
+			Orphans:    before.Orphans(table, sourceIDs),
+		}
+		documentsCount += len(ids)
+
+		if !dryRun {
+			log.Printf("Resyncing %d documents of user %s from collection: %s", len(ids), userSourceID, collectionName)
+			if err := s.SyncCollection(ctx, collectionName, ids); err != nil {
+				log.Printf("Error resyncing %s of user %s: %v", collectionName, userSourceID, err)
+				result.Error = err.Error()
+				collectionErrors = append(collectionErrors, fmt.Sprintf("%s: %v", collectionName, err))
+			}
+		}
+		report.Collections = append(report.Collections, result)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	after, err := s.userSnapshot(userSourceID)
+	if err != nil {
+		return report, err
+	}
+	for i := range report.Collections {
+		c := &report.Collections[i]
+		sourceIDs := rowIDs[c.Collection]
+		if c.Collection == "expenses" {
+			// A resync may create the row of an aggregate under another member
+			sourceIDs = aggregateRowIDs(mongodb.DocIDStrings(docIDs[c.Collection]), aggregates, c.Table, after, before)
+		}
+		c.SnapshotDiff = before.Diff(after, c.Table, sourceIDs)
+	}
+
+	if len(collectionErrors) > 0 {
+		syncErr := fmt.Errorf("failed to resync %d collection(s): %s", len(collectionErrors), strings.Join(collectionErrors, "; "))
+		s.recordSync(models.SyncStatusFailed, documentsCount, syncErr)
+		return report, syncErr
+	}
+	s.recordSync(models.SyncStatusSuccess, documentsCount, nil)
+
+	log.Printf("Resynced user %s: %d documents", userSourceID, documentsCount)
+	return report, nil
+}
+
+// expenseAggregates groups the IDs of the expenses synced into one expense row with
+// installments: invoices and savings with the same name and validity month. Expenses
+// without a validity have a row each and are left out, as are aggregates of one expense.
+func expenseAggregates(expenses []mongodb.ExpenseDocument, month func(interface{}) (string, error)) [][]string {
+	index := make(map[string]int)
+	var groups [][]string
+	for _, e := range expenses {
+		if (e.Type != "invoice" && e.Type != "savings") || dates.IsEmpty(e.Validity) {
+			continue
+		}
+		validity, err := month(e.Validity)
+		if err != nil {
+			continue
+		}
+		key := e.ExpenseName + "\x00" + validity
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], e.ID)
+	}
+
+	aggregates := groups[:0]
+	for _, group := range groups {
+		if len(group) > 1 {
+			aggregates = append(aggregates, group)
+		}
+	}
+	return aggregates
+}
+
+// aggregateRowIDs returns the source IDs the rows of a table are kept under for the given
+// document IDs. The members of an aggregate share one row, whose source_id is the member
+// that created it, so each aggregate is counted once: under the member with a row in the
+// first snapshot that has one, or under its first member when there is no row yet.
+func aggregateRowIDs(sourceIDs []string, aggregates [][]string, table string, snapshots ...mariadb.UserSnapshot) []string {
+	memberOf := make(map[string]int)
+	for i, group := range aggregates {
+		for _, id := range group {
+			memberOf[id] = i
+		}
+	}
+
+	counted := make(map[int]bool)
+	rowIDs := make([]string, 0, len(sourceIDs))
+	for _, id := range sourceIDs {
+		i, ok := memberOf[id]
+		if !ok {
+			rowIDs = append(rowIDs, id)
+			continue
+		}
+		if counted[i] {
+			continue
+		}
+		counted[i] = true
+		rowIDs = append(rowIDs, aggregateRowID(aggregates[i], table, snapshots))
+	}
+	return rowIDs
+}
+
+// aggregateRowID returns the member of an aggregate holding its row
+func aggregateRowID(members []string, table string, snapshots []mariadb.UserSnapshot) string {
+	for _, snapshot := range snapshots {
+		for _, id := range members {
+			if _, ok := snapshot[table][id]; ok {
+				return id
+			}
+		}
+	}
+	return members[0]
+}
+
+// userSnapshot fingerprints the rows of a user, an empty snapshot when the user is not in
+// MariaDB
+func (s *Service) userSnapshot(userSourceID string) (mariadb.UserSnapshot, error) {
+	user, err := mariadb.NewUserRepository(s.mariaDB).GetUserBySourceID(userSourceID)
+	if err != nil {
+		return nil, err
+	}
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	return mariadb.NewUserSnapshotRepository(s.mariaDB).Snapshot(userID)
+}
@@ -0,0 +1,91 @@
+package ingestion
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/dates"
+)
+
+func TestCollectionTables(t *testing.T) {
+	// Every collection synced per user is resynced, settings are not per user
+	for _, collection := range collectionOrder {
+		if _, ok := collectionTables[collection]; !ok && collection != "settings" {
+			t.Errorf("collection %s has no table", collection)
+		}
+	}
+	if len(collectionTables) != len(collectionOrder)-1 {
+		t.Errorf("collectionTables has %d collections, want %d", len(collectionTables), len(collectionOrder)-1)
+	}
+}
+
+func TestResyncReportChanged(t *testing.T) {
+	report := &ResyncReport{Collections: []ResyncCollection{
+		{Collection: "users", SnapshotDiff: mariadb.SnapshotDiff{Unchanged: 1}},
+		{Collection: "expenses", SnapshotDiff: mariadb.SnapshotDiff{Missing: 2}},
+	}}
+	if report.Changed() {
+		t.Error("Changed() = true, want false without created or updated rows")
+	}
+
+	report.Collections[1].Updated = 1
+	if !report.Changed() {
+		t.Error("Changed() = false, want true with an updated row")
+	}
+}
+
+func TestExpenseAggregates(t *testing.T) {
+	month := dates.NewNormalizer(time.UTC).Month
+	expenses := []mongodb.ExpenseDocument{
+		{ID: "inv-1", Type: "invoice", ExpenseName: "Car", Validity: "2026-12"},
+		{ID: "exp-1", Type: "expense", ExpenseName: "Car", Validity: "2026-12"},
+		{ID: "inv-2", Type: "invoice", ExpenseName: "Car", Validity: "2026-12"},
+		{ID: "sav-1", Type: "savings", ExpenseName: "Trip"},
+		{ID: "sav-2", Type: "savings", ExpenseName: "Trip"},
+		{ID: "inv-3", Type: "invoice", ExpenseName: "Car", Validity: "2027-01"},
+		{ID: "inv-4", Type: "invoice", ExpenseName: "Car", Validity: "2026-12"},
+	}
+
+	got := expenseAggregates(expenses, month)
+	want := [][]string{{"inv-1", "inv-2", "inv-4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expenseAggregates() = %v, want %v", got, want)
+	}
+}
+
+func TestAggregateRowIDs(t *testing.T) {
+	aggregates := [][]string{{"inv-1", "inv-2", "inv-3"}}
+	ids := []string{"exp-1", "inv-1", "inv-2", "inv-3"}
+
+	// Before the resync the aggregate's row is held by its second member
+	before := mariadb.UserSnapshot{"expense": {"exp-1": "a", "inv-2": "b"}}
+	after := mariadb.UserSnapshot{"expense": {"exp-1": "a", "inv-2": "c"}}
+
+	rowIDs := aggregateRowIDs(ids, aggregates, "expense", before)
+	if want := []string{"exp-1", "inv-2"}; !reflect.DeepEqual(rowIDs, want) {
+		t.Fatalf("aggregateRowIDs() = %v, want %v", rowIDs, want)
+	}
+	if n := before.Existing("expense", rowIDs); n != 2 {
+		t.Errorf("Existing() = %d, want 2", n)
+	}
+	if orphans := before.Orphans("expense", rowIDs); len(orphans) != 0 {
+		t.Errorf("Orphans() = %v, want none", orphans)
+	}
+	diff := before.Diff(after, "expense", aggregateRowIDs(ids, aggregates, "expense", after, before))
+	if want := (mariadb.SnapshotDiff{Updated: 1, Unchanged: 1}); diff != want {
+		t.Errorf("Diff() = %+v, want %+v without missing aggregate members", diff, want)
+	}
+
+	// An aggregate without a row yet is counted once, under its first member
+	created := mariadb.UserSnapshot{"expense": {"exp-1": "a", "inv-3": "d"}}
+	diff = before.Diff(created, "expense", aggregateRowIDs([]string{"inv-3", "inv-1"}, aggregates, "expense", created, mariadb.UserSnapshot{}))
+	if want := (mariadb.SnapshotDiff{Created: 1}); diff != want {
+		t.Errorf("Diff() of a new aggregate = %+v, want %+v", diff, want)
+	}
+	if got := aggregateRowIDs([]string{"inv-2", "inv-1"}, aggregates, "expense"); !reflect.DeepEqual(got, []string{"inv-1"}) {
+		t.Errorf("aggregateRowIDs() without a row = %v, want [inv-1]", got)
+	}
+}
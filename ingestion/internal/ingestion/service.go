@@ -4,19 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
 	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
-
+	"github.com/porcool/ingestion/internal/balance"
+	"github.com/porcool/ingestion/internal/blobstore"
 	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/currency"
 	"github.com/porcool/ingestion/internal/database/mariadb"
 	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/dates"
 	"github.com/porcool/ingestion/internal/firestore"
+	"github.com/porcool/ingestion/internal/logging"
 	"github.com/porcool/ingestion/internal/models"
+	"github.com/porcool/ingestion/internal/validation"
 )
 
 const serviceName = "porcool-ingestion-non-relational-database-to-relational-database"
@@ -27,16 +32,37 @@ type Service struct {
 	mongoDB         *mongodb.Connection
 	cfg             *config.Config
 	firestoreClient *firestore.Client
+	converter       *currency.Converter
+	dates           *dates.Normalizer
+	validator       *validation.Validator
+	domains         *mariadb.DomainRegistry
+	blobs           blobstore.Store
 }
 
 // NewService creates a new ingestion service
-func NewService(mariaDB *mariadb.Connection, mongoDB *mongodb.Connection, cfg *config.Config) *Service {
+func NewService(mariaDB *mariadb.Connection, mongoDB *mongodb.Connection, cfg *config.Config) (*Service, error) {
 	svc := &Service{
 		mariaDB: mariaDB,
 		mongoDB: mongoDB,
 		cfg:     cfg,
 	}
 
+	svc.converter = currency.NewConverter(cfg.Currency.BaseCurrency, mariadb.NewExchangeRateRepository(mariaDB))
+
+	loc, err := time.LoadLocation(cfg.Dates.BusinessTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid business timezone %q: %w", cfg.Dates.BusinessTimezone, err)
+	}
+	svc.dates = dates.NewNormalizer(loc)
+	svc.validator = validation.NewValidator(svc.dates)
+	svc.domains = mariadb.NewDomainRegistry(mariaDB, cfg.Domains, serviceName)
+
+	blobs, err := blobstore.New(cfg.BlobStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize blob store: %w", err)
+	}
+	svc.blobs = blobs
+
 	// Initialize Firestore client if enabled
 	if cfg.Firebase.Enabled {
 		client, err := firestore.NewClient(cfg.Firebase.ServiceAccountPath)
@@ -48,56 +74,64 @@ func NewService(mariaDB *mariadb.Connection, mongoDB *mongodb.Connection, cfg *c
 		}
 	}
 
-	return svc
+	return svc, nil
 }
 
-// formatSpendingDate converts a spending date to the YYYY/MM format for MariaDB
-// Input formats supported: "YYYY-MM", "YYYY/MM", "YYYYMM"
-func formatSpendingDate(date string) string {
-	if date == "" {
-		return ""
+// Start preloads the domain registry and keeps it refreshed until the context is done
+func (s *Service) Start(ctx context.Context) error {
+	if err := s.domains.Refresh(); err != nil {
+		return fmt.Errorf("failed to preload domains: %w", err)
 	}
+	s.domains.StartAutoRefresh(ctx, s.cfg.Domains.RefreshInterval)
 
-	// Remove any dashes or slashes and normalize
-	normalized := strings.ReplaceAll(date, "-", "")
-	normalized = strings.ReplaceAll(normalized, "/", "")
-
-	// If it's already in YYYYMM format (6 chars), convert to YYYY/MM
-	if len(normalized) == 6 {
-		return normalized[:4] + "/" + normalized[4:]
-	}
+	log.Printf("Domain registry loaded (unknown value policy: %s)", s.domains.Policy())
+	return nil
+}
 
-	// If the date is in YYYY-MM or YYYY/MM format, extract and reformat
-	if len(date) >= 7 {
-		year := date[:4]
-		month := date[5:7]
-		return year + "/" + month
-	}
+// rejectedError marks a document rejected during transformation, so that it is quarantined
+// like a document that failed validation
+type rejectedError struct {
+	violation validation.Violation
+}
 
-	// Return as-is if we can't parse it
-	return date
+// Error implements the error interface
+func (e *rejectedError) Error() string {
+	return e.violation.String()
 }
 
-// parseSpendingDateToTime parses a spending date string (YYYY/MM or YYYY-MM) to a time.Time
-// The day is set to 1 (first day of the month)
-func parseSpendingDateToTime(date string) (time.Time, error) {
-	if date == "" {
-		return time.Time{}, fmt.Errorf("empty date")
+// resolveDomain resolves a document field to a domain ID through the domain registry.
+// Values rejected by the unknown-value policy return a *rejectedError.
+func (s *Service) resolveDomain(field, name, domainType, source string) (sql.NullInt64, error) {
+	id, err := s.domains.Resolve(name, domainType, source)
+	if errors.Is(err, mariadb.ErrUnknownDomain) {
+		return id, &rejectedError{violation: validation.Violation{Field: field, Rule: "domain", Message: err.Error()}}
 	}
+	return id, err
+}
 
-	normalized := strings.ReplaceAll(date, "-", "/")
-	parts := strings.Split(normalized, "/")
-	if len(parts) != 2 {
-		return time.Time{}, fmt.Errorf("invalid date format: %s", date)
+// quarantineRejected quarantines a document rejected during transformation and reports whether it did
+func (s *Service) quarantineRejected(ctx context.Context, collectionName, docID string, err error) bool {
+	var rejected *rejectedError
+	if !errors.As(err, &rejected) {
+		return false
 	}
+	s.quarantine(ctx, collectionName, docID, []validation.Violation{rejected.violation})
+	return true
+}
 
-	dateStr := fmt.Sprintf("%s-%s-01", parts[0], parts[1])
-	return time.Parse("2006-01-02", dateStr)
+// optionalMonth normalizes an optional date to the YYYY/MM format for MariaDB.
+// Missing values yield an empty string; malformed or ambiguous values yield an error.
+func (s *Service) optionalMonth(value interface{}) (string, error) {
+	month, err := s.dates.Month(value)
+	if errors.Is(err, dates.ErrEmpty) {
+		return "", nil
+	}
+	return month, err
 }
 
 // addMonths adds n months to a date and returns YYYY/MM format
 func addMonths(date string, months int) string {
-	t, err := parseSpendingDateToTime(date)
+	t, err := dates.ParseMonthKey(date)
 	if err != nil {
 		return ""
 	}
@@ -107,11 +141,11 @@ func addMonths(date string, months int) string {
 
 // generateMonthRange generates all months between start and end (inclusive) in YYYY/MM format
 func generateMonthRange(start, end string) []string {
-	startTime, err := parseSpendingDateToTime(start)
+	startTime, err := dates.ParseMonthKey(start)
 	if err != nil {
 		return nil
 	}
-	endTime, err := parseSpendingDateToTime(end)
+	endTime, err := dates.ParseMonthKey(end)
 	if err != nil {
 		return nil
 	}
@@ -123,38 +157,59 @@ func generateMonthRange(start, end string) []string {
 	return months
 }
 
+// convertToBase converts amounts into the base currency using the rate effective at the
+// end of the given spending month. When no rate is available the base values stay NULL,
+// so reports never sum amounts in different currencies.
+func (s *Service) convertToBase(currencyCode string, spendingDate string, amounts ...float64) currency.Conversion {
+	on := time.Now()
+	if t, err := dates.ParseMonthKey(spendingDate); err == nil {
+		on = t.AddDate(0, 1, -1)
+	}
+
+	conversion, err := s.converter.Convert(currencyCode, on, amounts...)
+	if err != nil {
+		log.Printf("Error converting %s amounts to %s: %v", conversion.CurrencyCode, s.converter.BaseCurrency(), err)
+	} else if !conversion.Rate.Valid {
+		log.Printf("Warning: no exchange rate from %s to %s on %s, base amounts left empty",
+			conversion.CurrencyCode, s.converter.BaseCurrency(), on.Format("2006-01-02"))
+	}
+
+	return conversion
+}
+
 // syncSimpleExpense creates a single expense record without installments
-func (s *Service) syncSimpleExpense(ctx context.Context, mongoExpense mongodb.ExpenseDocument, userID int64) error {
+func (s *Service) syncSimpleExpense(ctx context.Context, mongoExpense mongodb.ExpenseDocument, userID int64, touched userMonths) error {
 	expenseRepo := mariadb.NewExpenseRepository(s.mariaDB)
 
-	var statusID sql.NullInt64
-	if mongoExpense.Status != "" {
-		id, err := s.mariaDB.GetDomainID(mongoExpense.Status, "id_status", "expense")
-		if err == nil {
-			statusID = sql.NullInt64{Int64: id, Valid: true}
-		}
+	statusID, err := s.resolveDomain("status", mongoExpense.Status, "id_status", "expense")
+	if err != nil {
+		return err
 	}
 
-	var typeID sql.NullInt64
-	if mongoExpense.Type != "" {
-		id, err := s.mariaDB.GetDomainID(mongoExpense.Type, "id_type", "expense")
-		if err == nil {
-			typeID = sql.NullInt64{Int64: id, Valid: true}
-		}
+	typeID, err := s.resolveDomain("type", mongoExpense.Type, "id_type", "expense")
+	if err != nil {
+		return err
 	}
 
 	var validityDate sql.NullTime
-	if mongoExpense.Validity != nil && *mongoExpense.Validity != "" {
-		t, err := parseSpendingDateToTime(*mongoExpense.Validity)
-		if err == nil {
-			validityDate = sql.NullTime{Time: t, Valid: true}
+	if !dates.IsEmpty(mongoExpense.Validity) {
+		t, err := s.dates.MonthStart(mongoExpense.Validity)
+		if err != nil {
+			return fmt.Errorf("invalid validity: %w", err)
 		}
+		validityDate = sql.NullTime{Time: t, Valid: true}
+	}
+
+	spendingDate, err := s.optionalMonth(mongoExpense.SpendingDate)
+	if err != nil {
+		return fmt.Errorf("invalid spending date: %w", err)
 	}
+	conversion := s.convertToBase(mongoExpense.Currency, spendingDate, mongoExpense.Amount, mongoExpense.AlreadyPaidAmount)
 
 	expense := &models.Expense{
 		SourceID:                          mongoExpense.ID,
 		UserID:                            userID,
-		SpendingDateYYYYMM:                formatSpendingDate(mongoExpense.SpendingDate),
+		SpendingDateYYYYMM:                spendingDate,
 		IDStatus:                          statusID,
 		IDType:                            typeID,
 		ValidityPeriodDate:                validityDate,
@@ -162,18 +217,39 @@ func (s *Service) syncSimpleExpense(ctx context.Context, mongoExpense mongodb.Ex
 		Name:                              mongoExpense.ExpenseName,
 		TotalAmount:                       mongoExpense.Amount,
 		TotalPaidAmount:                   mongoExpense.AlreadyPaidAmount,
+		CurrencyCode:                      sql.NullString{String: conversion.CurrencyCode, Valid: true},
+		ExchangeRate:                      conversion.Rate,
+		TotalAmountBase:                   conversion.Amounts[0],
+		TotalPaidAmountBase:               conversion.Amounts[1],
+	}
+
+	previous, err := expenseRepo.GetUserMonthBySourceID(mongoExpense.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := expenseRepo.UpsertExpense(expense); err != nil {
+		return err
 	}
+	touched.addExisting(previous)
+	touched.add(userID, spendingDate)
 
-	return expenseRepo.UpsertExpense(expense)
+	if mongoExpense.ExpenseAutomaticWorkflowID != "" {
+		if err := s.linkExpenseToWorkflow(expense.ID, mongoExpense.ExpenseAutomaticWorkflowID); err != nil {
+			log.Printf("Warning: Failed to link expense %s to its automatic workflow: %v", mongoExpense.ID, err)
+		}
+	}
+
+	return nil
 }
 
 // syncExpenseWithInstallments handles invoice/savings with validity dates
 // This fetches all related expenses (same name and validity) and generates installments
-func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense mongodb.ExpenseDocument, userID int64) error {
+func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense mongodb.ExpenseDocument, userID int64, touched userMonths) error {
 	expenseRepo := mariadb.NewExpenseRepository(s.mariaDB)
 	installmentRepo := mariadb.NewExpenseInstallmentRepository(s.mariaDB)
 
-	validity := *mongoExpense.Validity
+	validity := mongoExpense.Validity
 	expenseName := mongoExpense.ExpenseName
 
 	// Get all expenses in the aggregate (same name and validity for this user)
@@ -182,9 +258,13 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 		return fmt.Errorf("failed to get expense aggregate: %w", err)
 	}
 
-	// Format validity to YYYY/MM for database lookup
-	// The validity from MongoDB can be in ISO format (2026-03-01T03:00:00Z) or YYYY-MM format
-	validityFormatted := formatSpendingDate(validity)
+	// Normalize validity to YYYY/MM in the business timezone for database lookup
+	// The validity from MongoDB can be an ISO timestamp (2026-03-01T03:00:00Z), a Firestore
+	// timestamp or a YYYY-MM string
+	validityFormatted, err := s.dates.Month(validity)
+	if err != nil {
+		return fmt.Errorf("invalid validity: %w", err)
+	}
 
 	// If this aggregate has already been processed, just mark as synced and return
 	// We check by looking for an existing expense with this name, validity, and no spending_date
@@ -193,17 +273,14 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 		return fmt.Errorf("failed to check existing expense: %w", err)
 	}
 
-	var typeID sql.NullInt64
-	if mongoExpense.Type != "" {
-		id, err := s.mariaDB.GetDomainID(mongoExpense.Type, "id_type", "expense")
-		if err == nil {
-			typeID = sql.NullInt64{Int64: id, Valid: true}
-		}
+	typeID, err := s.resolveDomain("type", mongoExpense.Type, "id_type", "expense")
+	if err != nil {
+		return err
 	}
 
 	var validityDate sql.NullTime
 	// Use the formatted validity (YYYY/MM) for parsing to time.Time
-	t, err := parseSpendingDateToTime(validityFormatted)
+	t, err := dates.ParseMonthKey(validityFormatted)
 	if err == nil {
 		validityDate = sql.NullTime{Time: t, Valid: true}
 	}
@@ -227,6 +304,7 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 			Name:                              expenseName,
 			TotalAmount:                       0, // Not set for aggregate
 			TotalPaidAmount:                   0, // Not set for aggregate
+			CurrencyCode:                      sql.NullString{String: s.converter.EffectiveCode(mongoExpense.Currency), Valid: true},
 		}
 
 		if err := expenseRepo.UpsertExpense(expense); err != nil {
@@ -236,16 +314,44 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 		log.Printf("Created new generic expense record for aggregate: %s (ID: %d)", expenseName, expenseID)
 	}
 
+	if mongoExpense.ExpenseAutomaticWorkflowID != "" {
+		if err := s.linkExpenseToWorkflow(expenseID, mongoExpense.ExpenseAutomaticWorkflowID); err != nil {
+			log.Printf("Warning: Failed to link expense %s to its automatic workflow: %v", mongoExpense.ID, err)
+		}
+	}
+
+	// Normalize spending dates, skipping expenses whose month cannot be determined
+	months := make(map[string]string, len(aggregateExpenses))
+	validExpenses := aggregateExpenses[:0]
+	for _, aggExp := range aggregateExpenses {
+		month, err := s.dates.Month(aggExp.SpendingDate)
+		if err != nil {
+			log.Printf("Skipping installment for expense %s: invalid spending date: %v", aggExp.ID, err)
+			continue
+		}
+		months[aggExp.ID] = month
+		validExpenses = append(validExpenses, aggExp)
+	}
+	aggregateExpenses = validExpenses
+
 	// Sort aggregate expenses by spending date
 	sort.Slice(aggregateExpenses, func(i, j int) bool {
-		return aggregateExpenses[i].SpendingDate < aggregateExpenses[j].SpendingDate
+		return months[aggregateExpenses[i].ID] < months[aggregateExpenses[j].ID]
 	})
 
 	// Create installments from MongoDB expense records
 	existingInstallmentDates := make(map[string]bool)
 
 	for _, aggExp := range aggregateExpenses {
-		spendingDate := formatSpendingDate(aggExp.SpendingDate)
+		spendingDate := months[aggExp.ID]
+
+		statusID, err := s.resolveDomain("status", aggExp.Status, "id_status", "expense_installment")
+		if err != nil {
+			if !s.quarantineRejected(ctx, "expenses", aggExp.ID, err) {
+				log.Printf("Error resolving installment status for expense %s: %v", aggExp.ID, err)
+			}
+			continue
+		}
 
 		// Check if installment already exists for this date
 		existingInstallment, err := installmentRepo.GetInstallmentByExpenseAndDate(expenseID, spendingDate)
@@ -255,19 +361,15 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 
 		if existingInstallment != nil {
 			// Update existing installment
+			conversion := s.convertToBase(aggExp.Currency, spendingDate, aggExp.Amount, aggExp.AlreadyPaidAmount)
 			existingInstallment.Amount = aggExp.Amount
 			existingInstallment.PaidAmount = aggExp.AlreadyPaidAmount
-
-			var statusID sql.NullInt64
-			if aggExp.Status != "" {
-				id, err := s.mariaDB.GetDomainID(aggExp.Status, "id_status", "expense_installment")
-				if err == nil {
-					statusID = sql.NullInt64{Int64: id, Valid: true}
-				}
-			}
+			existingInstallment.ExchangeRate = conversion.Rate
+			existingInstallment.AmountBase = conversion.Amounts[0]
+			existingInstallment.PaidAmountBase = conversion.Amounts[1]
 			existingInstallment.IDStatus = statusID
 
-			dueDate, _ := parseSpendingDateToTime(spendingDate)
+			dueDate, _ := dates.ParseMonthKey(spendingDate)
 			existingInstallment.DueDate = sql.NullTime{Time: dueDate, Valid: true}
 
 			if err := installmentRepo.UpsertExpenseInstallment(existingInstallment); err != nil {
@@ -275,22 +377,18 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 			}
 		} else {
 			// Create new installment
-			var statusID sql.NullInt64
-			if aggExp.Status != "" {
-				id, err := s.mariaDB.GetDomainID(aggExp.Status, "id_status", "expense_installment")
-				if err == nil {
-					statusID = sql.NullInt64{Int64: id, Valid: true}
-				}
-			}
-
-			dueDate, _ := parseSpendingDateToTime(spendingDate)
+			dueDate, _ := dates.ParseMonthKey(spendingDate)
+			conversion := s.convertToBase(aggExp.Currency, spendingDate, aggExp.Amount, aggExp.AlreadyPaidAmount)
 
 			installment := &models.ExpenseInstallment{
-				ExpenseID:  expenseID,
-				Amount:     aggExp.Amount,
-				PaidAmount: aggExp.AlreadyPaidAmount,
-				IDStatus:   statusID,
-				DueDate:    sql.NullTime{Time: dueDate, Valid: true},
+				ExpenseID:      expenseID,
+				Amount:         aggExp.Amount,
+				PaidAmount:     aggExp.AlreadyPaidAmount,
+				IDStatus:       statusID,
+				DueDate:        sql.NullTime{Time: dueDate, Valid: true},
+				ExchangeRate:   conversion.Rate,
+				AmountBase:     conversion.Amounts[0],
+				PaidAmountBase: conversion.Amounts[1],
 			}
 
 			if err := installmentRepo.UpsertExpenseInstallment(installment); err != nil {
@@ -299,20 +397,23 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 		}
 
 		existingInstallmentDates[spendingDate] = true
+		touched.add(userID, spendingDate)
 	}
 
 	// Generate remaining installments from the last MongoDB expense date + 1 month until validity
 	if len(aggregateExpenses) > 0 {
-		lastExpenseDate := formatSpendingDate(aggregateExpenses[len(aggregateExpenses)-1].SpendingDate)
-		validityFormatted := formatSpendingDate(validity)
+		// Get the "pending" status ID for new installments
+		pendingStatusID, err := s.resolveDomain("status", "pending", "id_status", "expense_installment")
+		if err != nil {
+			return fmt.Errorf("failed to resolve pending installment status: %w", err)
+		}
+
+		lastExpenseDate := months[aggregateExpenses[len(aggregateExpenses)-1].ID]
 
 		// Generate months from lastExpenseDate + 1 month until validity
 		nextMonth := addMonths(lastExpenseDate, 1)
 		remainingMonths := generateMonthRange(nextMonth, validityFormatted)
 
-		// Get the "pending" status ID for new installments
-		pendingStatusID, _ := s.mariaDB.GetDomainID("pending", "id_status", "expense_installment")
-
 		for _, month := range remainingMonths {
 			if existingInstallmentDates[month] {
 				continue // Skip if already exists
@@ -324,19 +425,24 @@ func (s *Service) syncExpenseWithInstallments(ctx context.Context, mongoExpense
 				continue // Skip if already exists in DB
 			}
 
-			dueDate, _ := parseSpendingDateToTime(month)
+			dueDate, _ := dates.ParseMonthKey(month)
+			conversion := s.convertToBase(mongoExpense.Currency, month, mongoExpense.Amount, 0)
 
 			installment := &models.ExpenseInstallment{
-				ExpenseID:  expenseID,
-				Amount:     mongoExpense.Amount, // New generated installments use the MongoDB expense's amount
-				PaidAmount: 0,
-				IDStatus:   sql.NullInt64{Int64: pendingStatusID, Valid: true},
-				DueDate:    sql.NullTime{Time: dueDate, Valid: true},
+				ExpenseID:      expenseID,
+				Amount:         mongoExpense.Amount, // New generated installments use the MongoDB expense's amount
+				PaidAmount:     0,
+				IDStatus:       pendingStatusID,
+				DueDate:        sql.NullTime{Time: dueDate, Valid: true},
+				ExchangeRate:   conversion.Rate,
+				AmountBase:     conversion.Amounts[0],
+				PaidAmountBase: conversion.Amounts[1],
 			}
 
 			if err := installmentRepo.UpsertExpenseInstallment(installment); err != nil {
 				log.Printf("Error creating generated installment for date %s: %v", month, err)
 			} else {
+				touched.add(userID, month)
 				log.Printf("Generated pending installment for %s: %s", expenseName, month)
 			}
 		}
@@ -360,26 +466,20 @@ func (s *Service) ProcessIngestionMessage(ctx context.Context, docID string) err
 		log.Printf("Document not found for ID: %s - this should not happen", docID)
 		return fmt.Errorf("document not found for ID: %s", docID)
 	}
+	return s.processIngestionDoc(ctx, docID, doc)
+}
 
+// processIngestionDoc syncs the documents listed by a fetched succesfully_ingested_firestore_docs
+// document, then marks it as processed
+func (s *Service) processIngestionDoc(ctx context.Context, docID string, doc *mongodb.SuccessfullyIngestedFirestoreDocsDocument) error {
 	log.Printf("Found document with %d collections to process", len(doc.MapCollectionToDocs))
 
-	// Define the correct ingestion order - users must be first since other collections depend on them
-	collectionOrder := []string{
-		"users",
-		"banks",
-		"expenses",
-		"additional_balances",
-		"balance_history",
-		"expense_automatic_workflow",
-		"expense_automatic_workflow_pre_saved_description",
-		"payments",
-		"settings",
-	}
-
 	// Track errors for each collection
 	var collectionErrors []string
 	processedCollections := 0
 	successfulCollections := 0
+	documentsCount := 0
+	droppedIDs := 0
 
 	// Process collections in the correct order
 	for _, collectionName := range collectionOrder {
@@ -388,40 +488,21 @@ func (s *Service) ProcessIngestionMessage(ctx context.Context, docID string) err
 			continue
 		}
 
-		ids := extractDocIDs(docIDs)
+		ids, dropped := mongodb.ParseDocIDs(docIDs)
+		if dropped > 0 {
+			log.Printf("Warning: Dropped %d elements of map_collection_to_docs.%s that are not document IDs", dropped, collectionName)
+			droppedIDs += dropped
+		}
 		if len(ids) == 0 {
 			log.Printf("No document IDs found for collection: %s", collectionName)
 			continue
 		}
 
 		processedCollections++
+		documentsCount += len(ids)
 		log.Printf("Processing %d documents from collection: %s", len(ids), collectionName)
 
-		var syncErr error
-		switch collectionName {
-		case "users":
-			syncErr = s.syncUsersByIDs(ctx, ids)
-		case "expenses":
-			syncErr = s.syncExpensesByIDs(ctx, ids)
-		case "banks":
-			syncErr = s.syncFinancialInstitutionsByIDs(ctx, ids)
-		case "additional_balances":
-			syncErr = s.syncAdditionalBalancesByIDs(ctx, ids)
-		case "balance_history":
-			syncErr = s.syncBalanceHistoryByIDs(ctx, ids)
-		case "expense_automatic_workflow":
-			syncErr = s.syncExpenseAutomaticWorkflowsByIDs(ctx, ids)
-		case "expense_automatic_workflow_pre_saved_description":
-			syncErr = s.syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx, ids)
-		case "payments":
-			syncErr = s.syncServicePaymentsByIDs(ctx, ids)
-		case "settings":
-			syncErr = s.syncSettingsByIDs(ctx, ids)
-		default:
-			log.Printf("Unknown collection: %s", collectionName)
-			continue
-		}
-
+		syncErr := s.SyncCollection(ctx, collectionName, ids)
 		if syncErr != nil {
 			errMsg := fmt.Sprintf("%s: %v", collectionName, syncErr)
 			log.Printf("Error syncing %s: %v", collectionName, syncErr)
@@ -432,14 +513,18 @@ func (s *Service) ProcessIngestionMessage(ctx context.Context, docID string) err
 		}
 	}
 
-	log.Printf("Completed processing ingestion message for document ID: %s (processed: %d, successful: %d, failed: %d)",
-		docID, processedCollections, successfulCollections, len(collectionErrors))
+	log.Printf("Completed processing ingestion message for document ID: %s (processed: %d, successful: %d, failed: %d, dropped IDs: %d)",
+		docID, processedCollections, successfulCollections, len(collectionErrors), droppedIDs)
 
 	// Return error if any collection failed to sync
 	if len(collectionErrors) > 0 {
-		return fmt.Errorf("failed to sync %d collection(s): %s", len(collectionErrors), strings.Join(collectionErrors, "; "))
+		syncErr := fmt.Errorf("failed to sync %d collection(s): %s", len(collectionErrors), strings.Join(collectionErrors, "; "))
+		s.recordSync(models.SyncStatusFailed, documentsCount, syncErr)
+		return syncErr
 	}
 
+	s.recordSync(models.SyncStatusSuccess, documentsCount, nil)
+
 	// Mark the ingestion document as processed with ingestedBy and ingestedAt
 	if err := s.mongoDB.MarkIngestionDocAsProcessed(ctx, docID, serviceName); err != nil {
 		log.Printf("Warning: failed to mark ingestion document as processed: %v", err)
@@ -448,10 +533,7 @@ func (s *Service) ProcessIngestionMessage(ctx context.Context, docID string) err
 
 	// Update Firestore settings syncMetadata if enabled
 	if s.firestoreClient != nil {
-		syncServiceName := s.cfg.Firebase.SyncMetadataServiceName
-		if syncServiceName == "" {
-			syncServiceName = "porcool-ingestion-non-relational-db-to-relational-db"
-		}
+		syncServiceName := s.syncServiceName()
 		if err := s.firestoreClient.UpdateSettingsSyncMetadata(ctx, syncServiceName); err != nil {
 			log.Printf("Warning: failed to update Firestore settings syncMetadata: %v", err)
 			// Don't return error here - the ingestion was successful, this is just metadata
@@ -463,53 +545,165 @@ func (s *Service) ProcessIngestionMessage(ctx context.Context, docID string) err
 	return nil
 }
 
-// extractDocIDs extracts string document IDs from various formats
-// The map_collection_to_docs field can contain arrays of strings or other formats
-func extractDocIDs(docIDs interface{}) []string {
-	var ids []string
+// collectionOrder is the order collections are ingested in - users must be first since other
+// collections depend on them
+var collectionOrder = []string{
+	"users",
+	"banks",
+	"expenses",
+	"additional_balances",
+	"balance_history",
+	"expense_automatic_workflow",
+	"expense_automatic_workflow_pre_saved_description",
+	"payments",
+	"settings",
+}
 
-	log.Printf("extractDocIDs: received type %T, value: %v", docIDs, docIDs)
+// SyncCollection syncs the given documents of a MongoDB collection into MariaDB
+func (s *Service) SyncCollection(ctx context.Context, collectionName string, ids []mongodb.DocID) error {
+	switch collectionName {
+	case "users":
+		return s.syncUsersByIDs(ctx, ids)
+	case "expenses":
+		return s.syncExpensesByIDs(ctx, ids)
+	case "banks":
+		return s.syncFinancialInstitutionsByIDs(ctx, ids)
+	case "additional_balances":
+		return s.syncAdditionalBalancesByIDs(ctx, ids)
+	case "balance_history":
+		return s.syncBalanceHistoryByIDs(ctx, ids)
+	case "expense_automatic_workflow":
+		return s.syncExpenseAutomaticWorkflowsByIDs(ctx, ids)
+	case "expense_automatic_workflow_pre_saved_description":
+		return s.syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx, ids)
+	case "payments":
+		return s.syncServicePaymentsByIDs(ctx, ids)
+	case "settings":
+		return s.syncSettingsByIDs(ctx, ids)
+	default:
+		return fmt.Errorf("unknown collection: %s", collectionName)
+	}
+}
 
-	switch v := docIDs.(type) {
-	case []interface{}:
-		for _, id := range v {
-			log.Printf("extractDocIDs: array element type %T, value: %v", id, id)
-			if strID, ok := id.(string); ok {
-				ids = append(ids, strID)
-			}
+// workflowFetchBatchSize bounds the workflows fetched at once, since each carries its
+// receipt image
+const workflowFetchBatchSize = 25
+
+// maxLoggedMissingIDs bounds the IDs listed when documents are missing from MongoDB
+const maxLoggedMissingIDs = 20
+
+// syncedDocs collects the documents of a fetched batch that were synced, so they are
+// marked in MongoDB with one bulk write
+type syncedDocs struct {
+	fetched mongodb.FetchedDocs
+	marks   []mongodb.SyncMark
+}
+
+// add records a document as synced
+func (d *syncedDocs) add(id string) {
+	d.marks = append(d.marks, d.fetched.Mark(id))
+}
+
+// fetchAndSync fetches the documents of a collection by ID and passes them to a syncer one
+// batch at a time. The documents the syncer reports synced are marked in MongoDB after each
+// batch, even when it fails part way. IDs without a document are logged, and fields the
+// document type does not know are reported as schema drift.
+func fetchAndSync[T any](ctx context.Context, s *Service, collectionName string, ids []mongodb.DocID, opts mongodb.FetchOptions, sync func(context.Context, []T, *syncedDocs) error) error {
+	opts = s.driftOptions(collectionName, opts)
+	result, err := mongodb.FetchByIDs(ctx, s.mongoDB, collectionName, ids, opts, func(batch []T, fetched mongodb.FetchedDocs) error {
+		synced := &syncedDocs{fetched: fetched}
+		syncErr := sync(ctx, batch, synced)
+		if opts.PreserveExtra {
+			s.saveExtraAttributes(collectionName, synced)
 		}
-	case []string:
-		ids = v
-	case string:
-		ids = []string{v}
-	case primitive.A:
-		// MongoDB primitive.A is the BSON array type
-		for _, id := range v {
-			log.Printf("extractDocIDs: primitive.A element type %T, value: %v", id, id)
-			if strID, ok := id.(string); ok {
-				ids = append(ids, strID)
-			}
+		if err := s.mongoDB.MarkAsSynced(ctx, collectionName, synced.marks, serviceName); err != nil {
+			log.Printf("Error marking %d %s documents as synced: %v", len(synced.marks), collectionName, err)
 		}
-	default:
-		log.Printf("extractDocIDs: unhandled type %T", docIDs)
+		return syncErr
+	})
+	s.recordSchemaDrift(ctx, collectionName, result.UnknownFields)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Missing) > 0 {
+		log.Printf("Warning: %d of %d %s IDs were not found in MongoDB: %s",
+			len(result.Missing), result.Requested, collectionName, missingIDList(result.Missing))
 	}
+	return nil
+}
 
-	log.Printf("extractDocIDs: extracted %d IDs", len(ids))
-	return ids
+// missingIDList joins missing IDs for a log line, keeping the first maxLoggedMissingIDs
+func missingIDList(ids []string) string {
+	if len(ids) <= maxLoggedMissingIDs {
+		return strings.Join(ids, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(ids[:maxLoggedMissingIDs], ", "), len(ids)-maxLoggedMissingIDs)
+}
+
+// validDocuments is the validation stage that runs before documents are transformed.
+// Documents failing a rule are written to the quarantine collection and left out;
+// documents passing every rule have any previous quarantine entry resolved.
+func validDocuments[T any](ctx context.Context, s *Service, collectionName string, docs []T, docID func(T) string, validate func(T) []validation.Violation) []T {
+	valid := make([]T, 0, len(docs))
+	var validIDs []string
+
+	for _, doc := range docs {
+		id := docID(doc)
+		violations := validate(doc)
+		if len(violations) == 0 {
+			valid = append(valid, doc)
+			validIDs = append(validIDs, id)
+			continue
+		}
+
+		s.quarantine(ctx, collectionName, id, violations)
+	}
+
+	if err := s.mongoDB.ResolveQuarantinedDocuments(ctx, collectionName, validIDs); err != nil {
+		log.Printf("Error resolving quarantined %s documents: %v", collectionName, err)
+	}
+
+	return valid
+}
+
+// quarantine writes a document and its rule violations to the quarantine collection
+func (s *Service) quarantine(ctx context.Context, collectionName, docID string, violations []validation.Violation) {
+	quarantineViolations := make([]mongodb.QuarantineViolation, len(violations))
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		quarantineViolations[i] = mongodb.QuarantineViolation{Field: v.Field, Rule: v.Rule, Message: v.Message}
+		messages[i] = v.String()
+	}
+
+	log.Printf("Quarantining %s document %s: %s", collectionName, docID, strings.Join(messages, "; "))
+	if err := s.mongoDB.QuarantineDocument(ctx, collectionName, docID, quarantineViolations); err != nil {
+		log.Printf("Error quarantining %s document %s: %v", collectionName, docID, err)
+	}
 }
 
 // syncUsersByIDs syncs specific users by their IDs
-func (s *Service) syncUsersByIDs(ctx context.Context, ids []string) error {
-	users, err := s.mongoDB.GetUsersByIDs(ctx, ids)
+func (s *Service) syncUsersByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "users", ids, mongodb.FetchOptions{}, s.syncUsers)
+}
+
+// syncUsers syncs a batch of user documents
+func (s *Service) syncUsers(ctx context.Context, users []mongodb.UserDocument, synced *syncedDocs) error {
+	log.Printf("Found %d users to sync", len(users))
+	users, err := s.dropErasedUsers(ctx, users)
 	if err != nil {
 		return err
 	}
-
-	log.Printf("Found %d users to sync", len(users))
+	users = validDocuments(ctx, s, "users", users, func(d mongodb.UserDocument) string { return d.ID }, s.validator.ValidateUser)
 
 	repo := mariadb.NewUserRepository(s.mariaDB)
 
 	for _, mongoUser := range users {
+		currentSpendingDate, err := s.optionalMonth(mongoUser.LookingAtSpendingDate)
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid lookingAtSpendingDate for user %s: %v", mongoUser.ID, err)
+		}
+
 		user := &models.User{
 			SourceID:            mongoUser.ID,
 			FirstName:           mongoUser.Name,
@@ -520,7 +714,20 @@ func (s *Service) syncUsersByIDs(ctx context.Context, ids []string) error {
 			FlPaymentRequested:  mongoUser.RequestedPayment,
 			FlPaymentPending:    mongoUser.PendingPayment,
 			FlPaymentPaid:       mongoUser.PaidPayment,
-			CurrentSpendingDate: sql.NullString{String: formatSpendingDate(mongoUser.LookingAtSpendingDate), Valid: mongoUser.LookingAtSpendingDate != ""},
+			CurrentSpendingDate: sql.NullString{String: currentSpendingDate, Valid: currentSpendingDate != ""},
+		}
+
+		skip, err := s.resolveEmailConflict(repo, user)
+		if s.quarantineRejected(ctx, "users", mongoUser.ID, err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error resolving email conflict for user %s: %v", mongoUser.ID, err)
+			continue
+		}
+		if skip {
+			synced.add(mongoUser.ID)
+			continue
 		}
 
 		if err := repo.UpsertUser(user); err != nil {
@@ -528,26 +735,27 @@ func (s *Service) syncUsersByIDs(ctx context.Context, ids []string) error {
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "users", mongoUser.ID, serviceName); err != nil {
-			log.Printf("Error marking user %s as synced: %v", mongoUser.ID, err)
-		}
+		synced.add(mongoUser.ID)
 
-		log.Printf("Synced user: %s (%s)", user.Email, user.GUID)
+		log.Printf("Synced user: %s (%s)", logging.MaskEmail(user.Email), user.GUID)
 	}
 
 	return nil
 }
 
 // syncExpensesByIDs syncs specific expenses by their IDs
-func (s *Service) syncExpensesByIDs(ctx context.Context, ids []string) error {
-	expenses, err := s.mongoDB.GetExpensesByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncExpensesByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "expenses", ids, mongodb.FetchOptions{}, s.syncExpenses)
+}
 
+// syncExpenses syncs a batch of expense documents
+func (s *Service) syncExpenses(ctx context.Context, expenses []mongodb.ExpenseDocument, synced *syncedDocs) error {
 	log.Printf("Found %d expenses to sync", len(expenses))
+	expenses = validDocuments(ctx, s, "expenses", expenses, func(d mongodb.ExpenseDocument) string { return d.ID }, s.validator.ValidateExpense)
 
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
+	touched := userMonths{}
+	defer s.refreshMonthSummaries(touched)
 
 	for _, mongoExpense := range expenses {
 		user, err := userRepo.GetUserBySourceID(mongoExpense.User)
@@ -556,36 +764,31 @@ func (s *Service) syncExpensesByIDs(ctx context.Context, ids []string) error {
 			continue
 		}
 
-		expenseType := mongoExpense.Type
-
-		if expenseType == "expense" {
-			if err := s.syncSimpleExpense(ctx, mongoExpense, user.ID); err != nil {
-				log.Printf("Error syncing simple expense %s: %v", mongoExpense.ID, err)
-				continue
-			}
-		} else if expenseType == "invoice" || expenseType == "savings" {
-			if mongoExpense.Validity == nil || *mongoExpense.Validity == "" {
-				if err := s.syncSimpleExpense(ctx, mongoExpense, user.ID); err != nil {
-					log.Printf("Error syncing expense (no validity) %s: %v", mongoExpense.ID, err)
-					continue
-				}
+		var syncErr error
+		switch mongoExpense.Type {
+		case "expense":
+			syncErr = s.syncSimpleExpense(ctx, mongoExpense, user.ID, touched)
+		case "invoice", "savings":
+			if dates.IsEmpty(mongoExpense.Validity) {
+				syncErr = s.syncSimpleExpense(ctx, mongoExpense, user.ID, touched)
 			} else {
-				if err := s.syncExpenseWithInstallments(ctx, mongoExpense, user.ID); err != nil {
-					log.Printf("Error syncing expense with installments %s: %v", mongoExpense.ID, err)
-					continue
-				}
-			}
-		} else {
-			if err := s.syncSimpleExpense(ctx, mongoExpense, user.ID); err != nil {
-				log.Printf("Error syncing expense (unknown type) %s: %v", mongoExpense.ID, err)
-				continue
+				syncErr = s.syncExpenseWithInstallments(ctx, mongoExpense, user.ID, touched)
 			}
+		default:
+			// Unknown types are quarantined by the validation stage and should never get here
+			log.Printf("Skipping expense %s with unsupported type %q", mongoExpense.ID, mongoExpense.Type)
+			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "expenses", mongoExpense.ID, serviceName); err != nil {
-			log.Printf("Error marking expense %s as synced: %v", mongoExpense.ID, err)
+		if syncErr != nil {
+			if !s.quarantineRejected(ctx, "expenses", mongoExpense.ID, syncErr) {
+				log.Printf("Error syncing expense %s: %v", mongoExpense.ID, syncErr)
+			}
+			continue
 		}
 
+		synced.add(mongoExpense.ID)
+
 		log.Printf("Synced expense: %s (%s)", mongoExpense.ExpenseName, mongoExpense.ID)
 	}
 
@@ -593,13 +796,14 @@ func (s *Service) syncExpensesByIDs(ctx context.Context, ids []string) error {
 }
 
 // syncFinancialInstitutionsByIDs syncs specific financial institutions by their IDs
-func (s *Service) syncFinancialInstitutionsByIDs(ctx context.Context, ids []string) error {
-	institutions, err := s.mongoDB.GetFinancialInstitutionsByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncFinancialInstitutionsByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "banks", ids, mongodb.FetchOptions{}, s.syncFinancialInstitutions)
+}
 
+// syncFinancialInstitutions syncs a batch of financial institution documents
+func (s *Service) syncFinancialInstitutions(ctx context.Context, institutions []mongodb.FinancialInstitutionDocument, synced *syncedDocs) error {
 	log.Printf("Found %d financial institutions to sync", len(institutions))
+	institutions = validDocuments(ctx, s, "banks", institutions, func(d mongodb.FinancialInstitutionDocument) string { return d.ID }, s.validator.ValidateFinancialInstitution)
 
 	fiRepo := mariadb.NewFinancialInstitutionRepository(s.mariaDB)
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
@@ -625,9 +829,7 @@ func (s *Service) syncFinancialInstitutionsByIDs(ctx context.Context, ids []stri
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "banks", mongoFI.ID, serviceName); err != nil {
-			log.Printf("Error marking financial institution %s as synced: %v", mongoFI.ID, err)
-		}
+		synced.add(mongoFI.ID)
 
 		log.Printf("Synced financial institution: %s (%s)", fi.Name, fi.GUID)
 	}
@@ -636,16 +838,19 @@ func (s *Service) syncFinancialInstitutionsByIDs(ctx context.Context, ids []stri
 }
 
 // syncAdditionalBalancesByIDs syncs specific additional balances by their IDs
-func (s *Service) syncAdditionalBalancesByIDs(ctx context.Context, ids []string) error {
-	balances, err := s.mongoDB.GetAdditionalBalancesByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncAdditionalBalancesByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "additional_balances", ids, mongodb.FetchOptions{}, s.syncAdditionalBalances)
+}
 
+// syncAdditionalBalances syncs a batch of additional balance documents
+func (s *Service) syncAdditionalBalances(ctx context.Context, balances []mongodb.AdditionalBalanceDocument, synced *syncedDocs) error {
 	log.Printf("Found %d additional balances to sync", len(balances))
+	balances = validDocuments(ctx, s, "additional_balances", balances, func(d mongodb.AdditionalBalanceDocument) string { return d.ID }, s.validator.ValidateAdditionalBalance)
 
 	abRepo := mariadb.NewAdditionalBalanceRepository(s.mariaDB)
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
+	touched := userMonths{}
+	defer s.refreshMonthSummaries(touched)
 
 	for _, mongoAB := range balances {
 		user, err := userRepo.GetUserBySourceID(mongoAB.User)
@@ -654,22 +859,38 @@ func (s *Service) syncAdditionalBalancesByIDs(ctx context.Context, ids []string)
 			continue
 		}
 
+		spendingDate, err := s.optionalMonth(mongoAB.SpendingDate)
+		if err != nil {
+			log.Printf("Error normalizing spending date for additional balance %s: %v", mongoAB.ID, err)
+			continue
+		}
+		conversion := s.convertToBase(mongoAB.Currency, spendingDate, mongoAB.Balance)
+
 		ab := &models.AdditionalBalance{
 			SourceID:           mongoAB.ID,
 			UserID:             user.ID,
-			SpendingDateYYYYMM: formatSpendingDate(mongoAB.SpendingDate),
+			SpendingDateYYYYMM: spendingDate,
 			Amount:             mongoAB.Balance,
 			Description:        sql.NullString{String: mongoAB.Description, Valid: mongoAB.Description != ""},
+			CurrencyCode:       sql.NullString{String: conversion.CurrencyCode, Valid: true},
+			ExchangeRate:       conversion.Rate,
+			AmountBase:         conversion.Amounts[0],
+		}
+
+		previous, err := abRepo.GetUserMonthBySourceID(mongoAB.ID)
+		if err != nil {
+			log.Printf("Error getting stored month of additional balance %s: %v", mongoAB.ID, err)
+			continue
 		}
 
 		if err := abRepo.UpsertAdditionalBalance(ab); err != nil {
 			log.Printf("Error upserting additional balance %s: %v", mongoAB.ID, err)
 			continue
 		}
+		touched.addExisting(previous)
+		touched.add(user.ID, spendingDate)
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "additional_balances", mongoAB.ID, serviceName); err != nil {
-			log.Printf("Error marking additional balance %s as synced: %v", mongoAB.ID, err)
-		}
+		synced.add(mongoAB.ID)
 
 		log.Printf("Synced additional balance: %s", ab.GUID)
 	}
@@ -678,16 +899,18 @@ func (s *Service) syncAdditionalBalancesByIDs(ctx context.Context, ids []string)
 }
 
 // syncBalanceHistoryByIDs syncs specific balance history records by their IDs
-func (s *Service) syncBalanceHistoryByIDs(ctx context.Context, ids []string) error {
-	history, err := s.mongoDB.GetBalanceHistoryByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncBalanceHistoryByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "balance_history", ids, mongodb.FetchOptions{}, s.syncBalanceHistory)
+}
 
+// syncBalanceHistory syncs a batch of balance history documents
+func (s *Service) syncBalanceHistory(ctx context.Context, history []mongodb.BalanceHistoryDocument, synced *syncedDocs) error {
 	log.Printf("Found %d balance history records to sync", len(history))
+	history = validDocuments(ctx, s, "balance_history", history, func(d mongodb.BalanceHistoryDocument) string { return d.ID }, s.validator.ValidateBalanceHistory)
 
 	bhRepo := mariadb.NewBalanceHistoryRepository(s.mariaDB)
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
+	var syncedIDs []int64
 
 	for _, mongoBH := range history {
 		user, err := userRepo.GetUserBySourceID(mongoBH.User)
@@ -696,13 +919,25 @@ func (s *Service) syncBalanceHistoryByIDs(ctx context.Context, ids []string) err
 			continue
 		}
 
+		spendingDate, err := s.optionalMonth(mongoBH.SpendingDate)
+		if err != nil {
+			log.Printf("Error normalizing spending date for balance history %s: %v", mongoBH.ID, err)
+			continue
+		}
+		conversion := s.convertToBase(mongoBH.Currency, spendingDate, mongoBH.Balance, mongoBH.LastMonthBalance, mongoBH.MonthlyIncome)
+
 		bh := &models.BalanceHistory{
-			SourceID:           mongoBH.ID,
-			UserID:             user.ID,
-			SpendingDateYYYYMM: formatSpendingDate(mongoBH.SpendingDate),
-			Amount:             mongoBH.Balance,
-			LastMonthAmount:    mongoBH.LastMonthBalance,
-			MonthlyIncome:      mongoBH.MonthlyIncome,
+			SourceID:            mongoBH.ID,
+			UserID:              user.ID,
+			SpendingDateYYYYMM:  spendingDate,
+			Amount:              mongoBH.Balance,
+			LastMonthAmount:     mongoBH.LastMonthBalance,
+			MonthlyIncome:       mongoBH.MonthlyIncome,
+			CurrencyCode:        sql.NullString{String: conversion.CurrencyCode, Valid: true},
+			ExchangeRate:        conversion.Rate,
+			AmountBase:          conversion.Amounts[0],
+			LastMonthAmountBase: conversion.Amounts[1],
+			MonthlyIncomeBase:   conversion.Amounts[2],
 		}
 
 		if err := bhRepo.UpsertBalanceHistory(bh); err != nil {
@@ -710,26 +945,57 @@ func (s *Service) syncBalanceHistoryByIDs(ctx context.Context, ids []string) err
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "balance_history", mongoBH.ID, serviceName); err != nil {
-			log.Printf("Error marking balance history %s as synced: %v", mongoBH.ID, err)
-		}
+		synced.add(mongoBH.ID)
 
+		syncedIDs = append(syncedIDs, bh.ID)
 		log.Printf("Synced balance history: %s", bh.GUID)
 	}
 
+	s.verifyBalances(syncedIDs)
 	return nil
 }
 
-// syncExpenseAutomaticWorkflowsByIDs syncs specific expense automatic workflows by their IDs
-func (s *Service) syncExpenseAutomaticWorkflowsByIDs(ctx context.Context, ids []string) error {
-	workflows, err := s.mongoDB.GetExpenseAutomaticWorkflowsByIDs(ctx, ids)
+// verifyBalances checks synced balance_history rows against the ingested expenses and
+// additional balances. Discrepancies are recorded and logged but never fail the sync.
+func (s *Service) verifyBalances(balanceHistoryIDs []int64) {
+	if len(balanceHistoryIDs) == 0 {
+		return
+	}
+
+	verifier, err := balance.NewVerifier(mariadb.NewBalanceDiscrepancyRepository(s.mariaDB), mariadb.NewUserRepository(s.mariaDB),
+		s.dates.Location(), balance.DefaultBasis, balance.DefaultTolerance)
 	if err != nil {
-		return err
+		log.Printf("Warning: failed to create balance verifier: %v", err)
+		return
+	}
+
+	summary, err := verifier.Verify(models.BalanceFilter{BalanceHistoryIDs: balanceHistoryIDs})
+	if err != nil {
+		log.Printf("Warning: failed to verify balances: %v", err)
+		return
+	}
+	if summary.Discrepancies > 0 {
+		log.Printf("Warning: %d of %d synced balance history records do not match the recomputed balance, see balance_discrepancy",
+			summary.Discrepancies, summary.Verified)
 	}
+	if summary.Unconverted > 0 {
+		log.Printf("Warning: %d synced balance history records were not verified: their month has amounts without an exchange rate",
+			summary.Unconverted)
+	}
+}
 
+// syncExpenseAutomaticWorkflowsByIDs syncs specific expense automatic workflows by their IDs
+func (s *Service) syncExpenseAutomaticWorkflowsByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "expense_automatic_workflow", ids, mongodb.FetchOptions{BatchSize: workflowFetchBatchSize}, s.syncExpenseAutomaticWorkflows)
+}
+
+// syncExpenseAutomaticWorkflows syncs a batch of expense automatic workflow documents
+func (s *Service) syncExpenseAutomaticWorkflows(ctx context.Context, workflows []mongodb.ExpenseAutomaticWorkflowDocument, synced *syncedDocs) error {
 	log.Printf("Found %d expense automatic workflows to sync", len(workflows))
+	workflows = validDocuments(ctx, s, "expense_automatic_workflow", workflows, func(d mongodb.ExpenseAutomaticWorkflowDocument) string { return d.ID }, s.validator.ValidateExpenseAutomaticWorkflow)
 
 	eawRepo := mariadb.NewExpenseAutomaticWorkflowRepository(s.mariaDB)
+	itemRepo := mariadb.NewExpenseAutomaticWorkflowItemRepository(s.mariaDB)
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
 
 	for _, mongoEAW := range workflows {
@@ -739,37 +1005,64 @@ func (s *Service) syncExpenseAutomaticWorkflowsByIDs(ctx context.Context, ids []
 			continue
 		}
 
-		var syncStatusID sql.NullInt64
-		if mongoEAW.SyncStatus != "" {
-			id, err := s.mariaDB.GetDomainID(mongoEAW.SyncStatus, "id_sync_status", "expense_automatic_workflow")
-			if err == nil {
-				syncStatusID = sql.NullInt64{Int64: id, Valid: true}
+		syncStatusID, err := s.resolveDomain("syncStatus", mongoEAW.SyncStatus, "id_sync_status", "expense_automatic_workflow")
+		if err != nil {
+			if !s.quarantineRejected(ctx, "expense_automatic_workflow", mongoEAW.ID, err) {
+				log.Printf("Error resolving sync status for expense automatic workflow %s: %v", mongoEAW.ID, err)
 			}
+			continue
 		}
 
 		var extractedContent sql.NullString
 		if mongoEAW.ExtractedExpenseContentFromImage != nil {
-			jsonBytes, err := json.Marshal(mongoEAW.ExtractedExpenseContentFromImage)
+			jsonBytes, err := json.Marshal(plainValue(mongoEAW.ExtractedExpenseContentFromImage))
 			if err == nil && string(jsonBytes) != "null" {
 				extractedContent = sql.NullString{String: string(jsonBytes), Valid: true}
 			}
 		}
 
+		// Parse the OCR output into line items; unknown shapes keep only the raw JSON and are flagged
+		items, parseErr := parseWorkflowItems(mongoEAW.ExtractedExpenseContentFromImage, s.dates)
+		if parseErr != nil {
+			log.Printf("Warning: Could not parse extracted content of expense automatic workflow %s, keeping raw JSON: %v", mongoEAW.ID, parseErr)
+		}
+
+		spendingDate, err := s.optionalMonth(mongoEAW.SpendingDate)
+		if err != nil {
+			log.Printf("Error normalizing spending date for expense automatic workflow %s: %v", mongoEAW.ID, err)
+			continue
+		}
+
 		var syncProcessedDate sql.NullTime
-		if mongoEAW.SyncProcessedDate != "" {
-			t, err := time.Parse(time.RFC3339, mongoEAW.SyncProcessedDate)
-			if err == nil {
+		if !dates.IsEmpty(mongoEAW.SyncProcessedDate) {
+			t, err := s.dates.Time(mongoEAW.SyncProcessedDate)
+			if err != nil {
+				log.Printf("Warning: Ignoring invalid syncProcessedDate for expense automatic workflow %s: %v", mongoEAW.ID, err)
+			} else {
 				syncProcessedDate = sql.NullTime{Time: t, Valid: true}
 			}
 		}
 
+		// Receipt images live in the blob store; MariaDB only keeps the reference
+		var image blobstore.Blob
+		if mongoEAW.Base64Image != "" {
+			image, err = blobstore.PutBase64(ctx, s.blobs, mongoEAW.Base64Image)
+			if err != nil {
+				log.Printf("Error storing image of expense automatic workflow %s: %v", mongoEAW.ID, err)
+				continue
+			}
+		}
+
 		eaw := &models.ExpenseAutomaticWorkflow{
 			SourceID:                         mongoEAW.ID,
 			UserID:                           user.ID,
-			Base64Image:                      sql.NullString{String: mongoEAW.Base64Image, Valid: mongoEAW.Base64Image != ""},
+			ImageSHA256:                      sql.NullString{String: image.Key, Valid: image.Key != ""},
+			ImageMimeType:                    sql.NullString{String: image.MimeType, Valid: image.Key != ""},
+			ImageSize:                        sql.NullInt64{Int64: image.Size, Valid: image.Key != ""},
 			Description:                      sql.NullString{String: mongoEAW.Description, Valid: mongoEAW.Description != ""},
 			ExtractedExpenseContentFromImage: extractedContent,
-			SpendingDateYYYYMM:               sql.NullString{String: formatSpendingDate(mongoEAW.SpendingDate), Valid: mongoEAW.SpendingDate != ""},
+			FlExtractedContentUnparsed:       parseErr != nil,
+			SpendingDateYYYYMM:               sql.NullString{String: spendingDate, Valid: spendingDate != ""},
 			SyncProcessedDate:                syncProcessedDate,
 			IDSyncStatus:                     syncStatusID,
 			ProcessingMessage:                sql.NullString{String: mongoEAW.ProcessingMessage, Valid: mongoEAW.ProcessingMessage != ""},
@@ -780,10 +1073,17 @@ func (s *Service) syncExpenseAutomaticWorkflowsByIDs(ctx context.Context, ids []
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "expense_automatic_workflow", mongoEAW.ID, serviceName); err != nil {
-			log.Printf("Error marking expense automatic workflow %s as synced: %v", mongoEAW.ID, err)
+		if err := itemRepo.ReplaceItems(eaw.ID, items); err != nil {
+			log.Printf("Error replacing items of expense automatic workflow %s: %v", mongoEAW.ID, err)
+			continue
 		}
 
+		if err := s.linkWorkflowExpenses(ctx, eaw, mongoEAW.SyncStatus, items); err != nil {
+			log.Printf("Warning: Failed to link expense automatic workflow %s to its expenses: %v", mongoEAW.ID, err)
+		}
+
+		synced.add(mongoEAW.ID)
+
 		log.Printf("Synced expense automatic workflow: %s", eaw.GUID)
 	}
 
@@ -791,13 +1091,14 @@ func (s *Service) syncExpenseAutomaticWorkflowsByIDs(ctx context.Context, ids []
 }
 
 // syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs syncs specific pre-saved descriptions by their IDs
-func (s *Service) syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx context.Context, ids []string) error {
-	descriptions, err := s.mongoDB.GetExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "expense_automatic_workflow_pre_saved_description", ids, mongodb.FetchOptions{}, s.syncExpenseAutomaticWorkflowPreSavedDescriptions)
+}
 
+// syncExpenseAutomaticWorkflowPreSavedDescriptions syncs a batch of pre-saved description documents
+func (s *Service) syncExpenseAutomaticWorkflowPreSavedDescriptions(ctx context.Context, descriptions []mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument, synced *syncedDocs) error {
 	log.Printf("Found %d expense automatic workflow pre-saved descriptions to sync", len(descriptions))
+	descriptions = validDocuments(ctx, s, "expense_automatic_workflow_pre_saved_description", descriptions, func(d mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument) string { return d.ID }, s.validator.ValidateExpenseAutomaticWorkflowPreSavedDescription)
 
 	eawpsdRepo := mariadb.NewExpenseAutomaticWorkflowPreSavedDescriptionRepository(s.mariaDB)
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
@@ -820,9 +1121,7 @@ func (s *Service) syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx cont
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "expense_automatic_workflow_pre_saved_description", mongoDesc.ID, serviceName); err != nil {
-			log.Printf("Error marking pre-saved description %s as synced: %v", mongoDesc.ID, err)
-		}
+		synced.add(mongoDesc.ID)
 
 		log.Printf("Synced pre-saved description: %s", desc.GUID)
 	}
@@ -831,13 +1130,14 @@ func (s *Service) syncExpenseAutomaticWorkflowPreSavedDescriptionsByIDs(ctx cont
 }
 
 // syncServicePaymentsByIDs syncs specific service payments by their IDs
-func (s *Service) syncServicePaymentsByIDs(ctx context.Context, ids []string) error {
-	payments, err := s.mongoDB.GetServicePaymentsByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncServicePaymentsByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "payments", ids, mongodb.FetchOptions{}, s.syncServicePayments)
+}
 
+// syncServicePayments syncs a batch of service payment documents
+func (s *Service) syncServicePayments(ctx context.Context, payments []mongodb.ServicePaymentDocument, synced *syncedDocs) error {
 	log.Printf("Found %d service payments to sync", len(payments))
+	payments = validDocuments(ctx, s, "payments", payments, func(d mongodb.ServicePaymentDocument) string { return d.ID }, s.validator.ValidateServicePayment)
 
 	spRepo := mariadb.NewServicePaymentRepository(s.mariaDB)
 	userRepo := mariadb.NewUserRepository(s.mariaDB)
@@ -850,29 +1150,47 @@ func (s *Service) syncServicePaymentsByIDs(ctx context.Context, ids []string) er
 		}
 
 		var paymentDate time.Time
-		if mongoSP.PaymentDate != "" {
-			t, err := time.Parse("2006-01-02", mongoSP.PaymentDate)
+		if !dates.IsEmpty(mongoSP.PaymentDate) {
+			t, err := s.dates.Date(mongoSP.PaymentDate)
 			if err != nil {
-				t, err = time.Parse(time.RFC3339, mongoSP.PaymentDate)
-				if err != nil {
-					log.Printf("Error parsing payment date for %s: %v", mongoSP.ID, err)
-					continue
-				}
+				log.Printf("Error parsing payment date for %s: %v", mongoSP.ID, err)
+				continue
 			}
 			paymentDate = t
 		}
 
-		paymentTypeID, err := s.mariaDB.GetDomainID("PayPal", "service_payment_type_id", "service_payment")
-		var paymentTypeIDSQL sql.NullInt64
-		if err == nil {
-			paymentTypeIDSQL = sql.NullInt64{Int64: paymentTypeID, Valid: true}
+		provider := mongoSP.Provider
+		if provider == "" {
+			provider = s.cfg.Payments.DefaultProvider
+		}
+
+		providerID, err := s.resolveDomain("provider", provider, "service_payment_type_id", "service_payment")
+		if err != nil {
+			if !s.quarantineRejected(ctx, "payments", mongoSP.ID, err) {
+				log.Printf("Error resolving provider for service payment %s: %v", mongoSP.ID, err)
+			}
+			continue
+		}
+
+		statusID, err := s.resolveDomain("status", mongoSP.Status, "service_payment_status_id", "service_payment")
+		if err != nil {
+			if !s.quarantineRejected(ctx, "payments", mongoSP.ID, err) {
+				log.Printf("Error resolving status for service payment %s: %v", mongoSP.ID, err)
+			}
+			continue
 		}
 
 		sp := &models.ServicePayment{
-			SourceID:             mongoSP.ID,
-			UserID:               user.ID,
-			ServicePaymentDate:   paymentDate,
-			ServicePaymentTypeID: paymentTypeIDSQL,
+			SourceID:               mongoSP.ID,
+			UserID:                 user.ID,
+			ServicePaymentDate:     paymentDate,
+			ServicePaymentTypeID:   providerID,
+			ProviderTransactionID:  sql.NullString{String: mongoSP.ProviderTransactionID, Valid: mongoSP.ProviderTransactionID != ""},
+			ServicePaymentStatusID: statusID,
+		}
+		if mongoSP.Amount != nil {
+			sp.Amount = sql.NullFloat64{Float64: *mongoSP.Amount, Valid: true}
+			sp.CurrencyCode = sql.NullString{String: s.converter.EffectiveCode(mongoSP.Currency), Valid: true}
 		}
 
 		if err := spRepo.UpsertServicePayment(sp); err != nil {
@@ -880,9 +1198,7 @@ func (s *Service) syncServicePaymentsByIDs(ctx context.Context, ids []string) er
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "payments", mongoSP.ID, serviceName); err != nil {
-			log.Printf("Error marking service payment %s as synced: %v", mongoSP.ID, err)
-		}
+		synced.add(mongoSP.ID)
 
 		log.Printf("Synced service payment: %s", sp.GUID)
 	}
@@ -891,31 +1207,22 @@ func (s *Service) syncServicePaymentsByIDs(ctx context.Context, ids []string) er
 }
 
 // syncSettingsByIDs syncs specific system settings by their IDs
-func (s *Service) syncSettingsByIDs(ctx context.Context, ids []string) error {
-	settings, err := s.mongoDB.GetSettingsByIDs(ctx, ids)
-	if err != nil {
-		return err
-	}
+func (s *Service) syncSettingsByIDs(ctx context.Context, ids []mongodb.DocID) error {
+	return fetchAndSync(ctx, s, "settings", ids, mongodb.FetchOptions{}, s.syncSettings)
+}
 
+// syncSettings syncs a batch of settings documents
+func (s *Service) syncSettings(ctx context.Context, settings []mongodb.SettingsDocument, synced *syncedDocs) error {
 	log.Printf("Found %d system settings to sync", len(settings))
 
 	ssRepo := mariadb.NewSystemSettingsRepository(s.mariaDB)
+	smRepo := mariadb.NewSyncMetadataRepository(s.mariaDB)
 
 	for _, mongoSettings := range settings {
-		// Serialize syncMetadata to JSON
-		var syncMetadataJSON sql.NullString
-		if mongoSettings.SyncMetadata != nil && len(mongoSettings.SyncMetadata) > 0 {
-			jsonBytes, err := json.Marshal(mongoSettings.SyncMetadata)
-			if err == nil && string(jsonBytes) != "null" {
-				syncMetadataJSON = sql.NullString{String: string(jsonBytes), Valid: true}
-			}
-		}
-
 		ss := &models.SystemSettings{
 			SourceID:                mongoSettings.ID,
 			FlBlockUserRegistration: mongoSettings.BlockUserRegistration,
 			FlMaintenance:           mongoSettings.Maintenance,
-			JSONSyncMetadata:        syncMetadataJSON,
 		}
 
 		if err := ssRepo.UpsertSystemSettings(ss); err != nil {
@@ -923,10 +1230,14 @@ func (s *Service) syncSettingsByIDs(ctx context.Context, ids []string) error {
 			continue
 		}
 
-		if err := s.mongoDB.MarkAsSynced(ctx, "settings", mongoSettings.ID, serviceName); err != nil {
-			log.Printf("Error marking system settings %s as synced: %v", mongoSettings.ID, err)
+		for _, entry := range parseSyncMetadata(mongoSettings.ID, mongoSettings.SyncMetadata, s.dates) {
+			if err := smRepo.UpsertLatestSync(entry.Name, entry.LatestSyncDatetime); err != nil {
+				log.Printf("Error upserting sync metadata %s: %v", entry.Name, err)
+			}
 		}
 
+		synced.add(mongoSettings.ID)
+
 		log.Printf("Synced system settings: %s", ss.GUID)
 	}
 
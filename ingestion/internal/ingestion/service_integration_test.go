@@ -0,0 +1,232 @@
+//go:build integration
+
+package ingestion
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/porcool/ingestion/internal/blobstore"
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// newIntegrationService creates a service on fresh MariaDB and MongoDB databases, such as
+// the services in docker-compose.yml:
+//
+//	docker compose up -d mariadb mongodb
+//	go test -tags integration ./internal/ingestion/
+func newIntegrationService(t *testing.T) (*Service, *mongodb.Connection) {
+	t.Helper()
+
+	password := os.Getenv("MYSQL_ROOT_PASSWORD")
+	if password == "" {
+		password = "root_secret"
+	}
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017/?replicaSet=rs0&directConnection=true"
+	}
+	database := fmt.Sprintf("porcool_ingestion_test_%d", time.Now().UnixNano())
+
+	cfg := &config.Config{
+		MariaDB:   config.MariaDBConfig{Host: "localhost", Port: 3306, User: "root", Password: password, Database: database},
+		MongoDB:   config.MongoDBConfig{URI: uri, Database: database},
+		Currency:  config.CurrencyConfig{BaseCurrency: "BRL"},
+		Dates:     config.DatesConfig{BusinessTimezone: "America/Sao_Paulo"},
+		Domains:   config.DomainsConfig{UnknownPolicy: "reject", RefreshInterval: time.Minute},
+		BlobStore: config.BlobStoreConfig{LocalDir: t.TempDir()},
+		Users:     config.UsersConfig{EmailConflictPolicy: config.EmailConflictFail},
+		Erasure:   config.ErasureConfig{ReceiptSigningKey: "secret"},
+	}
+
+	mariaDB, err := mariadb.NewConnection(cfg.MariaDB)
+	if err != nil {
+		t.Fatalf("mariadb.NewConnection() returned error: %v", err)
+	}
+	t.Cleanup(func() {
+		mariaDB.DB().Exec("DROP DATABASE `" + database + "`")
+		mariaDB.Close()
+	})
+	if err := mariaDB.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations() returned error: %v", err)
+	}
+	if err := mariaDB.SeedDomains(); err != nil {
+		t.Fatalf("SeedDomains() returned error: %v", err)
+	}
+
+	mongoDB, err := mongodb.NewConnection(cfg.MongoDB)
+	if err != nil {
+		t.Fatalf("mongodb.NewConnection() returned error: %v", err)
+	}
+	t.Cleanup(func() {
+		mongoDB.Database().Drop(context.Background())
+		mongoDB.Close()
+	})
+
+	svc, err := NewService(mariaDB, mongoDB, cfg)
+	if err != nil {
+		t.Fatalf("NewService() returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := svc.Start(ctx); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	return svc, mongoDB
+}
+
+// TestInstallmentExpenseLinkedToWorkflow tests that an invoice split into installments is
+// linked to the workflow it references, like a simple expense
+func TestInstallmentExpenseLinkedToWorkflow(t *testing.T) {
+	svc, mongoDB := newIntegrationService(t)
+	ctx := context.Background()
+
+	insert := func(collection string, doc bson.M) {
+		t.Helper()
+		if _, err := mongoDB.Collection(collection).InsertOne(ctx, doc); err != nil {
+			t.Fatalf("failed to insert into %s: %v", collection, err)
+		}
+	}
+	insert("users", bson.M{"_id": "user-1", "email": "ana@example.com", "name": "Ana"})
+	insert("expense_automatic_workflow", bson.M{"_id": "eaw-1", "user": "user-1", "syncStatus": "success", "spendingDate": "2026-03-01T03:00:00Z"})
+	for i, month := range []string{"2026-03-01T03:00:00Z", "2026-04-01T03:00:00Z"} {
+		insert("expenses", bson.M{
+			"_id":                        fmt.Sprintf("exp-%d", i+1),
+			"user":                       "user-1",
+			"expenseName":                "Notebook",
+			"type":                       "invoice",
+			"status":                     "pending",
+			"amount":                     500.0,
+			"spendingDate":               month,
+			"validity":                   "2026-04-01T03:00:00Z",
+			"expenseAutomaticWorkflowId": "eaw-1",
+		})
+	}
+
+	for _, sync := range []struct {
+		collection string
+		ids        []string
+	}{
+		{"users", []string{"user-1"}},
+		{"expense_automatic_workflow", []string{"eaw-1"}},
+		{"expenses", []string{"exp-1", "exp-2"}},
+	} {
+		if err := svc.SyncCollection(ctx, sync.collection, mongodb.StringIDs(sync.ids)); err != nil {
+			t.Fatalf("SyncCollection(%s) returned error: %v", sync.collection, err)
+		}
+	}
+
+	var links int
+	err := svc.mariaDB.DB().QueryRow(`
+		SELECT COUNT(*) FROM expense_automatic_workflow_expense l
+		JOIN expense_automatic_workflow w ON w.id = l.expense_automatic_workflow_id
+		JOIN expense e ON e.id = l.expense_id
+		WHERE w.source_id = 'eaw-1' AND e.name = 'Notebook' AND l.match_method = ?`,
+		models.WorkflowMatchExplicit).Scan(&links)
+	if err != nil {
+		t.Fatalf("failed to count workflow links: %v", err)
+	}
+	if links != 1 {
+		t.Errorf("installment expense has %d explicit workflow links, want 1", links)
+	}
+}
+
+// TestEraseUserDeletesUnreferencedImages tests that erasing a user deletes its receipt images
+// from the blob store, except the ones a workflow of another user still references
+func TestEraseUserDeletesUnreferencedImages(t *testing.T) {
+	svc, mongoDB := newIntegrationService(t)
+	ctx := context.Background()
+
+	shared := base64.StdEncoding.EncodeToString([]byte("shared receipt"))
+	own := base64.StdEncoding.EncodeToString([]byte("own receipt"))
+	docs := map[string][]interface{}{
+		"users": {
+			bson.M{"_id": "user-1", "email": "ana@example.com", "name": "Ana"},
+			bson.M{"_id": "user-2", "email": "bia@example.com", "name": "Bia"},
+		},
+		"expense_automatic_workflow": {
+			bson.M{"_id": "eaw-1", "user": "user-1", "base64_image": shared},
+			bson.M{"_id": "eaw-2", "user": "user-1", "base64_image": own},
+			bson.M{"_id": "eaw-3", "user": "user-2", "base64_image": shared},
+		},
+	}
+	for _, collection := range []string{"users", "expense_automatic_workflow"} {
+		if _, err := mongoDB.Collection(collection).InsertMany(ctx, docs[collection]); err != nil {
+			t.Fatalf("failed to insert into %s: %v", collection, err)
+		}
+	}
+	if err := svc.SyncCollection(ctx, "users", mongodb.StringIDs([]string{"user-1", "user-2"})); err != nil {
+		t.Fatalf("SyncCollection(users) returned error: %v", err)
+	}
+	if err := svc.SyncCollection(ctx, "expense_automatic_workflow", mongodb.StringIDs([]string{"eaw-1", "eaw-2", "eaw-3"})); err != nil {
+		t.Fatalf("SyncCollection(expense_automatic_workflow) returned error: %v", err)
+	}
+
+	receipt, err := svc.EraseUser(ctx, "user-1", "test")
+	if err != nil {
+		t.Fatalf("EraseUser() returned error: %v", err)
+	}
+	if receipt.Status != models.ErasureStatusCompleted || receipt.BlobsDeleted != 1 {
+		t.Errorf("receipt status = %s, blobs deleted = %d, want completed and 1", receipt.Status, receipt.BlobsDeleted)
+	}
+
+	for _, c := range []struct {
+		content string
+		want    bool
+	}{{"shared receipt", true}, {"own receipt", false}} {
+		exists, err := svc.blobs.Exists(ctx, blobstore.Key([]byte(c.content)))
+		if err != nil || exists != c.want {
+			t.Errorf("blob of %q exists = %v, %v, want %v", c.content, exists, err, c.want)
+		}
+	}
+}
+
+// TestMonthSummaryInBaseCurrency tests that the month summary adds up base-currency amounts
+// and counts the expenses without an exchange rate apart instead of mixing them in
+func TestMonthSummaryInBaseCurrency(t *testing.T) {
+	svc, mongoDB := newIntegrationService(t)
+	ctx := context.Background()
+
+	docs := map[string][]interface{}{
+		"users": {bson.M{"_id": "user-1", "email": "ana@example.com", "name": "Ana"}},
+		"expenses": {
+			bson.M{"_id": "exp-1", "user": "user-1", "expenseName": "Rent", "type": "expense", "status": "pending",
+				"amount": 100.0, "spendingDate": "2026-03-01T03:00:00Z"},
+			bson.M{"_id": "exp-2", "user": "user-1", "expenseName": "Hotel", "type": "expense", "status": "pending",
+				"amount": 50.0, "currency": "USD", "spendingDate": "2026-03-01T03:00:00Z"},
+		},
+	}
+	for _, collection := range []string{"users", "expenses"} {
+		if _, err := mongoDB.Collection(collection).InsertMany(ctx, docs[collection]); err != nil {
+			t.Fatalf("failed to insert into %s: %v", collection, err)
+		}
+	}
+	if err := svc.SyncCollection(ctx, "users", mongodb.StringIDs([]string{"user-1"})); err != nil {
+		t.Fatalf("SyncCollection(users) returned error: %v", err)
+	}
+	if err := svc.SyncCollection(ctx, "expenses", mongodb.StringIDs([]string{"exp-1", "exp-2"})); err != nil {
+		t.Fatalf("SyncCollection(expenses) returned error: %v", err)
+	}
+
+	var total float64
+	var count, unconverted int
+	err := svc.mariaDB.DB().QueryRow(`
+		SELECT s.total_expense_amount, s.expense_count, s.unconverted_expense_count
+		FROM user_month_summary s JOIN user u ON u.id = s.user_id
+		WHERE u.source_id = 'user-1' AND s.spending_date__YYYY_MM = '2026/03'`).Scan(&total, &count, &unconverted)
+	if err != nil {
+		t.Fatalf("failed to read the month summary: %v", err)
+	}
+	if total != 100 || count != 2 || unconverted != 1 {
+		t.Errorf("summary total = %v, count = %d, unconverted = %d, want 100 from 2 expenses with 1 unconverted", total, count, unconverted)
+	}
+}
@@ -1,9 +1,14 @@
 package ingestion
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/dates"
+	"github.com/porcool/ingestion/internal/validation"
 )
 
 func TestNewService(t *testing.T) {
@@ -11,9 +16,13 @@ func TestNewService(t *testing.T) {
 		Ingestion: config.IngestionConfig{
 			BatchSize: 100,
 		},
+		BlobStore: config.BlobStoreConfig{LocalDir: t.TempDir()},
 	}
 
-	svc := NewService(nil, nil, cfg)
+	svc, err := NewService(nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
 
 	if svc == nil {
 		t.Error("NewService() returned nil")
@@ -24,6 +33,77 @@ func TestNewService(t *testing.T) {
 	}
 }
 
+func TestNewServiceBlobStore(t *testing.T) {
+	cfg := &config.Config{BlobStore: config.BlobStoreConfig{Driver: "ftp"}}
+	if _, err := NewService(nil, nil, cfg); err == nil {
+		t.Error("NewService() should fail when the blob store cannot be initialized")
+	}
+}
+
+func TestNewServiceBusinessTimezone(t *testing.T) {
+	blobStore := config.BlobStoreConfig{LocalDir: t.TempDir()}
+	cfg := &config.Config{Dates: config.DatesConfig{BusinessTimezone: "America/Sao_Paulo"}, BlobStore: blobStore}
+	svc, err := NewService(nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	if svc.dates.Location().String() != "America/Sao_Paulo" {
+		t.Errorf("business timezone = %s, want America/Sao_Paulo", svc.dates.Location())
+	}
+
+	cfg = &config.Config{Dates: config.DatesConfig{BusinessTimezone: "Not/AZone"}, BlobStore: blobStore}
+	if _, err := NewService(nil, nil, cfg); err == nil {
+		t.Error("NewService() should reject an invalid business timezone")
+	}
+}
+
+// TestOptionalMonth tests that missing spending dates are allowed but malformed ones are not
+func TestOptionalMonth(t *testing.T) {
+	svc, err := NewService(nil, nil, &config.Config{
+		Dates:     config.DatesConfig{BusinessTimezone: "America/Sao_Paulo"},
+		BlobStore: config.BlobStoreConfig{LocalDir: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	if month, err := svc.optionalMonth(""); err != nil || month != "" {
+		t.Errorf("optionalMonth(\"\") = %q, %v, want empty and no error", month, err)
+	}
+	if month, err := svc.optionalMonth(nil); err != nil || month != "" {
+		t.Errorf("optionalMonth(nil) = %q, %v, want empty and no error", month, err)
+	}
+	if month, err := svc.optionalMonth("2026-03-01T03:00:00Z"); err != nil || month != "2026/03" {
+		t.Errorf("optionalMonth(2026-03-01T03:00:00Z) = %q, %v, want 2026/03", month, err)
+	}
+	if _, err := svc.optionalMonth("2023"); !errors.Is(err, dates.ErrAmbiguous) {
+		t.Errorf("optionalMonth(2023) error = %v, want ErrAmbiguous", err)
+	}
+}
+
+// TestRejectedError tests that only rejected documents are quarantined
+func TestRejectedError(t *testing.T) {
+	svc, err := NewService(nil, nil, &config.Config{BlobStore: config.BlobStoreConfig{LocalDir: t.TempDir()}})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	err = &rejectedError{violation: validation.Violation{Field: "status", Rule: "domain", Message: "unknown domain value"}}
+	if err.Error() != "status: unknown domain value (domain)" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	if svc.quarantineRejected(context.Background(), "expenses", "e1", errors.New("connection refused")) {
+		t.Error("quarantineRejected() should not quarantine documents for other errors")
+	}
+
+	// Empty domain values resolve to NULL without touching the registry
+	id, err := svc.resolveDomain("status", "", "id_status", "expense")
+	if err != nil || id.Valid {
+		t.Errorf("resolveDomain(\"\") = %+v, %v, want NULL and no error", id, err)
+	}
+}
+
 func TestConfig_IngestionConfig(t *testing.T) {
 	cfg := config.IngestionConfig{
 		BatchSize: 50,
@@ -81,201 +161,6 @@ func TestConfig_RabbitMQConfig(t *testing.T) {
 	}
 }
 
-func TestExtractDocIDs(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    interface{}
-		expected []string
-	}{
-		{
-			name:     "slice of interface with strings",
-			input:    []interface{}{"doc1", "doc2", "doc3"},
-			expected: []string{"doc1", "doc2", "doc3"},
-		},
-		{
-			name:     "slice of strings",
-			input:    []string{"doc1", "doc2"},
-			expected: []string{"doc1", "doc2"},
-		},
-		{
-			name:     "single string",
-			input:    "doc1",
-			expected: []string{"doc1"},
-		},
-		{
-			name:     "nil",
-			input:    nil,
-			expected: nil,
-		},
-		{
-			name:     "empty slice",
-			input:    []interface{}{},
-			expected: nil,
-		},
-		{
-			name:     "mixed types in slice",
-			input:    []interface{}{"doc1", 123, "doc2"},
-			expected: []string{"doc1", "doc2"},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := extractDocIDs(tt.input)
-
-			if len(result) != len(tt.expected) {
-				t.Errorf("extractDocIDs() returned %d items, want %d", len(result), len(tt.expected))
-				return
-			}
-
-			for i, id := range result {
-				if id != tt.expected[i] {
-					t.Errorf("extractDocIDs()[%d] = %s, want %s", i, id, tt.expected[i])
-				}
-			}
-		})
-	}
-}
-
-// TestFormatSpendingDate tests the formatSpendingDate function
-// which converts various date formats to the standard YYYY/MM format for MariaDB
-func TestFormatSpendingDate(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "empty string",
-			input:    "",
-			expected: "",
-		},
-		{
-			name:     "YYYYMM format",
-			input:    "202312",
-			expected: "2023/12",
-		},
-		{
-			name:     "YYYY-MM format",
-			input:    "2023-12",
-			expected: "2023/12",
-		},
-		{
-			name:     "YYYY/MM format already correct",
-			input:    "2023/12",
-			expected: "2023/12",
-		},
-		{
-			name:     "YYYYMM format with leading zeros",
-			input:    "202301",
-			expected: "2023/01",
-		},
-		{
-			name:     "YYYY-MM format January",
-			input:    "2024-01",
-			expected: "2024/01",
-		},
-		{
-			name:     "short invalid format returns as-is",
-			input:    "2023",
-			expected: "2023",
-		},
-		{
-			name:     "ISO format with time (validity field format)",
-			input:    "2026-03-01T03:00:00Z",
-			expected: "2026/03",
-		},
-		{
-			name:     "ISO format with date only",
-			input:    "2026-03-01",
-			expected: "2026/03",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := formatSpendingDate(tt.input)
-			if result != tt.expected {
-				t.Errorf("formatSpendingDate(%q) = %q, want %q", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
-
-// TestParseSpendingDateToTime tests the parseSpendingDateToTime function
-func TestParseSpendingDateToTime(t *testing.T) {
-	tests := []struct {
-		name        string
-		input       string
-		expectError bool
-		expectYear  int
-		expectMonth int
-	}{
-		{
-			name:        "empty string",
-			input:       "",
-			expectError: true,
-		},
-		{
-			name:        "YYYY/MM format",
-			input:       "2023/12",
-			expectError: false,
-			expectYear:  2023,
-			expectMonth: 12,
-		},
-		{
-			name:        "YYYY-MM format",
-			input:       "2023-12",
-			expectError: false,
-			expectYear:  2023,
-			expectMonth: 12,
-		},
-		{
-			name:        "invalid format",
-			input:       "2023",
-			expectError: true,
-		},
-		{
-			name:        "YYYY/MM January",
-			input:       "2024/01",
-			expectError: false,
-			expectYear:  2024,
-			expectMonth: 1,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result, err := parseSpendingDateToTime(tt.input)
-
-			if tt.expectError {
-				if err == nil {
-					t.Errorf("parseSpendingDateToTime(%q) expected error, got nil", tt.input)
-				}
-				return
-			}
-
-			if err != nil {
-				t.Errorf("parseSpendingDateToTime(%q) unexpected error: %v", tt.input, err)
-				return
-			}
-
-			if result.Year() != tt.expectYear {
-				t.Errorf("parseSpendingDateToTime(%q) year = %d, want %d", tt.input, result.Year(), tt.expectYear)
-			}
-
-			if int(result.Month()) != tt.expectMonth {
-				t.Errorf("parseSpendingDateToTime(%q) month = %d, want %d", tt.input, result.Month(), tt.expectMonth)
-			}
-
-			// Day should always be 1
-			if result.Day() != 1 {
-				t.Errorf("parseSpendingDateToTime(%q) day = %d, want 1", tt.input, result.Day())
-			}
-		})
-	}
-}
-
 // TestAddMonths tests the addMonths function
 func TestAddMonths(t *testing.T) {
 	tests := []struct {
@@ -410,3 +295,17 @@ func TestServiceName(t *testing.T) {
 		t.Errorf("serviceName = %q, want %q", serviceName, expectedName)
 	}
 }
+
+func TestMissingIDList(t *testing.T) {
+	if got := missingIDList([]string{"a", "b"}); got != "a, b" {
+		t.Errorf("missingIDList() = %q, want a, b", got)
+	}
+
+	ids := make([]string, maxLoggedMissingIDs+3)
+	for i := range ids {
+		ids[i] = "x"
+	}
+	if got := missingIDList(ids); !strings.HasSuffix(got, "x and 3 more") {
+		t.Errorf("missingIDList() = %q, want the list cut after %d IDs", got, maxLoggedMissingIDs)
+	}
+}
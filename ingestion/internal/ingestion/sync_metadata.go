@@ -0,0 +1,65 @@
+package ingestion
+
+import (
+	"log"
+	"time"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/dates"
+)
+
+// syncMetadataEntry is an entry of the syncMetadata array of a settings document
+type syncMetadataEntry struct {
+	Name               string
+	LatestSyncDatetime time.Time
+}
+
+// parseSyncMetadata parses the syncMetadata array of a settings document. Each entry is a
+// map with a name and a latestSyncDatetime. Entries without a name are skipped; entries that
+// are not maps or whose datetime cannot be parsed are logged and skipped, so one bad entry
+// does not hold back the others.
+func parseSyncMetadata(settingsID string, value []interface{}, normalizer *dates.Normalizer) []syncMetadataEntry {
+	var entries []syncMetadataEntry
+	for i, raw := range value {
+		m, ok := plainValue(raw).(map[string]interface{})
+		if !ok {
+			log.Printf("Warning: skipping syncMetadata entry %d of system settings %s: unexpected type %T", i, settingsID, raw)
+			continue
+		}
+
+		name, _ := m["name"].(string)
+		if name == "" {
+			continue
+		}
+
+		t, err := normalizer.Time(m["latestSyncDatetime"])
+		if err != nil {
+			log.Printf("Warning: skipping syncMetadata entry %s of system settings %s: invalid latestSyncDatetime: %v", name, settingsID, err)
+			continue
+		}
+		entries = append(entries, syncMetadataEntry{Name: name, LatestSyncDatetime: t})
+	}
+	return entries
+}
+
+// syncServiceName returns the name this service records its syncs under
+func (s *Service) syncServiceName() string {
+	if s.cfg.Firebase.SyncMetadataServiceName != "" {
+		return s.cfg.Firebase.SyncMetadataServiceName
+	}
+	return "porcool-ingestion-non-relational-db-to-relational-db"
+}
+
+// recordSync stores the outcome of an ingestion message in sync_metadata. Failures are only
+// logged, the sync itself already succeeded or failed on its own.
+func (s *Service) recordSync(status string, documents int, syncErr error) {
+	errMsg := ""
+	if syncErr != nil {
+		errMsg = syncErr.Error()
+	}
+
+	repo := mariadb.NewSyncMetadataRepository(s.mariaDB)
+	if err := repo.RecordSync(s.syncServiceName(), status, documents, errMsg, time.Now()); err != nil {
+		log.Printf("Warning: failed to record sync metadata: %v", err)
+	}
+}
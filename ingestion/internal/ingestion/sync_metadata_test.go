@@ -0,0 +1,56 @@
+package ingestion
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/porcool/ingestion/internal/dates"
+)
+
+func TestParseSyncMetadata(t *testing.T) {
+	normalizer := dates.NewNormalizer(time.UTC)
+	synced := time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	value := []interface{}{
+		primitive.D{
+			{Key: "name", Value: "porcool-ingestion-non-relational-db-to-relational-db"},
+			{Key: "latestSyncDatetime", Value: "2024-03-10T12:30:00Z"},
+		},
+		map[string]interface{}{
+			"name":               "porcool-firestore-backup",
+			"latestSyncDatetime": primitive.NewDateTimeFromTime(synced),
+		},
+		map[string]interface{}{"latestSyncDatetime": "2024-03-10T12:30:00Z"},
+	}
+
+	entries := parseSyncMetadata("settings-1", value, normalizer)
+	if len(entries) != 2 {
+		t.Fatalf("parseSyncMetadata() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].Name != "porcool-ingestion-non-relational-db-to-relational-db" {
+		t.Errorf("entries[0].Name = %q", entries[0].Name)
+	}
+	for _, e := range entries {
+		if !e.LatestSyncDatetime.Equal(synced) {
+			t.Errorf("%s: LatestSyncDatetime = %v, want %v", e.Name, e.LatestSyncDatetime, synced)
+		}
+	}
+}
+
+func TestParseSyncMetadataSkipsInvalidEntries(t *testing.T) {
+	normalizer := dates.NewNormalizer(time.UTC)
+
+	value := []interface{}{
+		"item1",
+		map[string]interface{}{"name": "yesterday-svc", "latestSyncDatetime": "yesterday"},
+		map[string]interface{}{"name": "missing-svc"},
+		map[string]interface{}{"name": "svc", "latestSyncDatetime": "2024-03-10T12:30:00Z"},
+	}
+
+	entries := parseSyncMetadata("settings-1", value, normalizer)
+	if len(entries) != 1 || entries[0].Name != "svc" {
+		t.Errorf("parseSyncMetadata() = %+v, want only the valid svc entry", entries)
+	}
+}
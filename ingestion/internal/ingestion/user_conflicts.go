@@ -0,0 +1,127 @@
+package ingestion
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/logging"
+	"github.com/porcool/ingestion/internal/models"
+	"github.com/porcool/ingestion/internal/validation"
+)
+
+// renamedEmail returns the email given to a stale user by the rename policy. It is derived
+// from the user's GUID, so it is unique and stable, and the .invalid domain never delivers.
+func renamedEmail(guid string) string {
+	return fmt.Sprintf("stale-%s@invalid", guid)
+}
+
+// emailConflictViolation returns the violation a user is quarantined with by the fail policy
+func emailConflictViolation(staleSourceID string) validation.Violation {
+	return validation.Violation{
+		Field:   "email",
+		Rule:    "unique",
+		Message: fmt.Sprintf("email already used by user %s", staleSourceID),
+	}
+}
+
+// isMergedAlias reports whether the incoming user was merged into another one. Its document
+// is then an alias of the kept user and must not be stored again, or the next sync of the
+// kept user would merge them back.
+func isMergedAlias(sourceID string, resolved *models.User) bool {
+	return resolved != nil && resolved.SourceID != sourceID
+}
+
+// resolveEmailConflict applies the email conflict policy before a user is upserted. A
+// conflict is another user holding the incoming email under a different source_id, usually
+// an account deleted and recreated in Firestore. It returns skip when the incoming user is
+// an alias of a merged user, and a rejectedError when the fail policy rejects it. Every
+// conflict is recorded in user_email_conflict.
+func (s *Service) resolveEmailConflict(repo *mariadb.UserRepository, user *models.User) (skip bool, err error) {
+	incoming, err := repo.GetUserBySourceID(user.SourceID)
+	if err != nil {
+		return false, err
+	}
+	if isMergedAlias(user.SourceID, incoming) {
+		log.Printf("Skipping user %s: merged into user %s", user.SourceID, incoming.SourceID)
+		return true, nil
+	}
+
+	stale, err := repo.GetUserByEmail(user.Email)
+	if err != nil {
+		return false, err
+	}
+	if stale == nil || stale.SourceID == user.SourceID {
+		return false, nil
+	}
+
+	policy := s.cfg.Users.EmailConflictPolicy
+	conflict := &models.UserEmailConflict{
+		Email:            user.Email,
+		IncomingSourceID: user.SourceID,
+		StaleUserID:      stale.ID,
+		StaleSourceID:    stale.SourceID,
+		Policy:           policy,
+	}
+
+	var rejected error
+	switch policy {
+	case config.EmailConflictRename:
+		email := renamedEmail(stale.GUID)
+		if err := repo.RenameEmail(stale.ID, email); err != nil {
+			return false, err
+		}
+		conflict.Resolution = models.EmailConflictRenamed
+		conflict.RenamedEmail = sql.NullString{String: email, Valid: true}
+
+	case config.EmailConflictMerge:
+		keptID := stale.ID
+		if incoming == nil {
+			// Nothing to move: the stale row becomes the incoming user
+			if err := repo.AdoptUser(stale.ID, user.SourceID); err != nil {
+				return false, err
+			}
+		} else {
+			moved, err := repo.MergeUsers(stale.ID, incoming.ID)
+			if err != nil {
+				return false, err
+			}
+			keptID = incoming.ID
+			conflict.MovedRows = moved
+		}
+		conflict.Resolution = models.EmailConflictMerged
+		conflict.KeptUserID = sql.NullInt64{Int64: keptID, Valid: true}
+
+	default:
+		conflict.Resolution = models.EmailConflictFailed
+		rejected = &rejectedError{violation: emailConflictViolation(stale.SourceID)}
+	}
+
+	if err := mariadb.NewUserEmailConflictRepository(s.mariaDB).RecordConflict(conflict); err != nil {
+		return false, err
+	}
+	log.Printf("Email conflict on %s: user %s vs %s, %s", logging.MaskEmail(user.Email), user.SourceID, stale.SourceID, conflict.Resolution)
+
+	if conflict.Resolution == models.EmailConflictMerged && conflict.MovedRows > 0 {
+		s.refreshUserSummaries(conflict.KeptUserID.Int64)
+	}
+	return false, rejected
+}
+
+// refreshUserSummaries refreshes every month summary of a user, after rows of another user
+// were moved to it
+func (s *Service) refreshUserSummaries(userID int64) {
+	months, err := mariadb.NewUserMonthSummaryRepository(s.mariaDB).GetUserMonths(userID)
+	if err != nil {
+		log.Printf("Warning: failed to list months of user %d: %v", userID, err)
+		return
+	}
+
+	touched := userMonths{}
+	for i := range months {
+		touched.addExisting(&months[i])
+	}
+	s.refreshMonthSummaries(touched)
+}
@@ -0,0 +1,160 @@
+//go:build integration
+
+package ingestion
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// storeUser upserts a user into MariaDB
+func storeUser(t *testing.T, repo *mariadb.UserRepository, sourceID, email string) *models.User {
+	t.Helper()
+	user := &models.User{SourceID: sourceID, FirstName: "Ana", Email: email}
+	if err := repo.UpsertUser(user); err != nil {
+		t.Fatalf("UpsertUser(%s) returned error: %v", sourceID, err)
+	}
+	return user
+}
+
+// conflictResolution returns the resolution recorded for the only email conflict
+func conflictResolution(t *testing.T, svc *Service) string {
+	t.Helper()
+	var resolution string
+	var count int
+	err := svc.mariaDB.DB().QueryRow("SELECT COUNT(*), COALESCE(MAX(resolution), '') FROM user_email_conflict").Scan(&count, &resolution)
+	if err != nil {
+		t.Fatalf("failed to read email conflicts: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("%d email conflicts recorded, want 1", count)
+	}
+	return resolution
+}
+
+// TestEmailConflictFailPolicy tests that the fail policy rejects the incoming user and
+// leaves the stale user untouched
+func TestEmailConflictFailPolicy(t *testing.T) {
+	svc, _ := newIntegrationService(t)
+	svc.cfg.Users.EmailConflictPolicy = config.EmailConflictFail
+	repo := mariadb.NewUserRepository(svc.mariaDB)
+	storeUser(t, repo, "user-old", "ana@example.com")
+
+	skip, err := svc.resolveEmailConflict(repo, &models.User{SourceID: "user-new", FirstName: "Ana", Email: "ana@example.com"})
+	var rejected *rejectedError
+	if skip || !errors.As(err, &rejected) {
+		t.Fatalf("resolveEmailConflict() = %v, %v, want a rejected user", skip, err)
+	}
+	if rejected.violation != emailConflictViolation("user-old") {
+		t.Errorf("violation = %+v, want %+v", rejected.violation, emailConflictViolation("user-old"))
+	}
+
+	stale, err := repo.GetUserBySourceID("user-old")
+	if err != nil || stale == nil || stale.Email != "ana@example.com" {
+		t.Errorf("stale user = %+v, %v, want it to keep its email", stale, err)
+	}
+	if resolution := conflictResolution(t, svc); resolution != models.EmailConflictFailed {
+		t.Errorf("conflict resolution = %s, want %s", resolution, models.EmailConflictFailed)
+	}
+}
+
+// TestEmailConflictRenamePolicy tests that the rename policy frees the email for the
+// incoming user by renaming the stale user
+func TestEmailConflictRenamePolicy(t *testing.T) {
+	svc, _ := newIntegrationService(t)
+	svc.cfg.Users.EmailConflictPolicy = config.EmailConflictRename
+	repo := mariadb.NewUserRepository(svc.mariaDB)
+	stale := storeUser(t, repo, "user-old", "ana@example.com")
+
+	incoming := &models.User{SourceID: "user-new", FirstName: "Ana", Email: "ana@example.com"}
+	skip, err := svc.resolveEmailConflict(repo, incoming)
+	if skip || err != nil {
+		t.Fatalf("resolveEmailConflict() = %v, %v, want the user to be stored", skip, err)
+	}
+	if err := repo.UpsertUser(incoming); err != nil {
+		t.Fatalf("UpsertUser() after renaming returned error: %v", err)
+	}
+
+	renamed, err := repo.GetUserBySourceID("user-old")
+	if err != nil || renamed == nil || renamed.Email != renamedEmail(stale.GUID) {
+		t.Errorf("stale user = %+v, %v, want email %s", renamed, err, renamedEmail(stale.GUID))
+	}
+	if resolution := conflictResolution(t, svc); resolution != models.EmailConflictRenamed {
+		t.Errorf("conflict resolution = %s, want %s", resolution, models.EmailConflictRenamed)
+	}
+}
+
+// TestEmailConflictMergePolicy tests that the merge policy moves the stale user's rows to
+// the incoming user and drops the stale user
+func TestEmailConflictMergePolicy(t *testing.T) {
+	svc, _ := newIntegrationService(t)
+	svc.cfg.Users.EmailConflictPolicy = config.EmailConflictMerge
+	repo := mariadb.NewUserRepository(svc.mariaDB)
+	stale := storeUser(t, repo, "user-old", "ana@example.com")
+	kept := storeUser(t, repo, "user-new", "ana.new@example.com")
+
+	_, err := svc.mariaDB.DB().Exec("INSERT INTO financial_institution (guid, source_id, user_id, name) VALUES ('fi1', 'bank-1', ?, 'Bank')", stale.ID)
+	if err != nil {
+		t.Fatalf("failed to insert bank of the stale user: %v", err)
+	}
+
+	skip, err := svc.resolveEmailConflict(repo, &models.User{SourceID: "user-new", FirstName: "Ana", Email: "ana@example.com"})
+	if skip || err != nil {
+		t.Fatalf("resolveEmailConflict() = %v, %v, want the user to be stored", skip, err)
+	}
+
+	if user, err := repo.GetUserByGUID(stale.GUID); err != nil || user != nil {
+		t.Errorf("stale user = %+v, %v, want it merged away", user, err)
+	}
+	var owner int64
+	if err := svc.mariaDB.DB().QueryRow("SELECT user_id FROM financial_institution WHERE source_id = 'bank-1'").Scan(&owner); err != nil {
+		t.Fatalf("failed to read bank owner: %v", err)
+	}
+	if owner != kept.ID {
+		t.Errorf("bank owned by user %d, want the kept user %d", owner, kept.ID)
+	}
+
+	var moved int64
+	var keptID int64
+	if err := svc.mariaDB.DB().QueryRow("SELECT moved_rows, kept_user_id FROM user_email_conflict").Scan(&moved, &keptID); err != nil {
+		t.Fatalf("failed to read email conflict: %v", err)
+	}
+	if moved != 1 || keptID != kept.ID {
+		t.Errorf("conflict moved %d rows to user %d, want 1 to user %d", moved, keptID, kept.ID)
+	}
+	if resolution := conflictResolution(t, svc); resolution != models.EmailConflictMerged {
+		t.Errorf("conflict resolution = %s, want %s", resolution, models.EmailConflictMerged)
+	}
+
+	// The stale user's document is now an alias of the kept user and is not stored again
+	skip, err = svc.resolveEmailConflict(repo, &models.User{SourceID: "user-old", FirstName: "Ana", Email: "ana@example.com"})
+	if !skip || err != nil {
+		t.Errorf("resolveEmailConflict() of the merged user = %v, %v, want it skipped", skip, err)
+	}
+}
+
+// TestEmailConflictMergeAdoptsStaleUser tests that the merge policy hands the stale row to
+// an incoming user that is not stored yet
+func TestEmailConflictMergeAdoptsStaleUser(t *testing.T) {
+	svc, _ := newIntegrationService(t)
+	svc.cfg.Users.EmailConflictPolicy = config.EmailConflictMerge
+	repo := mariadb.NewUserRepository(svc.mariaDB)
+	stale := storeUser(t, repo, "user-old", "ana@example.com")
+
+	skip, err := svc.resolveEmailConflict(repo, &models.User{SourceID: "user-new", FirstName: "Ana", Email: "ana@example.com"})
+	if skip || err != nil {
+		t.Fatalf("resolveEmailConflict() = %v, %v, want the user to be stored", skip, err)
+	}
+
+	adopted, err := repo.GetUserBySourceID("user-new")
+	if err != nil || adopted == nil || adopted.ID != stale.ID {
+		t.Errorf("user-new = %+v, %v, want the stale row %d", adopted, err, stale.ID)
+	}
+	if resolution := conflictResolution(t, svc); resolution != models.EmailConflictMerged {
+		t.Errorf("conflict resolution = %s, want %s", resolution, models.EmailConflictMerged)
+	}
+}
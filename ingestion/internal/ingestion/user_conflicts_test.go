@@ -0,0 +1,39 @@
+package ingestion
+
+import (
+	"testing"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+func TestRenamedEmail(t *testing.T) {
+	got := renamedEmail("0b6f2c4e-7a1d-4c2b-9f3e-5d8a1b2c3d4e")
+	if got != "stale-0b6f2c4e-7a1d-4c2b-9f3e-5d8a1b2c3d4e@invalid" {
+		t.Errorf("renamedEmail() = %q", got)
+	}
+}
+
+func TestEmailConflictViolation(t *testing.T) {
+	v := emailConflictViolation("user-1")
+	if v.Field != "email" || v.Rule != "unique" || v.Message != "email already used by user user-1" {
+		t.Errorf("emailConflictViolation() = %+v", v)
+	}
+}
+
+func TestIsMergedAlias(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolved *models.User
+		want     bool
+	}{
+		{"not stored", nil, false},
+		{"stored under its own source_id", &models.User{SourceID: "user-1"}, false},
+		{"merged into another user", &models.User{SourceID: "user-2"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := isMergedAlias("user-1", tt.resolved); got != tt.want {
+			t.Errorf("%s: isMergedAlias() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
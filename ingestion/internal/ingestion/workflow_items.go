@@ -0,0 +1,187 @@
+package ingestion
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/porcool/ingestion/internal/currency"
+	"github.com/porcool/ingestion/internal/dates"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// plainValue converts BSON containers decoded into interface{} (primitive.A, primitive.D,
+// primitive.M) into plain slices and maps, so they marshal to readable JSON
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.A:
+		return plainValue([]interface{}(v))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = plainValue(item)
+		}
+		return out
+	case primitive.D:
+		out := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			out[e.Key] = plainValue(e.Value)
+		}
+		return out
+	case primitive.M:
+		return plainValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = plainValue(item)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// parseWorkflowItems parses extracted_expense_content_from_image into line items.
+//
+// The known shape is an array (or a JSON string holding an array) of objects with storeName,
+// spendingAmount, spendingCurrency, spendingDate, rawText and an optional confidence between
+// 0 and 1. Empty content returns no items. Any other shape returns an error, in which case no
+// items are stored and only the raw JSON is kept.
+func parseWorkflowItems(content interface{}, normalizer *dates.Normalizer) ([]models.ExpenseAutomaticWorkflowItem, error) {
+	content = plainValue(content)
+
+	if s, ok := content.(string); ok {
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(s), &content); err != nil {
+			return nil, fmt.Errorf("content is not valid JSON: %w", err)
+		}
+	}
+
+	if content == nil {
+		return nil, nil
+	}
+
+	entries, ok := content.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("content is a %T, want an array of items", content)
+	}
+
+	items := make([]models.ExpenseAutomaticWorkflowItem, 0, len(entries))
+	for i, entry := range entries {
+		item, err := parseWorkflowItem(entry, normalizer)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i+1, err)
+		}
+		item.Position = i + 1
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseWorkflowItem parses a single extracted item
+func parseWorkflowItem(entry interface{}, normalizer *dates.Normalizer) (models.ExpenseAutomaticWorkflowItem, error) {
+	var item models.ExpenseAutomaticWorkflowItem
+
+	fields, ok := entry.(map[string]interface{})
+	if !ok {
+		return item, fmt.Errorf("item is a %T, want an object", entry)
+	}
+
+	name, err := optionalString(fields, "storeName")
+	if err != nil {
+		return item, err
+	}
+	amount, hasAmount, err := optionalNumber(fields, "spendingAmount")
+	if err != nil {
+		return item, err
+	}
+	if name == "" && !hasAmount {
+		return item, fmt.Errorf("item has neither storeName nor spendingAmount")
+	}
+
+	item.Name = sql.NullString{String: name, Valid: name != ""}
+	item.Amount = sql.NullFloat64{Float64: amount, Valid: hasAmount}
+
+	currencyCode, err := optionalString(fields, "spendingCurrency")
+	if err != nil {
+		return item, err
+	}
+	if code := currency.NormalizeCode(currencyCode); len(code) == 3 {
+		item.CurrencyCode = sql.NullString{String: code, Valid: true}
+	}
+
+	// OCR dates are often ambiguous (e.g. 03/04/2024), so an unparseable date is left empty
+	// instead of rejecting the item; the original text is still in rawText and the raw JSON
+	if value, found := fields["spendingDate"]; found && !dates.IsEmpty(value) {
+		if t, err := normalizer.Date(value); err == nil {
+			item.ItemDate = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	confidence, hasConfidence, err := optionalNumber(fields, "confidence")
+	if err != nil {
+		return item, err
+	}
+	if hasConfidence && (confidence < 0 || confidence > 1) {
+		return item, fmt.Errorf("confidence must be between 0 and 1, got %v", confidence)
+	}
+	item.Confidence = sql.NullFloat64{Float64: confidence, Valid: hasConfidence}
+
+	rawText, err := optionalString(fields, "rawText")
+	if err != nil {
+		return item, err
+	}
+	item.RawText = sql.NullString{String: rawText, Valid: rawText != ""}
+
+	return item, nil
+}
+
+// optionalString returns a trimmed string field, or "" when it is missing or null
+func optionalString(fields map[string]interface{}, key string) (string, error) {
+	switch v := fields[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	default:
+		return "", fmt.Errorf("%s is a %T, want a string", key, v)
+	}
+}
+
+// optionalNumber returns a numeric field, accepting numbers and numeric strings.
+// The second return value is false when the field is missing, null or empty.
+func optionalNumber(fields map[string]interface{}, key string) (float64, bool, error) {
+	switch v := fields[key].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return v, true, nil
+	case float32:
+		return float64(v), true, nil
+	case int:
+		return float64(v), true, nil
+	case int32:
+		return float64(v), true, nil
+	case int64:
+		return float64(v), true, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0, false, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%s %q is not a number", key, v)
+		}
+		return f, true, nil
+	default:
+		return 0, false, fmt.Errorf("%s is a %T, want a number", key, v)
+	}
+}
@@ -0,0 +1,114 @@
+package ingestion
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/porcool/ingestion/internal/dates"
+)
+
+func TestParseWorkflowItems(t *testing.T) {
+	normalizer := dates.NewNormalizer(time.UTC)
+
+	content := primitive.A{
+		primitive.D{
+			{Key: "storeName", Value: "Supermercado"},
+			{Key: "spendingAmount", Value: 152.3},
+			{Key: "spendingCurrency", Value: "brl"},
+			{Key: "spendingDate", Value: "2024-03-15"},
+			{Key: "confidence", Value: 0.92},
+			{Key: "rawText", Value: "SUPERMERCADO 152,30"},
+		},
+		primitive.D{
+			{Key: "storeName", Value: "Padaria"},
+			{Key: "spendingAmount", Value: "12.5"},
+			{Key: "spendingDate", Value: "15/03/2024"},
+		},
+	}
+
+	items, err := parseWorkflowItems(content, normalizer)
+	if err != nil {
+		t.Fatalf("parseWorkflowItems() returned error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("parseWorkflowItems() returned %d items, want 2", len(items))
+	}
+
+	first := items[0]
+	if first.Position != 1 || first.Name.String != "Supermercado" || first.Amount.Float64 != 152.3 {
+		t.Errorf("items[0] = %+v", first)
+	}
+	if first.CurrencyCode.String != "BRL" {
+		t.Errorf("items[0].CurrencyCode = %v, want BRL", first.CurrencyCode)
+	}
+	if !first.ItemDate.Valid || first.ItemDate.Time.Format("2006-01-02") != "2024-03-15" {
+		t.Errorf("items[0].ItemDate = %v, want 2024-03-15", first.ItemDate)
+	}
+	if !first.Confidence.Valid || first.Confidence.Float64 != 0.92 {
+		t.Errorf("items[0].Confidence = %v, want 0.92", first.Confidence)
+	}
+
+	second := items[1]
+	if second.Position != 2 || second.Amount.Float64 != 12.5 {
+		t.Errorf("items[1] = %+v", second)
+	}
+	// Ambiguous OCR dates are left empty instead of rejecting the item
+	if second.ItemDate.Valid || second.Confidence.Valid || second.CurrencyCode.Valid {
+		t.Errorf("items[1] should have no date, confidence or currency: %+v", second)
+	}
+}
+
+func TestParseWorkflowItemsJSONString(t *testing.T) {
+	items, err := parseWorkflowItems(`[{"storeName": "Farmácia", "spendingAmount": 30}]`, dates.NewNormalizer(time.UTC))
+	if err != nil {
+		t.Fatalf("parseWorkflowItems() returned error: %v", err)
+	}
+	if len(items) != 1 || items[0].Name.String != "Farmácia" || items[0].Amount.Float64 != 30 {
+		t.Errorf("parseWorkflowItems() = %+v", items)
+	}
+}
+
+func TestParseWorkflowItemsEmpty(t *testing.T) {
+	for _, content := range []interface{}{nil, "", primitive.A{}} {
+		items, err := parseWorkflowItems(content, dates.NewNormalizer(time.UTC))
+		if err != nil || len(items) != 0 {
+			t.Errorf("parseWorkflowItems(%#v) = %v, %v, want no items and no error", content, items, err)
+		}
+	}
+}
+
+func TestParseWorkflowItemsUnknownShape(t *testing.T) {
+	tests := map[string]interface{}{
+		"object":           primitive.D{{Key: "total", Value: 10}},
+		"invalid json":     "total: 10",
+		"scalar item":      primitive.A{"Supermercado"},
+		"empty item":       primitive.A{primitive.D{{Key: "rawText", Value: "???"}}},
+		"invalid amount":   primitive.A{primitive.D{{Key: "storeName", Value: "X"}, {Key: "spendingAmount", Value: "ten"}}},
+		"invalid name":     primitive.A{primitive.D{{Key: "storeName", Value: 10}}},
+		"confidence range": primitive.A{primitive.D{{Key: "storeName", Value: "X"}, {Key: "confidence", Value: 87}}},
+	}
+
+	for name, content := range tests {
+		if _, err := parseWorkflowItems(content, dates.NewNormalizer(time.UTC)); err == nil {
+			t.Errorf("%s: parseWorkflowItems() should return error", name)
+		}
+	}
+}
+
+func TestPlainValue(t *testing.T) {
+	value := plainValue(primitive.A{primitive.D{{Key: "storeName", Value: "X"}, {Key: "tags", Value: primitive.A{"a"}}}})
+
+	items, ok := value.([]interface{})
+	if !ok || len(items) != 1 {
+		t.Fatalf("plainValue() = %#v, want a one-element slice", value)
+	}
+	fields, ok := items[0].(map[string]interface{})
+	if !ok || fields["storeName"] != "X" {
+		t.Fatalf("plainValue() item = %#v, want a map", items[0])
+	}
+	if _, ok := fields["tags"].([]interface{}); !ok {
+		t.Errorf("plainValue() nested array = %#v, want a slice", fields["tags"])
+	}
+}
@@ -0,0 +1,179 @@
+package ingestion
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/porcool/ingestion/internal/database/mariadb"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// workflowSuccessStatus is the sync status of a workflow whose expenses were created
+const workflowSuccessStatus = "success"
+
+// amountTolerance is how far apart an extracted amount and an expense amount may be to match
+const amountTolerance = 0.005
+
+// itemMatch pairs an extracted workflow item with the expense it produced
+type itemMatch struct {
+	ItemID    int64
+	ExpenseID int64
+}
+
+// matchWorkflowItems matches extracted items to candidate expenses. An item matches when
+// exactly one unused expense has the same amount, narrowed down by name when more than one
+// does. Items without an amount match by name alone. Ambiguous items are left unmatched,
+// so a wrong link is never recorded.
+func matchWorkflowItems(items []models.ExpenseAutomaticWorkflowItem, candidates []models.Expense) []itemMatch {
+	used := make(map[int64]bool)
+	var matches []itemMatch
+
+	for _, item := range items {
+		if !item.Amount.Valid && !item.Name.Valid {
+			continue
+		}
+
+		var byAmount, byName []models.Expense
+		for _, expense := range candidates {
+			if used[expense.ID] {
+				continue
+			}
+			amountMatches := !item.Amount.Valid || math.Abs(expense.TotalAmount-item.Amount.Float64) < amountTolerance
+			if !amountMatches {
+				continue
+			}
+			byAmount = append(byAmount, expense)
+			if item.Name.Valid && sameName(item.Name.String, expense.Name) {
+				byName = append(byName, expense)
+			}
+		}
+
+		var match []models.Expense
+		switch {
+		case len(byName) > 0:
+			match = byName
+		case item.Amount.Valid:
+			match = byAmount
+		}
+		if len(match) != 1 {
+			continue
+		}
+
+		used[match[0].ID] = true
+		matches = append(matches, itemMatch{ItemID: item.ID, ExpenseID: match[0].ID})
+	}
+
+	return matches
+}
+
+// sameName reports whether an extracted store name and an expense name refer to the same thing
+func sameName(extracted, name string) bool {
+	extracted = strings.ToLower(strings.TrimSpace(extracted))
+	name = strings.ToLower(strings.TrimSpace(name))
+	if extracted == "" || name == "" {
+		return false
+	}
+	return extracted == name || strings.Contains(name, extracted) || strings.Contains(extracted, name)
+}
+
+// linkWorkflowExpenses records which expenses a workflow produced. Expenses that reference
+// the workflow through expenseAutomaticWorkflowId are linked explicitly; without them, the
+// extracted items of a successful workflow are matched to the user's expenses in the same
+// spending month. Heuristic links are recomputed on every sync, explicit links are kept.
+func (s *Service) linkWorkflowExpenses(ctx context.Context, eaw *models.ExpenseAutomaticWorkflow, syncStatus string, items []models.ExpenseAutomaticWorkflowItem) error {
+	linkRepo := mariadb.NewExpenseAutomaticWorkflowExpenseRepository(s.mariaDB)
+	expenseRepo := mariadb.NewExpenseRepository(s.mariaDB)
+
+	if err := linkRepo.DeleteLinks(eaw.ID, models.WorkflowMatchHeuristic); err != nil {
+		return err
+	}
+
+	sourceIDs, err := s.mongoDB.GetExpenseIDsByWorkflowID(ctx, eaw.SourceID)
+	if err != nil {
+		return err
+	}
+
+	explicit := 0
+	for _, sourceID := range sourceIDs {
+		expenseID, found, err := expenseRepo.GetExpenseIDBySourceID(sourceID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			// The expense is linked when it is synced, see linkExpenseToWorkflow
+			continue
+		}
+		link := &models.ExpenseAutomaticWorkflowExpense{
+			ExpenseAutomaticWorkflowID: eaw.ID,
+			ExpenseID:                  expenseID,
+			MatchMethod:                models.WorkflowMatchExplicit,
+		}
+		if err := linkRepo.UpsertLink(link); err != nil {
+			return err
+		}
+		explicit++
+	}
+	if len(sourceIDs) > 0 {
+		log.Printf("Linked expense automatic workflow %s to %d expenses by reference", eaw.SourceID, explicit)
+		return nil
+	}
+
+	if syncStatus != workflowSuccessStatus || !eaw.SpendingDateYYYYMM.Valid || len(items) == 0 {
+		return nil
+	}
+
+	candidates, err := expenseRepo.GetUnlinkedExpensesByUserAndMonth(eaw.UserID, eaw.SpendingDateYYYYMM.String, eaw.ID)
+	if err != nil {
+		return err
+	}
+
+	matches := matchWorkflowItems(items, candidates)
+	for _, m := range matches {
+		link := &models.ExpenseAutomaticWorkflowExpense{
+			ExpenseAutomaticWorkflowID:     eaw.ID,
+			ExpenseID:                      m.ExpenseID,
+			ExpenseAutomaticWorkflowItemID: sql.NullInt64{Int64: m.ItemID, Valid: m.ItemID != 0},
+			MatchMethod:                    models.WorkflowMatchHeuristic,
+		}
+		if err := linkRepo.UpsertLink(link); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Matched %d of %d extracted items of expense automatic workflow %s to expenses", len(matches), len(items), eaw.SourceID)
+	return nil
+}
+
+// linkExpenseToWorkflow links an expense to the workflow it references. It covers expenses
+// synced after their workflow; expenses synced before are linked by linkWorkflowExpenses.
+// An explicit reference replaces the workflow's heuristic links.
+func (s *Service) linkExpenseToWorkflow(expenseID int64, workflowSourceID string) error {
+	workflowRepo := mariadb.NewExpenseAutomaticWorkflowRepository(s.mariaDB)
+	linkRepo := mariadb.NewExpenseAutomaticWorkflowExpenseRepository(s.mariaDB)
+
+	workflowID, found, err := workflowRepo.GetWorkflowIDBySourceID(workflowSourceID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+
+	if err := linkRepo.DeleteLinks(workflowID, models.WorkflowMatchHeuristic); err != nil {
+		return err
+	}
+
+	link := &models.ExpenseAutomaticWorkflowExpense{
+		ExpenseAutomaticWorkflowID: workflowID,
+		ExpenseID:                  expenseID,
+		MatchMethod:                models.WorkflowMatchExplicit,
+	}
+	if err := linkRepo.UpsertLink(link); err != nil {
+		return fmt.Errorf("failed to link expense to workflow %s: %w", workflowSourceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package ingestion
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/porcool/ingestion/internal/models"
+)
+
+func workflowItem(id int64, name string, amount float64) models.ExpenseAutomaticWorkflowItem {
+	return models.ExpenseAutomaticWorkflowItem{
+		ID:     id,
+		Name:   sql.NullString{String: name, Valid: name != ""},
+		Amount: sql.NullFloat64{Float64: amount, Valid: amount != 0},
+	}
+}
+
+func TestMatchWorkflowItems(t *testing.T) {
+	candidates := []models.Expense{
+		{ID: 10, Name: "Supermercado Extra", TotalAmount: 152.30},
+		{ID: 11, Name: "Padaria", TotalAmount: 12.50},
+		{ID: 12, Name: "Farmácia", TotalAmount: 12.50},
+		{ID: 13, Name: "Aluguel", TotalAmount: 1500},
+	}
+
+	items := []models.ExpenseAutomaticWorkflowItem{
+		workflowItem(1, "SUPERMERCADO", 152.30), // unique amount
+		workflowItem(2, "Padaria", 12.50),       // same amount twice, narrowed by name
+		workflowItem(3, "", 12.50),              // only the farmácia is left once 2 took the padaria
+		workflowItem(4, "Restaurante", 99),      // no expense with this amount
+		workflowItem(5, "Mercado", 1500.20),     // amounts must match to the cent
+	}
+
+	matches := matchWorkflowItems(items, candidates)
+
+	want := map[int64]int64{1: 10, 2: 11, 3: 12}
+	if len(matches) != len(want) {
+		t.Fatalf("matchWorkflowItems() = %+v, want %d matches", matches, len(want))
+	}
+	for _, m := range matches {
+		if want[m.ItemID] != m.ExpenseID {
+			t.Errorf("item %d matched expense %d, want %d", m.ItemID, m.ExpenseID, want[m.ItemID])
+		}
+	}
+}
+
+func TestMatchWorkflowItemsAmbiguous(t *testing.T) {
+	candidates := []models.Expense{
+		{ID: 10, Name: "Padaria", TotalAmount: 12.50},
+		{ID: 11, Name: "Farmácia", TotalAmount: 12.50},
+	}
+
+	if matches := matchWorkflowItems([]models.ExpenseAutomaticWorkflowItem{workflowItem(1, "", 12.50)}, candidates); len(matches) != 0 {
+		t.Errorf("matchWorkflowItems() = %+v, ambiguous items must not match", matches)
+	}
+}
+
+func TestMatchWorkflowItemsUsesEachExpenseOnce(t *testing.T) {
+	candidates := []models.Expense{{ID: 10, Name: "Uber", TotalAmount: 20}}
+	items := []models.ExpenseAutomaticWorkflowItem{
+		workflowItem(1, "Uber", 20),
+		workflowItem(2, "Uber", 20),
+	}
+
+	matches := matchWorkflowItems(items, candidates)
+	if len(matches) != 1 || matches[0].ItemID != 1 {
+		t.Errorf("matchWorkflowItems() = %+v, want only item 1 matched", matches)
+	}
+}
+
+func TestMatchWorkflowItemsByNameOnly(t *testing.T) {
+	candidates := []models.Expense{
+		{ID: 10, Name: "Academia", TotalAmount: 90},
+		{ID: 11, Name: "Cinema", TotalAmount: 40},
+	}
+
+	matches := matchWorkflowItems([]models.ExpenseAutomaticWorkflowItem{workflowItem(1, "cinema", 0)}, candidates)
+	if len(matches) != 1 || matches[0].ExpenseID != 11 {
+		t.Errorf("matchWorkflowItems() = %+v, want item 1 matched to expense 11", matches)
+	}
+
+	if matches := matchWorkflowItems([]models.ExpenseAutomaticWorkflowItem{workflowItem(1, "", 0)}, candidates); len(matches) != 0 {
+		t.Errorf("matchWorkflowItems() = %+v, items without name and amount must not match", matches)
+	}
+}
+
+func TestSameName(t *testing.T) {
+	tests := []struct {
+		extracted, name string
+		want            bool
+	}{
+		{"Padaria", "padaria", true},
+		{"SUPERMERCADO", "Supermercado Extra", true},
+		{"Posto Shell Av. Brasil", "Posto Shell", true},
+		{"Padaria", "Farmácia", false},
+		{"", "Padaria", false},
+	}
+
+	for _, tt := range tests {
+		if got := sameName(tt.extracted, tt.name); got != tt.want {
+			t.Errorf("sameName(%q, %q) = %v, want %v", tt.extracted, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package logging
+
+import "strings"
+
+// MaskEmail hides the local part of an email for log output, keeping its first character
+// and the domain: "ana.silva@example.com" becomes "a***@example.com". Values without an @
+// are fully masked.
+func MaskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return "***"
+	}
+	return local[:1] + "***@" + domain
+}
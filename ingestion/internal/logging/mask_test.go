@@ -0,0 +1,19 @@
+package logging
+
+import "testing"
+
+func TestMaskEmail(t *testing.T) {
+	tests := map[string]string{
+		"ana.silva@example.com": "a***@example.com",
+		"a@example.com":         "a***@example.com",
+		"not-an-email":          "***",
+		"@example.com":          "***",
+		"":                      "***",
+	}
+
+	for email, want := range tests {
+		if got := MaskEmail(email); got != want {
+			t.Errorf("MaskEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package metrics publishes the service's counters with expvar. When METRICS_ADDR is set they
+// are served as JSON at /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// schemaDriftFields counts, per collection.field, the sightings of a field their document
+// type does not know: a document fetched again is counted again
+var schemaDriftFields = expvar.NewMap("schema_drift_unknown_fields")
+
+// AddSchemaDrift counts fetched documents of a collection seen with an unknown field
+func AddSchemaDrift(collection, field string, documents int) {
+	schemaDriftFields.Add(collection+"."+field, int64(documents))
+}
+
+// SchemaDrift returns the sightings of an unknown field of a collection
+func SchemaDrift(collection, field string) int64 {
+	if v, ok := schemaDriftFields.Get(collection + "." + field).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// Handler returns the handler serving the published variables
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// Serve serves the published variables at /debug/vars on addr. It only returns on failure.
+func Serve(addr string) error {
+	return http.ListenAndServe(addr, Handler())
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddSchemaDrift(t *testing.T) {
+	AddSchemaDrift("banks", "color", 2)
+	AddSchemaDrift("banks", "color", 3)
+
+	if got := SchemaDrift("banks", "color"); got != 5 {
+		t.Errorf("SchemaDrift() = %d, want 5", got)
+	}
+	if got := SchemaDrift("banks", "never"); got != 0 {
+		t.Errorf("SchemaDrift() of an unseen field = %d, want 0", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	AddSchemaDrift("expenses", "tags", 1)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	var drift map[string]int64
+	if err := json.Unmarshal(vars["schema_drift_unknown_fields"], &drift); err != nil {
+		t.Fatalf("schema_drift_unknown_fields is not a map: %v", err)
+	}
+	if drift["expenses.tags"] < 1 {
+		t.Errorf("expenses.tags = %d, want at least 1", drift["expenses.tags"])
+	}
+}
@@ -2,6 +2,10 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
 	"time"
 )
 
@@ -40,9 +44,13 @@ type ExpenseAutomaticWorkflow struct {
 	GUID                             string         `json:"guid"`
 	SourceID                         string         `json:"source_id"`
 	UserID                           int64          `json:"user_id"`
-	Base64Image                      sql.NullString `json:"base64_image"`
+	Base64Image                      sql.NullString `json:"base64_image"` // legacy inline image, moved to the blob store by migrate-workflow-images
+	ImageSHA256                      sql.NullString `json:"image_sha256"`
+	ImageMimeType                    sql.NullString `json:"image_mime_type"`
+	ImageSize                        sql.NullInt64  `json:"image_size"`
 	Description                      sql.NullString `json:"description"`
 	ExtractedExpenseContentFromImage sql.NullString `json:"extracted_expense_content_from_image"`
+	FlExtractedContentUnparsed       bool           `json:"fl_extracted_content_unparsed"`
 	SpendingDateYYYYMM               sql.NullString `json:"spending_date__YYYY_MM"`
 	SyncProcessedDate                sql.NullTime   `json:"sync_processed_date"`
 	IDSyncStatus                     sql.NullInt64  `json:"id_sync_status"`
@@ -53,6 +61,48 @@ type ExpenseAutomaticWorkflow struct {
 	UpdatedBy                        sql.NullString `json:"updated_by"`
 }
 
+// ExpenseAutomaticWorkflowItem represents the expense_automatic_workflow_item table,
+// one line item parsed from a workflow's extracted_expense_content_from_image
+type ExpenseAutomaticWorkflowItem struct {
+	ID                         int64           `json:"id"`
+	GUID                       string          `json:"guid"`
+	ExpenseAutomaticWorkflowID int64           `json:"expense_automatic_workflow_id"`
+	Position                   int             `json:"position"`
+	Name                       sql.NullString  `json:"name"`
+	Amount                     sql.NullFloat64 `json:"amount"`
+	CurrencyCode               sql.NullString  `json:"currency_code"`
+	ItemDate                   sql.NullTime    `json:"item_date"`
+	Confidence                 sql.NullFloat64 `json:"confidence"`
+	RawText                    sql.NullString  `json:"raw_text"`
+	CreatedAt                  time.Time       `json:"created_at"`
+	CreatedBy                  sql.NullString  `json:"created_by"`
+	UpdatedAt                  sql.NullTime    `json:"updated_at"`
+	UpdatedBy                  sql.NullString  `json:"updated_by"`
+}
+
+// Match methods of an ExpenseAutomaticWorkflowExpense link
+const (
+	// WorkflowMatchExplicit links come from a reference stored in Firestore
+	WorkflowMatchExplicit = "explicit"
+	// WorkflowMatchHeuristic links come from matching extracted items to expenses
+	WorkflowMatchHeuristic = "heuristic"
+)
+
+// ExpenseAutomaticWorkflowExpense represents the expense_automatic_workflow_expense table,
+// linking an automatic workflow to an expense it produced
+type ExpenseAutomaticWorkflowExpense struct {
+	ID                             int64          `json:"id"`
+	GUID                           string         `json:"guid"`
+	ExpenseAutomaticWorkflowID     int64          `json:"expense_automatic_workflow_id"`
+	ExpenseID                      int64          `json:"expense_id"`
+	ExpenseAutomaticWorkflowItemID sql.NullInt64  `json:"expense_automatic_workflow_item_id"`
+	MatchMethod                    string         `json:"match_method"`
+	CreatedAt                      time.Time      `json:"created_at"`
+	CreatedBy                      sql.NullString `json:"created_by"`
+	UpdatedAt                      sql.NullTime   `json:"updated_at"`
+	UpdatedBy                      sql.NullString `json:"updated_by"`
+}
+
 // ExpenseAutomaticWorkflowPreSavedDescription represents the expense_automatic_workflow_pre_saved_description table
 type ExpenseAutomaticWorkflowPreSavedDescription struct {
 	ID          int64          `json:"id"`
@@ -68,82 +118,187 @@ type ExpenseAutomaticWorkflowPreSavedDescription struct {
 
 // Expense represents the expense table
 type Expense struct {
+	ID                                int64           `json:"id"`
+	GUID                              string          `json:"guid"`
+	SourceID                          string          `json:"source_id"`
+	UserID                            int64           `json:"user_id"`
+	SpendingDateYYYYMM                string          `json:"spending_date__YYYY_MM"`
+	IDStatus                          sql.NullInt64   `json:"id_status"`
+	IDType                            sql.NullInt64   `json:"id_type"`
+	ValidityPeriodDate                sql.NullTime    `json:"validity_period_date"`
+	FlIndeterminateValidityPeriodDate bool            `json:"fl_indeterminate_validity_period_date"`
+	Name                              string          `json:"name"`
+	TotalAmount                       float64         `json:"total_amount"`
+	TotalPaidAmount                   float64         `json:"total_paid_amount"`
+	CurrencyCode                      sql.NullString  `json:"currency_code"`
+	ExchangeRate                      sql.NullFloat64 `json:"exchange_rate"`
+	TotalAmountBase                   sql.NullFloat64 `json:"total_amount_base"`
+	TotalPaidAmountBase               sql.NullFloat64 `json:"total_paid_amount_base"`
+	CreatedAt                         time.Time       `json:"created_at"`
+	CreatedBy                         sql.NullString  `json:"created_by"`
+	UpdatedAt                         sql.NullTime    `json:"updated_at"`
+	UpdatedBy                         sql.NullString  `json:"updated_by"`
+}
+
+// ExpenseInstallment represents the expense_installment table
+type ExpenseInstallment struct {
+	ID             int64           `json:"id"`
+	GUID           string          `json:"guid"`
+	ExpenseID      int64           `json:"expense_id"`
+	Amount         float64         `json:"amount"`
+	PaidAmount     float64         `json:"paid_amount"`
+	IDStatus       sql.NullInt64   `json:"id_status"`
+	DueDate        sql.NullTime    `json:"due_date"`
+	ExchangeRate   sql.NullFloat64 `json:"exchange_rate"`
+	AmountBase     sql.NullFloat64 `json:"amount_base"`
+	PaidAmountBase sql.NullFloat64 `json:"paid_amount_base"`
+	CreatedAt      time.Time       `json:"created_at"`
+	CreatedBy      sql.NullString  `json:"created_by"`
+	UpdatedAt      sql.NullTime    `json:"updated_at"`
+	UpdatedBy      sql.NullString  `json:"updated_by"`
+}
+
+// AdditionalBalance represents the additional_balance table
+type AdditionalBalance struct {
+	ID                 int64           `json:"id"`
+	GUID               string          `json:"guid"`
+	SourceID           string          `json:"source_id"`
+	UserID             int64           `json:"user_id"`
+	SpendingDateYYYYMM string          `json:"spending_date__YYYY_MM"`
+	Amount             float64         `json:"amount"`
+	Description        sql.NullString  `json:"description"`
+	CurrencyCode       sql.NullString  `json:"currency_code"`
+	ExchangeRate       sql.NullFloat64 `json:"exchange_rate"`
+	AmountBase         sql.NullFloat64 `json:"amount_base"`
+	CreatedAt          time.Time       `json:"created_at"`
+	CreatedBy          sql.NullString  `json:"created_by"`
+	UpdatedAt          sql.NullTime    `json:"updated_at"`
+	UpdatedBy          sql.NullString  `json:"updated_by"`
+}
+
+// BalanceHistory represents the balance_history table
+type BalanceHistory struct {
+	ID                  int64           `json:"id"`
+	GUID                string          `json:"guid"`
+	SourceID            string          `json:"source_id"`
+	UserID              int64           `json:"user_id"`
+	SpendingDateYYYYMM  string          `json:"spending_date__YYYY_MM"`
+	Amount              float64         `json:"amount"`
+	LastMonthAmount     float64         `json:"last_month_amount"`
+	MonthlyIncome       float64         `json:"monthly_income"`
+	CurrencyCode        sql.NullString  `json:"currency_code"`
+	ExchangeRate        sql.NullFloat64 `json:"exchange_rate"`
+	AmountBase          sql.NullFloat64 `json:"amount_base"`
+	LastMonthAmountBase sql.NullFloat64 `json:"last_month_amount_base"`
+	MonthlyIncomeBase   sql.NullFloat64 `json:"monthly_income_base"`
+	CreatedAt           time.Time       `json:"created_at"`
+	CreatedBy           sql.NullString  `json:"created_by"`
+	UpdatedAt           sql.NullTime    `json:"updated_at"`
+	UpdatedBy           sql.NullString  `json:"updated_by"`
+}
+
+// UserMonth identifies a user's spending month
+type UserMonth struct {
+	UserID             int64
+	SpendingDateYYYYMM string
+}
+
+// UserMonthSummary represents the user_month_summary table
+type UserMonthSummary struct {
 	ID                                int64          `json:"id"`
 	GUID                              string         `json:"guid"`
-	SourceID                          string         `json:"source_id"`
 	UserID                            int64          `json:"user_id"`
 	SpendingDateYYYYMM                string         `json:"spending_date__YYYY_MM"`
-	IDStatus                          sql.NullInt64  `json:"id_status"`
-	IDType                            sql.NullInt64  `json:"id_type"`
-	ValidityPeriodDate                sql.NullTime   `json:"validity_period_date"`
-	FlIndeterminateValidityPeriodDate bool           `json:"fl_indeterminate_validity_period_date"`
-	Name                              string         `json:"name"`
-	TotalAmount                       float64        `json:"total_amount"`
+	TotalExpenseAmount                float64        `json:"total_expense_amount"`
 	TotalPaidAmount                   float64        `json:"total_paid_amount"`
+	TotalPendingAmount                float64        `json:"total_pending_amount"`
+	TotalAdditionalAmount             float64        `json:"total_additional_amount"`
+	ExpenseCount                      int            `json:"expense_count"`
+	AdditionalBalanceCount            int            `json:"additional_balance_count"`
+	UnconvertedExpenseCount           int            `json:"unconverted_expense_count"`
+	UnconvertedAdditionalBalanceCount int            `json:"unconverted_additional_balance_count"`
+	TypeExpenseCount                  int            `json:"type_expense_count"`
+	TypeInvoiceCount                  int            `json:"type_invoice_count"`
+	TypeSavingsCount                  int            `json:"type_savings_count"`
+	StatusPendingCount                int            `json:"status_pending_count"`
+	StatusPartiallyPaidCount          int            `json:"status_partially_paid_count"`
+	StatusPaidCount                   int            `json:"status_paid_count"`
+	RefreshedAt                       time.Time      `json:"refreshed_at"`
 	CreatedAt                         time.Time      `json:"created_at"`
 	CreatedBy                         sql.NullString `json:"created_by"`
 	UpdatedAt                         sql.NullTime   `json:"updated_at"`
 	UpdatedBy                         sql.NullString `json:"updated_by"`
 }
 
-// ExpenseInstallment represents the expense_installment table
-type ExpenseInstallment struct {
-	ID         int64          `json:"id"`
-	GUID       string         `json:"guid"`
-	ExpenseID  int64          `json:"expense_id"`
-	Amount     float64        `json:"amount"`
-	PaidAmount float64        `json:"paid_amount"`
-	IDStatus   sql.NullInt64  `json:"id_status"`
-	DueDate    sql.NullTime   `json:"due_date"`
-	CreatedAt  time.Time      `json:"created_at"`
-	CreatedBy  sql.NullString `json:"created_by"`
-	UpdatedAt  sql.NullTime   `json:"updated_at"`
-	UpdatedBy  sql.NullString `json:"updated_by"`
+// BalanceComponents is a balance_history row together with the values its balance is
+// computed from. It is not a table, it is the input of the balance verifier.
+type BalanceComponents struct {
+	BalanceHistoryID        int64           `json:"balance_history_id"`
+	UserID                  int64           `json:"user_id"`
+	UserSourceID            string          `json:"user_source_id"`
+	SpendingDateYYYYMM      string          `json:"spending_date__YYYY_MM"`
+	RecordedAmount          float64         `json:"recorded_amount"`
+	RecordedLastMonthAmount float64         `json:"recorded_last_month_amount"`
+	RecordedMonthlyIncome   float64         `json:"recorded_monthly_income"`
+	UserMonthlyIncome       float64         `json:"user_monthly_income"`
+	PreviousAmount          sql.NullFloat64 `json:"previous_amount"`
+	AdditionalAmount        float64         `json:"additional_amount"`
+	ExpenseAmount           float64         `json:"expense_amount"`
+	ExpensePaidAmount       float64         `json:"expense_paid_amount"`
+	UnconvertedRows         int             `json:"unconverted_rows"`
 }
 
-// AdditionalBalance represents the additional_balance table
-type AdditionalBalance struct {
-	ID                 int64          `json:"id"`
-	GUID               string         `json:"guid"`
-	SourceID           string         `json:"source_id"`
-	UserID             int64          `json:"user_id"`
-	SpendingDateYYYYMM string         `json:"spending_date__YYYY_MM"`
-	Amount             float64        `json:"amount"`
-	Description        sql.NullString `json:"description"`
-	CreatedAt          time.Time      `json:"created_at"`
-	CreatedBy          sql.NullString `json:"created_by"`
-	UpdatedAt          sql.NullTime   `json:"updated_at"`
-	UpdatedBy          sql.NullString `json:"updated_by"`
+// BalanceFilter selects the balance_history rows to verify. Zero values match everything.
+type BalanceFilter struct {
+	UserID             int64
+	SpendingDateYYYYMM string
+	BalanceHistoryIDs  []int64
+	AfterID            int64
+	Limit              int
 }
 
-// BalanceHistory represents the balance_history table
-type BalanceHistory struct {
-	ID                 int64          `json:"id"`
-	GUID               string         `json:"guid"`
-	SourceID           string         `json:"source_id"`
-	UserID             int64          `json:"user_id"`
-	SpendingDateYYYYMM string         `json:"spending_date__YYYY_MM"`
-	Amount             float64        `json:"amount"`
-	LastMonthAmount    float64        `json:"last_month_amount"`
-	MonthlyIncome      float64        `json:"monthly_income"`
-	CreatedAt          time.Time      `json:"created_at"`
-	CreatedBy          sql.NullString `json:"created_by"`
-	UpdatedAt          sql.NullTime   `json:"updated_at"`
-	UpdatedBy          sql.NullString `json:"updated_by"`
+// BalanceDiscrepancy represents the balance_discrepancy table
+type BalanceDiscrepancy struct {
+	ID                      int64          `json:"id"`
+	GUID                    string         `json:"guid"`
+	BalanceHistoryID        int64          `json:"balance_history_id"`
+	UserID                  int64          `json:"user_id"`
+	UserSourceID            string         `json:"user_source_id"`
+	SpendingDateYYYYMM      string         `json:"spending_date__YYYY_MM"`
+	Basis                   string         `json:"basis"`
+	Reasons                 string         `json:"reasons"`
+	RecordedAmount          float64        `json:"recorded_amount"`
+	ExpectedAmount          float64        `json:"expected_amount"`
+	DifferenceAmount        float64        `json:"difference_amount"`
+	RecordedLastMonthAmount float64        `json:"recorded_last_month_amount"`
+	ExpectedLastMonthAmount float64        `json:"expected_last_month_amount"`
+	RecordedMonthlyIncome   float64        `json:"recorded_monthly_income"`
+	ExpectedMonthlyIncome   float64        `json:"expected_monthly_income"`
+	AdditionalAmount        float64        `json:"additional_amount"`
+	ExpenseAmount           float64        `json:"expense_amount"`
+	VerifiedAt              time.Time      `json:"verified_at"`
+	CreatedAt               time.Time      `json:"created_at"`
+	CreatedBy               sql.NullString `json:"created_by"`
+	UpdatedAt               sql.NullTime   `json:"updated_at"`
+	UpdatedBy               sql.NullString `json:"updated_by"`
 }
 
 // ServicePayment represents the service_payment table
 type ServicePayment struct {
-	ID                   int64          `json:"id"`
-	GUID                 string         `json:"guid"`
-	SourceID             string         `json:"source_id"`
-	UserID               int64          `json:"user_id"`
-	ServicePaymentDate   time.Time      `json:"service_payment_date"`
-	ServicePaymentTypeID sql.NullInt64  `json:"service_payment_type_id"`
-	CreatedAt            time.Time      `json:"created_at"`
-	CreatedBy            sql.NullString `json:"created_by"`
-	UpdatedAt            sql.NullTime   `json:"updated_at"`
-	UpdatedBy            sql.NullString `json:"updated_by"`
+	ID                     int64           `json:"id"`
+	GUID                   string          `json:"guid"`
+	SourceID               string          `json:"source_id"`
+	UserID                 int64           `json:"user_id"`
+	ServicePaymentDate     time.Time       `json:"service_payment_date"`
+	ServicePaymentTypeID   sql.NullInt64   `json:"service_payment_type_id"`
+	Amount                 sql.NullFloat64 `json:"amount"`
+	CurrencyCode           sql.NullString  `json:"currency_code"`
+	ProviderTransactionID  sql.NullString  `json:"provider_transaction_id"`
+	ServicePaymentStatusID sql.NullInt64   `json:"service_payment_status_id"`
+	CreatedAt              time.Time       `json:"created_at"`
+	CreatedBy              sql.NullString  `json:"created_by"`
+	UpdatedAt              sql.NullTime    `json:"updated_at"`
+	UpdatedBy              sql.NullString  `json:"updated_by"`
 }
 
 // User represents the user table
@@ -166,6 +321,84 @@ type User struct {
 	UpdatedBy           sql.NullString `json:"updated_by"`
 }
 
+// UserHistory represents the user_history table. Each row is a version of the tracked
+// user fields, valid from valid_from until valid_to (NULL for the current version).
+type UserHistory struct {
+	ID                  int64          `json:"id"`
+	GUID                string         `json:"guid"`
+	UserID              int64          `json:"user_id"`
+	FlAdmin             bool           `json:"fl_admin"`
+	MonthlyIncome       float64        `json:"monthly_income"`
+	FlPaymentRequested  bool           `json:"fl_payment_requested"`
+	FlPaymentPending    bool           `json:"fl_payment_pending"`
+	FlPaymentPaid       bool           `json:"fl_payment_paid"`
+	CurrentSpendingDate sql.NullString `json:"current_spending_date"`
+	ValidFrom           time.Time      `json:"valid_from"`
+	ValidTo             sql.NullTime   `json:"valid_to"`
+	CreatedAt           time.Time      `json:"created_at"`
+	CreatedBy           sql.NullString `json:"created_by"`
+}
+
+// SameState reports whether the version holds the same tracked fields as the user
+func (h *UserHistory) SameState(user *User) bool {
+	return h.FlAdmin == user.FlAdmin &&
+		math.Abs(h.MonthlyIncome-user.MonthlyIncome) < 0.005 &&
+		h.FlPaymentRequested == user.FlPaymentRequested &&
+		h.FlPaymentPending == user.FlPaymentPending &&
+		h.FlPaymentPaid == user.FlPaymentPaid &&
+		h.CurrentSpendingDate == user.CurrentSpendingDate
+}
+
+// Resolutions recorded in user_email_conflict.resolution
+const (
+	EmailConflictFailed  = "failed"
+	EmailConflictRenamed = "renamed"
+	EmailConflictMerged  = "merged"
+)
+
+// UserEmailConflict represents the user_email_conflict table. The stale user is the one that
+// held the email; the kept user is the one left with the incoming source_id after a merge.
+type UserEmailConflict struct {
+	ID               int64          `json:"id"`
+	GUID             string         `json:"guid"`
+	Email            string         `json:"email"`
+	IncomingSourceID string         `json:"incoming_source_id"`
+	StaleUserID      int64          `json:"stale_user_id"`
+	StaleSourceID    string         `json:"stale_source_id"`
+	KeptUserID       sql.NullInt64  `json:"kept_user_id"`
+	Policy           string         `json:"policy"`
+	Resolution       string         `json:"resolution"`
+	RenamedEmail     sql.NullString `json:"renamed_email"`
+	MovedRows        int64          `json:"moved_rows"`
+	CreatedAt        time.Time      `json:"created_at"`
+	CreatedBy        sql.NullString `json:"created_by"`
+}
+
+// Erasure statuses stored in user_erasure.status
+const (
+	ErasureStatusCompleted = "completed"
+	// ErasureStatusPartial marks an erasure that left data behind, explained in status_reason
+	ErasureStatusPartial = "partial"
+)
+
+// UserErasure represents the user_erasure table, the receipt of a data-subject erasure. The
+// row counts are per table or collection, and the signature is an HMAC-SHA256 over the
+// other fields so the receipt cannot be altered unnoticed.
+type UserErasure struct {
+	ID               int64            `json:"-"`
+	GUID             string           `json:"guid"`
+	UserSourceID     string           `json:"user_source_id"`
+	RequestedBy      string           `json:"requested_by"`
+	RequestedAt      time.Time        `json:"requested_at"`
+	CompletedAt      time.Time        `json:"completed_at"`
+	Status           string           `json:"status"`
+	StatusReason     string           `json:"status_reason"`
+	MariaDBRows      map[string]int64 `json:"mariadb_rows"`
+	MongoDBDocuments map[string]int64 `json:"mongodb_documents"`
+	BlobsDeleted     int64            `json:"blobs_deleted"`
+	Signature        string           `json:"-"`
+}
+
 // SystemSettings represents the system_settings table
 type SystemSettings struct {
 	ID                      int64          `json:"id"`
@@ -173,18 +406,56 @@ type SystemSettings struct {
 	SourceID                string         `json:"source_id"`
 	FlBlockUserRegistration bool           `json:"fl_block_user_registration"`
 	FlMaintenance           bool           `json:"fl_maintenance"`
-	JSONSyncMetadata        sql.NullString `json:"json_sync_metadata"`
 	CreatedAt               time.Time      `json:"created_at"`
 	CreatedBy               sql.NullString `json:"created_by"`
 	UpdatedAt               sql.NullTime   `json:"updated_at"`
 	UpdatedBy               sql.NullString `json:"updated_by"`
 }
 
+// Sync statuses stored in sync_metadata.last_status
+const (
+	SyncStatusSuccess = "success"
+	SyncStatusFailed  = "failed"
+)
+
+// SyncMetadata represents the sync_metadata table
+type SyncMetadata struct {
+	ID                    int64          `json:"id"`
+	GUID                  string         `json:"guid"`
+	ServiceName           string         `json:"service_name"`
+	LatestSyncDatetime    sql.NullTime   `json:"latest_sync_datetime"`
+	LatestSuccessDatetime sql.NullTime   `json:"latest_success_datetime"`
+	LastStatus            sql.NullString `json:"last_status"`
+	LastError             sql.NullString `json:"last_error"`
+	LastDocumentsCount    int            `json:"last_documents_count"`
+	SyncCount             int64          `json:"sync_count"`
+	FailureCount          int64          `json:"failure_count"`
+	CreatedAt             time.Time      `json:"created_at"`
+	CreatedBy             sql.NullString `json:"created_by"`
+	UpdatedAt             sql.NullTime   `json:"updated_at"`
+	UpdatedBy             sql.NullString `json:"updated_by"`
+}
+
+// ExchangeRate represents the exchange_rate table
+type ExchangeRate struct {
+	ID               int64          `json:"id"`
+	GUID             string         `json:"guid"`
+	CurrencyCode     string         `json:"currency_code"`
+	BaseCurrencyCode string         `json:"base_currency_code"`
+	Rate             float64        `json:"rate"`
+	RateDate         time.Time      `json:"rate_date"`
+	Source           sql.NullString `json:"source"`
+	CreatedAt        time.Time      `json:"created_at"`
+	CreatedBy        sql.NullString `json:"created_by"`
+	UpdatedAt        sql.NullTime   `json:"updated_at"`
+	UpdatedBy        sql.NullString `json:"updated_by"`
+}
+
 // DomainSeed represents a domain to be seeded
 type DomainSeed struct {
-	Source string
-	Type   string
-	Names  []string
+	Source string   `json:"source"`
+	Type   string   `json:"type"`
+	Names  []string `json:"names"`
 }
 
 // GetDomainSeeds returns all domains to be seeded
@@ -215,5 +486,38 @@ func GetDomainSeeds() []DomainSeed {
 			Type:   "service_payment_type_id",
 			Names:  []string{"PayPal"},
 		},
+		{
+			Source: "service_payment",
+			Type:   "service_payment_status_id",
+			Names:  []string{"pending", "completed", "failed", "refunded"},
+		},
 	}
 }
+
+// LoadDomainSeedsFile reads extra domain seeds from a JSON file containing an array of
+// {"source", "type", "names"} objects, so new values such as payment providers can be
+// seeded without code changes
+func LoadDomainSeedsFile(path string) ([]DomainSeed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domain seed file: %w", err)
+	}
+
+	var seeds []DomainSeed
+	if err := json.Unmarshal(data, &seeds); err != nil {
+		return nil, fmt.Errorf("failed to parse domain seed file: %w", err)
+	}
+
+	for i, seed := range seeds {
+		if seed.Source == "" || seed.Type == "" {
+			return nil, fmt.Errorf("domain seed %d must have a source and a type", i+1)
+		}
+		for _, name := range seed.Names {
+			if name == "" {
+				return nil, fmt.Errorf("domain seed %d (%s.%s) has an empty name", i+1, seed.Source, seed.Type)
+			}
+		}
+	}
+
+	return seeds, nil
+}
@@ -1,14 +1,17 @@
 package models
 
 import (
+	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestGetDomainSeeds(t *testing.T) {
 	seeds := GetDomainSeeds()
 
-	if len(seeds) != 5 {
-		t.Errorf("GetDomainSeeds() returned %d seeds, want 5", len(seeds))
+	if len(seeds) != 6 {
+		t.Errorf("GetDomainSeeds() returned %d seeds, want 6", len(seeds))
 	}
 
 	// Test expense_automatic_workflow / id_sync_status
@@ -89,6 +92,51 @@ func TestGetDomainSeeds(t *testing.T) {
 	if !found {
 		t.Error("service_payment / service_payment_type_id not found")
 	}
+
+	// Test service_payment / service_payment_status_id
+	found = false
+	for _, seed := range seeds {
+		if seed.Source == "service_payment" && seed.Type == "service_payment_status_id" {
+			found = true
+			expectedNames := []string{"pending", "completed", "failed", "refunded"}
+			if len(seed.Names) != len(expectedNames) {
+				t.Errorf("service_payment_status_id has %d names, want %d", len(seed.Names), len(expectedNames))
+			}
+		}
+	}
+	if !found {
+		t.Error("service_payment / service_payment_status_id not found")
+	}
+}
+
+func TestLoadDomainSeedsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "domains.json")
+	content := `[{"source": "service_payment", "type": "service_payment_type_id", "names": ["Stripe", "Pix"]}]`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	seeds, err := LoadDomainSeedsFile(path)
+	if err != nil {
+		t.Fatalf("LoadDomainSeedsFile() returned error: %v", err)
+	}
+	if len(seeds) != 1 || seeds[0].Source != "service_payment" || len(seeds[0].Names) != 2 || seeds[0].Names[1] != "Pix" {
+		t.Errorf("LoadDomainSeedsFile() = %+v", seeds)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`[{"names": ["Stripe"]}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDomainSeedsFile(invalid); err == nil {
+		t.Error("LoadDomainSeedsFile() should return error for a seed without source and type")
+	}
+
+	if _, err := LoadDomainSeedsFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadDomainSeedsFile() should return error for a missing file")
+	}
 }
 
 func TestDomainStructure(t *testing.T) {
@@ -137,6 +185,42 @@ func TestUserStructure(t *testing.T) {
 	}
 }
 
+func TestUserHistorySameState(t *testing.T) {
+	user := &User{
+		MonthlyIncome:       5000,
+		FlPaymentPaid:       true,
+		CurrentSpendingDate: sql.NullString{String: "2024/03", Valid: true},
+	}
+	version := UserHistory{
+		MonthlyIncome:       5000,
+		FlPaymentPaid:       true,
+		CurrentSpendingDate: sql.NullString{String: "2024/03", Valid: true},
+	}
+
+	if !version.SameState(user) {
+		t.Error("SameState() = false for identical tracked fields")
+	}
+
+	user.FirstName = "John"
+	if !version.SameState(user) {
+		t.Error("SameState() = false, untracked fields must be ignored")
+	}
+
+	changes := map[string]func(u *User){
+		"monthly_income":        func(u *User) { u.MonthlyIncome = 6000 },
+		"fl_payment_paid":       func(u *User) { u.FlPaymentPaid = false },
+		"fl_payment_pending":    func(u *User) { u.FlPaymentPending = true },
+		"current_spending_date": func(u *User) { u.CurrentSpendingDate.String = "2024/04" },
+	}
+	for field, change := range changes {
+		changed := *user
+		change(&changed)
+		if version.SameState(&changed) {
+			t.Errorf("SameState() = true after changing %s", field)
+		}
+	}
+}
+
 func TestExpenseStructure(t *testing.T) {
 	expense := Expense{
 		ID:                 1,
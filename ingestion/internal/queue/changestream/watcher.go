@@ -0,0 +1,308 @@
+package changestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+)
+
+// IngestionDocsCollection is the collection stage 1 records its ingested Firestore documents in
+const IngestionDocsCollection = "succesfully_ingested_firestore_docs"
+
+// StreamName is the name the watcher's resume token is saved under
+const StreamName = "ingestion"
+
+// ownWriteFields are the fields the service itself writes to MongoDB documents after
+// syncing them. Updates touching only these fields are skipped, or every sync would
+// trigger another one.
+var ownWriteFields = map[string]bool{
+	mongodb.SyncDatetimeField:            true,
+	mongodb.SyncServiceField:             true,
+	mongodb.SyncContentHashField:         true,
+	mongodb.SyncFirestoreUpdateTimeField: true,
+	"ingestedBy":                         true,
+	"ingestedAt":                         true,
+}
+
+// Batch holds the changes collected during one flush interval
+type Batch struct {
+	// IngestionDocs are the IDs of new or changed succesfully_ingested_firestore_docs documents
+	IngestionDocs []string
+	// Documents are the IDs of changed documents per synced collection
+	Documents map[string][]mongodb.DocID
+
+	seen map[string]bool
+}
+
+// newBatch returns an empty batch
+func newBatch() *Batch {
+	return &Batch{Documents: make(map[string][]mongodb.DocID), seen: make(map[string]bool)}
+}
+
+// add records a changed document once
+func (b *Batch) add(collection string, id mongodb.DocID) {
+	key := collection + "/" + id.String()
+	if b.seen[key] {
+		return
+	}
+	b.seen[key] = true
+
+	if collection == IngestionDocsCollection {
+		b.IngestionDocs = append(b.IngestionDocs, id.String())
+		return
+	}
+	b.Documents[collection] = append(b.Documents[collection], id)
+}
+
+// Len returns the number of changed documents in the batch
+func (b *Batch) Len() int {
+	return len(b.seen)
+}
+
+// BatchHandler syncs a batch of changes. An error stops the watcher without saving the
+// batch's resume token, so the changes are seen again after a restart.
+type BatchHandler func(ctx context.Context, batch *Batch) error
+
+// changeEvent is the part of a change stream event the watcher reads
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	NS            struct {
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID bson.RawValue `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription *struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// isOwnWrite reports whether an update only touched the fields the service writes itself
+func (e *changeEvent) isOwnWrite() bool {
+	if e.OperationType != "update" || e.UpdateDescription == nil || len(e.UpdateDescription.RemovedFields) > 0 {
+		return false
+	}
+	if len(e.UpdateDescription.UpdatedFields) == 0 {
+		return false
+	}
+	for field := range e.UpdateDescription.UpdatedFields {
+		if !ownWriteFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// pipeline returns the change stream pipeline keeping inserts, updates and replacements of
+// the watched collections. Deletes are not synced.
+func pipeline(collections []string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"ns.coll":       bson.M{"$in": collections},
+			"operationType": bson.M{"$in": []string{"insert", "update", "replace"}},
+		}}},
+	}
+}
+
+// Watcher watches the synced collections and succesfully_ingested_firestore_docs with a
+// change stream and hands the changed documents to a handler in batches
+type Watcher struct {
+	mongoDB     *mongodb.Connection
+	cfg         config.TriggersConfig
+	collections []string
+	handler     BatchHandler
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	mu     sync.Mutex
+}
+
+// NewWatcher creates a watcher for the given synced collections
+func NewWatcher(mongoDB *mongodb.Connection, cfg config.TriggersConfig, collections []string, handler BatchHandler) *Watcher {
+	return &Watcher{
+		mongoDB:     mongoDB,
+		cfg:         cfg,
+		collections: append(append([]string{}, collections...), IngestionDocsCollection),
+		handler:     handler,
+	}
+}
+
+// Start opens the change stream, resuming after the saved token when there is one, and
+// starts watching. It fails when MongoDB is not a replica set.
+func (w *Watcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done != nil {
+		return nil
+	}
+
+	token, err := w.mongoDB.GetResumeToken(ctx, StreamName)
+	if err != nil {
+		return err
+	}
+
+	opts := options.ChangeStream().SetMaxAwaitTime(w.cfg.ChangeStreamFlushInterval)
+	if token != nil {
+		opts.SetResumeAfter(token)
+		log.Printf("Resuming change stream %s from its saved token", StreamName)
+	} else {
+		log.Printf("Starting change stream %s from the current time", StreamName)
+	}
+
+	stream, err := w.mongoDB.Database().Watch(ctx, pipeline(w.collections), opts)
+	if err != nil {
+		return fmt.Errorf("failed to open change stream (MongoDB must run as a replica set): %w", err)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.watch(watchCtx, stream)
+
+	log.Printf("Change stream watcher started on %d collections", len(w.collections))
+	return nil
+}
+
+// watch reads the stream until the context is canceled or an error occurs
+func (w *Watcher) watch(ctx context.Context, stream *mongo.ChangeStream) {
+	defer close(w.done)
+	defer stream.Close(context.Background())
+
+	err := w.run(ctx, stream)
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	if err != nil {
+		log.Printf("Change stream watcher stopped: %v", err)
+	}
+
+	w.mu.Lock()
+	w.err = err
+	w.mu.Unlock()
+}
+
+// run collects changes and flushes them when the batch is full or the flush interval has
+// passed. The resume token is only saved once a batch is synced.
+func (w *Watcher) run(ctx context.Context, stream *mongo.ChangeStream) error {
+	batch := newBatch()
+	var batchStarted time.Time
+	var saved bson.Raw
+
+	// A batch being synced is finished on Stop, like a message being consumed
+	syncCtx := context.WithoutCancel(ctx)
+
+	flush := func() error {
+		token := stream.ResumeToken()
+		if batch.Len() > 0 {
+			log.Printf("Syncing %d changed documents from the change stream", batch.Len())
+			if err := w.handler(syncCtx, batch); err != nil {
+				return err
+			}
+			batch = newBatch()
+		}
+		if token == nil || sameToken(token, saved) {
+			return nil
+		}
+		if err := w.mongoDB.SaveResumeToken(syncCtx, StreamName, token); err != nil {
+			return err
+		}
+		saved = token
+		return nil
+	}
+
+	for {
+		if stream.TryNext(ctx) {
+			var event changeEvent
+			if err := stream.Decode(&event); err != nil {
+				return fmt.Errorf("failed to decode change event: %w", err)
+			}
+			if !event.isOwnWrite() {
+				if batch.Len() == 0 {
+					batchStarted = time.Now()
+				}
+				if id, ok := mongodb.DocIDFromRaw(event.DocumentKey.ID); ok {
+					batch.add(event.NS.Coll, id)
+				} else {
+					log.Printf("Warning: Skipping change to %s document with an unsupported _id of BSON type %s", event.NS.Coll, event.DocumentKey.ID.Type)
+				}
+			}
+			// A steady trickle of changes never leaves TryNext idle, so the flush interval
+			// is checked here too
+			if batchDue(w.cfg, batch.Len(), batchStarted, time.Now()) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := stream.Err(); err != nil {
+			return fmt.Errorf("change stream failed: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// No change within the await time: sync what was collected, or only move the saved
+		// position past skipped events
+		if batch.Len() == 0 || time.Since(batchStarted) >= w.cfg.ChangeStreamFlushInterval {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// batchDue reports whether a batch of size changes, the first collected at started, must be
+// synced: when it is full or has waited for the flush interval
+func batchDue(cfg config.TriggersConfig, size int, started, now time.Time) bool {
+	if size == 0 {
+		return false
+	}
+	return size >= cfg.ChangeStreamMaxBatch || now.Sub(started) >= cfg.ChangeStreamFlushInterval
+}
+
+// sameToken reports whether two resume tokens are the same
+func sameToken(a, b bson.Raw) bool {
+	return string(a) == string(b)
+}
+
+// Stop stops watching and waits for the batch being synced to finish. Changes collected
+// but not synced yet are seen again after a restart.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// Done is closed when the watcher stops, on Stop or after an error
+func (w *Watcher) Done() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.done
+}
+
+// Err returns the error that stopped the watcher, nil while it runs or after Stop
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
@@ -0,0 +1,109 @@
+//go:build integration
+
+package changestream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+)
+
+// TestWatcherReplicaSet runs against a single-node replica set, such as the MongoDB service
+// in docker-compose.yml:
+//
+//	docker compose up -d mongodb
+//	go test -tags integration ./internal/queue/changestream/
+func TestWatcherReplicaSet(t *testing.T) {
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017/?replicaSet=rs0&directConnection=true"
+	}
+	database := fmt.Sprintf("porcool_changestream_test_%d", time.Now().UnixNano())
+
+	conn, err := mongodb.NewConnection(config.MongoDBConfig{URI: uri, Database: database})
+	if err != nil {
+		t.Fatalf("NewConnection() returned error: %v", err)
+	}
+	ctx := context.Background()
+	defer conn.Close()
+	defer conn.Database().Drop(ctx)
+
+	cfg := config.TriggersConfig{Mode: config.TriggerChangeStream, ChangeStreamFlushInterval: 200 * time.Millisecond, ChangeStreamMaxBatch: 100}
+	batches := make(chan *Batch, 10)
+	handler := func(ctx context.Context, batch *Batch) error {
+		batches <- batch
+		return nil
+	}
+
+	watcher := NewWatcher(conn, cfg, []string{"users", "expenses"}, handler)
+	if err := watcher.Start(ctx); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+
+	expenses := conn.Collection("expenses")
+	if _, err := expenses.InsertOne(ctx, bson.M{"_id": "exp-1", "amount": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Collection(IngestionDocsCollection).InsertOne(ctx, bson.M{"_id": "doc-1"}); err != nil {
+		t.Fatal(err)
+	}
+	// Neither the service's own sync marker nor an unwatched collection is a change
+	if err := conn.MarkAsSynced(ctx, "expenses", []mongodb.SyncMark{{ID: mongodb.StringID("exp-1"), ContentHash: "hash"}}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Collection("unwatched").InsertOne(ctx, bson.M{"_id": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, batches, 2)
+	if len(got.Documents["expenses"]) != 1 || len(got.IngestionDocs) != 1 || len(got.Documents) != 1 {
+		t.Errorf("changes = %+v, want expenses/exp-1 and doc-1", got)
+	}
+
+	// Changes made while the watcher is stopped are picked up from the saved resume token
+	watcher.Stop()
+	if _, err := expenses.UpdateOne(ctx, bson.M{"_id": "exp-1"}, bson.M{"$set": bson.M{"amount": 20}}); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewWatcher(conn, cfg, []string{"users", "expenses"}, handler)
+	if err := restarted.Start(ctx); err != nil {
+		t.Fatalf("Start() after restart returned error: %v", err)
+	}
+	defer restarted.Stop()
+
+	got = collect(t, batches, 1)
+	if ids := got.Documents["expenses"]; len(ids) != 1 || ids[0] != mongodb.StringID("exp-1") {
+		t.Errorf("changes after restart = %+v, want expenses/exp-1", got)
+	}
+}
+
+// collect merges handled batches until they hold n changes
+func collect(t *testing.T, batches <-chan *Batch, n int) *Batch {
+	t.Helper()
+	merged := newBatch()
+	timeout := time.After(10 * time.Second)
+	for merged.Len() < n {
+		select {
+		case b := <-batches:
+			for collection, ids := range b.Documents {
+				for _, id := range ids {
+					merged.add(collection, id)
+				}
+			}
+			for _, id := range b.IngestionDocs {
+				merged.add(IngestionDocsCollection, mongodb.StringID(id))
+			}
+		case <-timeout:
+			t.Fatalf("got %d changes, want %d", merged.Len(), n)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,155 @@
+package changestream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/porcool/ingestion/internal/config"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+)
+
+func TestBatchAdd(t *testing.T) {
+	oid := primitive.NewObjectID()
+	b := newBatch()
+	b.add("expenses", mongodb.StringID("e1"))
+	b.add("expenses", mongodb.ObjectID(oid))
+	b.add("expenses", mongodb.StringID("e1"))
+	b.add("users", mongodb.StringID("e1"))
+	b.add(IngestionDocsCollection, mongodb.StringID("doc1"))
+	b.add(IngestionDocsCollection, mongodb.StringID("doc1"))
+
+	if b.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", b.Len())
+	}
+	if want := []mongodb.DocID{mongodb.StringID("e1"), mongodb.ObjectID(oid)}; !reflect.DeepEqual(b.Documents["expenses"], want) {
+		t.Errorf("Documents[expenses] = %v, want %v", b.Documents["expenses"], want)
+	}
+	if want := []string{"doc1"}; !reflect.DeepEqual(b.IngestionDocs, want) {
+		t.Errorf("IngestionDocs = %v, want %v", b.IngestionDocs, want)
+	}
+	if _, ok := b.Documents[IngestionDocsCollection]; ok {
+		t.Error("ingestion documents must not be listed as synced documents")
+	}
+}
+
+func TestBatchDue(t *testing.T) {
+	cfg := config.TriggersConfig{ChangeStreamFlushInterval: 2 * time.Second, ChangeStreamMaxBatch: 3}
+	started := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		size int
+		now  time.Time
+		want bool
+	}{
+		{"empty batch", 0, started.Add(time.Hour), false},
+		{"partial batch within the interval", 2, started.Add(time.Second), false},
+		{"full batch", 3, started.Add(time.Second), true},
+		{"partial batch past the interval", 1, started.Add(2 * time.Second), true},
+	}
+	for _, tt := range tests {
+		if got := batchDue(cfg, tt.size, started, tt.now); got != tt.want {
+			t.Errorf("%s: batchDue() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// updateEvent returns an update event touching the given fields
+func updateEvent(removed []string, fields ...string) *changeEvent {
+	e := &changeEvent{OperationType: "update"}
+	e.UpdateDescription = &struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	}{UpdatedFields: bson.M{}, RemovedFields: removed}
+	for _, f := range fields {
+		e.UpdateDescription.UpdatedFields[f] = 1
+	}
+	return e
+}
+
+func TestIsOwnWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *changeEvent
+		want  bool
+	}{
+		{"sync marker", updateEvent(nil, "onPremiseRelationalDBSyncDatetime", "onPremiseRelationalDBSyncService"), true},
+		{"sync marker with version", updateEvent(nil, "onPremiseRelationalDBSyncDatetime", "onPremiseRelationalDBSyncContentHash", "onPremiseRelationalDBSyncFirestoreUpdateTime"), true},
+		{"ingestion marker", updateEvent(nil, "ingestedBy", "ingestedAt"), true},
+		{"data change", updateEvent(nil, "amount"), false},
+		{"data change with sync marker", updateEvent(nil, "amount", "onPremiseRelationalDBSyncDatetime"), false},
+		{"removed field", updateEvent([]string{"description"}, "onPremiseRelationalDBSyncDatetime"), false},
+		{"insert", &changeEvent{OperationType: "insert"}, false},
+		{"replace", &changeEvent{OperationType: "replace"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.isOwnWrite(); got != tt.want {
+				t.Errorf("isOwnWrite() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeChangeEvent(t *testing.T) {
+	raw, err := bson.Marshal(bson.M{
+		"operationType": "update",
+		"ns":            bson.M{"db": "porcool", "coll": "expenses"},
+		"documentKey":   bson.M{"_id": "exp-1"},
+		"updateDescription": bson.M{
+			"updatedFields": bson.M{"onPremiseRelationalDBSyncDatetime": "now"},
+			"removedFields": bson.A{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event changeEvent
+	if err := bson.Unmarshal(raw, &event); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	id, ok := mongodb.DocIDFromRaw(event.DocumentKey.ID)
+	if event.NS.Coll != "expenses" || !ok || id != mongodb.StringID("exp-1") || !event.isOwnWrite() {
+		t.Errorf("decoded event = %+v, want an own write to expenses/exp-1", event)
+	}
+}
+
+func TestNewWatcherCollections(t *testing.T) {
+	synced := []string{"users", "expenses"}
+	w := NewWatcher(nil, config.TriggersConfig{}, synced, nil)
+
+	if want := []string{"users", "expenses", IngestionDocsCollection}; !reflect.DeepEqual(w.collections, want) {
+		t.Errorf("collections = %v, want %v", w.collections, want)
+	}
+	if len(synced) != 2 {
+		t.Error("NewWatcher() must not change the given collections")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := pipeline([]string{"users"})
+	if len(p) != 1 || p[0][0].Key != "$match" {
+		t.Fatalf("pipeline() = %v, want one $match stage", p)
+	}
+	match := p[0][0].Value.(bson.M)
+	if ops := match["operationType"].(bson.M)["$in"]; !reflect.DeepEqual(ops, []string{"insert", "update", "replace"}) {
+		t.Errorf("operationType = %v, want insert, update and replace, no deletes", ops)
+	}
+	if colls := match["ns.coll"].(bson.M)["$in"]; !reflect.DeepEqual(colls, []string{"users"}) {
+		t.Errorf("ns.coll = %v, want [users]", colls)
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	w := NewWatcher(nil, config.TriggersConfig{}, nil, nil)
+	w.Stop()
+	if w.Err() != nil {
+		t.Errorf("Err() = %v, want nil", w.Err())
+	}
+}
@@ -12,10 +12,40 @@ import (
 	"github.com/porcool/ingestion/internal/config"
 )
 
+// Message types. Messages without a type are ingestion messages.
+const (
+	MessageTypeIngest     = "ingest"
+	MessageTypeEraseUser  = "erase-user"
+	MessageTypeResyncUser = "resync-user"
+)
+
 // IngestionMessage represents the message structure received from RabbitMQ
 // Message format: {successfullyIngestedFirestoreDocsID: string}
+// Erasure format: {type: "erase-user", userId: string, requestedBy: string}
+// Resync format: {type: "resync-user", userId: string}
 type IngestionMessage struct {
-	SuccessfullyIngestedFirestoreDocsID string `json:"successfullyIngestedFirestoreDocsID"`
+	Type                                string `json:"type,omitempty"`
+	SuccessfullyIngestedFirestoreDocsID string `json:"successfullyIngestedFirestoreDocsID,omitempty"`
+	// UserID is the Firestore user ID of an erase-user or resync-user message
+	UserID      string `json:"userId,omitempty"`
+	RequestedBy string `json:"requestedBy,omitempty"`
+}
+
+// Validate checks that a message carries the fields its type needs
+func (m IngestionMessage) Validate() error {
+	switch m.Type {
+	case "", MessageTypeIngest:
+		if m.SuccessfullyIngestedFirestoreDocsID == "" {
+			return fmt.Errorf("missing successfullyIngestedFirestoreDocsID")
+		}
+	case MessageTypeEraseUser, MessageTypeResyncUser:
+		if m.UserID == "" {
+			return fmt.Errorf("missing userId")
+		}
+	default:
+		return fmt.Errorf("unknown message type %q", m.Type)
+	}
+	return nil
 }
 
 // MessageHandler is a function type for handling ingestion messages
@@ -142,8 +172,8 @@ func (c *Consumer) processMessage(msg amqp.Delivery) {
 		return
 	}
 
-	if ingestionMsg.SuccessfullyIngestedFirestoreDocsID == "" {
-		log.Printf("Invalid message: missing successfullyIngestedFirestoreDocsID")
+	if err := ingestionMsg.Validate(); err != nil {
+		log.Printf("Invalid message: %v", err)
 		msg.Nack(false, false)
 		return
 	}
@@ -162,7 +192,14 @@ func (c *Consumer) processMessage(msg amqp.Delivery) {
 		log.Printf("Error acknowledging message: %v", err)
 	}
 
-	log.Printf("Successfully processed message for document ID: %s", ingestionMsg.SuccessfullyIngestedFirestoreDocsID)
+	switch ingestionMsg.Type {
+	case MessageTypeEraseUser:
+		log.Printf("Successfully processed erasure of user: %s", ingestionMsg.UserID)
+	case MessageTypeResyncUser:
+		log.Printf("Successfully processed resync of user: %s", ingestionMsg.UserID)
+	default:
+		log.Printf("Successfully processed message for document ID: %s", ingestionMsg.SuccessfullyIngestedFirestoreDocsID)
+	}
 }
 
 // Stop stops the consumer gracefully
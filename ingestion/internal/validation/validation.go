@@ -0,0 +1,260 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/porcool/ingestion/internal/blobstore"
+	"github.com/porcool/ingestion/internal/currency"
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/dates"
+	"github.com/porcool/ingestion/internal/logging"
+	"github.com/porcool/ingestion/internal/models"
+)
+
+// Violation describes a validation rule a document failed
+type Violation struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+// String returns a human readable description of the violation
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Field, v.Message, v.Rule)
+}
+
+// Rule checks a single constraint on a document of type T
+type Rule[T any] struct {
+	Name  string
+	Field string
+	// Check returns nil when the document satisfies the rule
+	Check func(doc T) error
+}
+
+// Check runs every rule against a document and returns the violations
+func Check[T any](doc T, rules []Rule[T]) []Violation {
+	var violations []Violation
+	for _, rule := range rules {
+		if err := rule.Check(doc); err != nil {
+			violations = append(violations, Violation{Field: rule.Field, Rule: rule.Name, Message: err.Error()})
+		}
+	}
+	return violations
+}
+
+// Validator holds the validation rules of every ingested collection
+type Validator struct {
+	users                 []Rule[mongodb.UserDocument]
+	expenses              []Rule[mongodb.ExpenseDocument]
+	financialInstitutions []Rule[mongodb.FinancialInstitutionDocument]
+	additionalBalances    []Rule[mongodb.AdditionalBalanceDocument]
+	balanceHistory        []Rule[mongodb.BalanceHistoryDocument]
+	workflows             []Rule[mongodb.ExpenseAutomaticWorkflowDocument]
+	preSavedDescriptions  []Rule[mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument]
+	servicePayments       []Rule[mongodb.ServicePaymentDocument]
+}
+
+// NewValidator creates a new Validator. Date rules use the given normalizer, so they accept
+// exactly what the sync functions can transform. Domain values other than the expense type,
+// which decides how an expense is transformed, are left to the domain registry policy.
+func NewValidator(normalizer *dates.Normalizer) *Validator {
+	return &Validator{
+		users: []Rule[mongodb.UserDocument]{
+			Required("email", func(d mongodb.UserDocument) string { return d.Email }),
+			Email("email", func(d mongodb.UserDocument) string { return d.Email }),
+			Required("name", func(d mongodb.UserDocument) string { return d.Name }),
+			NonNegative("monthlyIncome", func(d mongodb.UserDocument) float64 { return d.MonthlyIncome }),
+		},
+		expenses: []Rule[mongodb.ExpenseDocument]{
+			Required("user", func(d mongodb.ExpenseDocument) string { return d.User }),
+			Required("expenseName", func(d mongodb.ExpenseDocument) string { return d.ExpenseName }),
+			NonNegative("amount", func(d mongodb.ExpenseDocument) float64 { return d.Amount }),
+			NonNegative("alreadyPaidAmount", func(d mongodb.ExpenseDocument) float64 { return d.AlreadyPaidAmount }),
+			Required("type", func(d mongodb.ExpenseDocument) string { return d.Type }),
+			OneOf("type", func(d mongodb.ExpenseDocument) string { return d.Type }, domainNames("expense", "id_type")...),
+			CurrencyCode("currency", func(d mongodb.ExpenseDocument) string { return d.Currency }),
+			Date(normalizer, "spendingDate", true, func(d mongodb.ExpenseDocument) interface{} { return d.SpendingDate }),
+			Date(normalizer, "validity", false, func(d mongodb.ExpenseDocument) interface{} { return d.Validity }),
+		},
+		financialInstitutions: []Rule[mongodb.FinancialInstitutionDocument]{
+			Required("user", func(d mongodb.FinancialInstitutionDocument) string { return d.User }),
+			Required("nome", func(d mongodb.FinancialInstitutionDocument) string { return d.Nome }),
+		},
+		additionalBalances: []Rule[mongodb.AdditionalBalanceDocument]{
+			Required("user", func(d mongodb.AdditionalBalanceDocument) string { return d.User }),
+			CurrencyCode("currency", func(d mongodb.AdditionalBalanceDocument) string { return d.Currency }),
+			Date(normalizer, "spendingDate", true, func(d mongodb.AdditionalBalanceDocument) interface{} { return d.SpendingDate }),
+		},
+		balanceHistory: []Rule[mongodb.BalanceHistoryDocument]{
+			Required("user", func(d mongodb.BalanceHistoryDocument) string { return d.User }),
+			NonNegative("monthlyIncome", func(d mongodb.BalanceHistoryDocument) float64 { return d.MonthlyIncome }),
+			CurrencyCode("currency", func(d mongodb.BalanceHistoryDocument) string { return d.Currency }),
+			Date(normalizer, "spendingDate", true, func(d mongodb.BalanceHistoryDocument) interface{} { return d.SpendingDate }),
+		},
+		workflows: []Rule[mongodb.ExpenseAutomaticWorkflowDocument]{
+			Required("user", func(d mongodb.ExpenseAutomaticWorkflowDocument) string { return d.User }),
+			Date(normalizer, "spendingDate", false, func(d mongodb.ExpenseAutomaticWorkflowDocument) interface{} { return d.SpendingDate }),
+			Base64("base64_image", func(d mongodb.ExpenseAutomaticWorkflowDocument) string { return d.Base64Image }),
+		},
+		preSavedDescriptions: []Rule[mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument]{
+			Required("user", func(d mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument) string { return d.User }),
+			Required("description", func(d mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument) string { return d.Description }),
+		},
+		servicePayments: []Rule[mongodb.ServicePaymentDocument]{
+			Required("user", func(d mongodb.ServicePaymentDocument) string { return d.User }),
+			Date(normalizer, "paymentDate", true, func(d mongodb.ServicePaymentDocument) interface{} { return d.PaymentDate }),
+			NonNegative("amount", func(d mongodb.ServicePaymentDocument) float64 {
+				if d.Amount == nil {
+					return 0
+				}
+				return *d.Amount
+			}),
+			CurrencyCode("currency", func(d mongodb.ServicePaymentDocument) string { return d.Currency }),
+		},
+	}
+}
+
+// ValidateUser validates a users document
+func (v *Validator) ValidateUser(doc mongodb.UserDocument) []Violation {
+	return Check(doc, v.users)
+}
+
+// ValidateExpense validates an expenses document
+func (v *Validator) ValidateExpense(doc mongodb.ExpenseDocument) []Violation {
+	return Check(doc, v.expenses)
+}
+
+// ValidateFinancialInstitution validates a banks document
+func (v *Validator) ValidateFinancialInstitution(doc mongodb.FinancialInstitutionDocument) []Violation {
+	return Check(doc, v.financialInstitutions)
+}
+
+// ValidateAdditionalBalance validates an additional_balances document
+func (v *Validator) ValidateAdditionalBalance(doc mongodb.AdditionalBalanceDocument) []Violation {
+	return Check(doc, v.additionalBalances)
+}
+
+// ValidateBalanceHistory validates a balance_history document
+func (v *Validator) ValidateBalanceHistory(doc mongodb.BalanceHistoryDocument) []Violation {
+	return Check(doc, v.balanceHistory)
+}
+
+// ValidateExpenseAutomaticWorkflow validates an expense_automatic_workflow document
+func (v *Validator) ValidateExpenseAutomaticWorkflow(doc mongodb.ExpenseAutomaticWorkflowDocument) []Violation {
+	return Check(doc, v.workflows)
+}
+
+// ValidateExpenseAutomaticWorkflowPreSavedDescription validates an
+// expense_automatic_workflow_pre_saved_description document
+func (v *Validator) ValidateExpenseAutomaticWorkflowPreSavedDescription(doc mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument) []Violation {
+	return Check(doc, v.preSavedDescriptions)
+}
+
+// ValidateServicePayment validates a payments document
+func (v *Validator) ValidateServicePayment(doc mongodb.ServicePaymentDocument) []Violation {
+	return Check(doc, v.servicePayments)
+}
+
+// Required fails when a string field is empty
+func Required[T any](field string, get func(T) string) Rule[T] {
+	return Rule[T]{Name: "required", Field: field, Check: func(doc T) error {
+		if strings.TrimSpace(get(doc)) == "" {
+			return errors.New("must not be empty")
+		}
+		return nil
+	}}
+}
+
+// NonNegative fails when a numeric field is below zero
+func NonNegative[T any](field string, get func(T) float64) Rule[T] {
+	return Rule[T]{Name: "non_negative", Field: field, Check: func(doc T) error {
+		if value := get(doc); value < 0 {
+			return fmt.Errorf("must not be negative, got %v", value)
+		}
+		return nil
+	}}
+}
+
+// OneOf fails when a non-empty string field is not one of the allowed values
+func OneOf[T any](field string, get func(T) string, allowed ...string) Rule[T] {
+	return Rule[T]{Name: "one_of", Field: field, Check: func(doc T) error {
+		value := get(doc)
+		if value == "" {
+			return nil
+		}
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown value %q, want one of %s", value, strings.Join(allowed, ", "))
+	}}
+}
+
+// Email fails when a non-empty string field is not shaped like an email address
+func Email[T any](field string, get func(T) string) Rule[T] {
+	return Rule[T]{Name: "email", Field: field, Check: func(doc T) error {
+		value := strings.TrimSpace(get(doc))
+		if value == "" {
+			return nil
+		}
+		local, domain, found := strings.Cut(value, "@")
+		if !found || local == "" || domain == "" || strings.ContainsAny(value, " \t") || strings.Contains(domain, "@") {
+			// Violations are stored in the quarantine and logged, so the address is masked
+			return fmt.Errorf("invalid email address %q", logging.MaskEmail(value))
+		}
+		return nil
+	}}
+}
+
+// CurrencyCode fails when a non-empty string field is not a three-letter ISO 4217 code
+func CurrencyCode[T any](field string, get func(T) string) Rule[T] {
+	return Rule[T]{Name: "currency_code", Field: field, Check: func(doc T) error {
+		code := currency.NormalizeCode(get(doc))
+		if code == "" {
+			return nil
+		}
+		if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return fmt.Errorf("invalid currency code %q", get(doc))
+		}
+		return nil
+	}}
+}
+
+// Base64 fails when a non-empty string field cannot be decoded as base64 content or a base64 data URI
+func Base64[T any](field string, get func(T) string) Rule[T] {
+	return Rule[T]{Name: "base64", Field: field, Check: func(doc T) error {
+		if strings.TrimSpace(get(doc)) == "" {
+			return nil
+		}
+		_, _, err := blobstore.DecodeBase64(get(doc))
+		return err
+	}}
+}
+
+// Date fails when a field cannot be normalized into a date. Empty values only fail when required.
+func Date[T any](normalizer *dates.Normalizer, field string, required bool, get func(T) interface{}) Rule[T] {
+	return Rule[T]{Name: "date", Field: field, Check: func(doc T) error {
+		value := get(doc)
+		if dates.IsEmpty(value) {
+			if required {
+				return errors.New("must not be empty")
+			}
+			return nil
+		}
+		_, err := normalizer.Time(value)
+		return err
+	}}
+}
+
+// domainNames returns the seeded domain values for a source and type
+func domainNames(source, domainType string) []string {
+	for _, seed := range models.GetDomainSeeds() {
+		if seed.Source == source && seed.Type == domainType {
+			return seed.Names
+		}
+	}
+	return nil
+}
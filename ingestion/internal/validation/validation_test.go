@@ -0,0 +1,185 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/dates"
+)
+
+func newTestValidator() *Validator {
+	return NewValidator(dates.NewNormalizer(time.UTC))
+}
+
+// hasViolation reports whether a violation exists for the field and rule
+func hasViolation(violations []Violation, field, rule string) bool {
+	for _, v := range violations {
+		if v.Field == field && v.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateUser(t *testing.T) {
+	v := newTestValidator()
+
+	valid := mongodb.UserDocument{ID: "u1", Email: "john@example.com", Name: "John", MonthlyIncome: 5000}
+	if violations := v.ValidateUser(valid); len(violations) != 0 {
+		t.Errorf("ValidateUser(valid) = %v, want no violations", violations)
+	}
+
+	violations := v.ValidateUser(mongodb.UserDocument{ID: "u2", MonthlyIncome: -1})
+	if !hasViolation(violations, "email", "required") {
+		t.Errorf("ValidateUser() missing email required violation: %v", violations)
+	}
+	if !hasViolation(violations, "name", "required") {
+		t.Errorf("ValidateUser() missing name required violation: %v", violations)
+	}
+	if !hasViolation(violations, "monthlyIncome", "non_negative") {
+		t.Errorf("ValidateUser() missing monthlyIncome violation: %v", violations)
+	}
+
+	violations = v.ValidateUser(mongodb.UserDocument{ID: "u3", Email: "not-an-email", Name: "John"})
+	if !hasViolation(violations, "email", "email") {
+		t.Errorf("ValidateUser() missing email format violation: %v", violations)
+	}
+
+	violations = v.ValidateUser(mongodb.UserDocument{ID: "u4", Email: "john.doe@mail@example.com", Name: "John"})
+	for _, violation := range violations {
+		if strings.Contains(violation.Message, "john.doe") {
+			t.Errorf("ValidateUser() violation leaks the email address: %q", violation.Message)
+		}
+	}
+	if !hasViolation(violations, "email", "email") {
+		t.Errorf("ValidateUser() missing email format violation: %v", violations)
+	}
+}
+
+func TestValidateExpense(t *testing.T) {
+	v := newTestValidator()
+
+	valid := mongodb.ExpenseDocument{
+		ID:           "e1",
+		User:         "u1",
+		ExpenseName:  "Rent",
+		Amount:       100,
+		Type:         "invoice",
+		Status:       "pending",
+		Currency:     "usd",
+		SpendingDate: "2024-01",
+		Validity:     map[string]interface{}{"_seconds": int64(1772334000)},
+	}
+	if violations := v.ValidateExpense(valid); len(violations) != 0 {
+		t.Errorf("ValidateExpense(valid) = %v, want no violations", violations)
+	}
+
+	invalid := mongodb.ExpenseDocument{
+		ID:           "e2",
+		User:         "u1",
+		ExpenseName:  "Rent",
+		Amount:       -10,
+		Type:         "subscription",
+		Status:       "overdue",
+		Currency:     "dollars",
+		SpendingDate: "2024",
+		Validity:     "31/12/2024",
+	}
+	violations := v.ValidateExpense(invalid)
+
+	expected := []struct{ field, rule string }{
+		{"amount", "non_negative"},
+		{"type", "one_of"},
+		{"currency", "currency_code"},
+		{"spendingDate", "date"},
+		{"validity", "date"},
+	}
+	for _, e := range expected {
+		if !hasViolation(violations, e.field, e.rule) {
+			t.Errorf("ValidateExpense() missing %s/%s violation: %v", e.field, e.rule, violations)
+		}
+	}
+}
+
+func TestValidateServicePayment(t *testing.T) {
+	v := newTestValidator()
+
+	if violations := v.ValidateServicePayment(mongodb.ServicePaymentDocument{ID: "p1", User: "u1", PaymentDate: "2024-01-15"}); len(violations) != 0 {
+		t.Errorf("ValidateServicePayment(valid) = %v, want no violations", violations)
+	}
+
+	violations := v.ValidateServicePayment(mongodb.ServicePaymentDocument{ID: "p2", User: "u1"})
+	if !hasViolation(violations, "paymentDate", "date") {
+		t.Errorf("ValidateServicePayment() missing paymentDate violation for empty date: %v", violations)
+	}
+
+	violations = v.ValidateServicePayment(mongodb.ServicePaymentDocument{ID: "p3", User: "u1", PaymentDate: "yesterday"})
+	if !hasViolation(violations, "paymentDate", "date") {
+		t.Errorf("ValidateServicePayment() missing paymentDate violation for unparseable date: %v", violations)
+	}
+
+	amount := -10.0
+	violations = v.ValidateServicePayment(mongodb.ServicePaymentDocument{ID: "p4", User: "u1", PaymentDate: "2024-01-15", Amount: &amount, Currency: "dollars"})
+	if !hasViolation(violations, "amount", "non_negative") {
+		t.Errorf("ValidateServicePayment() missing amount violation: %v", violations)
+	}
+	if !hasViolation(violations, "currency", "currency_code") {
+		t.Errorf("ValidateServicePayment() missing currency violation: %v", violations)
+	}
+}
+
+func TestValidateOtherCollections(t *testing.T) {
+	v := newTestValidator()
+
+	if violations := v.ValidateFinancialInstitution(mongodb.FinancialInstitutionDocument{ID: "b1"}); !hasViolation(violations, "nome", "required") {
+		t.Errorf("ValidateFinancialInstitution() missing nome violation: %v", violations)
+	}
+	if violations := v.ValidateAdditionalBalance(mongodb.AdditionalBalanceDocument{ID: "a1", User: "u1", Balance: -50, SpendingDate: "2024-01"}); len(violations) != 0 {
+		t.Errorf("ValidateAdditionalBalance() = %v, negative balances are allowed", violations)
+	}
+	if violations := v.ValidateBalanceHistory(mongodb.BalanceHistoryDocument{ID: "h1", User: "u1"}); !hasViolation(violations, "spendingDate", "date") {
+		t.Errorf("ValidateBalanceHistory() missing spendingDate violation: %v", violations)
+	}
+	if violations := v.ValidateExpenseAutomaticWorkflow(mongodb.ExpenseAutomaticWorkflowDocument{ID: "w1", User: "u1", SpendingDate: "2024"}); !hasViolation(violations, "spendingDate", "date") {
+		t.Errorf("ValidateExpenseAutomaticWorkflow() missing spendingDate violation: %v", violations)
+	}
+	if violations := v.ValidateExpenseAutomaticWorkflow(mongodb.ExpenseAutomaticWorkflowDocument{ID: "w3", User: "u1", Base64Image: "not an image!"}); !hasViolation(violations, "base64_image", "base64") {
+		t.Errorf("ValidateExpenseAutomaticWorkflow() missing base64_image violation: %v", violations)
+	}
+	if violations := v.ValidateExpenseAutomaticWorkflow(mongodb.ExpenseAutomaticWorkflowDocument{ID: "w4", User: "u1", Base64Image: "data:image/png;base64,aGVsbG8="}); len(violations) != 0 {
+		t.Errorf("ValidateExpenseAutomaticWorkflow(data URI) = %v, want no violations", violations)
+	}
+	// Unknown statuses are handled by the domain registry policy, not by validation
+	if violations := v.ValidateExpenseAutomaticWorkflow(mongodb.ExpenseAutomaticWorkflowDocument{ID: "w2", User: "u1", SyncStatus: "done"}); len(violations) != 0 {
+		t.Errorf("ValidateExpenseAutomaticWorkflow() = %v, want no violations", violations)
+	}
+	if violations := v.ValidateExpenseAutomaticWorkflowPreSavedDescription(mongodb.ExpenseAutomaticWorkflowPreSavedDescriptionDocument{ID: "d1", User: "u1"}); !hasViolation(violations, "description", "required") {
+		t.Errorf("ValidateExpenseAutomaticWorkflowPreSavedDescription() missing description violation: %v", violations)
+	}
+}
+
+func TestViolationString(t *testing.T) {
+	v := Violation{Field: "amount", Rule: "non_negative", Message: "must not be negative, got -1"}
+	if s := v.String(); s != "amount: must not be negative, got -1 (non_negative)" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestCheckCustomRule(t *testing.T) {
+	rules := []Rule[string]{
+		Required("value", func(s string) string { return s }),
+		OneOf("value", func(s string) string { return s }, "a", "b"),
+	}
+
+	if violations := Check("a", rules); len(violations) != 0 {
+		t.Errorf("Check(a) = %v, want no violations", violations)
+	}
+	if violations := Check("", rules); len(violations) != 1 || violations[0].Rule != "required" {
+		t.Errorf("Check(\"\") = %v, want only a required violation", violations)
+	}
+	if violations := Check("c", rules); len(violations) != 1 || violations[0].Rule != "one_of" {
+		t.Errorf("Check(c) = %v, want only a one_of violation", violations)
+	}
+}
@@ -10,14 +10,23 @@ import (
 	"github.com/porcool/ingestion/internal/config"
 	"github.com/porcool/ingestion/internal/database/mariadb"
 	"github.com/porcool/ingestion/internal/database/mongodb"
+	"github.com/porcool/ingestion/internal/fieldcrypt"
 	"github.com/porcool/ingestion/internal/ingestion"
 	"github.com/porcool/ingestion/internal/logging"
+	"github.com/porcool/ingestion/internal/metrics"
+	"github.com/porcool/ingestion/internal/models"
+	"github.com/porcool/ingestion/internal/queue/changestream"
 	"github.com/porcool/ingestion/internal/queue/rabbitmq"
 )
 
 const serviceName = "porcool-ingestion-non-relational-database-to-relational-database"
 
 func main() {
+	// Run a one-off command instead of the consumer when one is given
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	log.Println("Starting PorCool Ingestion Service (porcool-ingestion-nosql-to-sql-database)...")
 
 	// Load configuration
@@ -46,14 +55,38 @@ func main() {
 
 	log.Println("Connected to MariaDB successfully")
 
-	// Run migrations
-	if err := mariaDB.RunMigrations(); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	// Encrypt PII columns when FIELD_ENCRYPTION_ENABLED is set
+	cipher, err := fieldcrypt.New(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to initialize field encryption: %v", err)
+	}
+	mariaDB.SetCipher(cipher)
+	if cipher != nil {
+		log.Printf("Field encryption enabled with key %s", cipher.ActiveKeyID())
 	}
-	log.Println("Database migrations completed successfully")
 
-	// Seed domains
-	if err := mariaDB.SeedDomains(); err != nil {
+	// Run migrations, or only check them when they are applied by a deploy step
+	if cfg.MariaDB.MigrateOnStart {
+		if err := mariaDB.RunMigrations(); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+		log.Println("Database migrations completed successfully")
+	} else {
+		if err := mariaDB.CheckMigrations(context.Background()); err != nil {
+			log.Fatalf("Database schema is not up to date (MARIADB_MIGRATE_ON_START=false), run 'ingestion migrate up': %v", err)
+		}
+		log.Println("Database schema is up to date")
+	}
+
+	// Seed domains, including the extra ones from DOMAIN_SEED_FILE
+	var extraSeeds []models.DomainSeed
+	if cfg.Domains.SeedFile != "" {
+		extraSeeds, err = models.LoadDomainSeedsFile(cfg.Domains.SeedFile)
+		if err != nil {
+			log.Fatalf("Failed to load domain seed file: %v", err)
+		}
+	}
+	if err := mariaDB.SeedDomains(extraSeeds...); err != nil {
 		log.Fatalf("Failed to seed domains: %v", err)
 	}
 	log.Println("Domain seeding completed successfully")
@@ -67,11 +100,62 @@ func main() {
 
 	log.Println("Connected to MongoDB successfully")
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if cfg.MongoDB.EnsureIndexes {
+		ensureIndexes(ctx, mongoDB)
+	} else {
+		log.Println("Skipping MongoDB index management (MONGODB_ENSURE_INDEXES=false)")
+	}
+
+	if cfg.Metrics.Addr != "" {
+		go func() {
+			if err := metrics.Serve(cfg.Metrics.Addr); err != nil {
+				log.Printf("Error serving metrics on %s: %v", cfg.Metrics.Addr, err)
+			}
+		}()
+		log.Printf("Serving metrics on %s/debug/vars", cfg.Metrics.Addr)
+	}
+
+	if cfg.Erasure.ReceiptSigningKey == "" {
+		log.Println("Warning: ERASURE_RECEIPT_SIGNING_KEY is not set, erase-user messages will fail")
+	}
+
 	// Initialize ingestion service
-	svc := ingestion.NewService(mariaDB, mongoDB, cfg)
+	svc, err := ingestion.NewService(mariaDB, mongoDB, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create ingestion service: %v", err)
+	}
+	if err := svc.Start(ctx); err != nil {
+		log.Fatalf("Failed to start ingestion service: %v", err)
+	}
+
+	if cfg.Triggers.Mode == config.TriggerChangeStream {
+		runChangeStream(ctx, cfg, mongoDB, svc)
+		return
+	}
 
 	// Create message handler that delegates to ingestion service
 	messageHandler := func(ctx context.Context, msg rabbitmq.IngestionMessage) error {
+		switch msg.Type {
+		case rabbitmq.MessageTypeEraseUser:
+			requestedBy := msg.RequestedBy
+			if requestedBy == "" {
+				requestedBy = "queue"
+			}
+			_, err := svc.EraseUser(ctx, msg.UserID, requestedBy)
+			return err
+		case rabbitmq.MessageTypeResyncUser:
+			report, err := svc.ResyncUser(ctx, msg.UserID, false)
+			if report != nil {
+				for _, c := range report.Collections {
+					log.Printf("Resync of user %s, %s: %d documents, %d created, %d updated, %d unchanged, %d missing, %d orphaned",
+						msg.UserID, c.Collection, c.Documents, c.Created, c.Updated, c.Unchanged, c.Missing, len(c.Orphans))
+				}
+			}
+			return err
+		}
 		return svc.ProcessIngestionMessage(ctx, msg.SuccessfullyIngestedFirestoreDocsID)
 	}
 
@@ -100,3 +184,48 @@ func main() {
 	consumer.Stop()
 	log.Println("Ingestion service stopped")
 }
+
+// runChangeStream syncs the changes MongoDB reports on its change stream instead of
+// consuming RabbitMQ messages, until a shutdown signal or a watcher failure
+func runChangeStream(ctx context.Context, cfg *config.Config, mongoDB *mongodb.Connection, svc *ingestion.Service) {
+	handler := func(ctx context.Context, batch *changestream.Batch) error {
+		return svc.SyncChanges(ctx, batch.IngestionDocs, batch.Documents)
+	}
+
+	watcher := changestream.NewWatcher(mongoDB, cfg.Triggers, ingestion.SyncedCollections(), handler)
+	if err := watcher.Start(ctx); err != nil {
+		log.Fatalf("Failed to start change stream watcher: %v", err)
+	}
+
+	log.Println("Ingestion service started, watching MongoDB change streams")
+
+	// Wait for shutdown signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-quit:
+	case <-watcher.Done():
+		log.Fatalf("Change stream watcher failed: %v", watcher.Err())
+	}
+
+	log.Println("Shutting down ingestion service...")
+	watcher.Stop()
+	log.Println("Ingestion service stopped")
+}
+
+// ensureIndexes creates the MongoDB indexes the service relies on. An index that cannot be
+// created is reported and the service starts anyway, since queries still work without it.
+func ensureIndexes(ctx context.Context, mongoDB *mongodb.Connection) {
+	created, failed := 0, 0
+	for _, result := range mongoDB.EnsureIndexes(ctx) {
+		switch {
+		case result.Err != nil:
+			failed++
+			log.Printf("Warning: Could not ensure index %s on %s (%s): %v", result.Name, result.Collection, result.Purpose, result.Err)
+		case result.Created:
+			created++
+			log.Printf("Created index %s on %s (%s)", result.Name, result.Collection, result.Purpose)
+		}
+	}
+	log.Printf("MongoDB indexes ensured: %d created, %d failed", created, failed)
+}